@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tala_base/db"
+	"tala_base/types"
+	"tala_base/utils"
+	"tala_base/utils/middleware"
+)
+
+// requireAdmin guards admin endpoints with the ADMIN_TOKEN bearer token.
+// Admin endpoints are disabled entirely when no token or database is configured.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" || s.db == nil {
+			utils.RespondError(w, r, http.StatusNotFound, "Admin API is not enabled")
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !utils.ConstantTimeEqual(token, s.adminToken) {
+			utils.RespondError(w, r, http.StatusUnauthorized, "Invalid admin token")
+			return
+		}
+		// The admin token is shared, so X-Actor names who is using it
+		actor := "admin"
+		if name := r.Header.Get(utils.ActorHeader); name != "" {
+			actor += ":" + name
+		}
+		next(w, withActor(r, actor))
+	}
+}
+
+// apiMiddleware is the stack every API route runs behind: the standard stack,
+// then the global and per-address rate limits before the caller's key is
+// looked up, so a flood of missing or invalid keys never reaches the
+// database, then the per-key limit of the key that authenticated it
+func (s *Server) apiMiddleware(route string, limiter *utils.RateLimiter) middleware.Middleware {
+	return middleware.Chain(middleware.Trace(route), middleware.Standard(route, s.metrics), limiter.Middleware, s.requireAPIKey, limiter.KeyMiddleware)
+}
+
+// requireAPIKey rejects requests without a valid X-API-Key when API key auth is enabled.
+// Authenticated requests are scoped to the key's tenant, overriding any X-Tenant-ID sent by the caller,
+// and audited as the key; without key auth, changes are audited as the caller's X-Actor.
+func (s *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.requireKeys {
+			next(w, withActor(r, r.Header.Get(utils.ActorHeader)))
+			return
+		}
+		raw := r.Header.Get(utils.APIKeyHeader)
+		if raw == "" {
+			utils.RespondError(w, r, http.StatusUnauthorized, "Missing API key")
+			return
+		}
+		key, err := db.AuthenticateAPIKey(r.Context(), s.db, raw)
+		if err != nil {
+			if errors.Is(err, db.ErrInvalidAPIKey) {
+				utils.RespondError(w, r, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+			utils.RespondError(w, r, http.StatusInternalServerError, "Failed to verify API key")
+			return
+		}
+		r.Header.Set(utils.TenantHeader, key.TenantID)
+		ctx := context.WithValue(r.Context(), apiKeyIDKey{}, key.ID)
+		r = r.WithContext(utils.WithRateLimitKey(ctx, strconv.FormatInt(key.ID, 10)))
+		next(w, withActor(r, "api_key:"+key.Prefix))
+	}
+}
+
+type apiKeyIDKey struct{}
+
+// apiKeyID returns the ID of the API key that authenticated r, or 0 without key auth
+func apiKeyID(r *http.Request) int64 {
+	id, _ := r.Context().Value(apiKeyIDKey{}).(int64)
+	return id
+}
+
+// withActor attributes the changes a request makes to actor in the audit log
+func withActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(db.WithAuditInfo(r.Context(), db.AuditInfo{Actor: actor}))
+}
+
+// adminTenant validates the tenant an admin request targets, writing a 400 if it is malformed
+func adminTenant(w http.ResponseWriter, r *http.Request, tenant string) bool {
+	if tenant != "" && !db.ValidTenantID(tenant) {
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid tenant ID")
+		return false
+	}
+	return true
+}
+
+// handleAPIKeys lists (GET) or issues (POST) API keys; both act on the tenant
+// named by the tenant_id query parameter or body field, or the default tenant
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if !adminTenant(w, r, query.Get("tenant_id")) {
+			return
+		}
+		ctx := db.WithTenant(r.Context(), query.Get("tenant_id"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		keys, total, err := db.ListAPIKeys(ctx, s.db, db.ListOptions{Limit: limit, Offset: offset})
+		if err != nil {
+			utils.RespondError(w, r, http.StatusInternalServerError, "Failed to list API keys")
+			return
+		}
+		utils.RespondSuccess(w, r, http.StatusOK, types.ListAPIKeysOutput{APIKeys: keys, Total: total})
+
+	case http.MethodPost:
+		var input types.CreateAPIKeyInput
+		if err := utils.DecodeJSONBody(w, r, &input); err != nil {
+			utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if !adminTenant(w, r, input.TenantID) {
+			return
+		}
+		key, secret, err := db.CreateAPIKey(db.WithTenant(r.Context(), input.TenantID), s.db, input)
+		if err != nil {
+			if errors.Is(err, db.ErrInvalidArgument) {
+				utils.RespondError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			utils.RespondError(w, r, http.StatusInternalServerError, "Failed to create API key")
+			return
+		}
+		utils.RespondSuccess(w, r, http.StatusCreated, types.CreateAPIKeyOutput{APIKey: *key, Key: secret})
+
+	default:
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleAPIKey revokes a single API key: DELETE /admin/api-keys/<id>?tenant_id=<tenant>
+func (s *Server) handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/admin/api-keys/"), 10, 64)
+	if err != nil {
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	tenant := r.URL.Query().Get("tenant_id")
+	if !adminTenant(w, r, tenant) {
+		return
+	}
+	key, err := db.RevokeAPIKey(db.WithTenant(r.Context(), tenant), s.db, id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			utils.RespondError(w, r, http.StatusNotFound, "API key not found")
+			return
+		}
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	utils.RespondSuccess(w, r, http.StatusOK, map[string]interface{}{"api_key": key})
+}
+
+// handleAdminExecution lets an operator unblock a durable execution stuck on
+// a step: POST /admin/executions/<id>/skip completes the step with the body's
+// output, and POST /admin/executions/<id>/fail fails it so its error handler
+// runs. Both act on the tenant named by the tenant_id query parameter.
+func (s *Server) handleAdminExecution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/executions/"), "/")
+	if id == "" || (action != "skip" && action != "fail") {
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid execution path")
+		return
+	}
+	tenant := r.URL.Query().Get("tenant_id")
+	if !adminTenant(w, r, tenant) {
+		return
+	}
+
+	var input types.StepOverrideInput
+	if err := utils.DecodeJSONBody(w, r, &input); err != nil && !errors.Is(err, io.EOF) {
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	override := s.jobs.SkipStep
+	if action == "fail" {
+		override = s.jobs.FailStep
+	}
+	exec, err := override(db.WithTenant(r.Context(), tenant), id, input)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		utils.RespondError(w, r, http.StatusNotFound, "Execution not found or not waiting on a step")
+	case errors.Is(err, db.ErrConflict):
+		utils.RespondError(w, r, http.StatusConflict, err.Error())
+	case err != nil:
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to override step")
+	default:
+		utils.RespondSuccess(w, r, http.StatusOK, exec)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tala_base/utils"
+	"tala_base/utils/middleware"
+)
+
+func TestAPIMiddlewareLimitsUnauthenticatedFloods(t *testing.T) {
+	server := &Server{metrics: middleware.NewMetrics(), requireKeys: true}
+	limiter := utils.NewRateLimiter(utils.RateLimitConfig{AddrRate: 1, AddrBurst: 3, KeyRate: 100})
+	handler := middleware.With(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("unauthenticated request reached the handler")
+	}, server.apiMiddleware("test", limiter))
+
+	send := func(addr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/workflow/test", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	// Requests without a key are turned away by authentication until the
+	// address runs out of tokens, then by the limit before any key lookup
+	for i := 0; i < 3; i++ {
+		if code := send("192.0.2.1:1234"); code != http.StatusUnauthorized {
+			t.Fatalf("request %d: got %d, want 401", i, code)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if code := send("192.0.2.1:1234"); code != http.StatusTooManyRequests {
+			t.Fatalf("flood request %d: got %d, want 429", i, code)
+		}
+	}
+
+	// Another address keeps its own bucket
+	if code := send("192.0.2.2:1234"); code != http.StatusUnauthorized {
+		t.Fatalf("other address: got %d, want 401", code)
+	}
+}
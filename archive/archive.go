@@ -0,0 +1,120 @@
+// Package archive exports execution history as CSV or JSON Lines, for
+// analytics and compliance archiving
+package archive
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"tala_base/db"
+	"tala_base/types"
+)
+
+// Format is the file format executions are exported in
+type Format string
+
+const (
+	FormatCSV   Format = "csv"
+	FormatJSONL Format = "jsonl"
+)
+
+// Options selects the executions to export. Zero fields do not filter.
+type Options struct {
+	Workflow string
+	// After and Before bound the executions' creation time
+	After  *time.Time
+	Before *time.Time
+	Format Format
+}
+
+// csvHeader names the columns of a CSV export. input, output, error and
+// labels hold JSON.
+var csvHeader = []string{
+	"id", "tenant_id", "workflow", "status", "error_code", "attempt",
+	"created_at", "scheduled_for", "started_at", "finished_at", "updated_at",
+	"input", "output", "error", "labels",
+}
+
+// Export writes the context tenant's executions matching opts to w, oldest
+// first, and returns how many it wrote. Executions created while it runs are
+// left out unless opts.Before is later.
+func Export(ctx context.Context, conn db.DBTX, w io.Writer, opts Options) (int, error) {
+	var write func(*types.Execution) error
+	var flush func() error
+	switch opts.Format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return 0, fmt.Errorf("failed to write export: %w", err)
+		}
+		write = func(exec *types.Execution) error { return cw.Write(csvRecord(exec)) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		write = func(exec *types.Execution) error { return enc.Encode(exec) }
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("unknown export format %q (expected csv or jsonl)", opts.Format)
+	}
+
+	before := opts.Before
+	if before == nil {
+		now := time.Now()
+		before = &now
+	}
+	page := types.PageRequest{Limit: db.MaxListLimit}
+	count := 0
+	for {
+		executions, err := db.ListExecutions(ctx, conn, types.ListExecutionsInput{
+			PageRequest:   page,
+			OrderBy:       "created_at",
+			Workflow:      opts.Workflow,
+			CreatedAfter:  opts.After,
+			CreatedBefore: before,
+		})
+		if err != nil {
+			return count, err
+		}
+		for _, exec := range executions.Items {
+			if err := write(exec); err != nil {
+				return count, fmt.Errorf("failed to write export: %w", err)
+			}
+			count++
+		}
+		if executions.Page.NextCursor == "" {
+			break
+		}
+		page.Cursor = executions.Page.NextCursor
+	}
+	if err := flush(); err != nil {
+		return count, fmt.Errorf("failed to write export: %w", err)
+	}
+	return count, nil
+}
+
+// csvRecord formats an execution as a row under csvHeader
+func csvRecord(exec *types.Execution) []string {
+	labels, _ := json.Marshal(exec.Labels)
+	return []string{
+		exec.ID, exec.TenantID, exec.Workflow, string(exec.Status), string(exec.ErrorCode), strconv.Itoa(exec.Attempt),
+		formatTime(&exec.CreatedAt), formatTime(exec.ScheduledFor), formatTime(exec.StartedAt), formatTime(exec.FinishedAt),
+		formatTime(&exec.UpdatedAt),
+		string(exec.Input), string(exec.Output), string(exec.Error), string(labels),
+	}
+}
+
+// formatTime renders a time as RFC 3339 in UTC, or "" when it is unset
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
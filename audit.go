@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tala_base/db"
+	"tala_base/types"
+	"tala_base/utils"
+)
+
+// handleAudit lists the request tenant's audit log of management actions,
+// newest first, filtered by the entity, entity_id, action, actor, since and
+// until query parameters and paged by cursor and limit
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		utils.RespondError(w, r, http.StatusNotFound, "Audit log is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	opts := types.ListAuditInput{
+		PageRequest: types.PageRequest{Cursor: query.Get("cursor"), Limit: limit},
+		Entity:      types.AuditEntity(query.Get("entity")),
+		EntityID:    query.Get("entity_id"),
+		Action:      types.AuditAction(query.Get("action")),
+		Actor:       query.Get("actor"),
+	}
+	for param, bound := range map[string]**time.Time{"since": &opts.CreatedAfter, "until": &opts.CreatedBefore} {
+		v := query.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			utils.RespondError(w, r, http.StatusBadRequest, param+" must be an RFC 3339 timestamp")
+			return
+		}
+		*bound = &t
+	}
+
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+	entries, err := db.ListAudit(ctx, s.db, opts)
+	if errors.Is(err, db.ErrInvalidArgument) || errors.Is(err, types.ErrInvalidCursor) {
+		utils.RespondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to list audit log")
+		return
+	}
+	utils.RespondSuccess(w, r, http.StatusOK, entries)
+}
@@ -0,0 +1,158 @@
+// Package auth hashes passwords and issues the access and refresh tokens
+// returned by the auth lambdas
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"tala_base/types"
+	"tala_base/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidToken is returned when an access token is malformed, expired or wrongly signed
+var ErrInvalidToken = errors.New("invalid token")
+
+// Config holds the token signing settings
+type Config struct {
+	// Secret signs access tokens with HS256; it must be at least 32 bytes
+	Secret []byte
+	// Issuer is written to and required in the iss claim
+	Issuer string
+	// AccessTTL and RefreshTTL are the token lifetimes
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// ConfigFromEnv builds a Config from JWT_SECRET, which may be a secret://
+// reference, JWT_ISSUER, JWT_ACCESS_TTL and REFRESH_TOKEN_TTL
+func ConfigFromEnv() (Config, error) {
+	secret, err := utils.SecretEnv("JWT_SECRET")
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{
+		Secret:     []byte(secret),
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 30 * 24 * time.Hour,
+	}
+	if len(cfg.Secret) < 32 {
+		return Config{}, fmt.Errorf("JWT_SECRET must be at least 32 bytes")
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "tala"
+	}
+	if v, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TTL")); err == nil {
+		cfg.AccessTTL = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL")); err == nil {
+		cfg.RefreshTTL = v
+	}
+	return cfg, nil
+}
+
+// HashPassword hashes a password with bcrypt at the default cost
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// dummyHash is compared against when a login names no known user, so that
+// unknown emails take as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("tala-dummy-password"), bcrypt.DefaultCost)
+
+// CheckPassword reports whether password matches hash. An empty hash never matches.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Claims are the claims carried by an access token
+type Claims struct {
+	TenantID string `json:"tid"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the subject as a user ID
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// IssueAccessToken signs an access token for a user of a tenant and returns it with its expiry
+func IssueAccessToken(cfg Config, userID int, tenantID string) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(cfg.AccessTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		TenantID: tenantID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    cfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+	signed, err := token.SignedString(cfg.Secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	return signed, expires, nil
+}
+
+// ParseAccessToken verifies an access token and returns its claims
+func ParseAccessToken(cfg Config, raw string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(*jwt.Token) (interface{}, error) {
+		return cfg.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(cfg.Issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
+
+// NewRefreshToken returns a random refresh token and the hash to store for it
+func NewRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the stored form of a refresh token
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Tokens issues an access token for user and pairs it with refreshToken
+func Tokens(cfg Config, user *types.User, refreshToken string) (types.AuthTokens, error) {
+	access, expires, err := IssueAccessToken(cfg, user.ID, user.TenantID)
+	if err != nil {
+		return types.AuthTokens{}, err
+	}
+	return types.AuthTokens{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expires).Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tala_base/db"
+	"tala_base/logging"
+	"tala_base/utils"
+)
+
+// Saturation signals new workflow submissions are refused on
+const (
+	signalInFlight = "in_flight"
+	signalQueue    = "queue"
+	signalDBPool   = "db_pool"
+)
+
+// queueSampleInterval is how long a count of the durable queue is reused
+// before submissions count it again
+const queueSampleInterval = time.Second
+
+// BackpressureConfig sets when new workflow submissions are refused with 503
+// and Retry-After instead of being accepted and left to time out. A threshold
+// of zero disables its signal.
+type BackpressureConfig struct {
+	// MaxInFlight is how many synchronous executions this process runs at once
+	MaxInFlight int
+	// MaxQueued is how many durable jobs may be due and waiting for a worker
+	MaxQueued int
+	// DBPoolUtilization is the share of the database pool's connections, from
+	// 0 to 1, that may be in use
+	DBPoolUtilization float64
+	// RetryAfter is the wait refused callers are told; defaults to 5s
+	RetryAfter time.Duration
+}
+
+// BackpressureConfigFromEnv reads BACKPRESSURE_MAX_IN_FLIGHT,
+// BACKPRESSURE_MAX_QUEUED, BACKPRESSURE_DB_POOL_UTILIZATION and
+// BACKPRESSURE_RETRY_AFTER
+func BackpressureConfigFromEnv() BackpressureConfig {
+	cfg := BackpressureConfig{RetryAfter: 5 * time.Second}
+	if n, err := strconv.Atoi(os.Getenv("BACKPRESSURE_MAX_IN_FLIGHT")); err == nil && n > 0 {
+		cfg.MaxInFlight = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BACKPRESSURE_MAX_QUEUED")); err == nil && n > 0 {
+		cfg.MaxQueued = n
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("BACKPRESSURE_DB_POOL_UTILIZATION"), 64); err == nil && v > 0 {
+		cfg.DBPoolUtilization = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("BACKPRESSURE_RETRY_AFTER")); err == nil && v > 0 {
+		cfg.RetryAfter = v
+	}
+	return cfg
+}
+
+// backpressure tracks how saturated the server is and refuses new
+// submissions past the configured thresholds
+type backpressure struct {
+	cfg    BackpressureConfig
+	db     *sql.DB
+	logger *slog.Logger
+
+	inFlight atomic.Int64
+	sampling atomic.Bool
+
+	mu        sync.Mutex
+	queued    int
+	sampledAt time.Time
+	refused   map[string]uint64
+}
+
+func newBackpressure(cfg BackpressureConfig, dbConn *sql.DB) *backpressure {
+	return &backpressure{
+		cfg:     cfg,
+		db:      dbConn,
+		logger:  logging.Component("backpressure"),
+		refused: make(map[string]uint64),
+	}
+}
+
+// admit returns the saturated signal a submission is refused on, or "" when
+// it may be accepted. A synchronous submission takes an in-flight slot, given
+// back by calling done once its execution finishes; any other is queued.
+func (b *backpressure) admit(ctx context.Context, sync bool) (done func(), signal string) {
+	done = func() {}
+	switch {
+	case b.dbPoolSaturated():
+		signal = signalDBPool
+	case !sync && b.queueSaturated(ctx):
+		signal = signalQueue
+	case sync:
+		if n := b.inFlight.Add(1); b.cfg.MaxInFlight > 0 && n > int64(b.cfg.MaxInFlight) {
+			b.inFlight.Add(-1)
+			signal = signalInFlight
+		} else {
+			done = func() { b.inFlight.Add(-1) }
+		}
+	}
+	if signal != "" {
+		b.mu.Lock()
+		b.refused[signal]++
+		b.mu.Unlock()
+	}
+	return done, signal
+}
+
+// dbPoolSaturated reports whether the share of the pool's connections in use
+// has reached the threshold
+func (b *backpressure) dbPoolSaturated() bool {
+	if b.cfg.DBPoolUtilization <= 0 || b.db == nil {
+		return false
+	}
+	stats := db.Stats(b.db)
+	return stats.MaxOpen > 0 && float64(stats.InUse) >= b.cfg.DBPoolUtilization*float64(stats.MaxOpen)
+}
+
+// queueSaturated reports whether the durable queue holds the threshold of due
+// jobs or more, counting it at most once per queueSampleInterval. One
+// submission counts while the others go on with the previous count, and a
+// failed count keeps it.
+func (b *backpressure) queueSaturated(ctx context.Context) bool {
+	if b.cfg.MaxQueued <= 0 || b.db == nil {
+		return false
+	}
+	b.mu.Lock()
+	stale := time.Since(b.sampledAt) >= queueSampleInterval
+	b.mu.Unlock()
+	if stale && b.sampling.CompareAndSwap(false, true) {
+		defer b.sampling.Store(false)
+		ctx, cancel := context.WithTimeout(ctx, queueSampleInterval)
+		defer cancel()
+		queued, err := db.CountDueJobs(ctx, b.db)
+		if err != nil {
+			b.logger.Warn("Failed to count queued jobs", "error", err)
+		}
+		b.mu.Lock()
+		if err == nil {
+			b.queued = queued
+		}
+		b.sampledAt = time.Now()
+		b.mu.Unlock()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.queued >= b.cfg.MaxQueued
+}
+
+// reject answers a refused submission with 503 OVERLOADED and Retry-After
+func (b *backpressure) reject(w http.ResponseWriter, r *http.Request, signal string) {
+	b.logger.Warn("Refused submission", "signal", signal, "path", r.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(b.cfg.RetryAfter.Round(time.Second)/time.Second), 1)))
+	utils.RespondError(w, r, http.StatusServiceUnavailable, fmt.Sprintf("Server is overloaded (%s), retry later", signal))
+}
+
+// WriteMetrics renders each signal's threshold and current level, and the
+// submissions refused on it, in the Prometheus text format
+func (b *backpressure) WriteMetrics(w io.Writer) {
+	var utilization float64
+	if b.db != nil {
+		if stats := db.Stats(b.db); stats.MaxOpen > 0 {
+			utilization = float64(stats.InUse) / float64(stats.MaxOpen)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	signals := []struct {
+		name             string
+		threshold, level float64
+	}{
+		{signalInFlight, float64(b.cfg.MaxInFlight), float64(b.inFlight.Load())},
+		{signalQueue, float64(b.cfg.MaxQueued), float64(b.queued)},
+		{signalDBPool, b.cfg.DBPoolUtilization, utilization},
+	}
+
+	const threshold, level, refused = "tala_backpressure_threshold", "tala_backpressure_level", "tala_backpressure_rejections_total"
+	fmt.Fprintf(w, "# HELP %s Level of each signal at which new submissions are refused with 503; 0 when the signal is off.\n# TYPE %s gauge\n", threshold, threshold)
+	for _, s := range signals {
+		fmt.Fprintf(w, "%s{signal=%q} %g\n", threshold, s.name, s.threshold)
+	}
+	fmt.Fprintf(w, "# HELP %s Current level of each saturation signal.\n# TYPE %s gauge\n", level, level)
+	for _, s := range signals {
+		fmt.Fprintf(w, "%s{signal=%q} %g\n", level, s.name, s.level)
+	}
+	fmt.Fprintf(w, "# HELP %s Submissions refused with 503, by saturated signal.\n# TYPE %s counter\n", refused, refused)
+	for _, s := range signals {
+		fmt.Fprintf(w, "%s{signal=%q} %d\n", refused, s.name, b.refused[s.name])
+	}
+}
+
+// admitLoad checks the server's saturation before a workflow submission,
+// writing a 503 when it is refused. sync submissions run in the request and
+// hold an in-flight slot until done is called; queued ones add to the
+// durable queue.
+func (s *Server) admitLoad(w http.ResponseWriter, r *http.Request, sync bool) (done func(), ok bool) {
+	done, signal := s.pressure.admit(r.Context(), sync)
+	if signal != "" {
+		s.pressure.reject(w, r, signal)
+		return nil, false
+	}
+	return done, true
+}
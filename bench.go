@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tala_base/orchestrator"
+	"tala_base/types"
+)
+
+// runBench implements the `tala bench workflow` command. The executor's own
+// benchmarks run with `go test -bench . ./orchestrator`.
+func runBench(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing bench command (expected workflow)")
+	}
+	switch args[0] {
+	case "workflow":
+		return runBenchWorkflow(args[1:])
+	default:
+		return fmt.Errorf("unknown bench command %q (expected workflow)", args[0])
+	}
+}
+
+// runBenchWorkflow implements `tala bench workflow [-rps n] [-duration d]
+// [-concurrency n] [-input file] [-mock] [-mock-latency d] <name>`. It starts
+// executions of the workflow at a steady rate, against its lambdas or mock
+// lambdas that echo their input, and reports throughput, latency percentiles
+// and errors. Executions due while -concurrency are still running are
+// dropped, so a slow workflow shows up as drops rather than as a rate lower
+// than asked for.
+func runBenchWorkflow(args []string) error {
+	flags := flag.NewFlagSet("bench workflow", flag.ContinueOnError)
+	rps := flags.Float64("rps", 10, "executions started per second")
+	duration := flags.Duration("duration", 10*time.Second, "how long to start executions for")
+	concurrency := flags.Int("concurrency", 100, "most executions running at once")
+	inputFile := flags.String("input", "", "JSON file of the workflow input data; empty for {}")
+	mock := flags.Bool("mock", false, "answer every lambda call with a mock that echoes its input")
+	mockLatency := flags.Duration("mock-latency", 0, "how long mock lambdas take to answer")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one workflow name")
+	}
+	if *rps <= 0 || *duration <= 0 || *concurrency <= 0 {
+		return fmt.Errorf("rps, duration and concurrency must be positive")
+	}
+	name := flags.Arg(0)
+
+	data := map[string]interface{}{}
+	if *inputFile != "" {
+		raw, err := os.ReadFile(*inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return fmt.Errorf("failed to parse input: %w", err)
+		}
+	}
+
+	executor := orchestrator.NewChainExecutor()
+	if err := executor.LoadWorkflow(name); err != nil {
+		return err
+	}
+	if *mock {
+		workflow, _ := executor.Workflow(name)
+		server := mockLambdas(executor, []types.Workflow{workflow}, *mockLatency)
+		defer server.Close()
+	}
+
+	report := &benchReport{errors: make(map[string]int)}
+	slots := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *rps))
+	defer ticker.Stop()
+	start := time.Now()
+	for deadline := start.Add(*duration); time.Now().Before(deadline); <-ticker.C {
+		select {
+		case slots <- struct{}{}:
+		default:
+			report.drop()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			input := types.WorkflowInput{Data: data, Context: types.ExecutionContext{RequestID: uuid.NewString()}}
+			began := time.Now()
+			out, err := executor.ExecuteChain(name, input)
+			report.add(time.Since(began), out, err)
+		}()
+	}
+	wg.Wait()
+	report.elapsed = time.Since(start)
+
+	report.write(os.Stdout, name)
+	return nil
+}
+
+// mockLambdas serves every lambda the workflows call from one local server
+// that answers with the request as the step's data, or {} for a request that
+// is not a JSON object, after latency
+func mockLambdas(executor *orchestrator.ChainExecutor, workflows []types.Workflow, latency time.Duration) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		body, _ := io.ReadAll(r.Body)
+		var data map[string]interface{}
+		if json.Unmarshal(body, &data) != nil || data == nil {
+			data = map[string]interface{}{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.StepResult{Data: data})
+	}))
+	urls := make(map[string]string)
+	for _, workflow := range workflows {
+		for _, step := range workflow.Steps {
+			if step.Lambda != "" {
+				urls[step.Lambda] = server.URL + "/" + step.Lambda
+			}
+		}
+	}
+	executor.SetRegistry(orchestrator.NewRegistry(urls))
+	return server
+}
+
+// benchReport collects the outcome of a workflow benchmark's executions
+type benchReport struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	succeeded int
+	failed    int
+	dropped   int
+	// errors counts failed executions by error code, with "internal" for
+	// executions that ended in an internal error rather than a workflow error
+	errors  map[string]int
+	elapsed time.Duration
+}
+
+func (r *benchReport) drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropped++
+}
+
+func (r *benchReport) add(latency time.Duration, out *types.WorkflowOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies = append(r.latencies, latency)
+	switch {
+	case err != nil:
+		r.failed++
+		r.errors["internal"]++
+	case out.Error != nil:
+		r.failed++
+		r.errors[string(out.Error.Code)]++
+	default:
+		r.succeeded++
+	}
+}
+
+// write prints the report
+func (r *benchReport) write(w io.Writer, name string) {
+	completed := len(r.latencies)
+	fmt.Fprintf(w, "workflow %s: %d executions in %s (%.2f/s), %d dropped\n",
+		name, completed, r.elapsed.Round(time.Millisecond), float64(completed)/r.elapsed.Seconds(), r.dropped)
+	fmt.Fprintf(w, "  succeeded %d, failed %d\n", r.succeeded, r.failed)
+	if completed > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		fmt.Fprintf(w, "  latency p50 %s, p90 %s, p99 %s, max %s\n",
+			percentile(r.latencies, 50), percentile(r.latencies, 90), percentile(r.latencies, 99), percentile(r.latencies, 100))
+	}
+	if len(r.errors) > 0 {
+		codes := make([]string, 0, len(r.errors))
+		for code := range r.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		fmt.Fprintln(w, "  errors:")
+		for _, code := range codes {
+			fmt.Fprintf(w, "    %s %d\n", code, r.errors[code])
+		}
+	}
+}
+
+// percentile returns the nearest-rank pth percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)].Round(10 * time.Microsecond)
+}
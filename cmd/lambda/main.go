@@ -0,0 +1,23 @@
+// Command lambda runs one lambda as its own process: go run ./cmd/lambda <name>
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"tala_base/lambdas"
+	"tala_base/lambdasdk"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: lambda <name>")
+		os.Exit(2)
+	}
+	l, ok := lambdas.Find(os.Args[1])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown lambda %q\n", os.Args[1])
+		os.Exit(2)
+	}
+	lambdasdk.Serve(l)
+}
@@ -0,0 +1,12 @@
+// Command lambdas serves every lambda from one process on PORT, each under
+// /<name>. Point the server at it with LAMBDA_BASE_URL.
+package main
+
+import (
+	"tala_base/lambdas"
+	"tala_base/lambdasdk"
+)
+
+func main() {
+	lambdasdk.ServeAll("lambdas", lambdas.All)
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"tala_base/types"
+
+	"github.com/lib/pq"
+)
+
+// apiKeyPrefix starts every issued key so they are recognisable in logs and scanners
+const apiKeyPrefix = "tala_"
+
+// ErrInvalidAPIKey is returned when a presented key is malformed, unknown or revoked
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// apiKeyRow is an APIKey plus its secret hash, which never leaves the package
+type apiKeyRow struct {
+	types.APIKey
+	secretHash string
+}
+
+// apiKeyColumns is the column list every api_keys query selects, in scanAPIKey order
+const apiKeyColumns = "id, tenant_id, name, prefix, secret_hash, scopes, created_at, last_used_at, revoked_at"
+
+var apiKeyRepository = NewRepository(Table[apiKeyRow]{
+	Name:          "api_keys",
+	Key:           "id",
+	Columns:       strings.Split(apiKeyColumns, ", "),
+	InsertColumns: []string{"name", "prefix", "secret_hash", "scopes"},
+	Sortable:      []string{"id", "name", "created_at", "last_used_at"},
+	Filterable:    []string{"prefix"},
+	Tenant:        true,
+	Scan:          scanAPIKey,
+	Values: func(key *apiKeyRow) []interface{} {
+		return []interface{}{key.Name, key.Prefix, key.secretHash, pq.Array(key.Scopes)}
+	},
+})
+
+func scanAPIKey(row rowScanner) (*apiKeyRow, error) {
+	var key apiKeyRow
+	var lastUsed, revoked sql.NullTime
+	if err := row.Scan(&key.ID, &key.TenantID, &key.Name, &key.Prefix, &key.secretHash, pq.Array(&key.Scopes),
+		&key.CreatedAt, &lastUsed, &revoked); err != nil {
+		return nil, err
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if lastUsed.Valid {
+		key.LastUsedAt = &lastUsed.Time
+	}
+	if revoked.Valid {
+		key.RevokedAt = &revoked.Time
+	}
+	return &key, nil
+}
+
+// hashSecret hashes the secret half of a key; keys are random, so a fast hash is sufficient
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key material: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateAPIKey issues a new key of the form tala_<prefix>_<secret> for the context's tenant.
+// It returns the stored key and the full key string, which cannot be recovered later.
+func CreateAPIKey(ctx context.Context, db DBTX, input types.CreateAPIKeyInput) (*types.APIKey, string, error) {
+	if strings.TrimSpace(input.Name) == "" {
+		return nil, "", fmt.Errorf("%w: API key name is required", ErrInvalidArgument)
+	}
+	prefix, err := randomHex(4)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, "", err
+	}
+
+	scopes := input.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	var key *apiKeyRow
+	err = inTx(ctx, db, func(tx DBTX) error {
+		var err error
+		key, err = apiKeyRepository.Create(ctx, tx, &apiKeyRow{
+			APIKey:     types.APIKey{Name: input.Name, Prefix: prefix, Scopes: scopes},
+			secretHash: hashSecret(secret),
+		})
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, types.AuditEntityAPIKey, strconv.FormatInt(key.ID, 10), types.AuditCreate, nil, key.APIKey)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &key.APIKey, apiKeyPrefix + prefix + "_" + secret, nil
+}
+
+// ListAPIKeys retrieves one page of the context tenant's API keys, including revoked ones
+func ListAPIKeys(ctx context.Context, db DBTX, opts ListOptions) ([]*types.APIKey, int, error) {
+	rows, total, err := apiKeyRepository.List(ctx, db, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := make([]*types.APIKey, len(rows))
+	for i, row := range rows {
+		keys[i] = &row.APIKey
+	}
+	return keys, total, nil
+}
+
+// RevokeAPIKey marks a key revoked so it can no longer authenticate.
+// Revoking a key that is already revoked changes nothing and is not audited.
+func RevokeAPIKey(ctx context.Context, db DBTX, id int64) (*types.APIKey, error) {
+	var key *apiKeyRow
+	err := inTx(ctx, db, func(tx DBTX) error {
+		before, err := scanAPIKey(tx.QueryRowContext(ctx,
+			"SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+			id, TenantFrom(ctx),
+		))
+		if err != nil {
+			return err
+		}
+		key, err = scanAPIKey(tx.QueryRowContext(ctx,
+			`UPDATE api_keys
+			SET revoked_at = COALESCE(revoked_at, NOW())
+			WHERE id = $1 AND tenant_id = $2
+			RETURNING `+apiKeyColumns,
+			id, TenantFrom(ctx),
+		))
+		if err != nil || before.RevokedAt != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, types.AuditEntityAPIKey, strconv.FormatInt(id, 10), types.AuditRevoke, before.APIKey, key.APIKey)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: api key %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	return &key.APIKey, nil
+}
+
+// AuthenticateAPIKey verifies a presented key and records when it was last used.
+// last_used_at is only written once a minute per key to keep auth cheap.
+// Keys are looked up across all tenants; the returned key's TenantID is the
+// tenant the caller should be scoped to.
+func AuthenticateAPIKey(ctx context.Context, db DBTX, raw string) (*types.APIKey, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyPrefix), "_")
+	if !strings.HasPrefix(raw, apiKeyPrefix) || !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key *apiKeyRow
+	err := withRetry(ctx, db, func() error {
+		var err error
+		key, err = scanAPIKey(db.QueryRowContext(ctx,
+			"SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = $1",
+			prefix,
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up api key: %w", err)
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.secretHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if _, err := db.ExecContext(ctx,
+		`UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`,
+		key.ID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to record api key use: %w", err)
+	}
+	return &key.APIKey, nil
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"tala_base/types"
+)
+
+// auditColumns is the column list every audit_log query selects, in scanAuditEntry order
+const auditColumns = "id, entity, entity_id, action, COALESCE(actor, ''), before, after, created_at"
+
+var auditRepository = NewRepository(Table[types.AuditEntry]{
+	Name:          "audit_log",
+	Key:           "id",
+	Columns:       strings.Split(auditColumns, ", "),
+	InsertColumns: []string{"entity", "entity_id", "action", "actor", "before", "after"},
+	Sortable:      []string{"created_at"},
+	Filterable:    []string{"entity", "entity_id", "action", "actor", "created_at"},
+	Tenant:        true,
+	Scan:          scanAuditEntry,
+	Values: func(e *types.AuditEntry) []interface{} {
+		return []interface{}{string(e.Entity), e.EntityID, string(e.Action), nullString(e.Actor), nullJSON(e.Before), nullJSON(e.After)}
+	},
+})
+
+func scanAuditEntry(row rowScanner) (*types.AuditEntry, error) {
+	var e types.AuditEntry
+	var before, after []byte
+	if err := row.Scan(&e.ID, &e.Entity, &e.EntityID, &e.Action, &e.Actor, &before, &after, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	e.Before, e.After = before, after
+	e.Changed = changedFields(before, after)
+	return &e, nil
+}
+
+// recordAudit writes one audit log entry for a management action in the
+// context's tenant, attributed to the context's actor. before is nil for
+// creates and after is nil for deletes; both are stored as JSON.
+func recordAudit(ctx context.Context, db DBTX, entity types.AuditEntity, id string, action types.AuditAction, before, after interface{}) error {
+	entry := types.AuditEntry{Entity: entity, EntityID: id, Action: action, Actor: auditInfoFrom(ctx).Actor}
+	var err error
+	if entry.Before, err = marshalImage(before); err != nil {
+		return err
+	}
+	if entry.After, err = marshalImage(after); err != nil {
+		return err
+	}
+	if _, err := auditRepository.Create(ctx, db, &entry); err != nil {
+		return fmt.Errorf("failed to record audit: %w", err)
+	}
+	return nil
+}
+
+// RecordAudit is recordAudit for actions taken outside this package, such as
+// an operator resolving the step of a durable execution
+func RecordAudit(ctx context.Context, db DBTX, entity types.AuditEntity, id string, action types.AuditAction, before, after interface{}) error {
+	return recordAudit(ctx, db, entity, id, action, before, after)
+}
+
+func marshalImage(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+	return b, nil
+}
+
+// changedFields returns the sorted top-level fields whose values differ
+// between two JSON objects, treating a missing object as empty
+func changedFields(before, after []byte) []string {
+	var b, a map[string]json.RawMessage
+	if before != nil && json.Unmarshal(before, &b) != nil {
+		return nil
+	}
+	if after != nil && json.Unmarshal(after, &a) != nil {
+		return nil
+	}
+	var changed []string
+	for field, value := range b {
+		if other, ok := a[field]; !ok || !bytes.Equal(value, other) {
+			changed = append(changed, field)
+		}
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// ListAudit retrieves one page of the context tenant's audit log, newest first
+func ListAudit(ctx context.Context, db DBTX, opts types.ListAuditInput) (types.ListAuditOutput, error) {
+	limit, offset, err := PageOptions(opts.PageRequest)
+	if err != nil {
+		return types.ListAuditOutput{}, err
+	}
+	var filters []Filter
+	if opts.Entity != "" {
+		filters = append(filters, Filter{Column: "entity", Op: OpEq, Value: string(opts.Entity)})
+	}
+	if opts.EntityID != "" {
+		filters = append(filters, Filter{Column: "entity_id", Op: OpEq, Value: opts.EntityID})
+	}
+	if opts.Action != "" {
+		filters = append(filters, Filter{Column: "action", Op: OpEq, Value: string(opts.Action)})
+	}
+	if opts.Actor != "" {
+		filters = append(filters, Filter{Column: "actor", Op: OpEq, Value: opts.Actor})
+	}
+	if opts.CreatedAfter != nil {
+		filters = append(filters, Filter{Column: "created_at", Op: OpGt, Value: *opts.CreatedAfter})
+	}
+	if opts.CreatedBefore != nil {
+		filters = append(filters, Filter{Column: "created_at", Op: OpLt, Value: *opts.CreatedBefore})
+	}
+	entries, total, err := auditRepository.List(ctx, db, ListOptions{
+		Limit:      limit,
+		Offset:     offset,
+		OrderBy:    "created_at",
+		Descending: true,
+		Filters:    filters,
+	})
+	if err != nil {
+		return types.ListAuditOutput{}, err
+	}
+	return types.NewListResponse(entries, total, limit, offset), nil
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tala_base/types"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired, revoked or reused
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// credentialRow appends the password hash column to the destinations scanned by scanUser
+type credentialRow struct {
+	rowScanner
+	passwordHash *string
+}
+
+func (r credentialRow) Scan(dest ...interface{}) error {
+	return r.rowScanner.Scan(append(dest, r.passwordHash)...)
+}
+
+// RegisterUser creates a user with a bcrypt password hash in one transaction.
+// This function is called by the auth_register lambda.
+func RegisterUser(ctx context.Context, db DBTX, input types.CreateUserInput, passwordHash string) (*types.User, error) {
+	var user *types.User
+	err := inTx(ctx, db, func(tx DBTX) error {
+		var err error
+		user, err = CreateUser(ctx, tx, input)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE users SET password_hash = $1 WHERE id = $2",
+			passwordHash, user.ID,
+		); err != nil {
+			return fmt.Errorf("failed to set password: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserCredentials retrieves an active user by email with their password hash,
+// which is empty for users that never registered a password.
+// This function is called by the auth_login lambda.
+func GetUserCredentials(ctx context.Context, db DBTX, email string) (*types.User, string, error) {
+	var user *types.User
+	var passwordHash string
+	err := withRetry(ctx, db, func() error {
+		var err error
+		user, err = scanUser(credentialRow{db.QueryRowContext(ctx,
+			`SELECT `+userColumns+`, COALESCE(password_hash, '')
+			FROM users
+			WHERE email_hash = $1 AND tenant_id = $2 AND deleted_at IS NULL`,
+			emailIndex(email), TenantFrom(ctx),
+		), &passwordHash})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("%w: user with email", ErrNotFound)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user credentials: %w", err)
+	}
+	return user, passwordHash, nil
+}
+
+// CreateRefreshToken stores the hash of a new refresh token for a user
+func CreateRefreshToken(ctx context.Context, db DBTX, userID int, tokenHash string, expiresAt time.Time) error {
+	err := withRetry(ctx, db, func() error {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO refresh_tokens (tenant_id, user_id, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4)`,
+			TenantFrom(ctx), userID, tokenHash, expiresAt,
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", translateError(err))
+	}
+	return nil
+}
+
+// RevokeRefreshTokens revokes every live refresh token of a user and returns how many were revoked.
+// This function is called by the user_delete lambda when a cascading delete is requested.
+func RevokeRefreshTokens(ctx context.Context, db DBTX, userID int) (int, error) {
+	var result sql.Result
+	err := withRetry(ctx, db, func() error {
+		var err error
+		result, err = db.ExecContext(ctx,
+			"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND tenant_id = $2 AND revoked_at IS NULL",
+			userID, TenantFrom(ctx),
+		)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke refresh tokens: %w", translateError(err))
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(revoked), nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one and returns its user.
+// This function is called by the auth_refresh lambda.
+// Presenting a token that was already rotated revokes every token of its user,
+// since it means the token was copied.
+func RotateRefreshToken(ctx context.Context, db DBTX, oldHash, newHash string, expiresAt time.Time) (*types.User, error) {
+	var user *types.User
+	reused := false
+	err := inTx(ctx, db, func(tx DBTX) error {
+		reused = false
+
+		var id int64
+		var userID int
+		var expires time.Time
+		var revoked sql.NullTime
+		err := tx.QueryRowContext(ctx,
+			`SELECT id, user_id, expires_at, revoked_at
+			FROM refresh_tokens
+			WHERE token_hash = $1 AND tenant_id = $2
+			FOR UPDATE`,
+			oldHash, TenantFrom(ctx),
+		).Scan(&id, &userID, &expires, &revoked)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+
+		if revoked.Valid {
+			reused = true
+			_, err := tx.ExecContext(ctx,
+				"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+				userID,
+			)
+			return err
+		}
+		if time.Now().After(expires) {
+			return ErrInvalidRefreshToken
+		}
+
+		user, err = GetUserByID(ctx, tx, userID)
+		if errors.Is(err, ErrNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		var newID int64
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO refresh_tokens (tenant_id, user_id, token_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`,
+			TenantFrom(ctx), userID, newHash, expiresAt,
+		).Scan(&newID); err != nil {
+			return fmt.Errorf("failed to create refresh token: %w", translateError(err))
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2",
+			newID, id,
+		)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if reused {
+		return nil, fmt.Errorf("%w: token was already used", ErrInvalidRefreshToken)
+	}
+	return user, nil
+}
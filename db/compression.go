@@ -0,0 +1,159 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms for stored execution state
+const (
+	CompressZstd = "zstd"
+	CompressGzip = "gzip"
+)
+
+// DefaultCompressThreshold is the size in bytes from which stored execution
+// state is compressed when no threshold is configured
+const DefaultCompressThreshold = 4096
+
+// compressedKeys maps each algorithm to the only key of the JSONB document a
+// compressed payload is stored as, {"$zstd": "<base64>"}, so the columns stay
+// JSONB and rows written before compression was enabled read unchanged
+var compressedKeys = map[string]string{CompressZstd: "$zstd", CompressGzip: "$gzip"}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+// StateCompressor compresses the input, output and job state of executions
+// before they are stored. Payloads under the threshold, and those that would
+// not shrink, are stored as they are.
+type StateCompressor struct {
+	algorithm string
+	threshold int
+}
+
+// NewStateCompressor creates a compressor for zstd or gzip. A threshold of
+// zero or less uses DefaultCompressThreshold.
+func NewStateCompressor(algorithm string, threshold int) (*StateCompressor, error) {
+	if _, ok := compressedKeys[algorithm]; !ok {
+		return nil, fmt.Errorf("unknown compression algorithm %q (expected %s or %s)", algorithm, CompressZstd, CompressGzip)
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	return &StateCompressor{algorithm: algorithm, threshold: threshold}, nil
+}
+
+// stateCompressor is the process-wide compressor installed by Connect; nil
+// stores execution state uncompressed. Compressed state is read either way.
+var stateCompressor *StateCompressor
+
+// SetStateCompressor installs the compressor used transparently by the
+// execution and job repositories. Connect calls it when compression is configured.
+func SetStateCompressor(c *StateCompressor) {
+	stateCompressor = c
+}
+
+// compress returns the stored form of a JSON document
+func (c *StateCompressor) compress(raw []byte) ([]byte, error) {
+	var compressed []byte
+	switch c.algorithm {
+	case CompressZstd:
+		compressed = zstdEncoder.EncodeAll(raw, nil)
+	case CompressGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(raw); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		compressed = buf.Bytes()
+	}
+	return json.Marshal(map[string]string{compressedKeys[c.algorithm]: base64.StdEncoding.EncodeToString(compressed)})
+}
+
+// compressedState reports the algorithm and data of a stored compressed
+// payload, or ok false for a plain JSON document
+func compressedState(stored []byte) (algorithm string, data []byte, ok bool) {
+	trimmed := bytes.TrimSpace(stored)
+	if !bytes.HasPrefix(trimmed, []byte(`{"$`)) {
+		return "", nil, false
+	}
+	var doc map[string]json.RawMessage
+	if json.Unmarshal(trimmed, &doc) != nil || len(doc) != 1 {
+		return "", nil, false
+	}
+	for algorithm, key := range compressedKeys {
+		var encoded string
+		if value, found := doc[key]; found && json.Unmarshal(value, &encoded) == nil {
+			if data, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+				return algorithm, data, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// packState converts execution state for a nullable JSONB column, compressing
+// it when a compressor is installed and it reaches the threshold. A document
+// that happens to look like a compressed one is always compressed, so reading
+// it back cannot mistake it for one.
+func packState(raw json.RawMessage) (sql.NullString, error) {
+	if len(raw) == 0 {
+		return nullJSON(raw), nil
+	}
+	c := stateCompressor
+	_, _, ambiguous := compressedState(raw)
+	if !ambiguous && (c == nil || len(raw) < c.threshold) {
+		return nullJSON(raw), nil
+	}
+	if c == nil {
+		c = &StateCompressor{algorithm: CompressZstd}
+	}
+	packed, err := c.compress(raw)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to compress execution state: %w", err)
+	}
+	if !ambiguous && len(packed) >= len(raw) {
+		return nullJSON(raw), nil
+	}
+	return nullJSON(packed), nil
+}
+
+// unpackState returns the JSON document of a stored execution state column,
+// decompressing it only when it was stored compressed
+func unpackState(stored []byte) (json.RawMessage, error) {
+	algorithm, data, ok := compressedState(stored)
+	if !ok {
+		return stored, nil
+	}
+	switch algorithm {
+	case CompressZstd:
+		raw, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress execution state: %w", err)
+		}
+		return raw, nil
+	default:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress execution state: %w", err)
+		}
+		defer zr.Close()
+		raw, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress execution state: %w", err)
+		}
+		return raw, nil
+	}
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"tala_base/utils"
+)
+
+// Config holds the connection pool settings for a database handle
+type Config struct {
+	URL             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// PIIKeys and PIIIndexKey enable column encryption; see ParsePIICipher
+	PIIKeys     string
+	PIIIndexKey string
+
+	// Compression, zstd or gzip, compresses execution state of at least
+	// CompressThreshold bytes; see NewStateCompressor
+	Compression       string
+	CompressThreshold int
+}
+
+// ConfigFromEnv builds a Config from DATABASE_URL, the DB_* pool variables, the
+// PII keys and EXECUTION_COMPRESSION(_THRESHOLD), falling back to defaults
+// suited to a single lambda process
+func ConfigFromEnv() Config {
+	cfg := Config{
+		URL:             os.Getenv("DATABASE_URL"),
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		PIIKeys:         os.Getenv("PII_KEYS"),
+		PIIIndexKey:     os.Getenv("PII_INDEX_KEY"),
+		Compression:     os.Getenv("EXECUTION_COMPRESSION"),
+	}
+	if v, err := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS")); err == nil {
+		cfg.MaxOpenConns = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS")); err == nil {
+		cfg.MaxIdleConns = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("DB_CONN_MAX_LIFETIME")); err == nil {
+		cfg.ConnMaxLifetime = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("DB_CONN_MAX_IDLE_TIME")); err == nil {
+		cfg.ConnMaxIdleTime = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("EXECUTION_COMPRESSION_THRESHOLD")); err == nil {
+		cfg.CompressThreshold = v
+	}
+	return cfg
+}
+
+// Connect opens a long-lived connection pool and verifies it is reachable.
+// It is meant to be called once at startup and the handle shared by all handlers.
+// URL and the PII keys may be secret:// references, resolved through utils.DefaultSecrets.
+func Connect(cfg Config) (*sql.DB, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("database URL is not set")
+	}
+	for _, value := range []*string{&cfg.URL, &cfg.PIIKeys, &cfg.PIIIndexKey} {
+		resolved, err := utils.ResolveSecret(context.Background(), utils.DefaultSecrets(), *value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve database configuration: %w", err)
+		}
+		*value = resolved
+	}
+	if cfg.PIIKeys != "" {
+		cipher, err := ParsePIICipher(cfg.PIIKeys, cfg.PIIIndexKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII configuration: %w", err)
+		}
+		SetPIICipher(cipher)
+	}
+	if cfg.Compression != "" {
+		compressor, err := NewStateCompressor(cfg.Compression, cfg.CompressThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid execution compression: %w", err)
+		}
+		SetStateCompressor(compressor)
+	}
+	connector, err := pq.NewConnector(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	dbConn := sql.OpenDB(observedConnector{connector})
+	dbConn.SetMaxOpenConns(cfg.MaxOpenConns)
+	dbConn.SetMaxIdleConns(cfg.MaxIdleConns)
+	dbConn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	dbConn.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := dbConn.Ping(); err != nil {
+		dbConn.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return dbConn, nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Sentinel errors returned (wrapped) by the repository functions.
+// Callers should test for them with errors.Is rather than matching messages.
+var (
+	// ErrNotFound is returned when the requested row does not exist or was soft-deleted
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicateEmail is returned when an insert or update would reuse an active user's email
+	ErrDuplicateEmail = errors.New("email already exists")
+
+	// ErrConflict is returned for other constraint violations and serialization conflicts
+	ErrConflict = errors.New("conflict")
+
+	// ErrInvalidArgument is returned when a caller-supplied option is not allowed,
+	// such as an unknown sort column
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// Postgres error codes translated by translateError
+const (
+	pqUniqueViolation      = "23505"
+	pqForeignKeyViolation  = "23503"
+	pqExclusionViolation   = "23P01"
+	pqCheckViolation       = "23514"
+	pqSerializationFailure = "40001"
+	pqQueryCanceled        = "57014"
+)
+
+// translateError wraps Postgres constraint errors in the matching sentinel,
+// keeping the original error in the chain for logging
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		if strings.Contains(pqErr.Constraint, "email") {
+			return fmt.Errorf("%w: %w", ErrDuplicateEmail, err)
+		}
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case pqCheckViolation:
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	case pqForeignKeyViolation, pqExclusionViolation, pqSerializationFailure:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// IsTimeout reports whether err was caused by the caller's context expiring,
+// either before the query was sent or while Postgres was executing it
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqQueryCanceled
+}
+
+// IsCanceled reports whether err was caused by the caller cancelling the request
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
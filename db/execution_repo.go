@@ -0,0 +1,444 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tala_base/types"
+
+	"github.com/google/uuid"
+)
+
+// executionColumns is the column list every workflow_executions query selects, in scanExecution order
+const executionColumns = "id, tenant_id, workflow, status, input, output, error_code, error, attempt, labels, created_at, scheduled_for, started_at, finished_at, updated_at, replay_of"
+
+// stepColumns is the column list every step_executions query selects, in scanStep order
+const stepColumns = "id, tenant_id, execution_id, step_index, step, lambda, status, input, output, error_code, error, attempts, started_at, finished_at"
+
+// scanExecution reads one row selected with executionColumns into an Execution
+func scanExecution(row rowScanner) (*types.Execution, error) {
+	var exec types.Execution
+	var input, output, errData, labels []byte
+	var errorCode, replayOf sql.NullString
+	var scheduledFor, startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&exec.ID, &exec.TenantID, &exec.Workflow, &exec.Status, &input, &output, &errorCode, &errData,
+		&exec.Attempt, &labels, &exec.CreatedAt, &scheduledFor, &startedAt, &finishedAt, &exec.UpdatedAt, &replayOf); err != nil {
+		return nil, err
+	}
+	var err error
+	if exec.Input, err = unpackState(input); err != nil {
+		return nil, err
+	}
+	if exec.Output, err = unpackState(output); err != nil {
+		return nil, err
+	}
+	exec.Error = errData
+	exec.ErrorCode = types.WorkflowErrorCode(errorCode.String)
+	exec.ReplayOf = replayOf.String
+	if err := json.Unmarshal(labels, &exec.Labels); err != nil {
+		return nil, fmt.Errorf("failed to decode execution labels: %w", err)
+	}
+	if scheduledFor.Valid {
+		exec.ScheduledFor = &scheduledFor.Time
+	}
+	if startedAt.Valid {
+		exec.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		exec.FinishedAt = &finishedAt.Time
+	}
+	return &exec, nil
+}
+
+// scanStep reads one row selected with stepColumns into a StepExecution
+func scanStep(row rowScanner) (*types.StepExecution, error) {
+	var step types.StepExecution
+	var input, output, errData []byte
+	var errorCode sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&step.ID, &step.TenantID, &step.ExecutionID, &step.StepIndex, &step.Step, &step.Lambda, &step.Status,
+		&input, &output, &errorCode, &errData, &step.Attempts, &startedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if step.Input, err = unpackState(input); err != nil {
+		return nil, err
+	}
+	if step.Output, err = unpackState(output); err != nil {
+		return nil, err
+	}
+	step.Error = errData
+	step.ErrorCode = types.WorkflowErrorCode(errorCode.String)
+	if startedAt.Valid {
+		step.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		step.FinishedAt = &finishedAt.Time
+	}
+	return &step, nil
+}
+
+// nullJSON converts a raw JSON document for a nullable JSONB column.
+// lib/pq would send a []byte as bytea, so documents are passed as text.
+func nullJSON(raw json.RawMessage) sql.NullString {
+	if len(raw) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(raw), Valid: true}
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+var executionRepository = NewRepository(Table[types.Execution]{
+	Name:       "workflow_executions",
+	Key:        "id",
+	Columns:    strings.Split(executionColumns, ", "),
+	Sortable:   []string{"created_at", "scheduled_for", "started_at", "finished_at", "workflow", "status"},
+	Filterable: []string{"workflow", "status", "error_code", "created_at", "labels", "replay_of"},
+	Tenant:     true,
+	Scan:       scanExecution,
+})
+
+// CreateExecution stores a new execution, generating its ID if it is empty.
+// The status defaults to pending.
+func CreateExecution(ctx context.Context, db DBTX, exec types.Execution) (*types.Execution, error) {
+	if exec.Workflow == "" {
+		return nil, fmt.Errorf("%w: workflow is required", ErrInvalidArgument)
+	}
+	if exec.ID == "" {
+		exec.ID = uuid.NewString()
+	}
+	if exec.Status == "" {
+		exec.Status = types.ExecutionPending
+	}
+	if !exec.Status.Valid() {
+		return nil, fmt.Errorf("%w: invalid execution status %q", ErrInvalidArgument, exec.Status)
+	}
+	if exec.Attempt <= 0 {
+		exec.Attempt = 1
+	}
+	labels := exec.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	encodedLabels, err := json.Marshal(labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode execution labels: %w", err)
+	}
+	input, err := packState(exec.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	var created *types.Execution
+	err = withRetry(ctx, db, func() error {
+		var err error
+		created, err = scanExecution(db.QueryRowContext(ctx,
+			`INSERT INTO workflow_executions (id, workflow, status, input, attempt, labels, started_at, tenant_id, scheduled_for, replay_of)
+			VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $3 = 'running' THEN NOW() END, $7, $8, $9)
+			RETURNING `+executionColumns,
+			exec.ID, exec.Workflow, exec.Status, input, exec.Attempt, string(encodedLabels), TenantFrom(ctx), exec.ScheduledFor,
+			nullString(exec.ReplayOf),
+		))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create execution: %w", translateError(err))
+	}
+	return created, nil
+}
+
+// StartExecution marks an execution running, keeping its first start time
+func StartExecution(ctx context.Context, db DBTX, id string) (*types.Execution, error) {
+	return updateExecution(ctx, db, id,
+		`UPDATE workflow_executions
+		SET status = 'running', started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND finished_at IS NULL
+		RETURNING `+executionColumns,
+		id, TenantFrom(ctx),
+	)
+}
+
+// FinishExecution records the terminal status, output and error of an execution
+func FinishExecution(ctx context.Context, db DBTX, id string, status types.ExecutionStatus, output json.RawMessage, errorCode types.WorkflowErrorCode, errData json.RawMessage) (*types.Execution, error) {
+	if !status.Finished() {
+		return nil, fmt.Errorf("%w: %q is not a terminal execution status", ErrInvalidArgument, status)
+	}
+	packed, err := packState(output)
+	if err != nil {
+		return nil, err
+	}
+	return updateExecution(ctx, db, id,
+		`UPDATE workflow_executions
+		SET status = $2, output = $3, error_code = $4, error = $5,
+			finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $6
+		RETURNING `+executionColumns,
+		id, status, packed, nullString(string(errorCode)), nullJSON(errData), TenantFrom(ctx),
+	)
+}
+
+// CancelScheduledExecution cancels an execution that is still waiting for its
+// scheduled start, removing its job. It returns ErrConflict once the execution
+// has been picked up by a worker.
+func CancelScheduledExecution(ctx context.Context, db DBTX, id string) (*types.Execution, error) {
+	var canceled *types.Execution
+	err := inTx(ctx, db, func(tx DBTX) error {
+		var status types.ExecutionStatus
+		err := tx.QueryRowContext(ctx,
+			`SELECT status FROM workflow_executions WHERE id = $1 AND tenant_id = $2 FOR UPDATE`,
+			id, TenantFrom(ctx),
+		).Scan(&status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: execution %s", ErrNotFound, id)
+		}
+		if err != nil {
+			return err
+		}
+		if status != types.ExecutionScheduled {
+			return fmt.Errorf("%w: execution %s is %s", ErrConflict, id, status)
+		}
+
+		// A job a worker holds is already starting
+		result, err := tx.ExecContext(ctx,
+			`DELETE FROM execution_jobs
+			WHERE execution_id = $1 AND (locked_until IS NULL OR locked_until < NOW())`,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("%w: execution %s is starting", ErrConflict, id)
+		}
+
+		canceled, err = scanExecution(tx.QueryRowContext(ctx,
+			`UPDATE workflow_executions
+			SET status = 'canceled', finished_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND tenant_id = $2
+			RETURNING `+executionColumns,
+			id, TenantFrom(ctx),
+		))
+		if err != nil {
+			return err
+		}
+		// Inputs can hold personal data, so only the status change is audited
+		return recordAudit(ctx, tx, types.AuditEntityExecution, id, types.AuditCancel,
+			map[string]interface{}{"workflow": canceled.Workflow, "status": status},
+			map[string]interface{}{"workflow": canceled.Workflow, "status": canceled.Status},
+		)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel execution: %w", translateError(err))
+	}
+	return canceled, nil
+}
+
+func updateExecution(ctx context.Context, db DBTX, id string, query string, args ...interface{}) (*types.Execution, error) {
+	var exec *types.Execution
+	err := withRetry(ctx, db, func() error {
+		var err error
+		exec, err = scanExecution(db.QueryRowContext(ctx, query, args...))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: execution %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update execution: %w", translateError(err))
+	}
+	return exec, nil
+}
+
+// StartStep records an attempt of a step, creating its row on the first attempt
+// and incrementing the attempt count on retries. The execution must belong to the context's tenant.
+func StartStep(ctx context.Context, db DBTX, step types.StepExecution) (*types.StepExecution, error) {
+	input, err := packState(step.Input)
+	if err != nil {
+		return nil, err
+	}
+	var started *types.StepExecution
+	err = withRetry(ctx, db, func() error {
+		var err error
+		started, err = scanStep(db.QueryRowContext(ctx,
+			`INSERT INTO step_executions (execution_id, step_index, step, lambda, status, input, attempts, started_at, tenant_id)
+			SELECT id, $2, $3, $4, 'running', $5, 1, NOW(), tenant_id
+			FROM workflow_executions
+			WHERE id = $1 AND tenant_id = $6
+			ON CONFLICT (execution_id, step_index) DO UPDATE
+			SET status = 'running', input = EXCLUDED.input, attempts = step_executions.attempts + 1,
+				output = NULL, error_code = NULL, error = NULL, finished_at = NULL
+			RETURNING `+stepColumns,
+			step.ExecutionID, step.StepIndex, step.Step, step.Lambda, input, TenantFrom(ctx),
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: execution %s", ErrNotFound, step.ExecutionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start step %s: %w", step.Step, translateError(err))
+	}
+	return started, nil
+}
+
+// FinishStep records the outcome of the latest attempt of a step
+func FinishStep(ctx context.Context, db DBTX, executionID string, stepIndex int, status types.ExecutionStatus, output json.RawMessage, errorCode types.WorkflowErrorCode, errData json.RawMessage) (*types.StepExecution, error) {
+	if !status.Finished() {
+		return nil, fmt.Errorf("%w: %q is not a terminal step status", ErrInvalidArgument, status)
+	}
+	packed, err := packState(output)
+	if err != nil {
+		return nil, err
+	}
+
+	var step *types.StepExecution
+	err = withRetry(ctx, db, func() error {
+		var err error
+		step, err = scanStep(db.QueryRowContext(ctx,
+			`UPDATE step_executions
+			SET status = $3, output = $4, error_code = $5, error = $6, finished_at = NOW()
+			WHERE execution_id = $1 AND step_index = $2 AND tenant_id = $7
+			RETURNING `+stepColumns,
+			executionID, stepIndex, status, packed, nullString(string(errorCode)), nullJSON(errData), TenantFrom(ctx),
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: step %d of execution %s", ErrNotFound, stepIndex, executionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish step: %w", translateError(err))
+	}
+	return step, nil
+}
+
+// GetExecution retrieves an execution with its steps in order
+func GetExecution(ctx context.Context, db DBTX, id string) (*types.Execution, error) {
+	exec, err := executionRepository.Get(ctx, db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withRetry(ctx, db, func() error {
+		rows, err := db.QueryContext(ctx,
+			`SELECT `+stepColumns+`
+			FROM step_executions
+			WHERE execution_id = $1 AND tenant_id = $2
+			ORDER BY step_index`,
+			id, TenantFrom(ctx),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		exec.Steps = []types.StepExecution{}
+		for rows.Next() {
+			step, err := scanStep(rows)
+			if err != nil {
+				return err
+			}
+			exec.Steps = append(exec.Steps, *step)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get execution steps: %w", err)
+	}
+	return exec, nil
+}
+
+// ListExecutions retrieves one page of executions, without steps, and the total matching the filters
+func ListExecutions(ctx context.Context, db DBTX, opts types.ListExecutionsInput) (types.ListExecutionsOutput, error) {
+	limit, offset, err := PageOptions(opts.PageRequest)
+	if err != nil {
+		return types.ListExecutionsOutput{}, err
+	}
+	var filters []Filter
+	if opts.Workflow != "" {
+		filters = append(filters, Filter{Column: "workflow", Op: OpEq, Value: opts.Workflow})
+	}
+	if opts.Status != "" {
+		if !opts.Status.Valid() {
+			return types.ListExecutionsOutput{}, fmt.Errorf("%w: invalid execution status %q", ErrInvalidArgument, opts.Status)
+		}
+		filters = append(filters, Filter{Column: "status", Op: OpEq, Value: opts.Status})
+	}
+	if opts.ErrorCode != "" {
+		filters = append(filters, Filter{Column: "error_code", Op: OpEq, Value: string(opts.ErrorCode)})
+	}
+	if opts.CreatedAfter != nil {
+		filters = append(filters, Filter{Column: "created_at", Op: OpGt, Value: *opts.CreatedAfter})
+	}
+	if opts.CreatedBefore != nil {
+		filters = append(filters, Filter{Column: "created_at", Op: OpLt, Value: *opts.CreatedBefore})
+	}
+	if len(opts.Labels) > 0 {
+		filters = append(filters, Filter{Column: "labels", Op: OpContains, Value: opts.Labels})
+	}
+	if opts.ReplayOf != "" {
+		filters = append(filters, Filter{Column: "replay_of", Op: OpEq, Value: opts.ReplayOf})
+	}
+	executions, total, err := executionRepository.List(ctx, db, ListOptions{
+		Limit:      limit,
+		Offset:     offset,
+		OrderBy:    opts.OrderBy,
+		Descending: opts.Descending,
+		Filters:    filters,
+	})
+	if err != nil {
+		return types.ListExecutionsOutput{}, err
+	}
+	return types.NewListResponse(executions, total, limit, offset), nil
+}
+
+// DeleteExecutionsFinishedBefore removes executions of every tenant, and their
+// steps, that finished before the cutoff. It deletes in batches so a retention janitor
+// never holds long locks, and returns the number of executions removed.
+func DeleteExecutionsFinishedBefore(ctx context.Context, db DBTX, before time.Time, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	deleted := 0
+	for {
+		var result sql.Result
+		err := withRetry(ctx, db, func() error {
+			var err error
+			result, err = db.ExecContext(ctx,
+				`DELETE FROM workflow_executions
+				WHERE id IN (
+					SELECT id FROM workflow_executions
+					WHERE finished_at < $1
+					ORDER BY finished_at
+					LIMIT $2
+					FOR UPDATE SKIP LOCKED
+				)`,
+				before, batchSize,
+			)
+			return err
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete executions: %w", translateError(err))
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		deleted += int(n)
+		if n < int64(batchSize) {
+			return deleted, nil
+		}
+	}
+}
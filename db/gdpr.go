@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"tala_base/types"
+
+	"github.com/lib/pq"
+)
+
+// ErasedName replaces the name of an anonymized user
+const ErasedName = "Erased user"
+
+// ErasedEmail is the placeholder address an anonymized user is left with.
+// The .invalid TLD is reserved, so it can never reach a real mailbox.
+func ErasedEmail(id int) string {
+	return fmt.Sprintf("erased-%d@example.invalid", id)
+}
+
+// AnonymizeUser scrubs a user's PII while keeping the row and its ID, so
+// records that reference the user stay valid. The user is soft-deleted,
+// suspended, loses their password and metadata, and has every refresh token
+// removed. It returns the anonymized user and the number of tokens removed.
+// This function is called by the gdpr_erase lambda.
+func AnonymizeUser(ctx context.Context, db DBTX, id int) (*types.User, int, error) {
+	var user *types.User
+	var revoked int
+	err := inTx(ctx, db, func(tx DBTX) error {
+		if _, err := lockUser(ctx, tx, id, anyUsers); err != nil {
+			return err
+		}
+		email, hash, err := sealEmail(ErasedEmail(id))
+		if err != nil {
+			return fmt.Errorf("failed to seal email: %w", err)
+		}
+		user, err = scanUser(tx.QueryRowContext(ctx,
+			`UPDATE users
+			SET email = $2, email_hash = $3, name = $4, metadata = '{}', password_hash = NULL,
+				status = $5, deleted_at = COALESCE(deleted_at, NOW()), updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+userColumns,
+			id, email, hash, ErasedName, types.UserStatusSuspended,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to anonymize user: %w", translateError(err))
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE user_id = $1", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete refresh tokens: %w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		revoked = int(n)
+
+		// The before-image holds the PII being erased, so only the result is audited
+		return recordUserAudit(ctx, tx, types.UserAuditErase, nil, user)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return user, revoked, nil
+}
+
+// PurgeResult counts the records whose payloads PurgeUserPayloads cleared
+type PurgeResult struct {
+	AuditEntries int
+	Executions   int
+	Steps        int
+}
+
+// PurgeUserPayloads clears the before and after images of a user's audit
+// entries, and the input, output and error payloads of every workflow
+// execution and step those entries name. The entries themselves are kept, so
+// the audit trail still shows what happened and when. Erase entries hold no
+// PII and are left intact, as are the executions that performed the erasure.
+// Executions that touched the user without writing an audit entry are not found.
+// This function is called by the gdpr_erase lambda.
+func PurgeUserPayloads(ctx context.Context, db DBTX, userID int) (PurgeResult, error) {
+	var purged PurgeResult
+	err := inTx(ctx, db, func(tx DBTX) error {
+		purged = PurgeResult{}
+		tenant := TenantFrom(ctx)
+
+		rows, err := tx.QueryContext(ctx,
+			`SELECT DISTINCT execution_id
+			FROM user_audit
+			WHERE user_id = $1 AND tenant_id = $2 AND action <> $3 AND execution_id IS NOT NULL`,
+			userID, tenant, types.UserAuditErase,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to find user executions: %w", err)
+		}
+		var executionIDs []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan execution ID: %w", err)
+			}
+			executionIDs = append(executionIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating user executions: %w", err)
+		}
+
+		if purged.AuditEntries, err = execCount(ctx, tx,
+			`UPDATE user_audit SET before = NULL, after = NULL
+			WHERE user_id = $1 AND tenant_id = $2 AND action <> $3 AND (before IS NOT NULL OR after IS NOT NULL)`,
+			userID, tenant, types.UserAuditErase,
+		); err != nil {
+			return fmt.Errorf("failed to purge user audit: %w", err)
+		}
+		if len(executionIDs) == 0 {
+			return nil
+		}
+		if purged.Executions, err = execCount(ctx, tx,
+			`UPDATE workflow_executions SET input = NULL, output = NULL, error = NULL, updated_at = NOW()
+			WHERE id = ANY($1) AND tenant_id = $2`,
+			pq.Array(executionIDs), tenant,
+		); err != nil {
+			return fmt.Errorf("failed to purge executions: %w", err)
+		}
+		if purged.Steps, err = execCount(ctx, tx,
+			`UPDATE step_executions SET input = NULL, output = NULL, error = NULL
+			WHERE execution_id = ANY($1) AND tenant_id = $2`,
+			pq.Array(executionIDs), tenant,
+		); err != nil {
+			return fmt.Errorf("failed to purge steps: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return PurgeResult{}, err
+	}
+	return purged, nil
+}
+
+// execCount runs a statement and returns the number of rows it affected
+func execCount(ctx context.Context, db DBTX, query string, args ...interface{}) (int, error) {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(n), nil
+}
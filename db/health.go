@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultPingTimeout bounds a readiness ping so a wedged pool fails the probe instead of hanging it
+const DefaultPingTimeout = 2 * time.Second
+
+// Ping checks that the database answers within timeout, using DefaultPingTimeout when it is zero
+func Ping(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database ping failed: %w", err)
+	}
+	return nil
+}
+
+// PoolStats is a snapshot of connection pool usage for the metrics endpoint
+type PoolStats struct {
+	MaxOpen      int           `json:"max_open"`
+	Open         int           `json:"open"`
+	InUse        int           `json:"in_use"`
+	Idle         int           `json:"idle"`
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration"`
+}
+
+// Stats reports the pool's current usage. A rising WaitCount means callers are
+// queuing for connections and the pool is close to exhaustion.
+func Stats(db *sql.DB) PoolStats {
+	s := db.Stats()
+	return PoolStats{
+		MaxOpen:      s.MaxOpenConnections,
+		Open:         s.OpenConnections,
+		InUse:        s.InUse,
+		Idle:         s.Idle,
+		WaitCount:    s.WaitCount,
+		WaitDuration: s.WaitDuration,
+	}
+}
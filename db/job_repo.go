@@ -0,0 +1,288 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"tala_base/types"
+)
+
+// ErrJobLost is returned when a worker updates a job whose lease it no longer
+// holds, because the lease lapsed and another worker claimed the job
+var ErrJobLost = errors.New("job lease lost")
+
+// jobColumns is the column list every execution_jobs query selects, in scanJob order
+const jobColumns = "execution_id, tenant_id, workflow, step_index, state, attempts, priority, run_at, locked_by, locked_until, last_error"
+
+func scanJob(row rowScanner) (*types.ExecutionJob, error) {
+	var job types.ExecutionJob
+	var state []byte
+	var lockedBy, lastError sql.NullString
+	var lockedUntil sql.NullTime
+	var priority int
+	if err := row.Scan(&job.ExecutionID, &job.TenantID, &job.Workflow, &job.StepIndex, &state, &job.Attempts,
+		&priority, &job.RunAt, &lockedBy, &lockedUntil, &lastError); err != nil {
+		return nil, err
+	}
+	var err error
+	if job.State, err = unpackState(state); err != nil {
+		return nil, err
+	}
+	job.Priority = types.PriorityFromRank(priority)
+	job.LockedBy, job.LastError = lockedBy.String, lastError.String
+	if lockedUntil.Valid {
+		job.LockedUntil = &lockedUntil.Time
+	}
+	return &job, nil
+}
+
+// EnqueueExecution stores a pending execution together with the job that
+// runs it from its first step with the given initial state and priority. An
+// execution with ScheduledFor set is stored as scheduled and its job is not
+// due until then.
+func EnqueueExecution(ctx context.Context, db DBTX, exec types.Execution, state json.RawMessage, priority types.ExecutionPriority) (*types.Execution, error) {
+	exec.Status = types.ExecutionPending
+	runAt := time.Now()
+	if exec.ScheduledFor != nil {
+		exec.Status = types.ExecutionScheduled
+		runAt = *exec.ScheduledFor
+	}
+	packed, err := packState(state)
+	if err != nil {
+		return nil, err
+	}
+	var created *types.Execution
+	err = inTx(ctx, db, func(tx DBTX) error {
+		var err error
+		created, err = CreateExecution(ctx, tx, exec)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO execution_jobs (execution_id, tenant_id, workflow, state, priority, run_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			created.ID, created.TenantID, created.Workflow, packed, priority.Rank(), runAt,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue execution: %w", translateError(err))
+	}
+	return created, nil
+}
+
+// ClaimJob leases the due job of any tenant with the highest priority, oldest
+// first, to worker until the lease runs out, skipping jobs other workers
+// hold. It returns nil when none is due.
+func ClaimJob(ctx context.Context, db DBTX, worker string, lease time.Duration) (*types.ExecutionJob, error) {
+	var job *types.ExecutionJob
+	err := withRetry(ctx, db, func() error {
+		var err error
+		job, err = scanJob(db.QueryRowContext(ctx,
+			`UPDATE execution_jobs
+			SET locked_by = $1, locked_until = NOW() + make_interval(secs => $2), updated_at = NOW()
+			WHERE execution_id = (
+				SELECT execution_id FROM execution_jobs
+				WHERE run_at <= NOW() AND (locked_until IS NULL OR locked_until < NOW())
+				ORDER BY priority DESC, run_at
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING `+jobColumns,
+			worker, lease.Seconds(),
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", translateError(err))
+	}
+	return job, nil
+}
+
+// CountDueJobs returns how many jobs of any tenant are due and waiting for a
+// worker, the depth of the durable queue
+func CountDueJobs(ctx context.Context, db DBTX) (int, error) {
+	var count int
+	err := withRetry(ctx, db, func() error {
+		return db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM execution_jobs
+			WHERE run_at <= NOW() AND (locked_until IS NULL OR locked_until < NOW())`,
+		).Scan(&count)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count due jobs: %w", translateError(err))
+	}
+	return count, nil
+}
+
+// LockJob leases the job of one of the context tenant's executions to worker,
+// whether or not it is due, so the job can be changed outside of a run. It
+// returns ErrConflict while another worker holds the job, and ErrNotFound
+// when the execution has no job because it finished or does not exist.
+func LockJob(ctx context.Context, db DBTX, executionID, worker string, lease time.Duration) (*types.ExecutionJob, error) {
+	var job *types.ExecutionJob
+	err := withRetry(ctx, db, func() error {
+		var err error
+		job, err = scanJob(db.QueryRowContext(ctx,
+			`UPDATE execution_jobs
+			SET locked_by = $3, locked_until = NOW() + make_interval(secs => $4), updated_at = NOW()
+			WHERE execution_id = $1 AND tenant_id = $2 AND (locked_until IS NULL OR locked_until < NOW())
+			RETURNING `+jobColumns,
+			executionID, TenantFrom(ctx), worker, lease.Seconds(),
+		))
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		var held bool
+		if err := db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM execution_jobs WHERE execution_id = $1 AND tenant_id = $2)`,
+			executionID, TenantFrom(ctx),
+		).Scan(&held); err != nil {
+			return err
+		}
+		if held {
+			return fmt.Errorf("%w: execution %s is running a step", ErrConflict, executionID)
+		}
+		return fmt.Errorf("%w: execution %s has no pending step", ErrNotFound, executionID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock job: %w", translateError(err))
+	}
+	return job, nil
+}
+
+// ExtendJobLease keeps a job leased to worker while it runs a long step
+func ExtendJobLease(ctx context.Context, db DBTX, executionID, worker string, lease time.Duration) error {
+	return updateJob(ctx, db, executionID,
+		`UPDATE execution_jobs
+		SET locked_until = NOW() + make_interval(secs => $3), updated_at = NOW()
+		WHERE execution_id = $1 AND locked_by = $2`,
+		executionID, worker, lease.Seconds(),
+	)
+}
+
+// AdvanceJob checkpoints a job after a step completed: the next step to run
+// and the state it starts from. The worker keeps its lease.
+func AdvanceJob(ctx context.Context, db DBTX, executionID, worker string, stepIndex int, state json.RawMessage) error {
+	packed, err := packState(state)
+	if err != nil {
+		return err
+	}
+	return updateJob(ctx, db, executionID,
+		`UPDATE execution_jobs
+		SET step_index = $3, state = $4, attempts = 0, last_error = NULL, updated_at = NOW()
+		WHERE execution_id = $1 AND locked_by = $2`,
+		executionID, worker, stepIndex, packed,
+	)
+}
+
+// RetryJob releases a job whose step failed transiently so any worker runs
+// the step again at runAt, from state
+func RetryJob(ctx context.Context, db DBTX, executionID, worker string, runAt time.Time, state json.RawMessage, lastError string) error {
+	packed, err := packState(state)
+	if err != nil {
+		return err
+	}
+	return updateJob(ctx, db, executionID,
+		`UPDATE execution_jobs
+		SET attempts = attempts + 1, run_at = $3, state = $4, last_error = $5,
+			locked_by = NULL, locked_until = NULL, updated_at = NOW()
+		WHERE execution_id = $1 AND locked_by = $2`,
+		executionID, worker, runAt, packed, lastError,
+	)
+}
+
+// ReleaseJob gives up a job's lease without counting an attempt, so any
+// worker resumes it at runAt, as when the process shuts down between steps
+func ReleaseJob(ctx context.Context, db DBTX, executionID, worker string, runAt time.Time) error {
+	return updateJob(ctx, db, executionID,
+		`UPDATE execution_jobs
+		SET run_at = $3, locked_by = NULL, locked_until = NULL, updated_at = NOW()
+		WHERE execution_id = $1 AND locked_by = $2`,
+		executionID, worker, runAt,
+	)
+}
+
+// CompleteJob removes the job of an execution that finished
+func CompleteJob(ctx context.Context, db DBTX, executionID, worker string) error {
+	return updateJob(ctx, db, executionID,
+		`DELETE FROM execution_jobs WHERE execution_id = $1 AND locked_by = $2`,
+		executionID, worker,
+	)
+}
+
+// updateJob runs a statement guarded by the worker's lease, returning
+// ErrJobLost when it matched no row
+func updateJob(ctx context.Context, db DBTX, executionID string, query string, args ...interface{}) error {
+	var result sql.Result
+	err := withRetry(ctx, db, func() error {
+		var err error
+		result, err = db.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", translateError(err))
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: execution %s", ErrJobLost, executionID)
+	}
+	return nil
+}
+
+// Idempotent applies a side effect at most once per key within the context's
+// tenant. The first call under a key runs fn in a transaction and stores its
+// response with the key; later calls, such as a durable step retried after
+// a crash, return the stored response without running fn again.
+func Idempotent(ctx context.Context, db *sql.DB, key string, fn func(tx *sql.Tx) (json.RawMessage, error)) (json.RawMessage, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: idempotency key is required", ErrInvalidArgument)
+	}
+	var response json.RawMessage
+	err := Retry(ctx, DefaultRetryPolicy, func() error {
+		return WithTx(ctx, db, func(tx *sql.Tx) error {
+			var stored []byte
+			err := tx.QueryRowContext(ctx,
+				`INSERT INTO idempotency_keys (tenant_id, key)
+				VALUES ($1, $2)
+				ON CONFLICT (tenant_id, key) DO UPDATE SET key = EXCLUDED.key
+				RETURNING response`,
+				TenantFrom(ctx), key,
+			).Scan(&stored)
+			if err != nil {
+				return err
+			}
+			if stored != nil {
+				response = stored
+				return nil
+			}
+			response, err = fn(tx)
+			if err != nil {
+				return err
+			}
+			stored = response
+			if stored == nil {
+				stored = []byte("null")
+			}
+			_, err = tx.ExecContext(ctx,
+				`UPDATE idempotency_keys SET response = $3 WHERE tenant_id = $1 AND key = $2`,
+				TenantFrom(ctx), key, string(stored),
+			)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply idempotent effect: %w", translateError(err))
+	}
+	return response, nil
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// lockClassID namespaces the advisory locks taken by TryAdvisoryLock, which
+// use the two-key form so they never collide with migrationLockID
+const lockClassID = 0x74616c61 // "tala"
+
+// TryAdvisoryLock takes a session-level advisory lock on name without
+// waiting. The lock is held on a dedicated connection until release is
+// called, or until that connection dies, so a crashed holder never leaves it
+// stuck. ok is false when another session holds it.
+func TryAdvisoryLock(ctx context.Context, db *sql.DB, name string) (release func(), ok bool, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get connection: %w", err)
+	}
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, hashtext($2))", lockClassID, name).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1, hashtext($2))", lockClassID, name)
+		conn.Close()
+	}, true, nil
+}
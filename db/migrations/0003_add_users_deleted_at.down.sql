@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_email_active_idx;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
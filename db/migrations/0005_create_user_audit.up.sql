@@ -0,0 +1,14 @@
+-- No foreign key to users: audit rows must outlive hard-deleted users
+CREATE TABLE IF NOT EXISTS user_audit (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL,
+    action        TEXT NOT NULL,
+    actor         TEXT,
+    execution_id  TEXT,
+    before        JSONB,
+    after         JSONB,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS user_audit_user_idx ON user_audit (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS user_audit_execution_idx ON user_audit (execution_id) WHERE execution_id IS NOT NULL;
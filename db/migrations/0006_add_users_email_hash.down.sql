@@ -0,0 +1,4 @@
+-- Emails encrypted by the application must be decrypted before reverting
+DROP INDEX IF EXISTS users_email_hash_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active_idx ON users (email) WHERE deleted_at IS NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS email_hash;
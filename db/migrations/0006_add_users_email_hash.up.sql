@@ -0,0 +1,13 @@
+-- Blind index for email lookups once emails are encrypted at rest.
+-- Backfilled with the unkeyed SHA-256 used when no PII keys are configured;
+-- run `tala rotate-pii` after enabling encryption to re-key it.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_hash TEXT;
+
+UPDATE users
+SET email_hash = encode(sha256(convert_to(lower(trim(email)), 'UTF8')), 'hex')
+WHERE email_hash IS NULL;
+
+ALTER TABLE users ALTER COLUMN email_hash SET NOT NULL;
+
+DROP INDEX IF EXISTS users_email_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_hash_active_idx ON users (email_hash) WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_metadata_idx;
+DROP INDEX IF EXISTS users_status_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS metadata, DROP COLUMN IF EXISTS status;
@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+        CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'pending')),
+    ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS users_status_idx ON users (status) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS users_metadata_idx ON users USING GIN (metadata jsonb_path_ops);
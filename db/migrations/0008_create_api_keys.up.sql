@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id            BIGSERIAL PRIMARY KEY,
+    name          TEXT NOT NULL,
+    prefix        TEXT NOT NULL UNIQUE,
+    secret_hash   TEXT NOT NULL,
+    scopes        TEXT[] NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at  TIMESTAMPTZ,
+    revoked_at    TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS step_executions;
+DROP TABLE IF EXISTS workflow_executions;
@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS workflow_executions (
+    id           TEXT PRIMARY KEY,
+    workflow     TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'pending'
+                 CHECK (status IN ('pending', 'running', 'succeeded', 'failed', 'canceled')),
+    input        JSONB,
+    output       JSONB,
+    error_code   TEXT,
+    error        JSONB,
+    attempt      INTEGER NOT NULL DEFAULT 1,
+    labels       JSONB NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMPTZ,
+    finished_at  TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Query API: recent executions of a workflow, optionally by status
+CREATE INDEX IF NOT EXISTS workflow_executions_workflow_idx ON workflow_executions (workflow, created_at DESC);
+CREATE INDEX IF NOT EXISTS workflow_executions_status_idx ON workflow_executions (status, created_at DESC);
+CREATE INDEX IF NOT EXISTS workflow_executions_labels_idx ON workflow_executions USING GIN (labels jsonb_path_ops);
+
+-- Retention janitor: finished executions oldest first
+CREATE INDEX IF NOT EXISTS workflow_executions_finished_idx ON workflow_executions (finished_at)
+    WHERE finished_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS step_executions (
+    id            BIGSERIAL PRIMARY KEY,
+    execution_id  TEXT NOT NULL REFERENCES workflow_executions (id) ON DELETE CASCADE,
+    step_index    INTEGER NOT NULL,
+    step          TEXT NOT NULL,
+    lambda        TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'pending'
+                  CHECK (status IN ('pending', 'running', 'succeeded', 'failed', 'canceled')),
+    input         JSONB,
+    output        JSONB,
+    error_code    TEXT,
+    error         JSONB,
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    started_at    TIMESTAMPTZ,
+    finished_at   TIMESTAMPTZ,
+    UNIQUE (execution_id, step_index)
+);
+
+CREATE INDEX IF NOT EXISTS step_executions_lambda_idx ON step_executions (lambda, started_at DESC);
+CREATE INDEX IF NOT EXISTS step_executions_error_code_idx ON step_executions (error_code)
+    WHERE error_code IS NOT NULL;
@@ -0,0 +1,19 @@
+DROP INDEX IF EXISTS api_keys_tenant_idx;
+
+DROP INDEX IF EXISTS workflow_executions_tenant_status_idx;
+DROP INDEX IF EXISTS workflow_executions_tenant_workflow_idx;
+CREATE INDEX IF NOT EXISTS workflow_executions_status_idx ON workflow_executions (status, created_at DESC);
+CREATE INDEX IF NOT EXISTS workflow_executions_workflow_idx ON workflow_executions (workflow, created_at DESC);
+
+DROP INDEX IF EXISTS user_audit_tenant_user_idx;
+CREATE INDEX IF NOT EXISTS user_audit_user_idx ON user_audit (user_id, created_at DESC);
+
+DROP INDEX IF EXISTS users_tenant_idx;
+DROP INDEX IF EXISTS users_tenant_email_hash_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_hash_active_idx ON users (email_hash) WHERE deleted_at IS NULL;
+
+ALTER TABLE step_executions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE workflow_executions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE user_audit DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
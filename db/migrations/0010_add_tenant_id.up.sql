@@ -0,0 +1,22 @@
+-- Every tenant-owned table gets a tenant_id. Existing rows belong to the
+-- 'default' tenant, which is also used for requests that name no tenant.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE user_audit ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE step_executions ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+-- Emails are unique per tenant, not globally
+DROP INDEX IF EXISTS users_email_hash_active_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_email_hash_active_idx ON users (tenant_id, email_hash) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS users_tenant_idx ON users (tenant_id, id);
+
+DROP INDEX IF EXISTS user_audit_user_idx;
+CREATE INDEX IF NOT EXISTS user_audit_tenant_user_idx ON user_audit (tenant_id, user_id, created_at DESC);
+
+DROP INDEX IF EXISTS workflow_executions_workflow_idx;
+DROP INDEX IF EXISTS workflow_executions_status_idx;
+CREATE INDEX IF NOT EXISTS workflow_executions_tenant_workflow_idx ON workflow_executions (tenant_id, workflow, created_at DESC);
+CREATE INDEX IF NOT EXISTS workflow_executions_tenant_status_idx ON workflow_executions (tenant_id, status, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS api_keys_tenant_idx ON api_keys (tenant_id, id);
@@ -0,0 +1,18 @@
+-- Users registered through auth_register have a bcrypt password hash;
+-- users created by other lambdas have none and cannot log in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+
+-- Refresh tokens are stored hashed and rotated on every use. replaced_by links
+-- a rotated token to its successor so reuse of an old token can be detected.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id           BIGSERIAL PRIMARY KEY,
+    tenant_id    TEXT NOT NULL DEFAULT 'default',
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash   TEXT NOT NULL UNIQUE,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at   TIMESTAMPTZ,
+    replaced_by  BIGINT REFERENCES refresh_tokens (id)
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens (user_id) WHERE revoked_at IS NULL;
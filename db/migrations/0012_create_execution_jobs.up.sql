@@ -0,0 +1,30 @@
+-- Durable executions: one job per execution that has not finished, holding the
+-- workflow state as of its last completed step. Workers claim a job by leasing
+-- it until locked_until; a job whose worker died is claimed again once the
+-- lease lapses and resumes from step_index.
+CREATE TABLE IF NOT EXISTS execution_jobs (
+    execution_id  TEXT PRIMARY KEY REFERENCES workflow_executions (id) ON DELETE CASCADE,
+    tenant_id     TEXT NOT NULL DEFAULT 'default',
+    workflow      TEXT NOT NULL,
+    step_index    INTEGER NOT NULL DEFAULT 0,
+    state         JSONB NOT NULL,
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    run_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_by     TEXT,
+    locked_until  TIMESTAMPTZ,
+    last_error    TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS execution_jobs_run_at_idx ON execution_jobs (run_at);
+
+-- Side effects already applied under an idempotency key, with the response to
+-- replay when the same key arrives again
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    tenant_id   TEXT NOT NULL DEFAULT 'default',
+    key         TEXT NOT NULL,
+    response    JSONB,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, key)
+);
@@ -0,0 +1,23 @@
+-- Events waiting to be relayed to a sink (nats, webhook or kafka). Rows are
+-- written in the same transaction as the state change they announce and
+-- delivered by the outbox relay, at least once, retrying until they succeed.
+CREATE TABLE IF NOT EXISTS outbox (
+    id               BIGSERIAL PRIMARY KEY,
+    tenant_id        TEXT NOT NULL DEFAULT 'default',
+    sink             TEXT NOT NULL,
+    topic            TEXT NOT NULL,
+    payload          JSONB NOT NULL,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error       TEXT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at     TIMESTAMPTZ
+);
+
+-- Relay: undelivered events due for an attempt, oldest first
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (next_attempt_at)
+    WHERE delivered_at IS NULL;
+
+-- Retention: delivered events oldest first
+CREATE INDEX IF NOT EXISTS outbox_delivered_idx ON outbox (delivered_at)
+    WHERE delivered_at IS NOT NULL;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS workflow_executions_tenant_scheduled_idx;
+DELETE FROM execution_jobs WHERE execution_id IN (SELECT id FROM workflow_executions WHERE status = 'scheduled');
+UPDATE workflow_executions SET status = 'canceled', finished_at = NOW() WHERE status = 'scheduled';
+ALTER TABLE workflow_executions DROP COLUMN IF EXISTS scheduled_for;
+ALTER TABLE workflow_executions DROP CONSTRAINT IF EXISTS workflow_executions_status_check;
+ALTER TABLE workflow_executions ADD CONSTRAINT workflow_executions_status_check
+    CHECK (status IN ('pending', 'running', 'succeeded', 'failed', 'canceled'));
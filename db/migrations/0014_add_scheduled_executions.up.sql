@@ -0,0 +1,11 @@
+-- Executions can be scheduled to start later. A scheduled execution waits in
+-- the 'scheduled' status, with its job's run_at set to scheduled_for, until a
+-- durable worker claims it.
+ALTER TABLE workflow_executions DROP CONSTRAINT IF EXISTS workflow_executions_status_check;
+ALTER TABLE workflow_executions ADD CONSTRAINT workflow_executions_status_check
+    CHECK (status IN ('scheduled', 'pending', 'running', 'succeeded', 'failed', 'canceled'));
+ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS scheduled_for TIMESTAMPTZ;
+
+-- Listing pending scheduled runs, soonest first
+CREATE INDEX IF NOT EXISTS workflow_executions_tenant_scheduled_idx ON workflow_executions (tenant_id, scheduled_for)
+    WHERE status = 'scheduled';
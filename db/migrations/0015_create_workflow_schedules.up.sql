@@ -0,0 +1,22 @@
+-- Recurring executions managed through the /schedules API. The scheduler
+-- claims schedules whose next_run_at has passed, queues an execution and
+-- moves next_run_at to the following firing; paused schedules have none.
+CREATE TABLE IF NOT EXISTS workflow_schedules (
+    id                 TEXT PRIMARY KEY,
+    tenant_id          TEXT NOT NULL DEFAULT 'default',
+    workflow           TEXT NOT NULL,
+    cron               TEXT NOT NULL,
+    timezone           TEXT NOT NULL DEFAULT 'UTC',
+    input              JSONB NOT NULL DEFAULT '{}',
+    paused             BOOLEAN NOT NULL DEFAULT FALSE,
+    next_run_at        TIMESTAMPTZ,
+    last_run_at        TIMESTAMPTZ,
+    last_execution_id  TEXT,
+    last_error         TEXT,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS workflow_schedules_tenant_idx ON workflow_schedules (tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS workflow_schedules_due_idx ON workflow_schedules (next_run_at)
+    WHERE NOT paused;
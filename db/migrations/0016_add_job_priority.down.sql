@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS execution_jobs_priority_run_at_idx;
+CREATE INDEX IF NOT EXISTS execution_jobs_run_at_idx ON execution_jobs (run_at);
+ALTER TABLE execution_jobs DROP COLUMN IF EXISTS priority;
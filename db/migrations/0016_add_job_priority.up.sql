@@ -0,0 +1,6 @@
+-- Durable executions have a priority (-1 low, 0 normal, 1 high); workers
+-- claim due jobs of a higher priority first
+ALTER TABLE execution_jobs ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS execution_jobs_run_at_idx;
+CREATE INDEX IF NOT EXISTS execution_jobs_priority_run_at_idx ON execution_jobs (priority DESC, run_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS audit_log_tenant_created_idx;
+DROP INDEX IF EXISTS audit_log_tenant_entity_idx;
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity, entity_id, created_at DESC);
+
+ALTER TABLE audit_log DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,7 @@
+-- audit_log records management actions (schedule, API key and execution
+-- cancel changes); like every other tenant-owned table it is scoped by tenant
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS audit_log_entity_idx;
+CREATE INDEX IF NOT EXISTS audit_log_tenant_entity_idx ON audit_log (tenant_id, entity, entity_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS audit_log_tenant_created_idx ON audit_log (tenant_id, created_at DESC);
@@ -0,0 +1,22 @@
+-- Monthly usage per tenant and API key. api_key_id 0 holds the tenant's
+-- total; rows for a key are counted in addition to it.
+CREATE TABLE IF NOT EXISTS usage_counters (
+    tenant_id   TEXT NOT NULL,
+    api_key_id  BIGINT NOT NULL DEFAULT 0,
+    month       DATE NOT NULL,
+    executions  BIGINT NOT NULL DEFAULT 0,
+    steps       BIGINT NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, month, api_key_id)
+);
+
+-- Monthly quotas of a tenant (api_key_id 0) or one of its API keys. A NULL
+-- limit falls back to the server default for tenants and is unlimited for keys.
+CREATE TABLE IF NOT EXISTS quotas (
+    tenant_id           TEXT NOT NULL,
+    api_key_id          BIGINT NOT NULL DEFAULT 0,
+    monthly_executions  BIGINT,
+    monthly_steps       BIGINT,
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, api_key_id)
+);
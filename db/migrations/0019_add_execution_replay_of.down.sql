@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS workflow_executions_replay_of_idx;
+ALTER TABLE workflow_executions DROP COLUMN IF EXISTS replay_of;
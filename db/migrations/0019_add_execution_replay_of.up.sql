@@ -0,0 +1,6 @@
+-- A replayed execution points at the execution whose input it re-ran
+ALTER TABLE workflow_executions ADD COLUMN IF NOT EXISTS replay_of TEXT
+    REFERENCES workflow_executions (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS workflow_executions_replay_of_idx ON workflow_executions (replay_of)
+    WHERE replay_of IS NOT NULL;
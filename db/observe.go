@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"time"
+)
+
+// QueryObserver is told the operation (select, insert, ...), duration and
+// error of each statement run on a pool opened by Connect. ctx is the
+// statement's context, so observers can attribute queries to a request.
+type QueryObserver func(ctx context.Context, op string, d time.Duration, err error)
+
+// queryObserver is the process-wide observer; nil disables timing
+var queryObserver QueryObserver
+
+// SetQueryObserver installs the observer for statements run on pools opened
+// by Connect. It must be called before Connect.
+func SetQueryObserver(o QueryObserver) {
+	queryObserver = o
+}
+
+// observedConnector wraps the driver's connector so every connection reports query timings
+type observedConnector struct {
+	driver.Connector
+}
+
+func (c observedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &observedConn{conn: conn}, nil
+}
+
+// observedConn forwards to the pq connection, timing ExecContext and QueryContext
+type observedConn struct {
+	conn driver.Conn
+}
+
+func (c *observedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(query)
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c *observedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *observedConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	observe(ctx, query, start, err)
+	return result, err
+}
+
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	observe(ctx, query, start, err)
+	return rows, err
+}
+
+func (c *observedConn) Ping(ctx context.Context) error {
+	return c.conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *observedConn) ResetSession(ctx context.Context) error {
+	return c.conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *observedConn) IsValid() bool {
+	return c.conn.(driver.Validator).IsValid()
+}
+
+func observe(ctx context.Context, query string, start time.Time, err error) {
+	if queryObserver == nil {
+		return
+	}
+	// Expected results like sql.ErrNoRows surface later, at Scan, so err here is a real failure
+	if err == driver.ErrSkip {
+		return
+	}
+	queryObserver(ctx, queryOp(query), time.Since(start), err)
+}
+
+// queryOp returns the lowercased leading keyword of query, keeping metric labels bounded
+func queryOp(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete", "with":
+		return op
+	default:
+		return "other"
+	}
+}
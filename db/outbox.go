@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tala_base/types"
+)
+
+// outboxColumns is the column list every outbox query selects, in scanOutboxEvent order
+const outboxColumns = "id, tenant_id, sink, topic, payload, attempts, last_error, created_at, delivered_at"
+
+func scanOutboxEvent(row rowScanner) (*types.OutboxEvent, error) {
+	var event types.OutboxEvent
+	var payload []byte
+	var lastError sql.NullString
+	var deliveredAt sql.NullTime
+	if err := row.Scan(&event.ID, &event.TenantID, &event.Sink, &event.Topic, &payload, &event.Attempts,
+		&lastError, &event.CreatedAt, &deliveredAt); err != nil {
+		return nil, err
+	}
+	event.Payload = payload
+	event.LastError = lastError.String
+	if deliveredAt.Valid {
+		event.DeliveredAt = &deliveredAt.Time
+	}
+	return &event, nil
+}
+
+// InsertOutboxEvent stores an event for each sink in the context's tenant.
+// Pass the transaction that makes the change the event announces, so the
+// event is stored if and only if the change commits.
+func InsertOutboxEvent(ctx context.Context, db DBTX, sinks []string, topic string, payload json.RawMessage) error {
+	for _, sink := range sinks {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO outbox (tenant_id, sink, topic, payload) VALUES ($1, $2, $3, $4)`,
+			TenantFrom(ctx), sink, topic, string(payload),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store outbox event: %w", translateError(err))
+		}
+	}
+	return nil
+}
+
+// ClaimOutboxEvents returns up to limit undelivered events of every tenant
+// that are due, oldest first, and holds them back from other relays for lease
+func ClaimOutboxEvents(ctx context.Context, db DBTX, limit int, lease time.Duration) ([]*types.OutboxEvent, error) {
+	var events []*types.OutboxEvent
+	err := withRetry(ctx, db, func() error {
+		rows, err := db.QueryContext(ctx,
+			`UPDATE outbox
+			SET next_attempt_at = NOW() + make_interval(secs => $2)
+			WHERE id IN (
+				SELECT id FROM outbox
+				WHERE delivered_at IS NULL AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING `+outboxColumns,
+			limit, lease.Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		events = events[:0]
+		for rows.Next() {
+			event, err := scanOutboxEvent(rows)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", translateError(err))
+	}
+	return events, nil
+}
+
+// MarkOutboxDelivered records that an event reached its sink
+func MarkOutboxDelivered(ctx context.Context, db DBTX, id int64) error {
+	return withRetry(ctx, db, func() error {
+		_, err := db.ExecContext(ctx,
+			`UPDATE outbox SET delivered_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE id = $1`,
+			id,
+		)
+		return err
+	})
+}
+
+// MarkOutboxFailed records a failed delivery and when to try again
+func MarkOutboxFailed(ctx context.Context, db DBTX, id int64, retryAt time.Time, lastError string) error {
+	return withRetry(ctx, db, func() error {
+		_, err := db.ExecContext(ctx,
+			`UPDATE outbox SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3 WHERE id = $1`,
+			id, retryAt, lastError,
+		)
+		return err
+	})
+}
+
+// DeleteOutboxDeliveredBefore removes events of every tenant delivered before
+// the cutoff, returning how many were removed
+func DeleteOutboxDeliveredBefore(ctx context.Context, db DBTX, before time.Time) (int, error) {
+	var result sql.Result
+	err := withRetry(ctx, db, func() error {
+		var err error
+		result, err = db.ExecContext(ctx, `DELETE FROM outbox WHERE delivered_at < $1`, before)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete outbox events: %w", translateError(err))
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(n), nil
+}
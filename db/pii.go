@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks a column value produced by PIICipher.Encrypt.
+// Values without it are treated as legacy plaintext.
+const encryptedPrefix = "enc:v1:"
+
+// PIICipher encrypts sensitive columns with AES-256-GCM and computes keyed
+// blind indexes so encrypted values can still be looked up by equality.
+// Ciphertexts carry the ID of the key that produced them, so old keys can
+// stay configured for decryption while new writes use the active key.
+type PIICipher struct {
+	keys      map[string]cipher.AEAD
+	activeKey string
+	indexKey  []byte
+}
+
+// NewPIICipher creates a cipher from 32-byte keys indexed by key ID.
+// activeKey selects the key used for new encryptions; indexKey keys the blind index HMAC.
+func NewPIICipher(keys map[string][]byte, activeKey string, indexKey []byte) (*PIICipher, error) {
+	if _, ok := keys[activeKey]; !ok {
+		return nil, fmt.Errorf("active PII key %q is not configured", activeKey)
+	}
+	if len(indexKey) < 32 {
+		return nil, fmt.Errorf("PII index key must be at least 32 bytes")
+	}
+
+	c := &PIICipher{
+		keys:      make(map[string]cipher.AEAD, len(keys)),
+		activeKey: activeKey,
+		indexKey:  indexKey,
+	}
+	for id, key := range keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("PII key ID %q must not contain ':'", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("PII key %q must be 32 bytes", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII key %q: %w", id, err)
+		}
+		c.keys[id] = aead
+	}
+	return c, nil
+}
+
+// ParsePIICipher builds a cipher from "id:base64key,id:base64key" (the first
+// key is active) and a base64 blind index key, as stored in PII_KEYS and PII_INDEX_KEY
+func ParsePIICipher(keySpec, indexKey string) (*PIICipher, error) {
+	keys := make(map[string][]byte)
+	var active string
+	for _, entry := range strings.Split(keySpec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid PII key entry %q (expected id:base64key)", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 for PII key %q: %w", id, err)
+		}
+		if active == "" {
+			active = id
+		}
+		keys[id] = key
+	}
+
+	index, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 for PII index key: %w", err)
+	}
+	return NewPIICipher(keys, active, index)
+}
+
+// Encrypt seals plaintext under the active key, bound to the given column
+func (c *PIICipher) Encrypt(column, plaintext string) (string, error) {
+	aead := c.keys[c.activeKey]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return encryptedPrefix + c.activeKey + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt for the same column.
+// Values without the encrypted prefix are returned unchanged.
+func (c *PIICipher) Decrypt(column, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted %s value", column)
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("PII key %q for %s is not configured", id, column)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted %s value", column)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", column, err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value is plaintext or sealed under a non-active key
+func (c *PIICipher) NeedsRotation(value string) bool {
+	return !strings.HasPrefix(value, encryptedPrefix+c.activeKey+":")
+}
+
+// BlindIndex returns a keyed hash of the normalized value for equality lookups
+func (c *PIICipher) BlindIndex(column, value string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(column + ":" + normalizeIndexed(value)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func normalizeIndexed(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// piiCipher is the process-wide cipher installed by Connect; nil leaves PII in plaintext
+var piiCipher *PIICipher
+
+// SetPIICipher installs the cipher used transparently by the user repository.
+// Connect calls it when PII keys are configured.
+func SetPIICipher(c *PIICipher) {
+	piiCipher = c
+}
+
+// PIIEncrypted reports whether sensitive columns are being encrypted
+func PIIEncrypted() bool {
+	return piiCipher != nil
+}
+
+// sealEmail returns the stored form and blind index for an email. Without a
+// cipher the email is stored as-is and indexed with an unkeyed SHA-256, which
+// matches the backfill in migration 0006.
+func sealEmail(email string) (string, string, error) {
+	if piiCipher == nil {
+		return email, emailIndex(email), nil
+	}
+	sealed, err := piiCipher.Encrypt("users.email", email)
+	if err != nil {
+		return "", "", err
+	}
+	return sealed, emailIndex(email), nil
+}
+
+// emailIndex returns the blind index used to look up an email
+func emailIndex(email string) string {
+	if piiCipher == nil {
+		sum := sha256.Sum256([]byte(normalizeIndexed(email)))
+		return hex.EncodeToString(sum[:])
+	}
+	return piiCipher.BlindIndex("users.email", email)
+}
+
+// openEmail returns the plaintext of a stored email
+func openEmail(stored string) (string, error) {
+	if piiCipher == nil {
+		if strings.HasPrefix(stored, encryptedPrefix) {
+			return "", fmt.Errorf("users.email is encrypted but no PII keys are configured")
+		}
+		return stored, nil
+	}
+	return piiCipher.Decrypt("users.email", stored)
+}
+
+// RotateUserEmails re-encrypts emails that are plaintext or sealed under an
+// old key, and recomputes their blind index, in batches. It returns the number
+// of rows rewritten. Run it after adding a new active key or enabling encryption.
+func RotateUserEmails(ctx context.Context, db DBTX, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	rotated := 0
+	lastID := 0
+	for {
+		rows, err := db.QueryContext(ctx,
+			"SELECT id, email FROM users WHERE id > $1 ORDER BY id LIMIT $2",
+			lastID, batchSize,
+		)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to read users for rotation: %w", err)
+		}
+
+		type pending struct {
+			id    int
+			email string
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.email); err != nil {
+				rows.Close()
+				return rotated, fmt.Errorf("failed to scan user: %w", err)
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rotated, fmt.Errorf("error iterating users: %w", err)
+		}
+		if len(batch) == 0 {
+			return rotated, nil
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			email, err := openEmail(p.email)
+			if err != nil {
+				return rotated, fmt.Errorf("user %d: %w", p.id, err)
+			}
+			sealed, hash, err := sealEmail(email)
+			if err != nil {
+				return rotated, fmt.Errorf("user %d: %w", p.id, err)
+			}
+			if piiCipher != nil && !piiCipher.NeedsRotation(p.email) {
+				sealed = p.email
+			}
+			if _, err := db.ExecContext(ctx,
+				"UPDATE users SET email = $1, email_hash = $2 WHERE id = $3",
+				sealed, hash, p.id,
+			); err != nil {
+				return rotated, fmt.Errorf("failed to rotate user %d: %w", p.id, translateError(err))
+			}
+			rotated++
+		}
+	}
+}
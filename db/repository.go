@@ -0,0 +1,334 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FilterOp is a comparison supported by Repository.List filters
+type FilterOp string
+
+const (
+	OpEq     FilterOp = "="
+	OpNotEq  FilterOp = "<>"
+	OpLt     FilterOp = "<"
+	OpLte    FilterOp = "<="
+	OpGt     FilterOp = ">"
+	OpGte    FilterOp = ">="
+	OpPrefix FilterOp = "prefix"
+	// OpContains matches JSONB columns containing Value, which is encoded as JSON
+	OpContains FilterOp = "@>"
+)
+
+// Filter restricts a List query to rows where Column Op Value holds
+type Filter struct {
+	Column string
+	Op     FilterOp
+	Value  interface{}
+}
+
+// ListOptions controls pagination, ordering and filtering for Repository.List
+type ListOptions struct {
+	Limit      int
+	Offset     int
+	OrderBy    string
+	Descending bool
+	Filters    []Filter
+}
+
+// Table describes how an entity type T maps onto a database table.
+// Column names come from code, never from callers; caller-supplied order and
+// filter columns are checked against Sortable and Filterable.
+type Table[T any] struct {
+	// Name is the table name
+	Name string
+	// Key is the primary key column
+	Key string
+	// Columns are selected, in order, for Scan
+	Columns []string
+	// InsertColumns are written, in order, from the values returned by Values
+	InsertColumns []string
+	// Sortable and Filterable whitelist the columns callers may order and filter by
+	Sortable   []string
+	Filterable []string
+	// SoftDelete makes Delete set deleted_at and hides deleted rows from Get and List
+	SoftDelete bool
+	// Tenant scopes every query to the context's tenant_id and makes Create write it
+	Tenant bool
+	// Scan reads one row selected with Columns
+	Scan func(row rowScanner) (*T, error)
+	// Values returns the values for InsertColumns
+	Values func(entity *T) []interface{}
+}
+
+// Repository implements CRUD, pagination and filtering for one table,
+// so a new entity only needs a Table description instead of a hand-written repo
+type Repository[T any] struct {
+	table      Table[T]
+	columns    string
+	sortable   map[string]bool
+	filterable map[string]bool
+}
+
+// Reader is the read side of a Repository, for tables whose writes go
+// through hand-written functions that keep other state, such as encrypted
+// columns and audit records, in step
+type Reader[T any] interface {
+	Get(ctx context.Context, db DBTX, id interface{}) (*T, error)
+	List(ctx context.Context, db DBTX, opts ListOptions) ([]*T, int, error)
+}
+
+// NewRepository creates a repository for the given table description
+func NewRepository[T any](table Table[T]) *Repository[T] {
+	r := &Repository[T]{
+		table:      table,
+		columns:    strings.Join(table.Columns, ", "),
+		sortable:   make(map[string]bool),
+		filterable: make(map[string]bool),
+	}
+	for _, column := range table.Sortable {
+		r.sortable[column] = true
+	}
+	for _, column := range table.Filterable {
+		r.filterable[column] = true
+	}
+	return r
+}
+
+// scope returns the conditions every query on the table applies, hiding
+// soft-deleted rows and other tenants' rows, with args extended by their values
+func (r *Repository[T]) scope(ctx context.Context, args []interface{}) ([]string, []interface{}) {
+	var where []string
+	if r.table.SoftDelete {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if r.table.Tenant {
+		args = append(args, TenantFrom(ctx))
+		where = append(where, fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+	if len(where) == 0 {
+		where = []string{"TRUE"}
+	}
+	return where, args
+}
+
+// Get retrieves one entity by primary key, returning ErrNotFound if it does not exist
+func (r *Repository[T]) Get(ctx context.Context, db DBTX, id interface{}) (*T, error) {
+	where, args := r.scope(ctx, []interface{}{id})
+
+	var entity *T
+	err := withRetry(ctx, db, func() error {
+		var err error
+		entity, err = r.table.Scan(db.QueryRowContext(ctx,
+			fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 AND %s", r.columns, r.table.Name, r.table.Key, strings.Join(where, " AND ")),
+			args...,
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s %v", ErrNotFound, r.table.Name, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", r.table.Name, err)
+	}
+	return entity, nil
+}
+
+// List retrieves one page of entities and the total number matching the filters
+func (r *Repository[T]) List(ctx context.Context, db DBTX, opts ListOptions) ([]*T, int, error) {
+	var entities []*T
+	var total int
+	err := withRetry(ctx, db, func() error {
+		var err error
+		entities, total, err = r.list(ctx, db, opts)
+		return err
+	})
+	return entities, total, err
+}
+
+func (r *Repository[T]) list(ctx context.Context, db DBTX, opts ListOptions) ([]*T, int, error) {
+	orderBy := r.table.Key
+	if opts.OrderBy != "" {
+		if !r.sortable[opts.OrderBy] {
+			return nil, 0, fmt.Errorf("%w: invalid order_by column %s", ErrInvalidArgument, opts.OrderBy)
+		}
+		orderBy = opts.OrderBy
+	}
+	direction := "ASC"
+	if opts.Descending {
+		direction = "DESC"
+	}
+
+	where, args := r.scope(ctx, nil)
+	for _, f := range opts.Filters {
+		if !r.filterable[f.Column] {
+			return nil, 0, fmt.Errorf("%w: invalid filter column %s", ErrInvalidArgument, f.Column)
+		}
+		switch f.Op {
+		case OpEq, OpNotEq, OpLt, OpLte, OpGt, OpGte:
+			args = append(args, f.Value)
+			where = append(where, fmt.Sprintf("%s %s $%d", f.Column, f.Op, len(args)))
+		case OpPrefix:
+			prefix, ok := f.Value.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: prefix filter on %s needs a string", ErrInvalidArgument, f.Column)
+			}
+			args = append(args, likeEscaper.Replace(prefix)+"%")
+			where = append(where, fmt.Sprintf("%s LIKE $%d", f.Column, len(args)))
+		case OpContains:
+			doc, err := json.Marshal(f.Value)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%w: contains filter on %s needs JSON: %v", ErrInvalidArgument, f.Column, err)
+			}
+			args = append(args, string(doc))
+			where = append(where, fmt.Sprintf("%s @> $%d::jsonb", f.Column, len(args)))
+		default:
+			return nil, 0, fmt.Errorf("%w: invalid filter operator %s", ErrInvalidArgument, f.Op)
+		}
+	}
+	whereClause := strings.Join(where, " AND ")
+
+	var total int
+	if err := db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", r.table.Name, whereClause),
+		args...,
+	).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count %s: %w", r.table.Name, err)
+	}
+
+	limit, offset := PageBounds(opts.Limit, opts.Offset)
+	args = append(args, limit, offset)
+	rows, err := db.QueryContext(ctx,
+		fmt.Sprintf(
+			"SELECT %s FROM %s WHERE %s ORDER BY %s %s, %s %s LIMIT $%d OFFSET $%d",
+			r.columns, r.table.Name, whereClause, orderBy, direction, r.table.Key, direction, len(args)-1, len(args),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list %s: %w", r.table.Name, err)
+	}
+	defer rows.Close()
+
+	entities := []*T{}
+	for rows.Next() {
+		entity, err := r.table.Scan(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan %s: %w", r.table.Name, err)
+		}
+		entities = append(entities, entity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating %s: %w", r.table.Name, err)
+	}
+	return entities, total, nil
+}
+
+// Create inserts the entity's InsertColumns and returns the stored row
+func (r *Repository[T]) Create(ctx context.Context, db DBTX, entity *T) (*T, error) {
+	if r.table.Values == nil || len(r.table.InsertColumns) == 0 {
+		return nil, fmt.Errorf("%w: %s is not written through a repository", ErrInvalidArgument, r.table.Name)
+	}
+	columns := r.table.InsertColumns
+	values := r.table.Values(entity)
+	if r.table.Tenant {
+		columns = append(append([]string{}, columns...), "tenant_id")
+		values = append(values, TenantFrom(ctx))
+	}
+	placeholders := make([]string, len(values))
+	for i := range values {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	var created *T
+	err := withRetry(ctx, db, func() error {
+		var err error
+		created, err = r.table.Scan(db.QueryRowContext(ctx,
+			fmt.Sprintf(
+				"INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
+				r.table.Name, strings.Join(columns, ", "), strings.Join(placeholders, ", "), r.columns,
+			),
+			values...,
+		))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", r.table.Name, translateError(err))
+	}
+	return created, nil
+}
+
+// Update sets the given columns, which must be among InsertColumns, and returns the stored row
+func (r *Repository[T]) Update(ctx context.Context, db DBTX, id interface{}, fields map[string]interface{}) (*T, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: no fields to update", ErrInvalidArgument)
+	}
+
+	var sets []string
+	var args []interface{}
+	for _, column := range r.table.InsertColumns {
+		value, ok := fields[column]
+		if !ok {
+			continue
+		}
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if len(sets) != len(fields) {
+		return nil, fmt.Errorf("%w: unknown column in update of %s", ErrInvalidArgument, r.table.Name)
+	}
+	args = append(args, id)
+	keyArg := len(args)
+	where, args := r.scope(ctx, args)
+
+	var updated *T
+	err := withRetry(ctx, db, func() error {
+		var err error
+		updated, err = r.table.Scan(db.QueryRowContext(ctx,
+			fmt.Sprintf(
+				"UPDATE %s SET %s WHERE %s = $%d AND %s RETURNING %s",
+				r.table.Name, strings.Join(sets, ", "), r.table.Key, keyArg, strings.Join(where, " AND "), r.columns,
+			),
+			args...,
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s %v", ErrNotFound, r.table.Name, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", r.table.Name, translateError(err))
+	}
+	return updated, nil
+}
+
+// Delete removes an entity, or marks it deleted when the table uses soft delete
+func (r *Repository[T]) Delete(ctx context.Context, db DBTX, id interface{}) error {
+	where, args := r.scope(ctx, []interface{}{id})
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND %s", r.table.Name, r.table.Key, strings.Join(where, " AND "))
+	if r.table.SoftDelete {
+		query = fmt.Sprintf("UPDATE %s SET deleted_at = NOW() WHERE %s = $1 AND %s", r.table.Name, r.table.Key, strings.Join(where, " AND "))
+	}
+
+	var result sql.Result
+	err := withRetry(ctx, db, func() error {
+		var err error
+		result, err = db.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", r.table.Name, translateError(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s %v", ErrNotFound, r.table.Name, id)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RetryPolicy bounds how often and how quickly transient failures are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used by the repository functions
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// Postgres error codes worth retrying
+const (
+	pqDeadlockDetected = "40P01"
+	pqCannotConnectNow = "57P03"
+)
+
+// IsTransient reports whether err is a failure that is safe and likely to
+// succeed if the whole operation is retried: a serialization failure or
+// deadlock, which rolled the transaction back, or a connection that was bad
+// or refused before the statement was sent. A connection lost while a
+// statement or commit was in flight is not transient, as the write may have
+// been applied and retrying it would apply it twice.
+func IsTransient(err error) bool {
+	var unknown *outcomeUnknownError
+	if err == nil || errors.As(err, &unknown) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqSerializationFailure, pqDeadlockDetected, pqCannotConnectNow:
+			return true
+		}
+	}
+	return false
+}
+
+// outcomeUnknownError marks a failed commit that may have been applied, so
+// it is never retried whatever caused it
+type outcomeUnknownError struct {
+	err error
+}
+
+func (e *outcomeUnknownError) Error() string { return e.err.Error() }
+func (e *outcomeUnknownError) Unwrap() error { return e.err }
+
+// Retry runs fn until it succeeds, returns a non-transient error, exhausts
+// the policy's attempts, or ctx is done. Backoff is exponential with jitter.
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	delay := policy.BaseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !IsTransient(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
+
+// withRetry retries fn under DefaultRetryPolicy when db is a pool. Inside a
+// caller's transaction a failure aborts the whole transaction, so retrying a
+// single statement would be wrong; the caller must retry the transaction instead.
+func withRetry(ctx context.Context, db DBTX, fn func() error) error {
+	if _, ok := db.(*sql.DB); !ok {
+		return fn()
+	}
+	return Retry(ctx, DefaultRetryPolicy, fn)
+}
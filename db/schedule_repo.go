@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tala_base/types"
+
+	"github.com/google/uuid"
+)
+
+// scheduleColumns is the column list every workflow_schedules query selects, in scanSchedule order
+const scheduleColumns = "id, tenant_id, workflow, cron, timezone, input, paused, next_run_at, last_run_at, last_execution_id, last_error, created_at, updated_at"
+
+var scheduleRepository = NewRepository(Table[types.Schedule]{
+	Name:          "workflow_schedules",
+	Key:           "id",
+	Columns:       strings.Split(scheduleColumns, ", "),
+	InsertColumns: []string{"id", "workflow", "cron", "timezone", "input", "paused", "next_run_at"},
+	Sortable:      []string{"created_at", "next_run_at", "last_run_at", "workflow"},
+	Filterable:    []string{"workflow", "paused"},
+	Tenant:        true,
+	Scan:          scanSchedule,
+	Values: func(s *types.Schedule) []interface{} {
+		return []interface{}{s.ID, s.Workflow, s.Cron, s.Timezone, string(s.Input), s.Paused, s.NextRunAt}
+	},
+})
+
+func scanSchedule(row rowScanner) (*types.Schedule, error) {
+	var s types.Schedule
+	var input []byte
+	var nextRun, lastRun sql.NullTime
+	var lastExecution, lastError sql.NullString
+	if err := row.Scan(&s.ID, &s.TenantID, &s.Workflow, &s.Cron, &s.Timezone, &input, &s.Paused, &nextRun, &lastRun,
+		&lastExecution, &lastError, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	s.Input = input
+	s.LastExecutionID, s.LastError = lastExecution.String, lastError.String
+	if nextRun.Valid {
+		s.NextRunAt = &nextRun.Time
+	}
+	if lastRun.Valid {
+		s.LastRunAt = &lastRun.Time
+	}
+	return &s, nil
+}
+
+// CreateSchedule stores a new schedule in the context's tenant, generating its ID
+func CreateSchedule(ctx context.Context, db DBTX, s types.Schedule) (*types.Schedule, error) {
+	if s.Workflow == "" || s.Cron == "" {
+		return nil, fmt.Errorf("%w: workflow and cron are required", ErrInvalidArgument)
+	}
+	s.ID = uuid.NewString()
+	if len(s.Input) == 0 {
+		s.Input = []byte("{}")
+	}
+	var created *types.Schedule
+	err := inTx(ctx, db, func(tx DBTX) error {
+		var err error
+		if created, err = scheduleRepository.Create(ctx, tx, &s); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, types.AuditEntitySchedule, created.ID, types.AuditCreate, nil, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetSchedule retrieves one of the context tenant's schedules
+func GetSchedule(ctx context.Context, db DBTX, id string) (*types.Schedule, error) {
+	return scheduleRepository.Get(ctx, db, id)
+}
+
+// ListSchedules retrieves one page of the context tenant's schedules, oldest
+// first, optionally only those of one workflow
+func ListSchedules(ctx context.Context, db DBTX, page types.PageRequest, workflow string) (types.ListSchedulesOutput, error) {
+	limit, offset, err := PageOptions(page)
+	if err != nil {
+		return types.ListSchedulesOutput{}, err
+	}
+	var filters []Filter
+	if workflow != "" {
+		filters = append(filters, Filter{Column: "workflow", Op: OpEq, Value: workflow})
+	}
+	schedules, total, err := scheduleRepository.List(ctx, db, ListOptions{
+		Limit:   limit,
+		Offset:  offset,
+		OrderBy: "created_at",
+		Filters: filters,
+	})
+	if err != nil {
+		return types.ListSchedulesOutput{}, err
+	}
+	return types.NewListResponse(schedules, total, limit, offset), nil
+}
+
+// UpdateSchedule saves a schedule's cron, timezone, input, paused flag and
+// next run; the run history is left as it is. The change is audited as a
+// pause or resume when it flips the paused flag.
+func UpdateSchedule(ctx context.Context, db DBTX, s types.Schedule) (*types.Schedule, error) {
+	var updated *types.Schedule
+	err := inTx(ctx, db, func(tx DBTX) error {
+		before, err := scanSchedule(tx.QueryRowContext(ctx,
+			`SELECT `+scheduleColumns+` FROM workflow_schedules WHERE id = $1 AND tenant_id = $2 FOR UPDATE`,
+			s.ID, TenantFrom(ctx),
+		))
+		if err != nil {
+			return err
+		}
+		updated, err = scanSchedule(tx.QueryRowContext(ctx,
+			`UPDATE workflow_schedules
+			SET cron = $2, timezone = $3, input = $4, paused = $5, next_run_at = $6, updated_at = NOW()
+			WHERE id = $1 AND tenant_id = $7
+			RETURNING `+scheduleColumns,
+			s.ID, s.Cron, s.Timezone, string(s.Input), s.Paused, s.NextRunAt, TenantFrom(ctx),
+		))
+		if err != nil {
+			return err
+		}
+		action := types.AuditUpdate
+		switch {
+		case updated.Paused && !before.Paused:
+			action = types.AuditPause
+		case !updated.Paused && before.Paused:
+			action = types.AuditResume
+		}
+		return recordAudit(ctx, tx, types.AuditEntitySchedule, s.ID, action, before, updated)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: schedule %s", ErrNotFound, s.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", translateError(err))
+	}
+	return updated, nil
+}
+
+// DeleteSchedule removes one of the context tenant's schedules. Executions it
+// already started are kept.
+func DeleteSchedule(ctx context.Context, db DBTX, id string) error {
+	return inTx(ctx, db, func(tx DBTX) error {
+		before, err := scheduleRepository.Get(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := scheduleRepository.Delete(ctx, tx, id); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, types.AuditEntitySchedule, id, types.AuditDelete, before, nil)
+	})
+}
+
+// ClaimDueSchedules locks up to limit schedules of every tenant that are due
+// to fire, soonest first, skipping those another scheduler holds. tx must be
+// a transaction; the locks last until it ends.
+func ClaimDueSchedules(ctx context.Context, tx DBTX, limit int) ([]*types.Schedule, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+scheduleColumns+`
+		FROM workflow_schedules
+		WHERE NOT paused AND next_run_at <= NOW()
+		ORDER BY next_run_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim schedules: %w", translateError(err))
+	}
+	defer rows.Close()
+
+	var schedules []*types.Schedule
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// RecordScheduleRun records that a schedule fired, starting executionID or
+// failing with lastError, and when it fires next
+func RecordScheduleRun(ctx context.Context, db DBTX, id, executionID, lastError string, nextRunAt *time.Time) error {
+	return withRetry(ctx, db, func() error {
+		_, err := db.ExecContext(ctx,
+			`UPDATE workflow_schedules
+			SET last_run_at = NOW(), last_execution_id = COALESCE($2, last_execution_id), last_error = $3,
+				next_run_at = $4, updated_at = NOW()
+			WHERE id = $1`,
+			id, nullString(executionID), nullString(lastError), nextRunAt,
+		)
+		return err
+	})
+}
@@ -0,0 +1,133 @@
+// Package seed loads YAML or JSON fixtures into the database for demos,
+// local development and integration tests.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tala_base/db"
+	"tala_base/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures is the document format accepted by LoadFile
+type Fixtures struct {
+	Users     []types.CreateUserInput `yaml:"users" json:"users"`
+	Workflows []types.Workflow        `yaml:"workflows" json:"workflows"`
+}
+
+// Options controls where Apply writes non-database fixtures
+type Options struct {
+	// WorkflowDir receives sample workflow definitions; empty skips them
+	WorkflowDir string
+}
+
+// Result counts what Apply created and what already existed
+type Result struct {
+	UsersCreated     int
+	UsersSkipped     int
+	WorkflowsWritten int
+	WorkflowsSkipped int
+}
+
+// LoadFile reads a fixtures file, choosing the decoder from its extension
+func LoadFile(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures %s: %w", path, err)
+	}
+
+	var fixtures Fixtures
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &fixtures)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &fixtures)
+	default:
+		return nil, fmt.Errorf("unsupported fixtures format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures %s: %w", path, err)
+	}
+	return &fixtures, nil
+}
+
+// Apply loads fixtures idempotently: users whose email already exists and
+// workflow files that are already present are skipped rather than overwritten
+func Apply(ctx context.Context, dbConn *sql.DB, fixtures *Fixtures, opts Options) (Result, error) {
+	var result Result
+
+	if len(fixtures.Users) > 0 {
+		err := db.WithTx(ctx, dbConn, func(tx *sql.Tx) error {
+			for start := 0; start < len(fixtures.Users); start += db.MaxBulkCreate {
+				end := min(start+db.MaxBulkCreate, len(fixtures.Users))
+				rows, err := db.CreateUsers(ctx, tx, fixtures.Users[start:end])
+				if err != nil {
+					return err
+				}
+				for _, row := range rows {
+					switch {
+					case row.User != nil:
+						result.UsersCreated++
+					case row.Error == db.ErrDuplicateEmail.Error():
+						result.UsersSkipped++
+					default:
+						return fmt.Errorf("user fixture %d: %s", start+row.Index, row.Error)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to seed users: %w", err)
+		}
+	}
+
+	if opts.WorkflowDir != "" {
+		for _, workflow := range fixtures.Workflows {
+			written, err := writeWorkflow(opts.WorkflowDir, workflow)
+			if err != nil {
+				return result, err
+			}
+			if written {
+				result.WorkflowsWritten++
+			} else {
+				result.WorkflowsSkipped++
+			}
+		}
+	}
+	return result, nil
+}
+
+// writeWorkflow saves a workflow definition unless a file with its name exists
+func writeWorkflow(dir string, workflow types.Workflow) (bool, error) {
+	if workflow.Name == "" || strings.ContainsAny(workflow.Name, `/\`) {
+		return false, fmt.Errorf("invalid workflow fixture name %q", workflow.Name)
+	}
+	workflow.SchemaVersion = types.WorkflowSchemaVersion
+	data, err := yaml.Marshal(workflow)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode workflow %s: %w", workflow.Name, err)
+	}
+
+	path := filepath.Join(dir, workflow.Name+".yaml")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to write workflow %s: %w", workflow.Name, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return false, fmt.Errorf("failed to write workflow %s: %w", workflow.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultTenant owns rows written before tenants existed and any request that names no tenant
+const DefaultTenant = "default"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenantID reports whether id is usable as a tenant ID:
+// lowercase letters, digits, '-' and '_', at most 63 characters
+func ValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+type tenantKey struct{}
+
+// WithTenant scopes ctx to a tenant; every repository function called with the
+// returned context reads and writes only that tenant's rows. An empty ID selects DefaultTenant.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFrom returns the tenant ctx is scoped to, or DefaultTenant
+func TenantFrom(ctx context.Context) string {
+	if id, _ := ctx.Value(tenantKey{}).(string); id != "" {
+		return id
+	}
+	return DefaultTenant
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// DBTX is the subset of *sql.DB and *sql.Tx used by the repository functions,
+// so each of them can run standalone or as part of a larger transaction
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// WithTx runs fn inside a transaction, committing if it returns nil and
+// rolling back if it returns an error or panics
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// Only a serialization failure or deadlock is known to have rolled
+		// the transaction back; after any other failure it may have committed
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || (pqErr.Code != pqSerializationFailure && pqErr.Code != pqDeadlockDetected) {
+			err = &outcomeUnknownError{err: err}
+		}
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// inTx runs fn directly when db is already a transaction, and otherwise
+// opens one so that multi-statement repository functions stay atomic.
+// Transactions it opens itself are retried on transient failures, but not
+// when a commit fails in a way that may have left it applied.
+func inTx(ctx context.Context, db DBTX, fn func(tx DBTX) error) error {
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+	return Retry(ctx, DefaultRetryPolicy, func() error {
+		return WithTx(ctx, sqlDB, func(tx *sql.Tx) error {
+			return fn(tx)
+		})
+	})
+}
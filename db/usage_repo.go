@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tala_base/types"
+
+	"github.com/lib/pq"
+)
+
+// MonthOf returns the first day of t's month in UTC, the month usage at t is counted in
+func MonthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// AddUsage adds executions and steps to the context tenant's usage in month,
+// and to apiKeyID's as well when it is set. It returns the tenant's and the
+// key's usage after the addition; the key's is empty when apiKeyID is 0.
+func AddUsage(ctx context.Context, db DBTX, apiKeyID int64, month time.Time, executions, steps int64) (types.Usage, types.Usage, error) {
+	var tenant, key types.Usage
+	keys := []int64{0}
+	if apiKeyID != 0 {
+		keys = append(keys, apiKeyID)
+	}
+	err := withRetry(ctx, db, func() error {
+		rows, err := db.QueryContext(ctx,
+			`INSERT INTO usage_counters (tenant_id, api_key_id, month, executions, steps)
+			SELECT $1, k, $3, $4, $5 FROM unnest($2::bigint[]) AS k
+			ON CONFLICT (tenant_id, month, api_key_id) DO UPDATE
+			SET executions = usage_counters.executions + EXCLUDED.executions,
+				steps = usage_counters.steps + EXCLUDED.steps,
+				updated_at = NOW()
+			RETURNING tenant_id, api_key_id, month, executions, steps`,
+			TenantFrom(ctx), pq.Array(keys), month, executions, steps,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			usage, err := scanUsage(rows)
+			if err != nil {
+				return err
+			}
+			if usage.APIKeyID == 0 {
+				tenant = *usage
+			} else {
+				key = *usage
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return types.Usage{}, types.Usage{}, fmt.Errorf("failed to add usage: %w", translateError(err))
+	}
+	return tenant, key, nil
+}
+
+func scanUsage(row rowScanner) (*types.Usage, error) {
+	var u types.Usage
+	var month time.Time
+	if err := row.Scan(&u.TenantID, &u.APIKeyID, &month, &u.Executions, &u.Steps); err != nil {
+		return nil, err
+	}
+	u.Month = month.Format("2006-01")
+	return &u, nil
+}
+
+// ListUsage retrieves the context tenant's usage in month: its total, then
+// each of its API keys'
+func ListUsage(ctx context.Context, db DBTX, month time.Time) ([]types.Usage, error) {
+	return listUsage(ctx, db, TenantFrom(ctx), month)
+}
+
+// ListAllUsage retrieves the usage of every tenant in month, ordered by tenant
+func ListAllUsage(ctx context.Context, db DBTX, month time.Time) ([]types.Usage, error) {
+	return listUsage(ctx, db, "", month)
+}
+
+func listUsage(ctx context.Context, db DBTX, tenant string, month time.Time) ([]types.Usage, error) {
+	usage := []types.Usage{}
+	err := withRetry(ctx, db, func() error {
+		usage = usage[:0]
+		rows, err := db.QueryContext(ctx,
+			`SELECT tenant_id, api_key_id, month, executions, steps
+			FROM usage_counters
+			WHERE ($1 = '' OR tenant_id = $1) AND month = $2
+			ORDER BY tenant_id, api_key_id`,
+			tenant, month,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			u, err := scanUsage(rows)
+			if err != nil {
+				return err
+			}
+			usage = append(usage, *u)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	return usage, nil
+}
+
+// quotaColumns is the column list every quotas query selects, in scanQuota order
+const quotaColumns = "tenant_id, api_key_id, monthly_executions, monthly_steps, updated_at"
+
+func scanQuota(row rowScanner) (*types.Quota, error) {
+	var q types.Quota
+	var executions, steps sql.NullInt64
+	if err := row.Scan(&q.TenantID, &q.APIKeyID, &executions, &steps, &q.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if executions.Valid {
+		q.MonthlyExecutions = &executions.Int64
+	}
+	if steps.Valid {
+		q.MonthlySteps = &steps.Int64
+	}
+	return &q, nil
+}
+
+// GetQuota retrieves the quota of the context's tenant (apiKeyID 0) or of one
+// of its API keys, with no limits set when none is stored
+func GetQuota(ctx context.Context, db DBTX, apiKeyID int64) (*types.Quota, error) {
+	var quota *types.Quota
+	err := withRetry(ctx, db, func() error {
+		var err error
+		quota, err = scanQuota(db.QueryRowContext(ctx,
+			`SELECT `+quotaColumns+` FROM quotas WHERE tenant_id = $1 AND api_key_id = $2`,
+			TenantFrom(ctx), apiKeyID,
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.Quota{TenantID: TenantFrom(ctx), APIKeyID: apiKeyID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota: %w", err)
+	}
+	return quota, nil
+}
+
+// ListQuotas retrieves the stored quotas of the context's tenant and its API keys
+func ListQuotas(ctx context.Context, db DBTX) ([]types.Quota, error) {
+	return listQuotas(ctx, db, TenantFrom(ctx))
+}
+
+// ListAllQuotas retrieves the stored quotas of every tenant and API key
+func ListAllQuotas(ctx context.Context, db DBTX) ([]types.Quota, error) {
+	return listQuotas(ctx, db, "")
+}
+
+func listQuotas(ctx context.Context, db DBTX, tenant string) ([]types.Quota, error) {
+	quotas := []types.Quota{}
+	err := withRetry(ctx, db, func() error {
+		quotas = quotas[:0]
+		rows, err := db.QueryContext(ctx,
+			`SELECT `+quotaColumns+` FROM quotas WHERE $1 = '' OR tenant_id = $1 ORDER BY tenant_id, api_key_id`,
+			tenant,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			q, err := scanQuota(rows)
+			if err != nil {
+				return err
+			}
+			quotas = append(quotas, *q)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quotas: %w", err)
+	}
+	return quotas, nil
+}
+
+// SetQuota stores the limits of a quota in the context's tenant, replacing
+// any it had, and audits the change. A key's quota needs the key to exist.
+func SetQuota(ctx context.Context, db DBTX, q types.Quota) (*types.Quota, error) {
+	for _, limit := range []*int64{q.MonthlyExecutions, q.MonthlySteps} {
+		if limit != nil && *limit < 0 {
+			return nil, fmt.Errorf("%w: quota limits must not be negative", ErrInvalidArgument)
+		}
+	}
+
+	var stored *types.Quota
+	err := inTx(ctx, db, func(tx DBTX) error {
+		if q.APIKeyID != 0 {
+			if _, err := apiKeyRepository.Get(ctx, tx, q.APIKeyID); err != nil {
+				return err
+			}
+		}
+		before, err := GetQuota(ctx, tx, q.APIKeyID)
+		if err != nil {
+			return err
+		}
+		stored, err = scanQuota(tx.QueryRowContext(ctx,
+			`INSERT INTO quotas (tenant_id, api_key_id, monthly_executions, monthly_steps)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (tenant_id, api_key_id) DO UPDATE
+			SET monthly_executions = EXCLUDED.monthly_executions,
+				monthly_steps = EXCLUDED.monthly_steps,
+				updated_at = NOW()
+			RETURNING `+quotaColumns,
+			TenantFrom(ctx), q.APIKeyID, q.MonthlyExecutions, q.MonthlySteps,
+		))
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, types.AuditEntityQuota, fmt.Sprint(q.APIKeyID), types.AuditUpdate, before, stored)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set quota: %w", translateError(err))
+	}
+	return stored, nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"tala_base/types"
+
+	"github.com/lib/pq"
+)
+
+// AuditInfo identifies who made a change and which workflow execution it came from
+type AuditInfo struct {
+	Actor       string
+	ExecutionID string
+}
+
+type auditInfoKey struct{}
+
+// WithAuditInfo attaches audit attribution to ctx; mutations made with the
+// returned context record it in their audit entries
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+func auditInfoFrom(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	return info
+}
+
+// recordUserAudit writes one audit entry; before is nil for creates and after is nil for hard deletes
+func recordUserAudit(ctx context.Context, db DBTX, action types.UserAuditAction, before, after *types.User) error {
+	user := after
+	if user == nil {
+		user = before
+	}
+	return recordUserAudits(ctx, db, action, []int{user.ID}, []*types.User{before}, []*types.User{after})
+}
+
+// recordUserAudits writes one audit entry per user with a single INSERT
+func recordUserAudits(ctx context.Context, db DBTX, action types.UserAuditAction, ids []int, befores, afters []*types.User) error {
+	beforeJSON, err := marshalUsers(befores)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshalUsers(afters)
+	if err != nil {
+		return err
+	}
+
+	info := auditInfoFrom(ctx)
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO user_audit (user_id, action, actor, execution_id, before, after, tenant_id)
+		SELECT u.user_id, $2, NULLIF($3, ''), NULLIF($4, ''), u.before::jsonb, u.after::jsonb, $7
+		FROM unnest($1::int[], $5::text[], $6::text[]) AS u(user_id, before, after)`,
+		pq.Array(ids), string(action), info.Actor, info.ExecutionID, pq.Array(beforeJSON), pq.Array(afterJSON), TenantFrom(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record user audit: %w", err)
+	}
+	return nil
+}
+
+// marshalUsers encodes each user as JSON, leaving nil users as SQL NULL.
+// Emails are stored in the same sealed form as the users table.
+func marshalUsers(users []*types.User) ([]sql.NullString, error) {
+	out := make([]sql.NullString, len(users))
+	for i, user := range users {
+		if user == nil {
+			continue
+		}
+		snapshot := *user
+		email, _, err := sealEmail(user.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+		}
+		snapshot.Email = email
+		b, err := json.Marshal(snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+		}
+		out[i] = sql.NullString{String: string(b), Valid: true}
+	}
+	return out, nil
+}
+
+// ListUserAudit retrieves audit entries, newest first, filtered by user and/or execution.
+// This function is called by the user_audit_read lambda.
+func ListUserAudit(ctx context.Context, db DBTX, opts types.ReadUserAuditInput) ([]types.UserAuditEntry, error) {
+	var entries []types.UserAuditEntry
+	err := withRetry(ctx, db, func() error {
+		var err error
+		entries, err = listUserAudit(ctx, db, opts)
+		return err
+	})
+	return entries, err
+}
+
+func listUserAudit(ctx context.Context, db DBTX, opts types.ReadUserAuditInput) ([]types.UserAuditEntry, error) {
+	if opts.UserID == 0 && opts.ExecutionID == "" {
+		return nil, fmt.Errorf("%w: user_id or execution_id is required", ErrInvalidArgument)
+	}
+	limit, offset := PageBounds(opts.Limit, opts.Offset)
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, user_id, action, COALESCE(actor, ''), COALESCE(execution_id, ''), before, after, created_at
+		FROM user_audit
+		WHERE tenant_id = $5 AND ($1 = 0 OR user_id = $1) AND ($2 = '' OR execution_id = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4`,
+		opts.UserID, opts.ExecutionID, limit, offset, TenantFrom(ctx),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user audit: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []types.UserAuditEntry{}
+	for rows.Next() {
+		var entry types.UserAuditEntry
+		var before, after []byte
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.Actor, &entry.ExecutionID, &before, &after, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user audit: %w", err)
+		}
+		if entry.Before, err = openSnapshot(before); err != nil {
+			return nil, err
+		}
+		if entry.After, err = openSnapshot(after); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user audit: %w", err)
+	}
+	return entries, nil
+}
+
+// openSnapshot decrypts the email inside a stored audit snapshot
+func openSnapshot(raw []byte) (json.RawMessage, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var user types.User
+	if err := json.Unmarshal(raw, &user); err != nil {
+		return nil, fmt.Errorf("failed to decode audit snapshot: %w", err)
+	}
+	email, err := openEmail(user.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audit snapshot: %w", err)
+	}
+	user.Email = email
+	return json.Marshal(user)
+}
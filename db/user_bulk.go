@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"tala_base/types"
+
+	"github.com/lib/pq"
+)
+
+// MaxBulkCreate is the largest batch CreateUsers accepts in one call
+const MaxBulkCreate = 1000
+
+// CreateUsers inserts a batch of users with a single multi-row INSERT.
+// This function is called by the user_bulk_create lambda for import workflows.
+// Rows that are invalid or whose email is already taken are skipped and reported
+// in their result entry; the returned slice has one result per input, in order.
+func CreateUsers(ctx context.Context, db DBTX, inputs []types.CreateUserInput) ([]types.BulkCreateUserResult, error) {
+	if len(inputs) > MaxBulkCreate {
+		return nil, fmt.Errorf("%w: batch of %d exceeds limit of %d", ErrInvalidArgument, len(inputs), MaxBulkCreate)
+	}
+
+	results := make([]types.BulkCreateUserResult, len(inputs))
+	// pending maps each email's blind index to its input row
+	pending := make(map[string]int, len(inputs))
+	var emails, hashes, names, statuses, metadata []string
+	for i, input := range inputs {
+		results[i].Index = i
+		switch {
+		case strings.TrimSpace(input.Email) == "":
+			results[i].Error = "email is required"
+		case strings.TrimSpace(input.Name) == "":
+			results[i].Error = "name is required"
+		default:
+			status, err := userStatus(input.Status)
+			if err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			doc, err := encodeMetadata(input.Metadata)
+			if err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			email, emailHash, err := sealEmail(input.Email)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create users: %w", err)
+			}
+			if _, dup := pending[emailHash]; dup {
+				results[i].Error = ErrDuplicateEmail.Error()
+				continue
+			}
+			pending[emailHash] = i
+			emails = append(emails, email)
+			hashes = append(hashes, emailHash)
+			names = append(names, input.Name)
+			statuses = append(statuses, string(status))
+			metadata = append(metadata, doc)
+		}
+	}
+	if len(emails) == 0 {
+		return results, nil
+	}
+
+	err := inTx(ctx, db, func(tx DBTX) error {
+		rows, err := tx.QueryContext(ctx,
+			`INSERT INTO users (email, email_hash, name, status, metadata, tenant_id)
+			SELECT e, h, n, s, m::jsonb, $6
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[]) AS t(e, h, n, s, m)
+			ON CONFLICT (tenant_id, email_hash) WHERE deleted_at IS NULL DO NOTHING
+			RETURNING `+userColumns,
+			pq.Array(emails), pq.Array(hashes), pq.Array(names), pq.Array(statuses), pq.Array(metadata), TenantFrom(ctx),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create users: %w", translateError(err))
+		}
+		defer rows.Close()
+
+		var ids []int
+		var created []*types.User
+		for rows.Next() {
+			user, err := scanUser(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan user: %w", err)
+			}
+			emailHash := emailIndex(user.Email)
+			i := pending[emailHash]
+			results[i].User = user
+			delete(pending, emailHash)
+			ids = append(ids, user.ID)
+			created = append(created, user)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating users: %w", err)
+		}
+		if len(created) == 0 {
+			return nil
+		}
+		return recordUserAudits(ctx, tx, types.UserAuditCreate, ids, make([]*types.User, len(created)), created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Anything not returned was skipped by ON CONFLICT
+	for _, i := range pending {
+		results[i].Error = ErrDuplicateEmail.Error()
+	}
+	return results, nil
+}
@@ -1,112 +1,396 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"tala_base/types"
 )
 
+// userColumns is the column list every user query selects, in scanUser order
+const userColumns = "id, tenant_id, email, name, status, metadata, created_at, updated_at, deleted_at"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads one row selected with userColumns into a User
+func scanUser(row rowScanner) (*types.User, error) {
+	var user types.User
+	var deletedAt sql.NullTime
+	var email string
+	var metadata []byte
+	if err := row.Scan(&user.ID, &user.TenantID, &email, &user.Name, &user.Status, &metadata, &user.CreatedAt, &user.UpdatedAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	email, err := openEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	user.Email = email
+	if err := json.Unmarshal(metadata, &user.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode user metadata: %w", err)
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return &user, nil
+}
+
+// userStatus validates a requested status, defaulting an empty one to active
+func userStatus(status types.UserStatus) (types.UserStatus, error) {
+	if status == "" {
+		return types.UserStatusActive, nil
+	}
+	if !status.Valid() {
+		return "", fmt.Errorf("%w: invalid user status %q", ErrInvalidArgument, status)
+	}
+	return status, nil
+}
+
+// encodeMetadata encodes user metadata for a JSONB column, storing nil as an empty object
+func encodeMetadata(metadata map[string]interface{}) (string, error) {
+	if metadata == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("%w: metadata is not valid JSON: %v", ErrInvalidArgument, err)
+	}
+	return string(b), nil
+}
+
 // CreateUser creates a new user in the database.
 // This function is called by the user_create lambda to persist user data.
 // It returns the created user with its ID and timestamps.
-func CreateUser(db *sql.DB, input types.CreateUserInput) (*types.User, error) {
-	var user types.User
-	err := db.QueryRow(
-		`INSERT INTO users (email, name) 
-		VALUES ($1, $2) 
-		RETURNING id, email, name, created_at, updated_at`,
-		input.Email, input.Name,
-	).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+func CreateUser(ctx context.Context, db DBTX, input types.CreateUserInput) (*types.User, error) {
+	status, err := userStatus(input.Status)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := encodeMetadata(input.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	email, emailHash, err := sealEmail(input.Email)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
-	return &user, nil
+
+	var user *types.User
+	err = inTx(ctx, db, func(tx DBTX) error {
+		var err error
+		user, err = scanUser(tx.QueryRowContext(ctx,
+			`INSERT INTO users (email, email_hash, name, status, metadata, tenant_id)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING `+userColumns,
+			email, emailHash, input.Name, status, metadata, TenantFrom(ctx),
+		))
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", translateError(err))
+		}
+		return recordUserAudit(ctx, tx, types.UserAuditCreate, nil, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 // GetUserByID retrieves a user by their ID.
 // This function is called by the user_read lambda to fetch user details.
-// It returns a user if found, or an error if not found or on database error.
-func GetUserByID(db *sql.DB, id int) (*types.User, error) {
-	var user types.User
-	err := db.QueryRow(
-		`SELECT id, email, name, created_at, updated_at 
-		FROM users 
-		WHERE id = $1`,
-		id,
-	).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found: %d", id)
+// It returns a user if found, or an error if not found, soft-deleted, or on database error.
+func GetUserByID(ctx context.Context, db DBTX, id int) (*types.User, error) {
+	var user *types.User
+	err := withRetry(ctx, db, func() error {
+		var err error
+		user, err = scanUser(db.QueryRowContext(ctx,
+			`SELECT `+userColumns+`
+			FROM users
+			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`,
+			id, TenantFrom(ctx),
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user %d", ErrNotFound, id)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-	return &user, nil
+	return user, nil
 }
 
-// ListUsers retrieves all users from the database.
-// This function is called by the user_list lambda to fetch all users.
-// It returns a slice of users, or an error if the database query fails.
-func ListUsers(db *sql.DB) ([]*types.User, error) {
-	rows, err := db.Query(
-		`SELECT id, email, name, created_at, updated_at 
-		FROM users 
-		ORDER BY id`,
-	)
+// GetUserByEmail retrieves an active user by email using the blind index,
+// so it works whether or not emails are encrypted at rest.
+func GetUserByEmail(ctx context.Context, db DBTX, email string) (*types.User, error) {
+	var user *types.User
+	err := withRetry(ctx, db, func() error {
+		var err error
+		user, err = scanUser(db.QueryRowContext(ctx,
+			`SELECT `+userColumns+`
+			FROM users
+			WHERE email_hash = $1 AND tenant_id = $2 AND deleted_at IS NULL`,
+			emailIndex(email), TenantFrom(ctx),
+		))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user with email", ErrNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-	defer rows.Close()
+	return user, nil
+}
+
+// Defaults and bounds applied to list pagination
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// userRepository provides the generic list query over users. It is read-only:
+// writes go through CreateUser, UpdateUser and DeleteUser, which handle email
+// encryption, the blind index and auditing.
+var userRepository Reader[types.User] = NewRepository(Table[types.User]{
+	Name:       "users",
+	Key:        "id",
+	Columns:    strings.Split(userColumns, ", "),
+	Sortable:   []string{"id", "email", "name", "status", "created_at", "updated_at"},
+	Filterable: []string{"email", "email_hash", "status", "metadata", "created_at"},
+	SoftDelete: true,
+	Tenant:     true,
+	Scan:       scanUser,
+})
 
-	var users []*types.User
-	for rows.Next() {
-		var user types.User
-		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
+// ListUsers retrieves one page of users that have not been soft-deleted.
+// This function is called by the user_list lambda to page through users.
+// It returns the page, the total number of users matching the filters and the next page's cursor.
+func ListUsers(ctx context.Context, db DBTX, opts types.ListUsersInput) (types.ListUsersOutput, error) {
+	limit, offset, err := PageOptions(opts.PageRequest)
+	if err != nil {
+		return types.ListUsersOutput{}, err
+	}
+	var filters []Filter
+	if opts.Email != "" {
+		filters = append(filters, Filter{Column: "email_hash", Op: OpEq, Value: emailIndex(opts.Email)})
+	}
+	if opts.EmailPrefix != "" {
+		if PIIEncrypted() {
+			return types.ListUsersOutput{}, fmt.Errorf("%w: email_prefix is unavailable while emails are encrypted; filter by exact email", ErrInvalidArgument)
 		}
-		users = append(users, &user)
+		filters = append(filters, Filter{Column: "email", Op: OpPrefix, Value: opts.EmailPrefix})
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating users: %w", err)
+	if opts.OrderBy == "email" && PIIEncrypted() {
+		return types.ListUsersOutput{}, fmt.Errorf("%w: order_by email is unavailable while emails are encrypted", ErrInvalidArgument)
 	}
-	return users, nil
+	if opts.CreatedAfter != nil {
+		filters = append(filters, Filter{Column: "created_at", Op: OpGt, Value: *opts.CreatedAfter})
+	}
+	if opts.Status != "" {
+		if !opts.Status.Valid() {
+			return types.ListUsersOutput{}, fmt.Errorf("%w: invalid user status %q", ErrInvalidArgument, opts.Status)
+		}
+		filters = append(filters, Filter{Column: "status", Op: OpEq, Value: opts.Status})
+	}
+	if opts.Metadata != nil {
+		filters = append(filters, Filter{Column: "metadata", Op: OpContains, Value: opts.Metadata})
+	}
+	users, total, err := userRepository.List(ctx, db, ListOptions{
+		Limit:      limit,
+		Offset:     offset,
+		OrderBy:    opts.OrderBy,
+		Descending: opts.Descending,
+		Filters:    filters,
+	})
+	if err != nil {
+		return types.ListUsersOutput{}, err
+	}
+	return types.NewListResponse(users, total, limit, offset), nil
+}
+
+// likeEscaper escapes LIKE wildcards so user input only matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// PageBounds clamps a requested limit and offset to the allowed range
+func PageBounds(limit, offset int) (int, int) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// PageOptions decodes a page request into the clamped limit and offset of a List query
+func PageOptions(page types.PageRequest) (int, int, error) {
+	offset, err := page.Offset()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	limit, offset := PageBounds(page.Limit, offset)
+	return limit, offset, nil
 }
 
-// UpdateUser updates an existing user's information.
+// UpdateUser updates the provided fields of an existing user.
 // This function is called by the user_update lambda to modify user data.
-// It returns the updated user with new timestamps.
-func UpdateUser(db *sql.DB, id int, input types.UpdateUserInput) (*types.User, error) {
-	var user types.User
-	err := db.QueryRow(
-		`UPDATE users 
-		SET email = $1, name = $2 
-		WHERE id = $3 
-		RETURNING id, email, name, created_at, updated_at`,
-		input.Email, input.Name, id,
-	).Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found: %d", id)
+// Fields left nil in the input are not changed. It returns the updated user with new timestamps.
+func UpdateUser(ctx context.Context, db DBTX, id int, input types.UpdateUserInput) (*types.User, error) {
+	var sets []string
+	var args []interface{}
+	if input.Email != nil {
+		email, emailHash, err := sealEmail(*input.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		args = append(args, email, emailHash)
+		sets = append(sets, fmt.Sprintf("email = $%d, email_hash = $%d", len(args)-1, len(args)))
+	}
+	if input.Name != nil {
+		args = append(args, *input.Name)
+		sets = append(sets, fmt.Sprintf("name = $%d", len(args)))
+	}
+	if input.Status != nil {
+		if !input.Status.Valid() {
+			return nil, fmt.Errorf("%w: invalid user status %q", ErrInvalidArgument, *input.Status)
+		}
+		args = append(args, *input.Status)
+		sets = append(sets, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if input.Metadata != nil {
+		metadata, err := encodeMetadata(input.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, metadata)
+		sets = append(sets, fmt.Sprintf("metadata = $%d", len(args)))
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("%w: no fields to update", ErrInvalidArgument)
 	}
+	sets = append(sets, "updated_at = NOW()")
+	args = append(args, id)
+
+	var user *types.User
+	err := inTx(ctx, db, func(tx DBTX) error {
+		before, err := lockUser(ctx, tx, id, activeUsers)
+		if err != nil {
+			return err
+		}
+		user, err = scanUser(tx.QueryRowContext(ctx,
+			fmt.Sprintf(
+				`UPDATE users
+				SET %s
+				WHERE id = $%d
+				RETURNING %s`,
+				strings.Join(sets, ", "), len(args), userColumns,
+			),
+			args...,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", translateError(err))
+		}
+		return recordUserAudit(ctx, tx, types.UserAuditUpdate, before, user)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
-// DeleteUser removes a user from the database.
+// DeleteUser soft-deletes a user by setting deleted_at.
 // This function is called by the user_delete lambda to remove a user.
-// It returns an error if the user is not found or if the deletion fails.
-func DeleteUser(db *sql.DB, id int) error {
-	result, err := db.Exec("DELETE FROM users WHERE id = $1", id)
+// It returns an error if the user is not found, already deleted, or if the deletion fails.
+func DeleteUser(ctx context.Context, db DBTX, id int) error {
+	return inTx(ctx, db, func(tx DBTX) error {
+		before, err := lockUser(ctx, tx, id, activeUsers)
+		if err != nil {
+			return err
+		}
+		after, err := scanUser(tx.QueryRowContext(ctx,
+			"UPDATE users SET deleted_at = NOW() WHERE id = $1 RETURNING "+userColumns,
+			id,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", translateError(err))
+		}
+		return recordUserAudit(ctx, tx, types.UserAuditDelete, before, after)
+	})
+}
+
+// HardDeleteUser permanently removes a user row, whether or not it was soft-deleted.
+// This function is called by the user_delete lambda when a hard delete is requested.
+func HardDeleteUser(ctx context.Context, db DBTX, id int) error {
+	return inTx(ctx, db, func(tx DBTX) error {
+		before, err := lockUser(ctx, tx, id, anyUsers)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id); err != nil {
+			return fmt.Errorf("failed to delete user: %w", translateError(err))
+		}
+		return recordUserAudit(ctx, tx, types.UserAuditHardDelete, before, nil)
+	})
+}
+
+// RestoreUser clears deleted_at on a soft-deleted user.
+// This function is called by the user_delete lambda's restore path.
+// It returns the restored user, or an error if no soft-deleted user has that ID.
+func RestoreUser(ctx context.Context, db DBTX, id int) (*types.User, error) {
+	var user *types.User
+	err := inTx(ctx, db, func(tx DBTX) error {
+		before, err := lockUser(ctx, tx, id, deletedUsers)
+		if err != nil {
+			return err
+		}
+		user, err = scanUser(tx.QueryRowContext(ctx,
+			"UPDATE users SET deleted_at = NULL WHERE id = $1 RETURNING "+userColumns,
+			id,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to restore user: %w", translateError(err))
+		}
+		return recordUserAudit(ctx, tx, types.UserAuditRestore, before, user)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+		return nil, err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+	return user, nil
+}
+
+// Row filters for lockUser
+const (
+	activeUsers  = "deleted_at IS NULL"
+	deletedUsers = "deleted_at IS NOT NULL"
+	anyUsers     = "TRUE"
+)
+
+// lockUser selects a user of the context's tenant FOR UPDATE so its before-image
+// can be audited. It must be called inside a transaction; statements that follow
+// may then address the row by ID alone.
+func lockUser(ctx context.Context, tx DBTX, id int, filter string) (*types.User, error) {
+	user, err := scanUser(tx.QueryRowContext(ctx,
+		`SELECT `+userColumns+`
+		FROM users
+		WHERE id = $1 AND tenant_id = $2 AND `+filter+`
+		FOR UPDATE`,
+		id, TenantFrom(ctx),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user %d", ErrNotFound, id)
 	}
-	if rows == 0 {
-		return fmt.Errorf("user not found: %d", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-	return nil
+	return user, nil
 }
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"tala_base/types"
+)
+
+// DefaultSearchLimit is the number of results SearchUsers returns when no limit is given
+const DefaultSearchLimit = 20
+
+// SearchOptions controls how SearchUsers matches and limits results
+type SearchOptions struct {
+	Limit         int
+	MinSimilarity float64
+}
+
+// rankedRow appends a rank column to the destinations scanned by scanUser
+type rankedRow struct {
+	rowScanner
+	rank *float64
+}
+
+func (r rankedRow) Scan(dest ...interface{}) error {
+	return r.rowScanner.Scan(append(dest, r.rank)...)
+}
+
+// SearchUsers finds users whose name or email contains or closely resembles query.
+// This function is called by the user_search lambda.
+// Matches use pg_trgm similarity and ILIKE, and are returned best match first.
+// While emails are encrypted at rest only exact email matches are found.
+func SearchUsers(ctx context.Context, db DBTX, query string, opts SearchOptions) ([]types.UserSearchResult, error) {
+	var results []types.UserSearchResult
+	err := withRetry(ctx, db, func() error {
+		var err error
+		results, err = searchUsers(ctx, db, query, opts)
+		return err
+	})
+	return results, err
+}
+
+func searchUsers(ctx context.Context, db DBTX, query string, opts SearchOptions) ([]types.UserSearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: search query is empty", ErrInvalidArgument)
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	// An exact email match through the blind index always ranks first
+	emailRank := "similarity(email, $1)"
+	emailMatch := "email ILIKE $2 OR email % $1"
+	if PIIEncrypted() {
+		emailRank = "0"
+		emailMatch = "FALSE"
+	}
+	rank := fmt.Sprintf("CASE WHEN email_hash = $5 THEN 1 ELSE GREATEST(similarity(name, $1), %s) END", emailRank)
+
+	rows, err := db.QueryContext(ctx,
+		fmt.Sprintf(
+			`SELECT %s, %s AS rank
+			FROM users
+			WHERE deleted_at IS NULL AND tenant_id = $6
+				AND (name ILIKE $2 OR name %% $1 OR email_hash = $5 OR %s)
+				AND %s >= $3
+			ORDER BY rank DESC, id
+			LIMIT $4`,
+			userColumns, rank, emailMatch, rank,
+		),
+		query, "%"+likeEscaper.Replace(query)+"%", opts.MinSimilarity, limit, emailIndex(query), TenantFrom(ctx),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	results := []types.UserSearchResult{}
+	for rows.Next() {
+		var rank float64
+		user, err := scanUser(rankedRow{rows, &rank})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		results = append(results, types.UserSearchResult{User: *user, Rank: rank})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+	return results, nil
+}
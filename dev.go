@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"tala_base/lambdas"
+	"tala_base/logging"
+	"tala_base/orchestrator"
+)
+
+// orchestratorProcess is the name the dev loop gives the server process
+const orchestratorProcess = "orchestrator"
+
+// devWatchExtensions are the source files whose changes trigger a rebuild
+var devWatchExtensions = map[string]bool{
+	".go":   true,
+	".mod":  true,
+	".sum":  true,
+	".sql":  true,
+	".tmpl": true,
+	".yaml": true,
+}
+
+// runDev implements the `tala dev [-port n] [-interval d]` command. It builds
+// and runs every lambda on its default port plus the orchestrator, then polls
+// the source tree and rebuilds and restarts only the processes a change affects.
+func runDev(args []string) error {
+	flags := flag.NewFlagSet("dev", flag.ContinueOnError)
+	port := flags.String("port", "8000", "port the orchestrator listens on")
+	interval := flags.Duration("interval", 500*time.Millisecond, "how often to check for changed files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	binDir, err := os.MkdirTemp("", "tala-dev-")
+	if err != nil {
+		return fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(binDir)
+
+	d := &devLoop{
+		lambdaBinary: filepath.Join(binDir, "lambda"),
+		serverBinary: filepath.Join(binDir, "tala"),
+		procs:        make(map[string]*devProcess),
+		logger:       logging.Component("dev"),
+	}
+	for _, l := range lambdas.All {
+		lambdaPort, ok := orchestrator.DefaultLambdaPorts[l.Name]
+		if !ok {
+			return fmt.Errorf("lambda %s has no port in orchestrator.DefaultLambdaPorts", l.Name)
+		}
+		d.order = append(d.order, l.Name)
+		d.procs[l.Name] = &devProcess{
+			name:   l.Name,
+			binary: d.lambdaBinary,
+			args:   []string{l.Name},
+			env:    []string{fmt.Sprintf("PORT=%d", lambdaPort)},
+		}
+	}
+	d.order = append(d.order, orchestratorProcess)
+	d.procs[orchestratorProcess] = &devProcess{
+		name:   orchestratorProcess,
+		binary: d.serverBinary,
+		env:    []string{"PORT=" + *port},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	snapshot, err := scanSources(".")
+	if err != nil {
+		return err
+	}
+	if err := d.build(d.order); err != nil {
+		return err
+	}
+	d.restart(d.order)
+	d.logger.Info("Watching for changes", "orchestrator", "http://localhost:"+*port)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("Stopping")
+			d.stopAll()
+			return nil
+		case <-ticker.C:
+		}
+
+		next, err := scanSources(".")
+		if err != nil {
+			d.logger.Warn("Failed to scan sources", "error", err)
+			continue
+		}
+		changed := changedFiles(snapshot, next)
+		snapshot = next
+		if len(changed) == 0 {
+			continue
+		}
+
+		targets := d.affected(changed)
+		d.logger.Info("Sources changed; restarting", "changed", changed, "restarting", targets)
+		if err := d.build(targets); err != nil {
+			// Keep the previous processes running until the tree builds again
+			d.logger.Error("Build failed", "error", err)
+			continue
+		}
+		d.restart(targets)
+	}
+}
+
+// devLoop owns the binaries and child processes of a `tala dev` session
+type devLoop struct {
+	lambdaBinary string
+	serverBinary string
+	order        []string
+	procs        map[string]*devProcess
+	logger       *slog.Logger
+}
+
+// affected maps changed files onto the processes that must restart. A file
+// under lambdas/<name>/ only affects that lambda, the orchestrator's own code
+// and workflows only affect the orchestrator, and anything else is shared.
+func (d *devLoop) affected(changed []string) []string {
+	want := make(map[string]bool)
+	for _, file := range changed {
+		parts := strings.Split(filepath.ToSlash(file), "/")
+		switch {
+		case len(parts) > 2 && parts[0] == "lambdas" && d.procs[parts[1]] != nil:
+			want[parts[1]] = true
+		case len(parts) == 1 && filepath.Ext(file) == ".go",
+			parts[0] == "orchestrator", parts[0] == "workflows":
+			want[orchestratorProcess] = true
+		case parts[0] == "lambdas", parts[0] == "lambdasdk", len(parts) > 1 && parts[0] == "cmd" && parts[1] == "lambda":
+			for _, name := range d.order {
+				if name != orchestratorProcess {
+					want[name] = true
+				}
+			}
+		default:
+			for _, name := range d.order {
+				want[name] = true
+			}
+		}
+	}
+
+	var targets []string
+	for _, name := range d.order {
+		if want[name] {
+			targets = append(targets, name)
+		}
+	}
+	return targets
+}
+
+// build compiles the binaries the given processes run
+func (d *devLoop) build(targets []string) error {
+	lambdaBuilt, serverBuilt := false, false
+	for _, name := range targets {
+		if name == orchestratorProcess {
+			if !serverBuilt {
+				if err := goBuild(d.serverBinary, "."); err != nil {
+					return err
+				}
+				serverBuilt = true
+			}
+		} else if !lambdaBuilt {
+			if err := goBuild(d.lambdaBinary, "./cmd/lambda"); err != nil {
+				return err
+			}
+			lambdaBuilt = true
+		}
+	}
+	return nil
+}
+
+// restart stops and starts each of the given processes
+func (d *devLoop) restart(targets []string) {
+	for _, name := range targets {
+		p := d.procs[name]
+		p.stop()
+		if err := p.start(d.logger); err != nil {
+			d.logger.Error("Failed to start process", "process", name, "error", err)
+		}
+	}
+}
+
+// stopAll stops every running process
+func (d *devLoop) stopAll() {
+	for _, name := range d.order {
+		d.procs[name].stop()
+	}
+}
+
+// goBuild builds pkg into output, returning the compiler output on failure
+func goBuild(output, pkg string) error {
+	cmd := exec.Command("go", "build", "-o", output, pkg)
+	var stderr bytes.Buffer
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build %s: %w\n%s", pkg, err, stderr.String())
+	}
+	return nil
+}
+
+// devProcess is one lambda or the orchestrator run as a child process
+type devProcess struct {
+	name   string
+	binary string
+	args   []string
+	env    []string
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// start runs the process with its output prefixed by its name, logging to
+// logger when it exits with an error
+func (p *devProcess) start(logger *slog.Logger) error {
+	out := &prefixWriter{prefix: fmt.Sprintf("%-16s | ", p.name)}
+	cmd := exec.Command(p.binary, p.args...)
+	cmd.Env = append(os.Environ(), p.env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := cmd.Wait(); err != nil {
+			logger.Warn("Process exited", "process", p.name, "error", err)
+		}
+	}()
+	p.cmd = cmd
+	p.done = done
+	return nil
+}
+
+// stop sends SIGTERM and kills the process if it has not exited within its shutdown timeout
+func (p *devProcess) stop() {
+	if p.cmd == nil {
+		return
+	}
+	select {
+	case <-p.done:
+	default:
+		p.cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-p.done:
+		case <-time.After(15 * time.Second):
+			p.cmd.Process.Kill()
+			<-p.done
+		}
+	}
+	p.cmd = nil
+}
+
+// prefixWriter writes each complete line to stdout behind a prefix
+type prefixWriter struct {
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		os.Stdout.Write(append([]byte(w.prefix), w.buf[:i+1]...))
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// scanSources returns the modification time of every watched file under root,
+// skipping hidden directories such as .git
+func scanSources(root string) (map[string]time.Time, error) {
+	files := make(map[string]time.Time)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !devWatchExtensions[filepath.Ext(path)] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files[path] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sources: %w", err)
+	}
+	return files, nil
+}
+
+// changedFiles lists files added, removed or modified between two scans
+func changedFiles(before, after map[string]time.Time) []string {
+	var changed []string
+	for path, modTime := range after {
+		if prev, ok := before[path]; !ok || !prev.Equal(modTime) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
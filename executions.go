@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tala_base/archive"
+	"tala_base/db"
+	"tala_base/storage"
+)
+
+// maxPutSize is the largest object S3 accepts in a single PUT
+const maxPutSize = 5 << 30
+
+// runExecutions implements the `tala executions export` command
+func runExecutions(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("unknown executions command %q (expected export)", strings.Join(args, " "))
+	}
+	return runExportExecutions(args[1:])
+}
+
+// runExportExecutions implements `tala executions export [-tenant id]
+// [-workflow name] [-since time] [-until time] [-format csv|jsonl] [-o output]`.
+// It writes a tenant's execution history, oldest first, to a file, to
+// s3://<bucket>/<key> through the S3_* settings, or to standard output.
+func runExportExecutions(args []string) error {
+	flags := flag.NewFlagSet("executions export", flag.ContinueOnError)
+	tenant := flags.String("tenant", db.DefaultTenant, "tenant whose executions are exported")
+	workflow := flags.String("workflow", "", "only export executions of this workflow")
+	since := flags.String("since", "", "only export executions created after this RFC 3339 time")
+	until := flags.String("until", "", "only export executions created before this RFC 3339 time")
+	format := flags.String("format", "", "csv or jsonl; defaults to the output's extension, else jsonl")
+	output := flags.String("o", "-", "file to write, s3://<bucket>/<key>, or - for standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !db.ValidTenantID(*tenant) {
+		return fmt.Errorf("invalid tenant ID %q", *tenant)
+	}
+
+	opts := archive.Options{Workflow: *workflow, Format: archive.Format(*format)}
+	var err error
+	if opts.After, err = parseTimeFlag("since", *since); err != nil {
+		return err
+	}
+	if opts.Before, err = parseTimeFlag("until", *until); err != nil {
+		return err
+	}
+	if opts.Format == "" {
+		opts.Format = archive.FormatJSONL
+		if filepath.Ext(*output) == ".csv" {
+			opts.Format = archive.FormatCSV
+		}
+	}
+	if opts.Format != archive.FormatCSV && opts.Format != archive.FormatJSONL {
+		return fmt.Errorf("unknown format %q (expected csv or jsonl)", opts.Format)
+	}
+
+	dbConn, err := db.Connect(db.ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+	ctx := db.WithTenant(context.Background(), *tenant)
+
+	var count int
+	switch {
+	case *output == "-":
+		count, err = archive.Export(ctx, dbConn, os.Stdout, opts)
+	case strings.HasPrefix(*output, "s3://"):
+		count, err = exportToS3(ctx, dbConn, *output, opts)
+	default:
+		count, err = exportToFile(ctx, dbConn, *output, opts)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Exported executions", "tenant", *tenant, "count", count, "format", opts.Format, "output", *output)
+	return nil
+}
+
+// exportToFile writes an export to path, removing the file if it fails
+func exportToFile(ctx context.Context, conn db.DBTX, path string, opts archive.Options) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+	count, err := archive.Export(ctx, conn, file, opts)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write export file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+	return count, nil
+}
+
+// exportToS3 writes an export to the object at target, an s3://<bucket>/<key>
+// URL, in one PUT of at most 5 GiB
+func exportToS3(ctx context.Context, conn db.DBTX, target string, opts archive.Options) (int, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+	if bucket == "" || key == "" {
+		return 0, fmt.Errorf("invalid S3 output %q (expected s3://<bucket>/<key>)", target)
+	}
+	cfg := storage.ConfigFromEnv()
+	cfg.Bucket = bucket
+	cfg.MaxObjectSize = maxPutSize
+	client, err := storage.New(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	count, err := archive.Export(ctx, conn, &buf, opts)
+	if err != nil {
+		return 0, err
+	}
+	contentType := "application/x-ndjson"
+	if opts.Format == archive.FormatCSV {
+		contentType = "text/csv"
+	}
+	if _, err := client.Put(ctx, key, contentType, buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// parseTimeFlag parses an optional RFC 3339 flag value
+func parseTimeFlag(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("-%s must be an RFC 3339 time: %w", name, err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/logging"
+	"tala_base/utils"
+)
+
+// handleHealthz reports that the process is up; it never touches dependencies
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	utils.RespondSuccess(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the server can take traffic, failing with 503
+// when the database does not answer a ping in time
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	status := http.StatusOK
+	if s.db != nil {
+		if err := db.Ping(r.Context(), s.db, db.DefaultPingTimeout); err != nil {
+			logging.LoggerFromContext(r.Context()).Warn("Readiness check failed", "error", err)
+			checks["database"] = err.Error()
+			status = http.StatusServiceUnavailable
+		} else {
+			checks["database"] = "ok"
+		}
+	}
+
+	state := "ready"
+	if status != http.StatusOK {
+		state = "unavailable"
+	}
+	utils.RespondSuccess(w, r, status, map[string]interface{}{
+		"status": state,
+		"checks": checks,
+	})
+}
+
+// handleMetrics exposes route, workflow and queue metrics and database pool stats in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.Write(w)
+	s.executor.WriteMetrics(w)
+	s.pressure.WriteMetrics(w)
+	if s.jobs != nil {
+		s.jobs.WriteMetrics(w)
+	}
+	if s.db == nil {
+		return
+	}
+
+	stats := db.Stats(s.db)
+	gauges := []struct {
+		name, help string
+		value      interface{}
+	}{
+		{"tala_db_max_open_connections", "Maximum number of open connections to the database.", stats.MaxOpen},
+		{"tala_db_open_connections", "Number of established connections, in use and idle.", stats.Open},
+		{"tala_db_in_use_connections", "Number of connections currently in use.", stats.InUse},
+		{"tala_db_idle_connections", "Number of idle connections.", stats.Idle},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", g.name, g.help, g.name, g.name, g.value)
+	}
+	fmt.Fprintf(w, "# HELP tala_db_wait_count_total Total number of connections waited for.\n# TYPE tala_db_wait_count_total counter\ntala_db_wait_count_total %d\n", stats.WaitCount)
+	fmt.Fprintf(w, "# HELP tala_db_wait_seconds_total Total time blocked waiting for a connection.\n# TYPE tala_db_wait_seconds_total counter\ntala_db_wait_seconds_total %g\n", stats.WaitDuration.Seconds())
+}
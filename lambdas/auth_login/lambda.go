@@ -0,0 +1,65 @@
+package auth_login
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tala_base/auth"
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the auth_login lambda
+var Lambda = lambdasdk.Lambda{Name: "auth_login", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	cfg, err := auth.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid auth configuration: %w", err)
+	}
+	dbConn := app.ConnectDB()
+	app.Handle("/", handleRequest(dbConn, cfg), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB, cfg auth.Config) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.LoginInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Verify the password; unknown emails are checked against a dummy hash
+		// so they cannot be told apart from wrong passwords
+		user, passwordHash, err := db.GetUserCredentials(ctx, dbConn, input.Email)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return nil, err
+		}
+		if !auth.CheckPassword(passwordHash, input.Password) || user == nil {
+			return nil, lambdasdk.Unauthorized(types.ErrorCodeInvalidCredentials, "Invalid email or password")
+		}
+		if user.Status != types.UserStatusActive {
+			return nil, lambdasdk.NewError(http.StatusForbidden, types.ErrorCodeAccountInactive, "Account is not active")
+		}
+
+		// Issue a token pair
+		refresh, refreshHash, err := auth.NewRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+		if err := db.CreateRefreshToken(ctx, dbConn, user.ID, refreshHash, time.Now().Add(cfg.RefreshTTL)); err != nil {
+			return nil, err
+		}
+		tokens, err := auth.Tokens(cfg, user, refresh)
+		if err != nil {
+			return nil, err
+		}
+		return types.AuthOutput{User: *user, Tokens: tokens}, nil
+	}
+}
@@ -0,0 +1,58 @@
+package auth_refresh
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tala_base/auth"
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the auth_refresh lambda
+var Lambda = lambdasdk.Lambda{Name: "auth_refresh", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	cfg, err := auth.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid auth configuration: %w", err)
+	}
+	dbConn := app.ConnectDB()
+	app.Handle("/", handleRequest(dbConn, cfg), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB, cfg auth.Config) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.RefreshInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Rotate the refresh token; each one can be used only once
+		refresh, refreshHash, err := auth.NewRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+		user, err := db.RotateRefreshToken(ctx, dbConn, auth.HashRefreshToken(input.RefreshToken), refreshHash, time.Now().Add(cfg.RefreshTTL))
+		if err != nil {
+			if errors.Is(err, db.ErrInvalidRefreshToken) {
+				return nil, lambdasdk.Unauthorized(types.ErrorCodeInvalidRefreshToken, "Invalid refresh token")
+			}
+			return nil, err
+		}
+
+		// Issue a new access token alongside the rotated refresh token
+		tokens, err := auth.Tokens(cfg, user, refresh)
+		if err != nil {
+			return nil, err
+		}
+		return types.AuthOutput{User: *user, Tokens: tokens}, nil
+	}
+}
@@ -0,0 +1,64 @@
+package auth_register
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tala_base/auth"
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the auth_register lambda
+var Lambda = lambdasdk.Lambda{Name: "auth_register", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	cfg, err := auth.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid auth configuration: %w", err)
+	}
+	dbConn := app.ConnectDB()
+	app.Handle("/", handleRequest(dbConn, cfg), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB, cfg auth.Config) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.RegisterInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Create the user with a hashed password
+		passwordHash, err := auth.HashPassword(input.Password)
+		if err != nil {
+			return nil, err
+		}
+		user, err := db.RegisterUser(ctx, dbConn, types.CreateUserInput{
+			Email: input.Email,
+			Name:  input.Name,
+		}, passwordHash)
+		if err != nil {
+			return nil, err
+		}
+
+		// Issue the first token pair
+		refresh, refreshHash, err := auth.NewRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+		if err := db.CreateRefreshToken(ctx, dbConn, user.ID, refreshHash, time.Now().Add(cfg.RefreshTTL)); err != nil {
+			return nil, err
+		}
+		tokens, err := auth.Tokens(cfg, user, refresh)
+		if err != nil {
+			return nil, err
+		}
+		return types.AuthOutput{User: *user, Tokens: tokens}, nil
+	}
+}
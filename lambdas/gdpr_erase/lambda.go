@@ -0,0 +1,55 @@
+package gdpr_erase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the gdpr_erase lambda
+var Lambda = lambdasdk.Lambda{Name: "gdpr_erase", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	app.Handle("/", handleRequest(dbConn), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.GDPREraseInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		output := types.GDPREraseOutput{UserID: input.UserID}
+		switch input.Operation {
+		case types.GDPREraseOpAnonymize:
+			user, revoked, err := db.AnonymizeUser(ctx, dbConn, input.UserID)
+			if err != nil {
+				if errors.Is(err, db.ErrNotFound) {
+					return nil, lambdasdk.NotFound(types.ErrorCodeUserNotFound, "User not found", err)
+				}
+				return nil, err
+			}
+			output.User, output.RevokedTokens = user, revoked
+
+		case types.GDPREraseOpPurge:
+			purged, err := db.PurgeUserPayloads(ctx, dbConn, input.UserID)
+			if err != nil {
+				return nil, err
+			}
+			output.AuditEntries, output.Executions, output.Steps = purged.AuditEntries, purged.Executions, purged.Steps
+
+		default:
+			return nil, lambdasdk.BadRequest("Operation must be anonymize or purge")
+		}
+		return output, nil
+	}
+}
@@ -0,0 +1,52 @@
+// Package lambdas lists every lambda so they can be run by name or served together
+package lambdas
+
+import (
+	"tala_base/lambdas/auth_login"
+	"tala_base/lambdas/auth_refresh"
+	"tala_base/lambdas/auth_register"
+	"tala_base/lambdas/gdpr_erase"
+	"tala_base/lambdas/notify_email"
+	"tala_base/lambdas/storage"
+	"tala_base/lambdas/transform"
+	"tala_base/lambdas/user_audit_read"
+	"tala_base/lambdas/user_bulk_create"
+	"tala_base/lambdas/user_create"
+	"tala_base/lambdas/user_delete"
+	"tala_base/lambdas/user_list"
+	"tala_base/lambdas/user_read"
+	"tala_base/lambdas/user_search"
+	"tala_base/lambdas/user_update"
+	"tala_base/lambdas/webhook_send"
+	"tala_base/lambdasdk"
+)
+
+// All is every lambda in the repository
+var All = []lambdasdk.Lambda{
+	user_create.Lambda,
+	user_read.Lambda,
+	user_update.Lambda,
+	user_delete.Lambda,
+	user_list.Lambda,
+	user_search.Lambda,
+	user_bulk_create.Lambda,
+	user_audit_read.Lambda,
+	auth_register.Lambda,
+	auth_login.Lambda,
+	auth_refresh.Lambda,
+	notify_email.Lambda,
+	webhook_send.Lambda,
+	transform.Lambda,
+	storage.Lambda,
+	gdpr_erase.Lambda,
+}
+
+// Find returns the lambda with the given name
+func Find(name string) (lambdasdk.Lambda, bool) {
+	for _, l := range All {
+		if l.Name == name {
+			return l, true
+		}
+	}
+	return lambdasdk.Lambda{}, false
+}
@@ -0,0 +1,65 @@
+package notify_email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"tala_base/lambdasdk"
+	"tala_base/notify"
+	"tala_base/types"
+)
+
+// Lambda is the notify_email lambda
+var Lambda = lambdasdk.Lambda{Name: "notify_email", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	sender, err := notify.EmailSenderFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid email configuration: %w", err)
+	}
+	from := os.Getenv("EMAIL_FROM")
+	if from == "" {
+		return fmt.Errorf("EMAIL_FROM is not set")
+	}
+	app.Handle("/", handleRequest(sender, notify.EmailTemplatesFromEnv(), from), http.MethodPost)
+	return nil
+}
+
+func handleRequest(sender notify.EmailSender, templates *notify.EmailTemplates, from string) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.SendEmailInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Render the message from a template, or take it inline
+		msg := notify.EmailMessage{From: from, To: []string{input.To}}
+		if input.Template != "" {
+			subject, text, html, err := templates.Render(input.Template, input.Data)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, lambdasdk.NotFound(types.ErrorCodeTemplateNotFound, "Email template not found", err)
+			}
+			if err != nil {
+				return nil, &lambdasdk.Error{Status: http.StatusUnprocessableEntity, Code: types.ErrorCodeTemplateInvalid, Message: err.Error(), Err: err}
+			}
+			msg.Subject, msg.Text, msg.HTML = subject, text, html
+		} else {
+			if input.Subject == "" || (input.Text == "" && input.HTML == "") {
+				return nil, lambdasdk.BadRequest("Either template or subject with text or html is required")
+			}
+			msg.Subject, msg.Text, msg.HTML = input.Subject, input.Text, input.HTML
+		}
+
+		// Send
+		id, err := sender.Send(ctx, msg)
+		if err != nil {
+			return nil, &lambdasdk.Error{Status: http.StatusBadGateway, Code: types.ErrorCodeEmailSendFailed, Message: "Failed to send email", Err: err}
+		}
+		return types.SendEmailOutput{MessageID: id, Provider: sender.Name(), To: input.To}, nil
+	}
+}
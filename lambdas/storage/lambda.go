@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/storage"
+	"tala_base/types"
+)
+
+// Lambda is the storage lambda
+var Lambda = lambdasdk.Lambda{Name: "storage", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	client, err := storage.New(storage.ConfigFromEnv())
+	if err != nil {
+		return fmt.Errorf("invalid storage configuration: %w", err)
+	}
+	app.Handle("/", handleRequest(client), http.MethodPost)
+	return nil
+}
+
+func handleRequest(client *storage.Client) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.StorageInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+		if input.Key != strings.TrimSpace(input.Key) || strings.HasPrefix(input.Key, "/") || strings.Contains(input.Key, "..") {
+			return nil, lambdasdk.BadRequest("Key must be a relative path without '..'")
+		}
+
+		// Objects are namespaced by tenant so tenants cannot read each other's keys
+		objectKey := "tenants/" + db.TenantFrom(ctx) + "/" + input.Key
+		output := types.StorageOutput{Bucket: client.Bucket(), Key: input.Key}
+
+		switch input.Operation {
+		case types.StorageOpPut:
+			body := []byte(input.Content)
+			if input.ContentBase64 != "" {
+				if input.Content != "" {
+					return nil, lambdasdk.BadRequest("Only one of content and content_base64 may be given")
+				}
+				decoded, err := base64.StdEncoding.DecodeString(input.ContentBase64)
+				if err != nil {
+					return nil, lambdasdk.BadRequest("Invalid content_base64")
+				}
+				body = decoded
+			}
+			obj, err := client.Put(ctx, objectKey, input.ContentType, body)
+			if err != nil {
+				return nil, storageError(err)
+			}
+			output.ContentType, output.ETag, output.Size = obj.ContentType, obj.ETag, obj.Size
+
+		case types.StorageOpGet:
+			obj, err := client.Get(ctx, objectKey)
+			if err != nil {
+				return nil, storageError(err)
+			}
+			output.ContentType, output.ETag, output.Size = obj.ContentType, obj.ETag, obj.Size
+			if isText(obj.ContentType) && utf8.Valid(obj.Body) {
+				output.Content = string(obj.Body)
+			} else {
+				output.ContentBase64 = base64.StdEncoding.EncodeToString(obj.Body)
+			}
+
+		case types.StorageOpPresign:
+			method := strings.ToUpper(input.Method)
+			if method == "" {
+				method = http.MethodGet
+			}
+			if method != http.MethodGet && method != http.MethodPut {
+				return nil, lambdasdk.BadRequest("Method must be GET or PUT")
+			}
+			expires := 15 * time.Minute
+			if input.ExpiresIn > 0 {
+				expires = time.Duration(input.ExpiresIn) * time.Second
+			}
+			url, err := client.Presign(method, objectKey, expires)
+			if err != nil {
+				return nil, lambdasdk.BadRequest(err.Error())
+			}
+			output.URL = url
+			output.ExpiresAt = time.Now().Add(expires).UTC().Format(time.RFC3339)
+
+		default:
+			return nil, lambdasdk.BadRequest("Operation must be put, get or presign")
+		}
+		return output, nil
+	}
+}
+
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return lambdasdk.NotFound(types.ErrorCodeObjectNotFound, "Object not found", err)
+	case errors.Is(err, storage.ErrTooLarge):
+		return &lambdasdk.Error{Status: http.StatusRequestEntityTooLarge, Code: types.ErrorCodeObjectTooLarge, Message: err.Error(), Err: err}
+	default:
+		return &lambdasdk.Error{Status: http.StatusBadGateway, Code: types.ErrorCodeStorageFailed, Message: "Storage request failed", Err: err}
+	}
+}
+
+func isText(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.HasPrefix(contentType, "application/json") ||
+		strings.HasPrefix(contentType, "application/xml")
+}
@@ -0,0 +1,99 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/itchyny/gojq"
+
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// maxResults bounds how many values one expression may produce, so a runaway
+// generator like `range(1e9)` cannot exhaust memory before the timeout
+const maxResults = 10000
+
+// Lambda is the transform lambda
+var Lambda = lambdasdk.Lambda{Name: "transform", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	timeout := 5 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("TRANSFORM_TIMEOUT")); err == nil && v > 0 {
+		timeout = v
+	}
+	app.Handle("/", handleRequest(timeout), http.MethodPost)
+	return nil
+}
+
+func handleRequest(timeout time.Duration) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.TransformInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Compile the expression with the input's variables
+		query, err := gojq.Parse(input.Expression)
+		if err != nil {
+			return nil, invalidExpression(err)
+		}
+		names := make([]string, 0, len(input.Vars))
+		for name := range input.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		values := make([]interface{}, len(names))
+		for i, name := range names {
+			values[i] = input.Vars[name]
+			names[i] = "$" + name
+		}
+		code, err := gojq.Compile(query, gojq.WithVariables(names))
+		if err != nil {
+			return nil, invalidExpression(err)
+		}
+
+		// Run it
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		results := []interface{}{}
+		iter := code.RunWithContext(ctx, input.Data, values...)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				var halt *gojq.HaltError
+				if errors.As(err, &halt) && halt.Value() == nil {
+					break
+				}
+				return nil, transformFailed(err)
+			}
+			if len(results) == maxResults {
+				return nil, transformFailed(fmt.Errorf("expression produced more than %d results", maxResults))
+			}
+			results = append(results, v)
+		}
+
+		output := types.TransformOutput{Results: results}
+		if len(results) > 0 {
+			output.Result = results[0]
+		}
+		return output, nil
+	}
+}
+
+func invalidExpression(err error) error {
+	return &lambdasdk.Error{Status: http.StatusUnprocessableEntity, Code: types.ErrorCodeInvalidExpression, Message: err.Error(), Err: err}
+}
+
+func transformFailed(err error) error {
+	return &lambdasdk.Error{Status: http.StatusUnprocessableEntity, Code: types.ErrorCodeTransformFailed, Message: err.Error(), Err: err}
+}
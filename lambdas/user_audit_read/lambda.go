@@ -0,0 +1,31 @@
+package user_audit_read
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_audit_read lambda
+var Lambda = lambdasdk.Lambda{Name: "user_audit_read", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	app.Handle("/", lambdasdk.Handle(handleRequest(dbConn)), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.TypedHandlerFunc[types.ReadUserAuditInput, types.ReadUserAuditOutput] {
+	return func(ctx context.Context, in lambdasdk.Input[types.ReadUserAuditInput]) (types.ReadUserAuditOutput, error) {
+		// Read audit entries
+		entries, err := db.ListUserAudit(ctx, dbConn, in.Body)
+		if err != nil {
+			return types.ReadUserAuditOutput{}, err
+		}
+		return types.ReadUserAuditOutput{Entries: entries}, nil
+	}
+}
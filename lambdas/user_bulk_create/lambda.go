@@ -0,0 +1,45 @@
+package user_bulk_create
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_bulk_create lambda
+var Lambda = lambdasdk.Lambda{Name: "user_bulk_create", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	app.Handle("/", handleRequest(dbConn), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.BulkCreateUsersInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Create users
+		results, err := db.CreateUsers(ctx, dbConn, input.Users)
+		if err != nil {
+			return nil, err
+		}
+		output := types.BulkCreateUsersOutput{Results: results}
+		for _, result := range results {
+			if result.User != nil {
+				output.Created++
+			} else {
+				output.Failed++
+			}
+		}
+		return output, nil
+	}
+}
@@ -0,0 +1,31 @@
+package user_create
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_create lambda
+var Lambda = lambdasdk.Lambda{Name: "user_create", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	app.Handle("/", lambdasdk.Handle(handleRequest(dbConn)), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.TypedHandlerFunc[types.CreateUserInput, types.CreateUserOutput] {
+	return func(ctx context.Context, in lambdasdk.Input[types.CreateUserInput]) (types.CreateUserOutput, error) {
+		// Create user
+		user, err := db.CreateUser(ctx, dbConn, in.Body)
+		if err != nil {
+			return types.CreateUserOutput{}, err
+		}
+		return types.CreateUserOutput{User: *user}, nil
+	}
+}
@@ -1,72 +0,0 @@
-package main
-
-import (
-	"database/sql"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"os"
-
-	"tala_base/db"
-	"tala_base/types"
-
-	"github.com/lib/pq"
-)
-
-func main() {
-	http.HandleFunc("/", handleRequest)
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	fmt.Printf("Starting user_create lambda on port %s\n", port)
-	http.ListenAndServe(":"+port, nil)
-}
-
-func handleRequest(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Parse input
-	var input types.CreateUserInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Get database connection
-	dbConn, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
-	if err != nil {
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
-		return
-	}
-	defer dbConn.Close()
-
-	// Create user
-	user, err := db.CreateUser(dbConn, input)
-	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			http.Error(w, "Email already exists", http.StatusConflict)
-			return
-		}
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
-		return
-	}
-
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	output := types.CreateUserOutput{User: *user}
-	json.NewEncoder(w).Encode(output)
-}
@@ -0,0 +1,78 @@
+package user_delete
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_delete lambda
+var Lambda = lambdasdk.Lambda{Name: "user_delete", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	// Workflow steps call every lambda with POST
+	app.Handle("/", handleRequest(dbConn), http.MethodDelete, http.MethodPost)
+	app.Handle("/restore", handleRestore(dbConn), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.DeleteUserInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Delete user, soft by default, and clean up related records with it
+		deleteUser := db.DeleteUser
+		if input.Hard {
+			deleteUser = db.HardDeleteUser
+		}
+		output := types.DeleteUserOutput{Success: true, Hard: input.Hard}
+		err := db.WithTx(ctx, dbConn, func(tx *sql.Tx) error {
+			if input.Cascade {
+				// Revoke before a hard delete removes the tokens, so they are counted
+				revoked, err := db.RevokeRefreshTokens(ctx, tx, input.ID)
+				if err != nil {
+					return err
+				}
+				output.RevokedTokens = revoked
+			}
+			return deleteUser(ctx, tx, input.ID)
+		})
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return nil, lambdasdk.NotFound(types.ErrorCodeUserNotFound, "User not found", err)
+			}
+			return nil, err
+		}
+		return output, nil
+	}
+}
+
+func handleRestore(dbConn *sql.DB) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.RestoreUserInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Restore user
+		user, err := db.RestoreUser(ctx, dbConn, input.ID)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return nil, lambdasdk.NotFound(types.ErrorCodeUserNotFound, "User not found", err)
+			}
+			return nil, err
+		}
+		return types.RestoreUserOutput{User: *user}, nil
+	}
+}
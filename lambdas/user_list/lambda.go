@@ -0,0 +1,27 @@
+package user_list
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_list lambda
+var Lambda = lambdasdk.Lambda{Name: "user_list", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	app.Handle("/", lambdasdk.Handle(handleRequest(dbConn)), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.TypedHandlerFunc[types.ListUsersInput, types.ListUsersOutput] {
+	return func(ctx context.Context, in lambdasdk.Input[types.ListUsersInput]) (types.ListUsersOutput, error) {
+		// List users
+		return db.ListUsers(ctx, dbConn, in.Body)
+	}
+}
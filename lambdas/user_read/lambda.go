@@ -0,0 +1,36 @@
+package user_read
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_read lambda
+var Lambda = lambdasdk.Lambda{Name: "user_read", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	// Workflow steps call every lambda with POST
+	app.Handle("/", lambdasdk.Handle(handleRequest(dbConn)), http.MethodGet, http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.TypedHandlerFunc[types.ReadUserInput, types.ReadUserOutput] {
+	return func(ctx context.Context, in lambdasdk.Input[types.ReadUserInput]) (types.ReadUserOutput, error) {
+		// Get user
+		user, err := db.GetUserByID(ctx, dbConn, in.Body.ID)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return types.ReadUserOutput{}, lambdasdk.NotFound(types.ErrorCodeUserNotFound, "User not found", err)
+			}
+			return types.ReadUserOutput{}, err
+		}
+		return types.ReadUserOutput{User: *user}, nil
+	}
+}
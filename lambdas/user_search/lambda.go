@@ -0,0 +1,40 @@
+package user_search
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_search lambda
+var Lambda = lambdasdk.Lambda{Name: "user_search", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	app.Handle("/", handleRequest(dbConn), http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.SearchUsersInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Search users
+		results, err := db.SearchUsers(ctx, dbConn, input.Query, db.SearchOptions{
+			Limit:         input.Limit,
+			MinSimilarity: input.MinSimilarity,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return types.SearchUsersOutput{Results: results}, nil
+	}
+}
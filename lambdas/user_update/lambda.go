@@ -0,0 +1,57 @@
+package user_update
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"tala_base/db"
+	"tala_base/lambdasdk"
+	"tala_base/types"
+)
+
+// Lambda is the user_update lambda
+var Lambda = lambdasdk.Lambda{Name: "user_update", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	dbConn := app.ConnectDB()
+	// Workflow steps call every lambda with POST, which updates like PATCH
+	app.Handle("/", handleRequest(dbConn), http.MethodPut, http.MethodPatch, http.MethodPost)
+	return nil
+}
+
+func handleRequest(dbConn *sql.DB) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.UpdateUserInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+
+		// Get user ID from path, or from the body of a POST
+		id, err := strconv.Atoi(r.URL.Path[1:])
+		if r.Method == http.MethodPost {
+			id, err = input.ID, nil
+		}
+		if err != nil || id <= 0 {
+			return nil, lambdasdk.BadRequest("Invalid user ID")
+		}
+
+		// PUT replaces the user, so every field must be present; PATCH changes only the fields given
+		if r.Method == http.MethodPut && (input.Email == nil || input.Name == nil) {
+			return nil, lambdasdk.BadRequest("PUT requires email and name; use PATCH for partial updates")
+		}
+
+		// Update user
+		user, err := db.UpdateUser(ctx, dbConn, id, input)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return nil, lambdasdk.NotFound(types.ErrorCodeUserNotFound, "User not found", err)
+			}
+			return nil, err
+		}
+		return types.UpdateUserOutput{User: *user}, nil
+	}
+}
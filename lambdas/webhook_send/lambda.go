@@ -0,0 +1,96 @@
+package webhook_send
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"tala_base/lambdasdk"
+	"tala_base/notify"
+	"tala_base/types"
+)
+
+// Lambda is the webhook_send lambda
+var Lambda = lambdasdk.Lambda{Name: "webhook_send", Setup: setup}
+
+func setup(app *lambdasdk.App) error {
+	sender := notify.NewWebhookSender(notify.WebhookConfigFromEnv())
+	app.Handle("/", handleRequest(sender), http.MethodPost)
+	return nil
+}
+
+func handleRequest(sender *notify.WebhookSender) lambdasdk.HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		// Parse input
+		var input types.WebhookInput
+		if err := lambdasdk.Decode(r, &input); err != nil {
+			return nil, err
+		}
+		switch input.Method {
+		case "":
+			input.Method = http.MethodPost
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			return nil, lambdasdk.BadRequest("Method must be POST, PUT or PATCH")
+		}
+
+		// Build the body
+		body, err := renderBody(input)
+		if err != nil {
+			return nil, err
+		}
+
+		// Deliver
+		result, err := sender.Send(ctx, notify.WebhookRequest{
+			URL:     input.URL,
+			Method:  input.Method,
+			Headers: input.Headers,
+			Body:    body,
+		})
+		if errors.Is(err, notify.ErrHostNotAllowed) {
+			return nil, lambdasdk.NewError(http.StatusForbidden, types.ErrorCodeHostNotAllowed, err.Error())
+		}
+		if result == nil && err != nil {
+			return nil, lambdasdk.BadRequest(err.Error())
+		}
+		if err != nil {
+			message := fmt.Sprintf("Webhook delivery failed after %d attempts: %v", result.Attempts, err)
+			return nil, &lambdasdk.Error{Status: http.StatusBadGateway, Code: types.ErrorCodeWebhookFailed, Message: message, Err: err}
+		}
+		return types.WebhookOutput{
+			DeliveryID: result.DeliveryID,
+			Status:     result.Status,
+			Attempts:   result.Attempts,
+			Response:   string(result.Body),
+		}, nil
+	}
+}
+
+// renderBody returns the payload, or the template rendered with data
+func renderBody(input types.WebhookInput) ([]byte, error) {
+	switch {
+	case input.Template != "" && len(input.Payload) > 0:
+		return nil, lambdasdk.BadRequest("Only one of payload and template may be given")
+	case len(input.Payload) > 0:
+		return input.Payload, nil
+	case input.Template == "":
+		return nil, lambdasdk.BadRequest("Either payload or template is required")
+	}
+
+	tmpl, err := template.New("payload").Option("missingkey=error").Parse(input.Template)
+	if err != nil {
+		return nil, lambdasdk.BadRequest(fmt.Sprintf("Invalid template: %v", err))
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, input.Data); err != nil {
+		return nil, lambdasdk.BadRequest(fmt.Sprintf("Failed to render template: %v", err))
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, lambdasdk.BadRequest("Rendered template is not valid JSON")
+	}
+	return buf.Bytes(), nil
+}
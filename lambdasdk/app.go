@@ -0,0 +1,451 @@
+// Package lambdasdk is the runtime shared by every lambda: handler
+// registration, CORS, JSON decoding and encoding, the standard error envelope,
+// health and metrics endpoints, request logging and graceful shutdown
+package lambdasdk
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"tala_base/db"
+	"tala_base/tracing"
+	"tala_base/types"
+	"tala_base/utils"
+	"tala_base/utils/httpclient"
+)
+
+// HandlerFunc is a lambda's business handler. ctx is scoped to the caller's
+// tenant and carries audit attribution; the returned value is encoded as the
+// 200 response, wrapped in a StepResult when the executor asks for one, and a
+// returned error is rendered in the standard error envelope.
+type HandlerFunc func(ctx context.Context, r *http.Request) (interface{}, error)
+
+// CheckFunc reports whether a dependency of the lambda is usable
+type CheckFunc func(ctx context.Context) error
+
+// Lambda defines a lambda by name and the routes Setup registers on an App,
+// so it can run as its own process or mounted alongside others
+type Lambda struct {
+	Name  string
+	Setup func(app *App) error
+}
+
+// App is a lambda's view of an HTTP server: its routes, logger and the
+// database pool. In a standalone process the App owns the server; when
+// mounted with ServeAll, its routes live under /<name> on a shared server.
+type App struct {
+	cfg    Config
+	name   string
+	prefix string
+	logger *slog.Logger
+	srv    *server
+}
+
+// server is the state shared by every App served from one process
+type server struct {
+	logger  *slog.Logger
+	mux     *http.ServeMux
+	db      *sql.DB
+	checks  map[string]CheckFunc
+	metrics *metrics
+	limiter *limiter
+
+	// shutdownTracing flushes buffered spans on exit
+	shutdownTracing func(context.Context) error
+
+	// draining is set once shutdown starts so /readyz stops advertising the lambdas
+	draining atomic.Bool
+}
+
+// New creates a lambda app configured from the environment, with /healthz
+// and /readyz registered
+func New(name string) *App {
+	cfg := LoadConfig(name)
+	logger := newLogger(cfg)
+	a := &App{
+		cfg:    cfg,
+		name:   name,
+		logger: logger.With("lambda", name),
+		srv: &server{
+			logger:  logger,
+			mux:     http.NewServeMux(),
+			checks:  make(map[string]CheckFunc),
+			metrics: newMetrics(),
+			limiter: newLimiter(cfg.MaxInFlight, cfg.RetryAfter),
+		},
+	}
+	if err := a.cfg.resolveSecrets(context.Background()); err != nil {
+		a.fatal("Failed to resolve secrets", "error", err)
+	}
+	a.registerHealth()
+	a.srv.mux.HandleFunc("/metrics", a.handleMetrics)
+	httpclient.SetObserver(a.srv.metrics.observeOutbound)
+
+	if !cfg.authEnabled() {
+		a.logger.Warn("LAMBDA_AUTH_SECRET and LAMBDA_SERVICE_TOKEN are unset; accepting unauthenticated requests")
+	}
+
+	shutdown, err := tracing.Init(context.Background(), name)
+	if err != nil {
+		a.logger.Warn("Tracing disabled", "error", err)
+		shutdown = func(context.Context) error { return nil }
+	}
+	a.srv.shutdownTracing = shutdown
+	return a
+}
+
+// Mount runs l's Setup against an App whose routes are served under /<l.Name>
+// and which shares this app's database pool. /<l.Name>/healthz and /readyz
+// are only registered once setup succeeds, so the orchestrator sees a lambda
+// that failed to mount as unavailable.
+func (a *App) Mount(l Lambda) error {
+	sub := &App{
+		cfg:    a.cfg,
+		name:   l.Name,
+		prefix: a.prefix + "/" + l.Name,
+		logger: a.srv.logger.With("lambda", l.Name),
+		srv:    a.srv,
+	}
+	if err := l.Setup(sub); err != nil {
+		return err
+	}
+	sub.registerHealth()
+	return nil
+}
+
+// Serve runs l as a standalone process, exiting if its setup fails
+func Serve(l Lambda) {
+	app := New(l.Name)
+	if err := l.Setup(app); err != nil {
+		app.fatal("Failed to set up lambda", "error", err)
+	}
+	app.Run()
+}
+
+// ServeAll runs every lambda in one process, each under /<name> on a single
+// port. A lambda whose setup fails, usually for missing configuration, is
+// skipped so the rest can still serve.
+func ServeAll(name string, lambdas []Lambda) {
+	app := New(name)
+	for _, l := range lambdas {
+		if err := app.Mount(l); err != nil {
+			app.logger.Warn("Skipping lambda", "name", l.Name, "error", err)
+			continue
+		}
+		app.logger.Info("Mounted lambda", "name", l.Name, "path", "/"+l.Name)
+	}
+	app.Run()
+}
+
+func (a *App) registerHealth() {
+	a.mount("/healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}))
+	a.mount("/readyz", http.HandlerFunc(a.handleReadyz))
+}
+
+// mount registers h for pattern under the app's prefix, stripping the prefix
+// so handlers see the same paths as when running standalone
+func (a *App) mount(pattern string, h http.Handler) {
+	if a.prefix == "" {
+		a.srv.mux.Handle(pattern, h)
+		return
+	}
+	stripped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = strings.TrimPrefix(r.URL.Path, a.prefix)
+		r2.URL.RawPath = ""
+		if r2.URL.Path == "" {
+			r2.URL.Path = "/"
+		}
+		h.ServeHTTP(w, r2)
+	})
+	a.srv.mux.Handle(a.prefix+pattern, stripped)
+	if pattern == "/" {
+		a.srv.mux.Handle(a.prefix, stripped)
+	}
+}
+
+// AddCheck registers a readiness check reported by /readyz under name
+func (a *App) AddCheck(name string, check CheckFunc) {
+	a.srv.checks[name] = check
+}
+
+// handleReadyz runs every readiness check and answers 503 if any fails,
+// so the orchestrator can route around a lambda that cannot serve
+func (a *App) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if a.srv.draining.Load() {
+		RespondJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "draining"})
+		return
+	}
+
+	results := make(map[string]string, len(a.srv.checks))
+	status := http.StatusOK
+	for name, check := range a.srv.checks {
+		if err := check(r.Context()); err != nil {
+			results[name] = err.Error()
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		results[name] = "ok"
+	}
+
+	state := "ready"
+	if status != http.StatusOK {
+		state = "unavailable"
+	}
+	RespondJSON(w, status, map[string]interface{}{"status": state, "checks": results})
+}
+
+// Logger returns the app's logger; inside a handler use LoggerFrom for one with request attributes
+func (a *App) Logger() *slog.Logger {
+	return a.logger
+}
+
+// fatal logs msg at error level and exits
+func (a *App) fatal(msg string, args ...any) {
+	a.logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// ConnectDB opens the shared database pool from DATABASE_URL and the DB_* variables,
+// exiting if the database is unreachable. Mounted apps share one pool, which
+// is closed when Run returns.
+func (a *App) ConnectDB() *sql.DB {
+	if a.srv.db != nil {
+		return a.srv.db
+	}
+	db.SetQueryObserver(a.observeQuery)
+	dbConn, err := db.Connect(db.ConfigFromEnv())
+	if err != nil {
+		a.fatal("Failed to connect to database", "error", err)
+	}
+	a.srv.db = dbConn
+	a.AddCheck("database", func(ctx context.Context) error {
+		return db.Ping(ctx, dbConn, db.DefaultPingTimeout)
+	})
+	return dbConn
+}
+
+// UseDB makes the app, and those mounted on it, share dbConn instead of
+// connecting from DATABASE_URL, for tests and programs that own the pool
+func (a *App) UseDB(dbConn *sql.DB) {
+	a.srv.db = dbConn
+}
+
+// Handler returns the routes of the app and those mounted on it, for serving
+// them from a test server or another process's mux
+func (a *App) Handler() http.Handler {
+	return a.srv.mux
+}
+
+// Handle registers h for pattern, accepting only the given methods
+func (a *App) Handle(pattern string, h HandlerFunc, methods ...string) {
+	allowed := strings.Join(append(methods, http.MethodOptions), ", ")
+	a.mount(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r, span := a.startRequestSpan(r, pattern)
+		logger := a.requestLogger(r)
+		var code string
+		var err error
+		defer func() {
+			endRequestSpan(span, rec.status, code, err)
+			a.srv.metrics.observeRequest(a.name, r.Method, rec.status, code, time.Since(start))
+			logger.Info("request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		}()
+
+		rec.Header().Set(utils.RequestIDHeader, r.Header.Get(utils.RequestIDHeader))
+		rec.Header().Set("Access-Control-Allow-Origin", "*")
+		rec.Header().Set("Access-Control-Allow-Methods", allowed)
+		rec.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Actor, X-Execution-ID, X-Request-ID, X-Tenant-ID, X-User-ID, X-Deadline, X-Deadline-Remaining, X-Context-Vars, X-Step-Envelope")
+		if r.Method == http.MethodOptions {
+			rec.WriteHeader(http.StatusOK)
+			return
+		}
+		if !contains(methods, r.Method) {
+			code = CodeMethodNotAllowed
+			RespondError(rec, NewError(http.StatusMethodNotAllowed, code, "Method not allowed"))
+			return
+		}
+		if authErr := a.authenticate(r); authErr != nil {
+			code = authErr.Code
+			logger.Warn("request rejected", "error", authErr)
+			RespondError(rec, authErr)
+			return
+		}
+		if !a.srv.limiter.acquire() {
+			code = CodeOverloaded
+			a.srv.limiter.reject(rec)
+			return
+		}
+		defer a.srv.limiter.release()
+
+		var ctx context.Context
+		var cancel context.CancelFunc
+		ctx, cancel, err = requestContext(r)
+		if err == nil {
+			defer cancel()
+			ctx, measured := withMeasurements(ctx)
+			var out interface{}
+			out, err = h(withLambda(withLogger(ctx, logger), a.name), r)
+			if err == nil && r.Header.Get(utils.StepEnvelopeHeader) == "true" {
+				var result *types.StepResult
+				if result, err = Envelope(out); err == nil {
+					result.Metrics = measured.list()
+					out = result
+				}
+			}
+			if err == nil {
+				RespondJSON(rec, http.StatusOK, out)
+				return
+			}
+		}
+		e := toError(err)
+		code = e.Code
+		if e.Status >= http.StatusInternalServerError {
+			logger.Error("request failed", "error", err)
+		}
+		RespondError(rec, e)
+	}))
+}
+
+// requestLogger returns a logger carrying the request's correlation IDs. A
+// request without X-Request-ID is given one, which is echoed in the response.
+func (a *App) requestLogger(r *http.Request) *slog.Logger {
+	requestID := r.Header.Get(utils.RequestIDHeader)
+	if requestID == "" {
+		requestID = uuid.NewString()
+		r.Header.Set(utils.RequestIDHeader, requestID)
+	}
+	args := []any{"request_id", requestID}
+	if id := r.Header.Get(utils.ExecutionIDHeader); id != "" {
+		args = append(args, "execution_id", id)
+	}
+	if tenant := r.Header.Get(utils.TenantHeader); tenant != "" {
+		args = append(args, "tenant_id", tenant)
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		args = append(args, "trace_id", sc.TraceID().String())
+	}
+	return a.logger.With(args...)
+}
+
+// requestContext scopes the request context to the X-Tenant-ID tenant,
+// attaches the execution context with its X-Actor (or user) audit attribution,
+// and applies the workflow deadline. The returned cancel must always be called.
+func requestContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	exec := utils.ExecutionContextFromHeaders(r.Header)
+	if exec.TenantID != "" && !db.ValidTenantID(exec.TenantID) {
+		return nil, nil, BadRequest("Invalid tenant ID")
+	}
+	actor := r.Header.Get(utils.ActorHeader)
+	if actor == "" {
+		actor = exec.UserID
+	}
+	ctx := db.WithTenant(r.Context(), exec.TenantID)
+	ctx = db.WithAuditInfo(ctx, db.AuditInfo{Actor: actor, ExecutionID: exec.ExecutionID})
+	ctx = context.WithValue(ctx, executionContextKey{}, exec)
+	if exec.Deadline != nil {
+		ctx, cancel := context.WithDeadline(ctx, *exec.Deadline)
+		return ctx, cancel, nil
+	}
+	return ctx, func() {}, nil
+}
+
+type executionContextKey struct{}
+
+// ExecutionContextFrom returns the workflow context the orchestrator sent with
+// the request ctx belongs to. Outside a request it returns an empty context.
+func ExecutionContextFrom(ctx context.Context) types.ExecutionContext {
+	exec, _ := ctx.Value(executionContextKey{}).(types.ExecutionContext)
+	return exec
+}
+
+// Run serves the app until SIGINT or SIGTERM. It then reports draining on
+// /readyz for DrainDelay, stops accepting requests, waits up to ShutdownTimeout
+// for in-flight ones to finish and closes the database pool, so a rolling
+// restart does not drop workflow steps.
+func (a *App) Run() {
+	server := &http.Server{Addr: ":" + a.cfg.Port, Handler: a.srv.mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		a.logger.Info("Starting", "port", a.cfg.Port)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			a.fatal("Server failed", "error", err)
+		}
+	case <-ctx.Done():
+		stop()
+		a.srv.draining.Store(true)
+		a.logger.Info("Shutting down", "drain_delay", a.cfg.DrainDelay.String())
+		time.Sleep(a.cfg.DrainDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			a.logger.Warn("Shutdown did not complete", "error", err)
+		}
+	}
+
+	if a.srv.db != nil {
+		if err := a.srv.db.Close(); err != nil {
+			a.logger.Error("Failed to close database", "error", err)
+		}
+	}
+	tracingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.srv.shutdownTracing(tracingCtx); err != nil {
+		a.logger.Warn("Failed to flush traces", "error", err)
+	}
+	a.logger.Info("Stopped")
+}
+
+// statusRecorder captures the response status for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package lambdasdk
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"tala_base/types"
+	"tala_base/utils"
+)
+
+// CodeUnauthenticated is returned with a 401 when a request is not from the orchestrator
+const CodeUnauthenticated = string(types.ErrorCodeUnauthenticated)
+
+// maxSignedBody bounds the body read into memory to verify a signature
+const maxSignedBody = 10 << 20
+
+// authEnabled reports whether requests must be signed or carry the service token
+func (c Config) authEnabled() bool {
+	return c.AuthSecret != "" || c.ServiceToken != ""
+}
+
+// authenticate accepts a request signed with AuthSecret or bearing ServiceToken.
+// The signature covers the path the caller requested, before any ServeAll prefix
+// was stripped, the execution context headers requestContext scopes the request
+// by, and the body, which is buffered so the handler can still read it.
+func (a *App) authenticate(r *http.Request) *Error {
+	if !a.cfg.authEnabled() {
+		return nil
+	}
+
+	if a.cfg.AuthSecret != "" && r.Header.Get(utils.SignatureHeader) != "" {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+		if err != nil {
+			return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "Failed to read request body", Err: err}
+		}
+		if len(body) > maxSignedBody {
+			return NewError(http.StatusRequestEntityTooLarge, CodeBadRequest, "Request body is too large")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		path, _, _ := strings.Cut(r.RequestURI, "?")
+		if err := utils.VerifyLambdaRequest(
+			a.cfg.AuthSecret,
+			r.Header.Get(utils.SignatureHeader),
+			r.Header.Get(utils.SignatureTimestampHeader),
+			r.Method, path, r.Header, body, time.Now(),
+		); err != nil {
+			return &Error{Status: http.StatusUnauthorized, Code: CodeUnauthenticated, Message: "Invalid request signature", Err: err}
+		}
+		return nil
+	}
+
+	if a.cfg.ServiceToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && utils.ConstantTimeEqual(token, a.cfg.ServiceToken) {
+			return nil
+		}
+	}
+	return NewError(http.StatusUnauthorized, CodeUnauthenticated, "Request is not signed by the orchestrator")
+}
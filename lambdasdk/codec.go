@@ -0,0 +1,27 @@
+package lambdasdk
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Decode reads the JSON request body into v and validates it, returning a 400
+// Error if the body is malformed and a 422 Error if a `validate` rule fails
+func Decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "Invalid request body", Err: err}
+	}
+	return Validate(v)
+}
+
+// RespondJSON writes v as a JSON response with the given status
+func RespondJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// RespondError writes err in the standard error envelope
+func RespondError(w http.ResponseWriter, err *Error) {
+	RespondJSON(w, err.Status, ErrorBody{Error: err.Message, Code: err.Code, Fields: err.Fields})
+}
@@ -0,0 +1,79 @@
+package lambdasdk
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"tala_base/utils"
+)
+
+// Config holds the settings every lambda reads from its environment
+type Config struct {
+	// Name identifies the lambda in logs
+	Name string
+	// Port is the port to listen on, from PORT
+	Port string
+	// ShutdownTimeout bounds how long in-flight requests may run after SIGTERM, from SHUTDOWN_TIMEOUT
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long /readyz reports draining before the listener closes,
+	// giving the orchestrator's health poll time to stop routing here, from SHUTDOWN_DRAIN_DELAY
+	DrainDelay time.Duration
+	// LogFormat is json or text, from LOG_FORMAT; LogLevel is a slog level name, from LOG_LEVEL
+	LogFormat string
+	LogLevel  string
+	// MaxInFlight caps concurrent requests per process, from MAX_IN_FLIGHT; 0 is unlimited.
+	// Keep it at or below DB_MAX_OPEN_CONNS for lambdas that use the database.
+	MaxInFlight int
+	// RetryAfter is sent with 503s when MaxInFlight is reached, from LOAD_SHED_RETRY_AFTER
+	RetryAfter time.Duration
+	// AuthSecret verifies the orchestrator's request signatures, from LAMBDA_AUTH_SECRET.
+	// It and ServiceToken may be secret:// references, resolved when the app starts.
+	AuthSecret string
+	// ServiceToken is accepted as a bearer token from other callers, from LAMBDA_SERVICE_TOKEN.
+	// With neither set, lambdas accept any request.
+	ServiceToken string
+}
+
+// LoadConfig reads a lambda's configuration from the environment
+func LoadConfig(name string) Config {
+	cfg := Config{
+		Name:            name,
+		Port:            os.Getenv("PORT"),
+		ShutdownTimeout: 10 * time.Second,
+		LogFormat:       os.Getenv("LOG_FORMAT"),
+		LogLevel:        os.Getenv("LOG_LEVEL"),
+		RetryAfter:      time.Second,
+		AuthSecret:      os.Getenv("LAMBDA_AUTH_SECRET"),
+		ServiceToken:    os.Getenv("LAMBDA_SERVICE_TOKEN"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+	if v, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil {
+		cfg.ShutdownTimeout = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("SHUTDOWN_DRAIN_DELAY")); err == nil {
+		cfg.DrainDelay = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MAX_IN_FLIGHT")); err == nil {
+		cfg.MaxInFlight = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("LOAD_SHED_RETRY_AFTER")); err == nil {
+		cfg.RetryAfter = v
+	}
+	return cfg
+}
+
+// resolveSecrets replaces secret:// references in the auth settings with their values
+func (c *Config) resolveSecrets(ctx context.Context) error {
+	for _, value := range []*string{&c.AuthSecret, &c.ServiceToken} {
+		resolved, err := utils.ResolveSecret(ctx, utils.DefaultSecrets(), *value)
+		if err != nil {
+			return err
+		}
+		*value = resolved
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package lambdasdk
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tala_base/types"
+)
+
+// Envelope wraps a handler output in the StepResult the executor chains on,
+// turning v into the step's Data object
+func Envelope(v interface{}) (*types.StepResult, error) {
+	data, err := Data(v)
+	if err != nil {
+		return nil, err
+	}
+	return &types.StepResult{Data: data}, nil
+}
+
+// Data converts a handler output to the map form used for step Data.
+// v must encode to a JSON object.
+func Data(v interface{}) (map[string]interface{}, error) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode step data: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("step data must be a JSON object: %w", err)
+	}
+	return data, nil
+}
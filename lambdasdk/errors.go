@@ -0,0 +1,92 @@
+package lambdasdk
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/types"
+)
+
+// Error codes used in the standard error envelope, from the types taxonomy
+const (
+	CodeBadRequest       = string(types.ErrorCodeBadRequest)
+	CodeInvalidArgument  = string(types.ErrorCodeInvalidArgument)
+	CodeNotFound         = string(types.ErrorCodeNotFound)
+	CodeConflict         = string(types.ErrorCodeConflict)
+	CodeDuplicateEmail   = types.ErrorCodeDuplicateEmail
+	CodeMethodNotAllowed = string(types.ErrorCodeMethodNotAllowed)
+	CodeTimeout          = string(types.ErrorCodeTimeout)
+	CodeInternal         = string(types.ErrorCodeInternal)
+)
+
+// Error is an error with the HTTP status and code a handler wants returned
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	// Fields holds per-field messages for validation errors
+	Fields map[string]string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError creates an Error with the given status, code and client-facing message
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest creates a 400 Error
+func BadRequest(message string) *Error {
+	return NewError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// NotFound creates a 404 Error with a resource-specific code, keeping err for logging
+func NotFound(code, message string, err error) *Error {
+	return &Error{Status: http.StatusNotFound, Code: code, Message: message, Err: err}
+}
+
+// Unauthorized creates a 401 Error with the given code
+func Unauthorized(code, message string) *Error {
+	return NewError(http.StatusUnauthorized, code, message)
+}
+
+// ErrorBody is the standard error envelope every lambda responds with
+type ErrorBody struct {
+	Error  string            `json:"error"`
+	Code   string            `json:"code"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// toError maps a handler error onto an Error. Repository sentinels get their
+// matching status; anything unrecognised becomes a 500 without leaking details.
+func toError(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, db.ErrNotFound):
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: err.Error(), Err: err}
+	case errors.Is(err, db.ErrDuplicateEmail):
+		return &Error{Status: http.StatusConflict, Code: CodeDuplicateEmail, Message: "Email already exists", Err: err}
+	case errors.Is(err, db.ErrConflict):
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: "Conflicting change", Err: err}
+	case errors.Is(err, db.ErrInvalidArgument):
+		return &Error{Status: http.StatusBadRequest, Code: CodeInvalidArgument, Message: err.Error(), Err: err}
+	case db.IsTimeout(err):
+		return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: "Database timeout", Err: err}
+	default:
+		return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error", Err: err}
+	}
+}
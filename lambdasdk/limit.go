@@ -0,0 +1,60 @@
+package lambdasdk
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"tala_base/types"
+)
+
+// CodeOverloaded is returned with a 503 when a lambda sheds load
+const CodeOverloaded = string(types.ErrorCodeOverloaded)
+
+// limiter caps the number of requests handled at once across a process, so a
+// burst is rejected quickly instead of queuing on the database pool
+type limiter struct {
+	slots      chan struct{}
+	retryAfter time.Duration
+	inFlight   atomic.Int64
+}
+
+// newLimiter creates a limiter allowing max concurrent requests; max <= 0 means unlimited
+func newLimiter(max int, retryAfter time.Duration) *limiter {
+	l := &limiter{retryAfter: retryAfter}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// acquire takes a slot without waiting, reporting false when the process is saturated
+func (l *limiter) acquire() bool {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	l.inFlight.Add(1)
+	return true
+}
+
+func (l *limiter) release() {
+	l.inFlight.Add(-1)
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// reject answers a request that could not get a slot with 503 and Retry-After
+func (l *limiter) reject(w http.ResponseWriter) {
+	seconds := int(l.retryAfter.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	RespondError(w, NewError(http.StatusServiceUnavailable, CodeOverloaded, "Lambda is overloaded, retry later"))
+}
@@ -0,0 +1,27 @@
+package lambdasdk
+
+import (
+	"context"
+	"log/slog"
+
+	"tala_base/logging"
+)
+
+// newLogger builds the process logger from LOG_FORMAT (json, the default, or
+// text) and LOG_LEVEL (debug, info, warn or error), installs it as the slog
+// default and returns it tagged as the lambda component
+func newLogger(cfg Config) *slog.Logger {
+	return logging.Setup(logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat}).With("component", "lambda")
+}
+
+// withLogger attaches a request-scoped logger to ctx
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return logging.WithLogger(ctx, logger)
+}
+
+// LoggerFrom returns the logger for the request ctx belongs to, which carries
+// the lambda name and the request, execution and tenant IDs so handler logs
+// join the orchestrator's log stream. Outside a request it returns slog.Default().
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	return logging.LoggerFromContext(ctx)
+}
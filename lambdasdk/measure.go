@@ -0,0 +1,53 @@
+package lambdasdk
+
+import (
+	"context"
+	"sync"
+
+	"tala_base/types"
+)
+
+// measurements collects the metrics a handler reports for its request
+type measurements struct {
+	mu      sync.Mutex
+	metrics []types.StepMetric
+}
+
+type measurementsKey struct{}
+
+// withMeasurements attaches a collector for Count and Gauge to ctx
+func withMeasurements(ctx context.Context) (context.Context, *measurements) {
+	m := &measurements{}
+	return context.WithValue(ctx, measurementsKey{}, m), m
+}
+
+func (m *measurements) add(metric types.StepMetric) {
+	m.mu.Lock()
+	m.metrics = append(m.metrics, metric)
+	m.mu.Unlock()
+}
+
+func (m *measurements) list() []types.StepMetric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.metrics
+}
+
+// Count adds value to the counter name in the metrics of the step result the
+// handler answers a workflow with, such as Count(ctx, "users_created_total",
+// 1, nil). The orchestrator exposes it as tala_step_<name>. Nothing is
+// reported when the handler fails or is not called by a workflow step.
+func Count(ctx context.Context, name string, value float64, labels map[string]string) {
+	measure(ctx, types.StepMetric{Name: name, Type: types.StepMetricCounter, Value: value, Labels: labels})
+}
+
+// Gauge sets the gauge name, as Count does for counters
+func Gauge(ctx context.Context, name string, value float64, labels map[string]string) {
+	measure(ctx, types.StepMetric{Name: name, Type: types.StepMetricGauge, Value: value, Labels: labels})
+}
+
+func measure(ctx context.Context, metric types.StepMetric) {
+	if m, ok := ctx.Value(measurementsKey{}).(*measurements); ok {
+		m.add(metric)
+	}
+}
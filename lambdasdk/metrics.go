@@ -0,0 +1,216 @@
+package lambdasdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"tala_base/db"
+)
+
+// latencyBuckets are the histogram upper bounds, in seconds, for request and query durations
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative Prometheus-style histogram
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+type requestKey struct{ lambda, method, status string }
+type errorKey struct{ lambda, code string }
+type queryKey struct{ lambda, op string }
+type outboundKey struct{ lambda, client string }
+type outboundStatusKey struct{ lambda, client, status string }
+
+// metrics collects request and database timings for every lambda in the process
+type metrics struct {
+	mu          sync.Mutex
+	requests    map[requestKey]uint64
+	errors      map[errorKey]uint64
+	latency     map[string]*histogram
+	queries     map[queryKey]*histogram
+	queryErrors map[queryKey]uint64
+	outbound    map[outboundKey]*histogram
+	outboundReq map[outboundStatusKey]uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:    make(map[requestKey]uint64),
+		errors:      make(map[errorKey]uint64),
+		latency:     make(map[string]*histogram),
+		queries:     make(map[queryKey]*histogram),
+		queryErrors: make(map[queryKey]uint64),
+		outbound:    make(map[outboundKey]*histogram),
+		outboundReq: make(map[outboundStatusKey]uint64),
+	}
+}
+
+// observeRequest records one handled request; code is the error code, empty on success
+func (m *metrics) observeRequest(lambda, method string, status int, code string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{lambda, method, strconv.Itoa(status)}]++
+	if code != "" {
+		m.errors[errorKey{lambda, code}]++
+	}
+	h := m.latency[lambda]
+	if h == nil {
+		h = &histogram{}
+		m.latency[lambda] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// observeQuery is installed as the db.QueryObserver
+func (m *metrics) observeQuery(ctx context.Context, op string, d time.Duration, err error) {
+	key := queryKey{lambdaFrom(ctx), op}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := m.queries[key]
+	if h == nil {
+		h = &histogram{}
+		m.queries[key] = h
+	}
+	h.observe(d.Seconds())
+	if err != nil {
+		m.queryErrors[key]++
+	}
+}
+
+// observeOutbound is installed as the httpclient.Observer. Requests that got
+// no response are counted under status "error".
+func (m *metrics) observeOutbound(ctx context.Context, client, method string, status int, d time.Duration, err error) {
+	key := outboundKey{lambdaFrom(ctx), client}
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outboundReq[outboundStatusKey{key.lambda, client, code}]++
+	h := m.outbound[key]
+	if h == nil {
+		h = &histogram{}
+		m.outbound[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// write renders the metrics, the in-flight gauge and pool stats when pool is set, in the Prometheus text format
+func (m *metrics) write(w io.Writer, inFlight int64, pool *db.PoolStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP tala_lambda_requests_total Requests handled, by lambda, method and status.\n# TYPE tala_lambda_requests_total counter\n")
+	for _, k := range sortedKeys(m.requests, func(k requestKey) string { return k.lambda + k.method + k.status }) {
+		fmt.Fprintf(w, "tala_lambda_requests_total{lambda=%q,method=%q,status=%q} %d\n", k.lambda, k.method, k.status, m.requests[k])
+	}
+
+	fmt.Fprintf(w, "# HELP tala_lambda_errors_total Requests that returned an error, by lambda and error code.\n# TYPE tala_lambda_errors_total counter\n")
+	for _, k := range sortedKeys(m.errors, func(k errorKey) string { return k.lambda + k.code }) {
+		fmt.Fprintf(w, "tala_lambda_errors_total{lambda=%q,code=%q} %d\n", k.lambda, k.code, m.errors[k])
+	}
+
+	fmt.Fprintf(w, "# HELP tala_lambda_request_duration_seconds Request handling time, by lambda.\n# TYPE tala_lambda_request_duration_seconds histogram\n")
+	for _, lambda := range sortedKeys(m.latency, func(k string) string { return k }) {
+		writeHistogram(w, "tala_lambda_request_duration_seconds", fmt.Sprintf("lambda=%q", lambda), m.latency[lambda])
+	}
+
+	fmt.Fprintf(w, "# HELP tala_lambda_db_query_duration_seconds Database statement time, by lambda and operation.\n# TYPE tala_lambda_db_query_duration_seconds histogram\n")
+	for _, k := range sortedKeys(m.queries, func(k queryKey) string { return k.lambda + k.op }) {
+		writeHistogram(w, "tala_lambda_db_query_duration_seconds", fmt.Sprintf("lambda=%q,op=%q", k.lambda, k.op), m.queries[k])
+	}
+
+	fmt.Fprintf(w, "# HELP tala_lambda_db_query_errors_total Database statements that failed, by lambda and operation.\n# TYPE tala_lambda_db_query_errors_total counter\n")
+	for _, k := range sortedKeys(m.queryErrors, func(k queryKey) string { return k.lambda + k.op }) {
+		fmt.Fprintf(w, "tala_lambda_db_query_errors_total{lambda=%q,op=%q} %d\n", k.lambda, k.op, m.queryErrors[k])
+	}
+
+	fmt.Fprintf(w, "# HELP tala_lambda_http_client_requests_total Outbound HTTP requests, by lambda, client and status.\n# TYPE tala_lambda_http_client_requests_total counter\n")
+	for _, k := range sortedKeys(m.outboundReq, func(k outboundStatusKey) string { return k.lambda + k.client + k.status }) {
+		fmt.Fprintf(w, "tala_lambda_http_client_requests_total{lambda=%q,client=%q,status=%q} %d\n", k.lambda, k.client, k.status, m.outboundReq[k])
+	}
+
+	fmt.Fprintf(w, "# HELP tala_lambda_http_client_duration_seconds Outbound HTTP request time including retries, by lambda and client.\n# TYPE tala_lambda_http_client_duration_seconds histogram\n")
+	for _, k := range sortedKeys(m.outbound, func(k outboundKey) string { return k.lambda + k.client }) {
+		writeHistogram(w, "tala_lambda_http_client_duration_seconds", fmt.Sprintf("lambda=%q,client=%q", k.lambda, k.client), m.outbound[k])
+	}
+
+	fmt.Fprintf(w, "# HELP tala_lambda_in_flight_requests Requests currently being handled.\n# TYPE tala_lambda_in_flight_requests gauge\ntala_lambda_in_flight_requests %d\n", inFlight)
+
+	if pool != nil {
+		fmt.Fprintf(w, "# HELP tala_db_open_connections Number of established connections, in use and idle.\n# TYPE tala_db_open_connections gauge\ntala_db_open_connections %d\n", pool.Open)
+		fmt.Fprintf(w, "# HELP tala_db_in_use_connections Number of connections currently in use.\n# TYPE tala_db_in_use_connections gauge\ntala_db_in_use_connections %d\n", pool.InUse)
+		fmt.Fprintf(w, "# HELP tala_db_wait_seconds_total Total time blocked waiting for a connection.\n# TYPE tala_db_wait_seconds_total counter\ntala_db_wait_seconds_total %g\n", pool.WaitDuration.Seconds())
+	}
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, labels, bound, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// sortedKeys returns m's keys ordered by sortKey, so scrapes are stable
+func sortedKeys[K comparable, V any](m map[K]V, sortKey func(K) string) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return sortKey(keys[i]) < sortKey(keys[j]) })
+	return keys
+}
+
+// handleMetrics exposes the process's metrics in the Prometheus text format
+func (a *App) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var pool *db.PoolStats
+	if a.srv.db != nil {
+		stats := db.Stats(a.srv.db)
+		pool = &stats
+	}
+	a.srv.metrics.write(w, a.srv.limiter.inFlight.Load(), pool)
+}
+
+type lambdaKey struct{}
+
+// withLambda records which lambda is handling ctx's request, for query metrics
+func withLambda(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, lambdaKey{}, name)
+}
+
+func lambdaFrom(ctx context.Context) string {
+	if name, ok := ctx.Value(lambdaKey{}).(string); ok {
+		return name
+	}
+	return "unknown"
+}
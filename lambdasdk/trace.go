@@ -0,0 +1,68 @@
+package lambdasdk
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"tala_base/tracing"
+)
+
+// startRequestSpan starts a server span for r as a child of the caller's
+// traceparent, so the lambda call joins the executor's trace
+func (a *App) startRequestSpan(r *http.Request, pattern string) (*http.Request, trace.Span) {
+	ctx := tracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracing.Tracer().Start(ctx, a.name+" "+pattern,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("lambda", a.name),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		),
+	)
+	return r.WithContext(ctx), span
+}
+
+// endRequestSpan records the outcome of a request on its span and ends it
+func endRequestSpan(span trace.Span, status int, code string, err error) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if code != "" {
+		span.SetAttributes(attribute.String("error.code", code))
+	}
+	if status >= http.StatusInternalServerError {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetStatus(codes.Error, code)
+	}
+	span.End()
+}
+
+// observeQuery is the db.QueryObserver for the app's pool: it records query
+// metrics and a client span covering the statement
+func (a *App) observeQuery(ctx context.Context, op string, d time.Duration, err error) {
+	a.srv.metrics.observeQuery(ctx, op, d, err)
+
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	end := time.Now()
+	_, span := tracing.Tracer().Start(ctx, "db "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(end.Add(-d)),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", op),
+		),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
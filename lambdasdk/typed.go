@@ -0,0 +1,43 @@
+package lambdasdk
+
+import (
+	"context"
+	"net/http"
+
+	"tala_base/types"
+)
+
+// Input is a typed handler's decoded and validated request body, with the
+// request and workflow context it arrived with
+type Input[T any] struct {
+	Body    T
+	Request *http.Request
+	Context types.ExecutionContext
+}
+
+// Output is the typed form of the StepResult envelope a lambda answers a
+// workflow step with, for Go callers decoding a lambda's response
+type Output[T any] struct {
+	Data  T                    `json:"data"`
+	Error *types.WorkflowError `json:"error,omitempty"`
+}
+
+// TypedHandlerFunc handles a request whose body decodes into TIn and whose
+// response is TOut
+type TypedHandlerFunc[TIn, TOut any] func(ctx context.Context, in Input[TIn]) (TOut, error)
+
+// Handle adapts a typed handler for App.Handle. The body is decoded into TIn
+// and validated with Decode before fn runs, so fn only sees valid input:
+//
+//	app.Handle("/", lambdasdk.Handle(createUser), http.MethodPost)
+//
+//	func createUser(ctx context.Context, in lambdasdk.Input[types.CreateUserInput]) (types.CreateUserOutput, error)
+func Handle[TIn, TOut any](fn TypedHandlerFunc[TIn, TOut]) HandlerFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		in := Input[TIn]{Request: r, Context: ExecutionContextFrom(ctx)}
+		if err := Decode(r, &in.Body); err != nil {
+			return nil, err
+		}
+		return fn(ctx, in)
+	}
+}
@@ -0,0 +1,31 @@
+package lambdasdk
+
+import (
+	"errors"
+	"net/http"
+
+	"tala_base/types"
+	"tala_base/utils/validate"
+)
+
+// CodeValidationFailed is the error code for inputs rejected by Validate
+const CodeValidationFailed = string(types.ErrorCodeValidationFailed)
+
+// Validate checks the `validate` struct tags of v, which must be a struct or
+// a pointer to one, with the rules of utils/validate: required, notblank,
+// email, enum, min, max and the rest of go-playground/validator's. Optional
+// pointer fields start their rules with omitnil.
+// It returns a 422 Error listing the message for each invalid field, keyed by JSON name.
+func Validate(v interface{}) error {
+	err := validate.Struct(v)
+	var fields validate.FieldErrors
+	if !errors.As(err, &fields) {
+		return err
+	}
+	return &Error{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeValidationFailed,
+		Message: "Validation failed",
+		Fields:  fields,
+	}
+}
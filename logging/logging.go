@@ -0,0 +1,85 @@
+// Package logging builds the structured slog loggers shared by the server,
+// orchestrator, CLI and lambdas, so every process writes one log format
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Config controls the process logger
+type Config struct {
+	// Level is a slog level name: debug, info (the default), warn or error
+	Level string
+	// Format is json (the default) or text
+	Format string
+	// Output is where records are written; defaults to stderr
+	Output io.Writer
+}
+
+// ConfigFromEnv reads LOG_LEVEL and LOG_FORMAT
+func ConfigFromEnv() Config {
+	return Config{
+		Level:  os.Getenv("LOG_LEVEL"),
+		Format: os.Getenv("LOG_FORMAT"),
+	}
+}
+
+// New builds a logger for cfg. An unknown level falls back to info and an
+// unknown format to json.
+func New(cfg Config) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	out := cfg.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	var handler slog.Handler = slog.NewJSONHandler(out, opts)
+	if strings.EqualFold(cfg.Format, "text") {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	return slog.New(handler)
+}
+
+// Setup builds the logger for cfg and installs it as the slog default, which
+// also routes the standard log package through it
+func Setup(cfg Config) *slog.Logger {
+	logger := New(cfg)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Component returns the default logger tagged with component, such as
+// "server" or "orchestrator"
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+// Fatal logs msg at error level and exits with status 1
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type loggerKey struct{}
+
+// WithLogger attaches a request-scoped logger to ctx
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger attached to ctx, which carries the
+// request's correlation IDs, or slog.Default() when there is none
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
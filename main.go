@@ -1,52 +1,118 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
+
+	"tala_base/db"
+	"tala_base/logging"
 	"tala_base/orchestrator"
+	"tala_base/outbox"
+	"tala_base/quota"
+	"tala_base/storage"
+	"tala_base/tracing"
+	"tala_base/triggers"
 	"tala_base/types"
 	"tala_base/utils"
+	"tala_base/utils/middleware"
 )
 
 type Server struct {
 	executor *orchestrator.ChainExecutor
+	metrics  *middleware.Metrics
+	// jobs runs queued executions: scheduled ones, and every execution when
+	// durable is set. nil when DATABASE_URL is not set.
+	jobs *orchestrator.DurableEngine
+	// durable queues workflows on jobs instead of running them in the
+	// request; set by EXECUTION_MODE=durable
+	durable bool
+	// schedules fires recurring schedules on jobs; nil when DATABASE_URL is not set
+	schedules *orchestrator.Scheduler
+	// quotas counts usage per tenant and API key and rejects workflows beyond
+	// their monthly quotas; nil when DATABASE_URL is not set
+	quotas *quota.Meter
+	// pressure refuses new workflow submissions while the server is saturated
+	pressure *backpressure
+
+	// db backs API keys and admin endpoints; nil when DATABASE_URL is not set
+	db          *sql.DB
+	adminToken  string
+	requireKeys bool
 }
 
-func NewServer() *Server {
+func NewServer(dbConn *sql.DB) *Server {
 	executor := orchestrator.NewChainExecutor()
+	logger := logging.Component("server")
 
 	// Load all workflows from the workflows directory
 	workflowFiles, err := filepath.Glob("workflows/*.yaml")
 	if err != nil {
-		log.Printf("Warning: Failed to read workflows directory: %v", err)
+		logger.Warn("Failed to read workflows directory", "error", err)
 	}
 
 	for _, file := range workflowFiles {
 		name := strings.TrimSuffix(filepath.Base(file), ".yaml")
 		if err := executor.LoadWorkflow(name); err != nil {
-			log.Printf("Warning: Failed to load workflow %s: %v", name, err)
+			logger.Warn("Failed to load workflow", "workflow", name, "error", err)
+		} else {
+			logger.Info("Loaded workflow", "workflow", name)
+		}
+	}
+
+	locker, err := orchestrator.LockerFromEnv(dbConn)
+	if err != nil {
+		logger.Warn("Workflow locks only cover this process", "error", err)
+	} else {
+		executor.SetLocker(locker)
+	}
+
+	flags, err := orchestrator.FlagsFromEnv()
+	if err != nil {
+		logger.Warn("Feature flags read from FLAG_* variables", "error", err)
+	} else {
+		executor.SetFlags(flags)
+	}
+
+	if os.Getenv("S3_BUCKET") != "" {
+		blobs, err := storage.New(storage.ConfigFromEnv())
+		if err != nil {
+			logger.Warn("Binary blob steps disabled", "error", err)
 		} else {
-			log.Printf("Loaded workflow: %s", name)
+			executor.SetBlobStore(blobs)
 		}
 	}
 
-	return &Server{executor: executor}
+	adminToken, err := utils.SecretEnv("ADMIN_TOKEN")
+	if err != nil {
+		logger.Warn("Admin API disabled", "error", err)
+	}
+
+	return &Server{
+		executor:    executor,
+		metrics:     middleware.NewMetrics(),
+		pressure:    newBackpressure(BackpressureConfigFromEnv(), dbConn),
+		db:          dbConn,
+		adminToken:  adminToken,
+		requireKeys: os.Getenv("REQUIRE_API_KEY") == "true",
+	}
 }
 
 // handleLambda handles direct lambda invocations
 func (s *Server) handleLambda(w http.ResponseWriter, r *http.Request) {
-	utils.SetCORSHeaders(w)
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodPost {
-		utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -54,7 +120,7 @@ func (s *Server) handleLambda(w http.ResponseWriter, r *http.Request) {
 	path := strings.Trim(r.URL.Path, "/")
 	parts := strings.Split(path, "/")
 	if len(parts) != 2 {
-		utils.RespondError(w, http.StatusBadRequest, "Invalid lambda path")
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid lambda path")
 		return
 	}
 	lambdaName := parts[1]
@@ -62,13 +128,17 @@ func (s *Server) handleLambda(w http.ResponseWriter, r *http.Request) {
 	// Parse input
 	var input map[string]interface{}
 	if err := utils.DecodeJSONBody(w, r, &input); err != nil {
-		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Create workflow input
 	workflowInput := types.WorkflowInput{
-		Data: input,
+		Data:    input,
+		Context: requestContext(r),
+	}
+	if !s.admit(w, r, workflowInput.Context, 0) {
+		return
 	}
 
 	// Execute single step
@@ -85,28 +155,17 @@ func (s *Server) handleLambda(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		utils.RespondError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	if result.Error != nil {
-		utils.RespondError(w, http.StatusInternalServerError, result.Error.Message)
+		utils.RespondError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.RespondJSON(w, http.StatusOK, result)
+	utils.RespondResult(w, r, result.Data, result.Error)
 }
 
 // handleWorkflow handles workflow executions
 func (s *Server) handleWorkflow(w http.ResponseWriter, r *http.Request) {
-	utils.SetCORSHeaders(w)
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	if r.Method != http.MethodPost {
-		utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
@@ -114,65 +173,460 @@ func (s *Server) handleWorkflow(w http.ResponseWriter, r *http.Request) {
 	path := strings.Trim(r.URL.Path, "/")
 	parts := strings.Split(path, "/")
 	if len(parts) != 2 {
-		utils.RespondError(w, http.StatusBadRequest, "Invalid workflow path")
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid workflow path")
 		return
 	}
 	workflowName := parts[1]
+	s.warnDeprecated(w, workflowName)
 
 	// Parse input
 	var input map[string]interface{}
 	if err := utils.DecodeJSONBody(w, r, &input); err != nil {
-		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Create workflow input
 	workflowInput := types.WorkflowInput{
-		Data: input,
+		Data:    input,
+		Context: requestContext(r),
+	}
+
+	// A run_at query parameter schedules the execution for later
+	var runAt time.Time
+	if v := r.URL.Query().Get("run_at"); v != "" {
+		if s.jobs == nil {
+			utils.RespondError(w, r, http.StatusBadRequest, "Scheduled executions need DATABASE_URL")
+			return
+		}
+		var err error
+		if runAt, err = time.Parse(time.RFC3339, v); err != nil {
+			utils.RespondError(w, r, http.StatusBadRequest, "run_at must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	// A priority query parameter orders queued executions; it has no effect
+	// on one run within the request
+	priority := types.ExecutionPriority(r.URL.Query().Get("priority"))
+	if !priority.Valid() {
+		utils.RespondError(w, r, http.StatusBadRequest, "priority must be low, normal or high")
+		return
+	}
+
+	// Refuse the execution while the server is saturated, before counting it
+	// against the caller's monthly quotas
+	queued := s.durable || !runAt.IsZero()
+	done, ok := s.admitLoad(w, r, !queued)
+	if !ok {
+		return
+	}
+	defer done()
+	if !s.admit(w, r, workflowInput.Context, 1) {
+		return
+	}
+
+	// Queue durable and scheduled executions, answering with the execution to poll
+	if queued {
+		ctx := db.WithTenant(r.Context(), workflowInput.Context.TenantID)
+		var exec *types.Execution
+		var invalid *types.WorkflowError
+		var err error
+		if runAt.IsZero() {
+			exec, invalid, err = s.jobs.Submit(ctx, workflowName, workflowInput, priority)
+		} else {
+			exec, invalid, err = s.jobs.Schedule(ctx, workflowName, workflowInput, runAt, priority)
+		}
+		if err != nil {
+			utils.RespondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if invalid != nil {
+			utils.RespondResult(w, r, nil, invalid)
+			return
+		}
+		w.Header().Set(utils.ExecutionIDHeader, exec.ID)
+		w.Header().Set("Location", "/executions/"+exec.ID)
+		utils.RespondSuccess(w, r, http.StatusAccepted, exec)
+		return
 	}
 
 	// Execute workflow
 	result, err := s.executor.ExecuteChain(workflowName, workflowInput)
 	if err != nil {
-		utils.RespondError(w, http.StatusInternalServerError, err.Error())
+		utils.RespondError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.RespondJSON(w, http.StatusOK, result)
+	w.Header().Set(utils.ExecutionIDHeader, result.Context.ExecutionID)
+	utils.RespondResult(w, r, result.Data, result.Error)
 }
 
-// handleListWorkflows returns a list of all available workflows
-func (s *Server) handleListWorkflows(w http.ResponseWriter, r *http.Request) {
-	utils.SetCORSHeaders(w)
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+// warnDeprecated tells callers of a deprecated workflow so through the
+// Deprecation, Sunset and Warning response headers
+func (s *Server) warnDeprecated(w http.ResponseWriter, workflow string) {
+	deprecation := s.executor.Deprecation(workflow)
+	if deprecation == nil {
+		return
+	}
+	w.Header().Set("Deprecation", "true")
+	if sunset, _ := deprecation.SunsetTime(); !sunset.IsZero() {
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+	message := deprecation.Message
+	if message == "" {
+		message = fmt.Sprintf("workflow %s is deprecated", workflow)
+	}
+	w.Header().Set("Warning", fmt.Sprintf("299 - %q", message))
+}
+
+// admit checks the quotas of the execution's tenant and API key, counting
+// executions against them, and writes the QUOTA_EXCEEDED error or a 500 when
+// it is refused. Every request is admitted when usage is not tracked.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request, execCtx types.ExecutionContext, executions int64) bool {
+	if s.quotas == nil {
+		return true
+	}
+	ctx := db.WithTenant(r.Context(), execCtx.TenantID)
+	exceeded, err := s.quotas.Admit(ctx, execCtx.APIKeyID, executions)
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to check quota")
+		return false
+	}
+	if exceeded != nil {
+		utils.RespondResult(w, r, nil, exceeded)
+		return false
+	}
+	return true
+}
+
+// handleExecution returns a stored execution with its steps (GET), such as
+// one queued by a durable workflow request, or cancels a scheduled execution
+// that has not started yet (DELETE). /executions/{id}/replay is handled by
+// handleReplay and /executions/{id}/timeline by handleTimeline.
+func (s *Server) handleExecution(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		utils.RespondError(w, r, http.StatusNotFound, "Execution history is not enabled")
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/executions/"), "/")
+	if id == "" || (action != "" && action != "replay" && action != "timeline") {
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid execution path")
+		return
+	}
+	switch action {
+	case "replay":
+		s.handleReplay(w, r, id)
+		return
+	case "timeline":
+		s.handleTimeline(w, r, id)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+	if r.Method == http.MethodDelete {
+		exec, err := db.CancelScheduledExecution(ctx, s.db, id)
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			utils.RespondError(w, r, http.StatusNotFound, "Execution not found")
+		case errors.Is(err, db.ErrConflict):
+			utils.RespondError(w, r, http.StatusConflict, "Only scheduled executions that have not started can be canceled")
+		case err != nil:
+			utils.RespondError(w, r, http.StatusInternalServerError, "Failed to cancel execution")
+		default:
+			utils.RespondSuccess(w, r, http.StatusOK, exec)
+		}
+		return
+	}
+
+	exec, err := db.GetExecution(ctx, s.db, id)
+	if errors.Is(err, db.ErrNotFound) {
+		utils.RespondError(w, r, http.StatusNotFound, "Execution not found")
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to get execution")
+		return
+	}
+	utils.RespondSuccess(w, r, http.StatusOK, exec)
+}
+
+// handleListExecutions lists stored executions, newest first, filtered by the
+// workflow, status and replay_of query parameters and paged by cursor and limit.
+// status=scheduled lists pending scheduled runs, soonest first.
+func (s *Server) handleListExecutions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		utils.RespondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		utils.RespondError(w, r, http.StatusNotFound, "Execution history is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	opts := types.ListExecutionsInput{
+		PageRequest: types.PageRequest{Cursor: query.Get("cursor"), Limit: limit},
+		OrderBy:     "created_at",
+		Descending:  true,
+		Workflow:    query.Get("workflow"),
+		Status:      types.ExecutionStatus(query.Get("status")),
+		ReplayOf:    query.Get("replay_of"),
+	}
+	if opts.Status == types.ExecutionScheduled {
+		opts.OrderBy, opts.Descending = "scheduled_for", false
+	}
+
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+	executions, err := db.ListExecutions(ctx, s.db, opts)
+	if errors.Is(err, db.ErrInvalidArgument) || errors.Is(err, types.ErrInvalidCursor) {
+		utils.RespondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to list executions")
+		return
+	}
+	utils.RespondSuccess(w, r, http.StatusOK, executions)
+}
+
+// handleListWorkflows returns a list of all available workflows
+func (s *Server) handleListWorkflows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Get list of workflows
 	workflows := s.executor.GetWorkflows()
 
-	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{
+	utils.RespondSuccess(w, r, http.StatusOK, map[string]interface{}{
 		"workflows": workflows,
 	})
 }
 
+// requestContext seeds the workflow context from request headers so that
+// the executor can forward them to every lambda in the chain. Callers may set
+// the user, deadline and vars; execution IDs and the idempotency keys derived
+// from them are only ever assigned by the server.
+func requestContext(r *http.Request) types.ExecutionContext {
+	ctx := utils.ExecutionContextFromHeaders(r.Header)
+	ctx.ExecutionID = ""
+	ctx.IdempotencyKey = ""
+	if ctx.RequestID == "" {
+		ctx.RequestID = uuid.NewString()
+	}
+	ctx.TraceParent = tracing.Traceparent(r.Context())
+	ctx.APIKeyID = apiKeyID(r)
+	return ctx
+}
+
+// handleListLambdas returns the registered lambdas and their last known health
+func (s *Server) handleListLambdas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	utils.RespondSuccess(w, r, http.StatusOK, map[string]interface{}{
+		"lambdas": s.executor.Registry().Statuses(),
+	})
+}
+
 func main() {
-	server := NewServer()
+	logging.Setup(logging.ConfigFromEnv())
+
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			logging.Fatal("Command failed", "command", os.Args[1], "error", err)
+		}
+		return
+	}
+	logger := logging.Component("server")
+
+	if os.Getenv("MIGRATE_ON_STARTUP") == "true" {
+		if err := migrateOnStartup(); err != nil {
+			logging.Fatal("Migration failed", "error", err)
+		}
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), "tala-server")
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	var dbConn *sql.DB
+	if os.Getenv("DATABASE_URL") != "" {
+		var err error
+		dbConn, err = db.Connect(db.ConfigFromEnv())
+		if err != nil {
+			logging.Fatal("Failed to connect to database", "error", err)
+		}
+		defer dbConn.Close()
+	}
+
+	server := NewServer(dbConn)
+	if server.requireKeys && dbConn == nil {
+		logging.Fatal("REQUIRE_API_KEY is set but DATABASE_URL is not")
+	}
+
+	// Relay execution events to the sinks configured by OUTBOX_* through the
+	// outbox table, so they survive a sink being briefly down
+	var relay *outbox.Relay
+	if dbConn != nil {
+		outboxCfg, err := outbox.ConfigFromEnv()
+		if err != nil {
+			logging.Fatal("Invalid outbox configuration", "error", err)
+		}
+		if len(outboxCfg.Sinks) > 0 {
+			relay = outbox.NewRelay(dbConn, outboxCfg)
+			server.executor.OnFinish(func(execCtx types.ExecutionContext, event types.ExecutionEvent) {
+				ctx := db.WithTenant(context.Background(), execCtx.TenantID)
+				if err := relay.Record(ctx, dbConn, event); err != nil {
+					logger.Warn("Failed to record execution event", "workflow", event.Workflow, "error", err)
+				}
+			})
+			relay.Start()
+		}
+	}
+
+	// Run workflows from the durable job table when EXECUTION_MODE=durable.
+	// With a database the workers also start scheduled executions when they
+	// fall due, whatever the mode.
+	switch mode := os.Getenv("EXECUTION_MODE"); mode {
+	case "", "sync":
+	case "durable":
+		if dbConn == nil {
+			logging.Fatal("EXECUTION_MODE=durable needs DATABASE_URL")
+		}
+		server.durable = true
+	default:
+		logging.Fatal("Unknown EXECUTION_MODE (expected sync or durable)", "mode", mode)
+	}
+	if dbConn != nil {
+		// Count executions and lambda calls per tenant and API key
+		server.quotas = quota.NewMeter(dbConn, quota.ConfigFromEnv())
+		server.executor.OnCall(func(execCtx types.ExecutionContext, step types.Step) {
+			server.quotas.CountStep(execCtx)
+		})
+		server.quotas.Start()
+
+		server.jobs = orchestrator.NewDurableEngine(server.executor, dbConn, orchestrator.DurableConfigFromEnv())
+		if relay != nil {
+			server.jobs.SetOutbox(relay)
+		}
+		server.jobs.Start()
+
+		// Fire recurring schedules managed through /schedules
+		var interval time.Duration
+		if v, err := time.ParseDuration(os.Getenv("SCHEDULER_POLL_INTERVAL")); err == nil {
+			interval = v
+		}
+		server.schedules = orchestrator.NewScheduler(server.jobs, dbConn, interval)
+		server.schedules.Start()
+	}
+	limiter := utils.NewRateLimiter(utils.RateLimitConfigFromEnv())
+
+	// Admin routes need the admin token instead of an API key
+	api := func(route string) middleware.Middleware {
+		return server.apiMiddleware(route, limiter)
+	}
+	admin := middleware.Chain(middleware.Standard("admin", server.metrics), server.requireAdmin)
 
 	// Handle direct lambda invocations
-	http.HandleFunc("/lambda/", server.handleLambda)
+	http.HandleFunc("/lambda/", middleware.With(server.handleLambda, api("lambda")))
 
 	// Handle workflow executions
-	http.HandleFunc("/workflow/", server.handleWorkflow)
+	http.HandleFunc("/workflow/", middleware.With(server.handleWorkflow, api("workflow")))
+
+	// Handle execution lookups
+	http.HandleFunc("/executions", middleware.With(server.handleListExecutions, api("executions")))
+	http.HandleFunc("/executions/", middleware.With(server.handleExecution, api("executions")))
+
+	// Handle recurring schedules
+	http.HandleFunc("/schedules", middleware.With(server.handleSchedules, api("schedules")))
+	http.HandleFunc("/schedules/", middleware.With(server.handleSchedule, api("schedules")))
+
+	// Handle the audit log of schedule, API key and cancellation changes
+	http.HandleFunc("/audit", middleware.With(server.handleAudit, api("audit")))
+
+	// Handle usage reporting
+	http.HandleFunc("/usage", middleware.With(server.handleUsage, api("usage")))
 
 	// Handle workflow listing
-	http.HandleFunc("/workflows", server.handleListWorkflows)
+	http.HandleFunc("/workflows", middleware.With(server.handleListWorkflows, api("workflows")))
+
+	// Handle API key administration
+	http.HandleFunc("/admin/api-keys", middleware.With(server.handleAPIKeys, admin))
+	http.HandleFunc("/admin/api-keys/", middleware.With(server.handleAPIKey, admin))
+
+	// Handle operator overrides of stuck durable executions
+	http.HandleFunc("/admin/executions/", middleware.With(server.handleAdminExecution, admin))
+
+	// Handle quota administration and usage across tenants
+	http.HandleFunc("/admin/quotas", middleware.With(server.handleQuotas, admin))
+	http.HandleFunc("/admin/usage", middleware.With(server.handleAdminUsage, admin))
+
+	// Poll lambda readiness so workflows fail fast on a lambda that is down
+	healthInterval := 10 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("LAMBDA_HEALTH_INTERVAL")); err == nil && v > 0 {
+		healthInterval = v
+	}
+	go server.executor.Registry().Poll(context.Background(), healthInterval)
+
+	// Optionally wake the lambdas the workflows call and keep connections to
+	// them open, so the first execution after a quiet spell is not slowed by
+	// cold starts and new connections
+	if warm, _ := strconv.ParseBool(os.Getenv("LAMBDA_WARMUP")); warm {
+		warmInterval := time.Minute
+		if v, err := time.ParseDuration(os.Getenv("LAMBDA_WARMUP_INTERVAL")); err == nil && v > 0 {
+			warmInterval = v
+		}
+		go server.executor.WarmEvery(context.Background(), warmInterval)
+	}
+	// Keep LAMBDA_WARM_CONNS connections dialed ahead to each lambda instance
+	go server.executor.KeepConnsWarm(context.Background())
+
+	// Re-read cached secrets so rotated values reach their rotation hooks
+	go utils.DefaultSecrets().Watch(context.Background(), time.Minute, func(err error) {
+		logger.Warn("Failed to refresh secrets", "error", err)
+	})
+
+	// Start workflows from NATS subjects when NATS_URL is set
+	natsCfg, err := triggers.NATSConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Invalid NATS configuration", "error", err)
+	}
+	var natsTrigger *triggers.NATSTrigger
+	if natsCfg.URL != "" {
+		natsTrigger, err = triggers.StartNATS(natsCfg, server.executor)
+		if err != nil {
+			logging.Fatal("Failed to start NATS trigger", "error", err)
+		}
+	}
+
+	// Start workflows from an SQS queue when SQS_QUEUE_URL is set
+	var sqsTrigger *triggers.SQSTrigger
+	if sqsCfg := triggers.SQSConfigFromEnv(); sqsCfg.QueueURL != "" {
+		sqsTrigger, err = triggers.StartSQS(sqsCfg, server.executor)
+		if err != nil {
+			logging.Fatal("Failed to start SQS trigger", "error", err)
+		}
+	}
+
+	// Handle lambda health listing
+	http.HandleFunc("/lambdas", middleware.With(server.handleListLambdas, api("lambdas")))
+
+	// Health, readiness and metrics probes bypass logging, rate limiting and API key auth
+	http.HandleFunc("/healthz", middleware.With(server.handleHealthz, middleware.Recover))
+	http.HandleFunc("/readyz", middleware.With(server.handleReadyz, middleware.Recover))
+	http.HandleFunc("/metrics", middleware.With(server.handleMetrics, middleware.Recover))
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -180,20 +634,86 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Starting server on port %s", port)
-	log.Printf("Available endpoints:")
-	log.Printf("  List workflows:  GET  /workflows")
-	log.Printf("  Direct lambda:   POST /lambda/<lambda_name>")
-	log.Printf("  Workflow:        POST /workflow/<workflow_name>")
-	log.Printf("\nExample usage:")
-	log.Printf("  # List available workflows")
-	log.Printf("  curl http://localhost:%s/workflows", port)
-	log.Printf("\n  # Call lambda directly")
-	log.Printf("  curl -X POST http://localhost:%s/lambda/user_create -H \"Content-Type: application/json\" -d '{\"data\":{\"email\":\"test@example.com\",\"name\":\"Test User\"}}'", port)
-	log.Printf("\n  # Execute workflow")
-	log.Printf("  curl -X POST http://localhost:%s/workflow/user_signup_chain -H \"Content-Type: application/json\" -d '{\"data\":{\"email\":\"test@example.com\",\"name\":\"Test User\"}}'", port)
-
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+	logger.Info("Starting server",
+		"port", port,
+		"endpoints", []string{
+			"GET /workflows",
+			"GET /lambdas",
+			"POST /lambda/<lambda_name>",
+			"POST /workflow/<workflow_name>[?run_at=<time>]",
+			"GET /executions[?status=scheduled]",
+			"GET|DELETE /executions/<execution_id>, POST /executions/<execution_id>/replay, GET /executions/<execution_id>/timeline",
+			"GET|POST /schedules, GET|PATCH|DELETE /schedules/<id>, POST /schedules/<id>/pause|resume",
+			"GET /audit, /usage",
+			"GET /healthz, /readyz, /metrics",
+			"GET|POST /admin/api-keys, DELETE /admin/api-keys/<id>",
+			"POST /admin/executions/<execution_id>/skip|fail",
+			"GET|PUT /admin/quotas, GET /admin/usage",
+		},
+	)
+
+	// Stop accepting requests on SIGTERM and let running workflows finish
+	httpServer := &http.Server{Addr: ":" + port}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		logger.Info("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Shutdown did not complete", "error", err)
+		}
+		if natsTrigger != nil {
+			natsTrigger.Stop(30 * time.Second)
+		}
+		if sqsTrigger != nil {
+			sqsTrigger.Stop(30 * time.Second)
+		}
+		if server.schedules != nil {
+			server.schedules.Stop(10 * time.Second)
+		}
+		if server.jobs != nil {
+			server.jobs.Stop(30 * time.Second)
+		}
+		if server.quotas != nil {
+			server.quotas.Stop(10 * time.Second)
+		}
+		if relay != nil {
+			relay.Stop(10 * time.Second)
+		}
+	}()
+
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logging.Fatal("Server failed", "error", err)
+	}
+	<-shutdownDone
+}
+
+// runCommand dispatches the CLI subcommands
+func runCommand(name string, args []string) error {
+	switch name {
+	case "migrate":
+		return runMigrate(args)
+	case "seed":
+		return runSeed(args)
+	case "rotate-pii":
+		return runRotatePII()
+	case "dev":
+		return runDev(args)
+	case "package":
+		return runPackage(args)
+	case "upgrade-workflows":
+		return runUpgradeWorkflows(args)
+	case "executions":
+		return runExecutions(args)
+	case "recording":
+		return runRecording(args)
+	case "bench":
+		return runBench(args)
+	default:
+		return fmt.Errorf("unknown command %q (expected migrate, seed, rotate-pii, dev, package, upgrade-workflows, executions, recording or bench)", name)
 	}
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"tala_base/db"
+)
+
+// runMigrate implements the `tala migrate [up|down [n]|version]` command
+func runMigrate(args []string) error {
+	dbConn, err := db.Connect(db.ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		if err := db.MigrateUp(ctx, dbConn); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		if err := db.MigrateDown(ctx, dbConn, steps); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down or version)", command)
+	}
+
+	version, err := db.MigrationVersion(ctx, dbConn)
+	if err != nil {
+		return err
+	}
+	slog.Info("Schema version", "version", version)
+	return nil
+}
+
+// migrateOnStartup applies pending migrations before the server starts serving
+func migrateOnStartup() error {
+	dbConn, err := db.Connect(db.ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+	return db.MigrateUp(context.Background(), dbConn)
+}
+
+// runRotatePII implements the `tala rotate-pii` command, re-encrypting emails
+// under the active PII key and recomputing their blind index
+func runRotatePII() error {
+	dbConn, err := db.Connect(db.ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	rotated, err := db.RotateUserEmails(context.Background(), dbConn, 500)
+	if err != nil {
+		return err
+	}
+	slog.Info("Rewrote user emails", "rotated", rotated)
+	return nil
+}
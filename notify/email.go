@@ -0,0 +1,76 @@
+// Package notify sends emails, webhooks and NATS messages from workflow steps
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"tala_base/sigv4"
+	"tala_base/utils"
+)
+
+// EmailMessage is a rendered email ready to send
+type EmailMessage struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// EmailSender delivers an email through one provider and returns the provider's message ID
+type EmailSender interface {
+	Name() string
+	Send(ctx context.Context, msg EmailMessage) (string, error)
+}
+
+// EmailSenderFromEnv builds the sender selected by EMAIL_PROVIDER: smtp, ses,
+// sendgrid, or log (the default), which only writes messages to the log.
+// SMTP_PASSWORD and SENDGRID_API_KEY may be secret:// references.
+func EmailSenderFromEnv() (EmailSender, error) {
+	switch provider := os.Getenv("EMAIL_PROVIDER"); provider {
+	case "", "log":
+		return logSender{}, nil
+	case "smtp":
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+		password, err := utils.SecretEnv("SMTP_PASSWORD")
+		if err != nil {
+			return nil, err
+		}
+		return NewSMTPSender(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: password,
+		})
+	case "ses":
+		return NewSESSender(os.Getenv("AWS_REGION"), sigv4.CredentialsFromEnv())
+	case "sendgrid":
+		apiKey, err := utils.SecretEnv("SENDGRID_API_KEY")
+		if err != nil {
+			return nil, err
+		}
+		return NewSendGridSender(apiKey)
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_PROVIDER %q (expected smtp, ses, sendgrid or log)", provider)
+	}
+}
+
+// logSender writes emails to the log instead of sending them, for local development
+type logSender struct{}
+
+func (logSender) Name() string { return "log" }
+
+func (logSender) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	id := uuid.NewString()
+	slog.InfoContext(ctx, "email", "message_id", id, "from", msg.From, "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return id, nil
+}
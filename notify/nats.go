@@ -0,0 +1,40 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// NATSPublisher publishes JSON messages to NATS subjects
+type NATSPublisher struct {
+	conn *nats.Conn
+}
+
+// NewNATSPublisher creates a publisher on an open connection
+func NewNATSPublisher(conn *nats.Conn) *NATSPublisher {
+	return &NATSPublisher{conn: conn}
+}
+
+func (p *NATSPublisher) Name() string { return "nats" }
+
+// Publish sends v as JSON to subject, with the trace context of ctx in the
+// message headers so subscribers can continue the trace
+func (p *NATSPublisher) Publish(ctx context.Context, subject string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode message for %s: %w", subject, err)
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+	if err := p.conn.PublishMsg(msg); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+	return nil
+}
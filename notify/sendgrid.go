@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"tala_base/utils/httpclient"
+)
+
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGridSender sends email through the SendGrid v3 API
+type SendGridSender struct {
+	apiKey string
+	client *http.Client
+}
+
+// NewSendGridSender creates a SendGrid sender
+func NewSendGridSender(apiKey string) (*SendGridSender, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("SENDGRID_API_KEY is not set")
+	}
+	return &SendGridSender{apiKey: apiKey, client: httpclient.New(httpclient.Config{Name: "sendgrid", Timeout: 10 * time.Second})}, nil
+}
+
+func (s *SendGridSender) Name() string { return "sendgrid" }
+
+func (s *SendGridSender) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	type address struct {
+		Email string `json:"email"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	to := make([]address, len(msg.To))
+	for i, addr := range msg.To {
+		to[i] = address{Email: addr}
+	}
+	var contents []content
+	if msg.Text != "" {
+		contents = append(contents, content{Type: "text/plain", Value: msg.Text})
+	}
+	if msg.HTML != "" {
+		contents = append(contents, content{Type: "text/html", Value: msg.HTML})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": to}},
+		"from":             address{Email: msg.From},
+		"subject":          msg.Subject,
+		"content":          contents,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode SendGrid request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build SendGrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send email via SendGrid: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("SendGrid returned %d: %s", resp.StatusCode, detail)
+	}
+	return resp.Header.Get("X-Message-Id"), nil
+}
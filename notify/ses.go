@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"tala_base/sigv4"
+	"tala_base/utils/httpclient"
+)
+
+// SESSender sends email through the SES v2 SendEmail API
+type SESSender struct {
+	signer sigv4.Signer
+	client *http.Client
+}
+
+// NewSESSender creates an SES sender for region
+func NewSESSender(region string, creds sigv4.Credentials) (*SESSender, error) {
+	if region == "" || !creds.Valid() {
+		return nil, fmt.Errorf("AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for SES")
+	}
+	return &SESSender{
+		signer: sigv4.Signer{Credentials: creds, Region: region, Service: "ses"},
+		client: httpclient.New(httpclient.Config{Name: "ses", Timeout: 10 * time.Second}),
+	}, nil
+}
+
+func (s *SESSender) Name() string { return "ses" }
+
+func (s *SESSender) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	type text struct {
+		Data string `json:"Data"`
+	}
+	emailBody := map[string]text{}
+	if msg.Text != "" {
+		emailBody["Text"] = text{Data: msg.Text}
+	}
+	if msg.HTML != "" {
+		emailBody["Html"] = text{Data: msg.HTML}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"FromEmailAddress": msg.From,
+		"Destination":      map[string]interface{}{"ToAddresses": msg.To},
+		"Content": map[string]interface{}{
+			"Simple": map[string]interface{}{
+				"Subject": text{Data: msg.Subject},
+				"Body":    emailBody,
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode SES request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", s.signer.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to build SES request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.signer.Sign(req, sigv4.HashPayload(body), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send email via SES: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("SES returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var out struct {
+		MessageID string `json:"MessageId"`
+	}
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return "", fmt.Errorf("failed to decode SES response: %w", err)
+	}
+	return out.MessageID, nil
+}
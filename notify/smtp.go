@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPConfig holds the SMTP server settings; Username may be empty for unauthenticated relays
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// SMTPSender sends email through an SMTP server, upgrading to TLS when offered
+type SMTPSender struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPSender creates an SMTP sender
+func NewSMTPSender(cfg SMTPConfig) (*SMTPSender, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP_HOST is not set")
+	}
+	return &SMTPSender{cfg: cfg}, nil
+}
+
+func (s *SMTPSender) Name() string { return "smtp" }
+
+// Send delivers msg. net/smtp has no context support, so ctx is only checked before sending.
+func (s *SMTPSender) Send(ctx context.Context, msg EmailMessage) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("<%s@%s>", uuid.NewString(), s.cfg.Host)
+	body, err := buildMIME(id, msg)
+	if err != nil {
+		return "", err
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := s.cfg.Host + ":" + strconv.Itoa(s.cfg.Port)
+	if err := smtp.SendMail(addr, auth, msg.From, msg.To, body); err != nil {
+		return "", fmt.Errorf("failed to send email via SMTP: %w", err)
+	}
+	return id, nil
+}
+
+// buildMIME renders msg as a MIME message, multipart/alternative when it has both text and HTML
+func buildMIME(id string, msg EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", id)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" || msg.Text == "" {
+		contentType, content := "text/plain", msg.Text
+		if msg.HTML != "" {
+			contentType, content = "text/html", msg.HTML
+		}
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n\r\n%s", contentType, content)
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType + "; charset=utf-8"}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		w.Write([]byte(part.content))
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+	return buf.Bytes(), nil
+}
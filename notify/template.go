@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// EmailTemplates renders named email templates. Each <name>.tmpl file defines
+// a "subject" block and at least one of "text" and "html"; the html block is
+// rendered with contextual escaping.
+type EmailTemplates struct {
+	fsys fs.FS
+}
+
+// NewEmailTemplates reads templates from fsys on each render, so edits to a
+// directory apply without a restart
+func NewEmailTemplates(fsys fs.FS) *EmailTemplates {
+	return &EmailTemplates{fsys: fsys}
+}
+
+// EmailTemplatesFromEnv reads templates from EMAIL_TEMPLATE_DIR, falling back
+// to the templates built into the binary
+func EmailTemplatesFromEnv() *EmailTemplates {
+	if dir := os.Getenv("EMAIL_TEMPLATE_DIR"); dir != "" {
+		return NewEmailTemplates(os.DirFS(dir))
+	}
+	sub, _ := fs.Sub(builtinTemplates, "templates")
+	return NewEmailTemplates(sub)
+}
+
+// Render fills template name with data and returns the subject, text and HTML bodies
+func (t *EmailTemplates) Render(name string, data interface{}) (subject, text, html string, err error) {
+	if name == "" || path.Base(name) != name {
+		return "", "", "", fmt.Errorf("invalid template name %q", name)
+	}
+	source, err := fs.ReadFile(t.fsys, name+".tmpl")
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to read email template %s: %w", name, err)
+	}
+
+	plain, err := template.New(name).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to parse email template %s: %w", name, err)
+	}
+	if subject, err = executeText(plain, "subject", data); err != nil {
+		return "", "", "", err
+	}
+	if subject == "" {
+		return "", "", "", fmt.Errorf("email template %s has no subject", name)
+	}
+	if text, err = executeText(plain, "text", data); err != nil {
+		return "", "", "", err
+	}
+
+	escaped, err := htmltemplate.New(name).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to parse email template %s: %w", name, err)
+	}
+	if escaped.Lookup("html") != nil {
+		var buf bytes.Buffer
+		if err := escaped.ExecuteTemplate(&buf, "html", data); err != nil {
+			return "", "", "", fmt.Errorf("failed to render email template %s: %w", name, err)
+		}
+		html = buf.String()
+	}
+	if text == "" && html == "" {
+		return "", "", "", fmt.Errorf("email template %s has no text or html body", name)
+	}
+	return subject, text, html, nil
+}
+
+func executeText(t *template.Template, block string, data interface{}) (string, error) {
+	if t.Lookup(block) == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, block, data); err != nil {
+		return "", fmt.Errorf("failed to render %s of email template %s: %w", block, t.Name(), err)
+	}
+	return buf.String(), nil
+}
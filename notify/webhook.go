@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tala_base/utils/httpclient"
+
+	"github.com/google/uuid"
+)
+
+// Headers set on every webhook delivery. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// ErrHostNotAllowed is returned when a webhook targets a host outside WEBHOOK_ALLOWED_HOSTS
+var ErrHostNotAllowed = errors.New("webhook host is not allowed")
+
+// WebhookConfig controls signing, timeouts and retries for webhook deliveries
+type WebhookConfig struct {
+	// Secret signs each delivery; deliveries are unsigned when empty
+	Secret string
+	// Timeout bounds each attempt
+	Timeout     time.Duration
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// AllowedHosts restricts target hosts when non-empty
+	AllowedHosts []string
+}
+
+// WebhookConfigFromEnv builds a WebhookConfig from the WEBHOOK_* variables
+func WebhookConfigFromEnv() WebhookConfig {
+	cfg := WebhookConfig{
+		Secret:      os.Getenv("WEBHOOK_SECRET"),
+		Timeout:     10 * time.Second,
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+	if v, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil && v > 0 {
+		cfg.Timeout = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && v > 0 {
+		cfg.MaxAttempts = v
+	}
+	for _, host := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			cfg.AllowedHosts = append(cfg.AllowedHosts, strings.ToLower(host))
+		}
+	}
+	return cfg
+}
+
+// WebhookRequest is one webhook to deliver
+type WebhookRequest struct {
+	URL     string
+	Method  string
+	Headers map[string]string
+	Body    []byte
+}
+
+// WebhookResult describes the final attempt of a delivery
+type WebhookResult struct {
+	DeliveryID string
+	Status     int
+	Attempts   int
+	Body       []byte
+}
+
+// WebhookSender delivers signed webhooks, retrying connection failures, 429s and 5xx responses
+type WebhookSender struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookSender creates a webhook sender. Send retries deliveries itself so
+// every attempt carries the same delivery ID, so the client does not retry.
+func NewWebhookSender(cfg WebhookConfig) *WebhookSender {
+	return &WebhookSender{cfg: cfg, client: httpclient.New(httpclient.Config{Name: "webhook", Timeout: cfg.Timeout})}
+}
+
+// Send delivers req. Every attempt carries the same delivery ID so receivers
+// can deduplicate. A non-2xx final response is returned with an error.
+func (s *WebhookSender) Send(ctx context.Context, req WebhookRequest) (*WebhookResult, error) {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q", req.URL)
+	}
+	if !s.allowed(target.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, target.Hostname())
+	}
+	if req.Method == "" {
+		req.Method = http.MethodPost
+	}
+
+	result := &WebhookResult{DeliveryID: uuid.NewString()}
+	delay := s.cfg.BaseDelay
+	for {
+		result.Attempts++
+		retry, err := s.attempt(ctx, req, result)
+		if err == nil {
+			return result, nil
+		}
+		if !retry || result.Attempts >= s.cfg.MaxAttempts {
+			return result, err
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(wait):
+		}
+		delay *= 2
+		if delay > s.cfg.MaxDelay {
+			delay = s.cfg.MaxDelay
+		}
+	}
+}
+
+// attempt makes one delivery, recording the response in result and reporting whether a failure is worth retrying
+func (s *WebhookSender) attempt(ctx context.Context, req WebhookRequest, result *WebhookResult) (bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return false, fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	if httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	timestamp := time.Now().Unix()
+	httpReq.Header.Set(WebhookIDHeader, result.DeliveryID)
+	httpReq.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	if s.cfg.Secret != "" {
+		httpReq.Header.Set(WebhookSignatureHeader, SignWebhook(s.cfg.Secret, timestamp, req.Body))
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	result.Status = resp.StatusCode
+	result.Body, _ = io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %d", resp.StatusCode)
+}
+
+func (s *WebhookSender) allowed(host string) bool {
+	if len(s.cfg.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range s.cfg.AllowedHosts {
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// SignWebhook returns the signature header value for a body sent at timestamp
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
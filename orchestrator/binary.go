@@ -0,0 +1,56 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path"
+
+	"tala_base/storage"
+	"tala_base/types"
+)
+
+// BlobStore keeps the responses of binary: blob steps. *storage.Client
+// implements it.
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, body []byte) (*storage.Object, error)
+	Bucket() string
+}
+
+// SetBlobStore sets where binary: blob steps store their responses. Without
+// one those steps fail.
+func (e *ChainExecutor) SetBlobStore(b BlobStore) {
+	e.blobs = b
+}
+
+// binaryResult is the output of a binary step whose lambda answered with a
+// body that is not JSON: its content type and size, and the body itself as
+// content_base64 or the bucket and key it was stored under, named as in
+// types.StorageOutput so the storage lambda can read a stored body back
+func (e *ChainExecutor) binaryResult(ctx context.Context, step types.Step, execCtx types.ExecutionContext, contentType string, body []byte) (*types.StepResult, error) {
+	data := map[string]interface{}{
+		"content_type": contentType,
+		"size":         len(body),
+	}
+	if step.Binary != types.BinaryBlob {
+		data["content_base64"] = base64.StdEncoding.EncodeToString(body)
+		return &types.StepResult{Data: data}, nil
+	}
+
+	if e.blobs == nil {
+		return &types.StepResult{
+			Error: types.NewWorkflowError(step.Name, types.ErrorCodeInternal, "binary: blob requires object storage; set S3_BUCKET"),
+		}, nil
+	}
+	id := execCtx.ExecutionID
+	if id == "" {
+		id = execCtx.RequestID
+	}
+	key := path.Join("step-responses", execCtx.TenantID, id, step.Name)
+	if _, err := e.blobs.Put(ctx, key, contentType, body); err != nil {
+		return nil, fmt.Errorf("failed to store the response of step %s: %w", step.Name, err)
+	}
+	data["bucket"] = e.blobs.Bucket()
+	data["key"] = key
+	return &types.StepResult{Data: data}, nil
+}
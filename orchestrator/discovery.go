@@ -0,0 +1,234 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tala_base/utils"
+	"tala_base/utils/httpclient"
+)
+
+// Discovery resolves a lambda name to the base URLs of its healthy instances
+type Discovery interface {
+	Instances(ctx context.Context, lambda string) ([]string, error)
+}
+
+// DiscoveryFromEnv builds the discovery backend selected by LAMBDA_DISCOVERY,
+// consul or etcd, and the cache TTL from LAMBDA_DISCOVERY_TTL (default 10s).
+// It returns a nil Discovery when LAMBDA_DISCOVERY is unset, leaving lambdas
+// at their static URLs.
+func DiscoveryFromEnv() (Discovery, time.Duration, error) {
+	ttl := 10 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("LAMBDA_DISCOVERY_TTL")); err == nil && v > 0 {
+		ttl = v
+	}
+	service := os.Getenv("LAMBDA_SERVICE_TEMPLATE")
+
+	switch backend := os.Getenv("LAMBDA_DISCOVERY"); backend {
+	case "":
+		return nil, ttl, nil
+	case "consul":
+		token, err := utils.SecretEnv("CONSUL_HTTP_TOKEN")
+		if err != nil {
+			return nil, ttl, err
+		}
+		return NewConsulDiscovery(os.Getenv("CONSUL_HTTP_ADDR"), token, service), ttl, nil
+	case "etcd":
+		return NewEtcdDiscovery(strings.Split(os.Getenv("ETCD_ENDPOINTS"), ","), os.Getenv("ETCD_PREFIX")), ttl, nil
+	default:
+		return nil, ttl, fmt.Errorf("unknown LAMBDA_DISCOVERY %q (expected consul or etcd)", backend)
+	}
+}
+
+// ConsulDiscovery resolves lambdas through Consul's health API, returning
+// only instances whose checks are all passing
+type ConsulDiscovery struct {
+	addr  string
+	token string
+	// service is the service name template, with {name} replaced by the lambda name
+	service string
+	client  *http.Client
+}
+
+// NewConsulDiscovery creates a Consul backend for the agent at addr (default
+// http://127.0.0.1:8500). service maps a lambda to its Consul service name,
+// such as "tala-{name}"; it defaults to the lambda name.
+func NewConsulDiscovery(addr, token, service string) *ConsulDiscovery {
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	if service == "" {
+		service = "{name}"
+	}
+	return &ConsulDiscovery{
+		addr:    strings.TrimSuffix(addr, "/"),
+		token:   token,
+		service: service,
+		client:  httpclient.New(httpclient.Config{Name: "consul", Timeout: 2 * time.Second, Retries: 1}),
+	}
+}
+
+func (d *ConsulDiscovery) Instances(ctx context.Context, lambda string) ([]string, error) {
+	service := strings.ReplaceAll(d.service, "{name}", lambda)
+	endpoint := fmt.Sprintf("%s/v1/health/service/%s?passing=true", d.addr, url.PathEscape(service))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build consul request: %w", err)
+	}
+	if d.token != "" {
+		req.Header.Set("X-Consul-Token", d.token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query consul for %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("consul returned %d for %s: %s", resp.StatusCode, service, detail)
+	}
+
+	var entries []struct {
+		Node struct {
+			Address string `json:"Address"`
+		} `json:"Node"`
+		Service struct {
+			Address string            `json:"Address"`
+			Port    int               `json:"Port"`
+			Meta    map[string]string `json:"Meta"`
+		} `json:"Service"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode consul response: %w", err)
+	}
+	instances := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		scheme := entry.Service.Meta["scheme"]
+		if scheme == "" {
+			scheme = "http"
+		}
+		instances = append(instances, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)))
+	}
+	sort.Strings(instances)
+	return instances, nil
+}
+
+// EtcdDiscovery resolves lambdas from keys under <prefix><name>/ in etcd,
+// each holding one instance's base URL. Instances register their key with a
+// lease they keep alive, so one that stops is dropped when its lease expires.
+type EtcdDiscovery struct {
+	endpoints []string
+	prefix    string
+	client    *http.Client
+}
+
+// NewEtcdDiscovery creates an etcd backend using the v3 JSON gateway of the
+// given endpoints (default http://127.0.0.1:2379), tried in order, under
+// prefix (default /tala/lambdas/)
+func NewEtcdDiscovery(endpoints []string, prefix string) *EtcdDiscovery {
+	var cleaned []string
+	for _, endpoint := range endpoints {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		cleaned = append(cleaned, strings.TrimSuffix(endpoint, "/"))
+	}
+	if len(cleaned) == 0 {
+		cleaned = []string{"http://127.0.0.1:2379"}
+	}
+	if prefix == "" {
+		prefix = "/tala/lambdas/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &EtcdDiscovery{
+		endpoints: cleaned,
+		prefix:    prefix,
+		client:    httpclient.New(httpclient.Config{Name: "etcd", Timeout: 2 * time.Second}),
+	}
+}
+
+func (d *EtcdDiscovery) Instances(ctx context.Context, lambda string) ([]string, error) {
+	key := d.prefix + lambda + "/"
+	// The range [key, rangeEnd) covers every key with the prefix key
+	rangeEnd := []byte(key)
+	rangeEnd[len(rangeEnd)-1]++
+	body, err := json.Marshal(map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(key)),
+		"range_end": base64.StdEncoding.EncodeToString(rangeEnd),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode etcd request: %w", err)
+	}
+
+	var lastErr error
+	for _, endpoint := range d.endpoints {
+		instances, err := d.query(ctx, endpoint, body)
+		if err == nil {
+			return instances, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("failed to query etcd for %s: %w", lambda, lastErr)
+}
+
+// query runs one range request against endpoint
+func (d *EtcdDiscovery) query(ctx context.Context, endpoint string, body []byte) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("etcd returned %d: %s", resp.StatusCode, detail)
+	}
+
+	var out struct {
+		KVs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode etcd response: %w", err)
+	}
+	instances := make([]string, 0, len(out.KVs))
+	for _, kv := range out.KVs {
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil || len(value) == 0 {
+			continue
+		}
+		instances = append(instances, strings.TrimSuffix(strings.TrimSpace(string(value)), "/"))
+	}
+	sort.Strings(instances)
+	return instances, nil
+}
@@ -0,0 +1,604 @@
+package orchestrator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tala_base/db"
+	"tala_base/logging"
+	"tala_base/types"
+	"tala_base/utils/validate"
+)
+
+// DurableConfig controls the workers that run durable executions
+type DurableConfig struct {
+	// Workers is how many executions one process runs at once; defaults to 4
+	Workers int
+	// Lease is how long a claimed job stays with its worker without being
+	// renewed; a crashed worker's jobs are resumed once it lapses. Defaults to 1m.
+	Lease time.Duration
+	// PollInterval is how long an idle worker waits before looking for jobs
+	// again; defaults to 1s
+	PollInterval time.Duration
+	// MaxAttempts is how many times a step failing with a retryable code is
+	// run before the execution fails; defaults to 5
+	MaxAttempts int
+	// RetryDelay is the wait before the first retry, doubled for each further
+	// one up to 5m; defaults to 5s
+	RetryDelay time.Duration
+}
+
+// DurableConfigFromEnv reads DURABLE_WORKERS, DURABLE_LEASE,
+// DURABLE_POLL_INTERVAL, DURABLE_MAX_ATTEMPTS and DURABLE_RETRY_DELAY
+func DurableConfigFromEnv() DurableConfig {
+	var cfg DurableConfig
+	if n, err := strconv.Atoi(os.Getenv("DURABLE_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if v, err := time.ParseDuration(os.Getenv("DURABLE_LEASE")); err == nil && v > 0 {
+		cfg.Lease = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("DURABLE_POLL_INTERVAL")); err == nil && v > 0 {
+		cfg.PollInterval = v
+	}
+	if n, err := strconv.Atoi(os.Getenv("DURABLE_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	if v, err := time.ParseDuration(os.Getenv("DURABLE_RETRY_DELAY")); err == nil && v > 0 {
+		cfg.RetryDelay = v
+	}
+	return cfg
+}
+
+// DurableEngine runs workflows from a Postgres job table instead of within
+// the request that started them. Each step's result is checkpointed with the
+// job, so an execution survives restarts and resumes at the step it was on:
+// steps run at least once, and lambdas make their side effects exactly-once
+// by applying them under the step's idempotency key (see db.Idempotent).
+type DurableEngine struct {
+	executor *ChainExecutor
+	db       *sql.DB
+	cfg      DurableConfig
+	worker   string
+	logger   *slog.Logger
+
+	// outbox, when set, records each finished execution's event in the
+	// transaction that stores its result
+	outbox EventRecorder
+
+	// queueWait is how long claimed jobs waited after falling due, by priority
+	queueWait *waitMetrics
+
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// EventRecorder stores an event within a transaction; *outbox.Relay implements it
+type EventRecorder interface {
+	Record(ctx context.Context, tx db.DBTX, event types.ExecutionEvent) error
+}
+
+// NewDurableEngine creates an engine running the executor's workflows from
+// the jobs in dbConn
+func NewDurableEngine(executor *ChainExecutor, dbConn *sql.DB, cfg DurableConfig) *DurableEngine {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 5 * time.Second
+	}
+	hostname, _ := os.Hostname()
+	return &DurableEngine{
+		executor: executor,
+		db:       dbConn,
+		cfg:      cfg,
+		worker:   hostname + "/" + uuid.NewString()[:8],
+		logger:   logging.Component("durable"),
+
+		queueWait: newWaitMetrics(),
+	}
+}
+
+// Submit validates input and queues an execution of the named workflow at
+// priority, or the workflow's priority when it is empty, returning it in the
+// pending state. The tenant is taken from ctx.
+func (d *DurableEngine) Submit(ctx context.Context, name string, input types.WorkflowInput, priority types.ExecutionPriority) (*types.Execution, *types.WorkflowError, error) {
+	return d.enqueue(ctx, d.db, types.Execution{Workflow: name}, input, priority)
+}
+
+// Schedule is like Submit, but the execution waits in the scheduled state
+// until runAt, when the first free worker starts it
+func (d *DurableEngine) Schedule(ctx context.Context, name string, input types.WorkflowInput, runAt time.Time, priority types.ExecutionPriority) (*types.Execution, *types.WorkflowError, error) {
+	runAt = runAt.UTC()
+	return d.enqueue(ctx, d.db, types.Execution{Workflow: name, ScheduledFor: &runAt}, input, priority)
+}
+
+// Replay is like Submit for the workflow of a stored execution, with its input
+// except for the fields of overrides, which replace the input's. The new
+// execution is linked to the original by ReplayOf.
+func (d *DurableEngine) Replay(ctx context.Context, original *types.Execution, overrides map[string]interface{}, execCtx types.ExecutionContext, priority types.ExecutionPriority) (*types.Execution, *types.WorkflowError, error) {
+	if _, exists := d.executor.workflows[original.Workflow]; !exists {
+		return nil, types.WorkflowErrorf("input", types.ErrorCodeNotFound, "workflow %s no longer exists", original.Workflow), nil
+	}
+	data := map[string]interface{}{}
+	if len(original.Input) > 0 {
+		if err := json.Unmarshal(original.Input, &data); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode execution input: %w", err)
+		}
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+	}
+	for field, value := range overrides {
+		data[field] = value
+	}
+	return d.enqueue(ctx, d.db, types.Execution{Workflow: original.Workflow, ReplayOf: original.ID},
+		types.WorkflowInput{Data: data, Context: execCtx}, priority)
+}
+
+// enqueue stores an execution of exec's workflow, scheduled for
+// exec.ScheduledFor or due at once when it is nil, and its job through conn
+func (d *DurableEngine) enqueue(ctx context.Context, conn db.DBTX, exec types.Execution, input types.WorkflowInput, priority types.ExecutionPriority) (*types.Execution, *types.WorkflowError, error) {
+	workflow, exists := d.executor.workflows[exec.Workflow]
+	if !exists {
+		return nil, nil, fmt.Errorf("workflow %s not found", exec.Workflow)
+	}
+	if workflow.Disabled {
+		return nil, disabledError(exec.Workflow), nil
+	}
+	if !priority.Valid() {
+		return nil, types.WorkflowErrorf("input", types.ErrorCodeInvalidArgument, "unknown priority %q (expected low, normal or high)", priority), nil
+	}
+	if priority == "" {
+		priority = workflow.Priority
+	}
+	if err := validate.Map(input.Data, workflow.Inputs); err != nil {
+		return nil, types.NewWorkflowError("input", types.ErrorCodeValidationFailed, err.Error()), nil
+	}
+
+	exec.ID = uuid.NewString()
+	input.Context.ExecutionID = exec.ID
+	input.Context.TenantID = db.TenantFrom(ctx)
+	state, err := json.Marshal(newWorkflowState(workflow, input))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode workflow state: %w", err)
+	}
+	data, err := json.Marshal(input.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode workflow input: %w", err)
+	}
+	exec.Input = data
+	created, err := db.EnqueueExecution(ctx, conn, exec, state, priority)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.executor.deprecated.count(exec.Workflow, workflow)
+	return created, nil, nil
+}
+
+// SetOutbox records the event of each finished execution through r
+func (d *DurableEngine) SetOutbox(r EventRecorder) {
+	d.outbox = r
+}
+
+// Start runs the workers until Stop is called
+func (d *DurableEngine) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.running.Add(1)
+		go func() {
+			defer d.running.Done()
+			d.work(ctx)
+		}()
+	}
+	d.logger.Info("Started durable workers", "worker", d.worker, "workers", d.cfg.Workers)
+}
+
+// Stop stops claiming jobs and waits up to timeout for running steps. Each
+// job is released after its current step, so another process resumes it at
+// once instead of after its lease.
+func (d *DurableEngine) Stop(timeout time.Duration) {
+	d.cancel()
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		d.logger.Warn("Stopped with steps still running")
+	}
+}
+
+// work claims and runs jobs until ctx is done
+func (d *DurableEngine) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := db.ClaimJob(ctx, d.db, d.worker, d.cfg.Lease)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Warn("Failed to claim job", "error", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(d.cfg.PollInterval):
+			}
+			continue
+		}
+		d.queueWait.observe(job.Priority, time.Since(job.RunAt))
+		d.run(ctx, job)
+	}
+}
+
+// run resumes a job at its next step and runs steps until the execution
+// finishes, a step must be retried later, or the worker stops
+func (d *DurableEngine) run(stop context.Context, job *types.ExecutionJob) {
+	// Checkpoints must land even while stopping, so they do not use stop
+	ctx := db.WithTenant(context.Background(), job.TenantID)
+	logger := d.logger.With("execution_id", job.ExecutionID, "workflow", job.Workflow)
+
+	leaseCtx, endLease := context.WithCancel(ctx)
+	defer endLease()
+	go d.keepLease(leaseCtx, job.ExecutionID, logger)
+
+	workflow, exists := d.executor.workflows[job.Workflow]
+	var state types.WorkflowState
+	if err := json.Unmarshal(job.State, &state); err != nil || !exists || job.StepIndex >= len(workflow.Steps) {
+		reason := fmt.Sprintf("cannot resume at step %d", job.StepIndex)
+		if !exists {
+			reason = "workflow no longer exists"
+		} else if err != nil {
+			reason = "failed to decode state: " + err.Error()
+		}
+		d.finish(ctx, job, &types.WorkflowOutput{Error: types.NewWorkflowError("", types.ErrorCodeInternal, reason)}, logger)
+		return
+	}
+	// A singleton workflow already running elsewhere, or one running its
+	// maximum of executions, is waited for rather than failed, since the
+	// execution was accepted
+	if workflow.Singleton || workflow.MaxConcurrentExecutions > 0 {
+		unlock, err := d.executor.lockExecution(ctx, job.Workflow, workflow)
+		if err != nil {
+			if !errors.Is(err, ErrLocked) {
+				logger.Warn("Failed to lock workflow", "error", err)
+			}
+			if err := db.ReleaseJob(ctx, d.db, job.ExecutionID, d.worker, time.Now().Add(d.cfg.RetryDelay)); err != nil {
+				logger.Warn("Failed to release job", "error", err)
+			}
+			return
+		}
+		defer unlock()
+	}
+	if _, err := db.StartExecution(ctx, d.db, job.ExecutionID); err != nil {
+		logger.Warn("Failed to mark execution running", "error", err)
+	}
+
+	for i := job.StepIndex; i < len(workflow.Steps); i++ {
+		if workflow.IsErrorHandler(i) {
+			continue
+		}
+		if stop.Err() != nil {
+			if err := db.ReleaseJob(ctx, d.db, job.ExecutionID, d.worker, time.Now()); err != nil {
+				logger.Warn("Failed to release job", "error", err)
+			}
+			return
+		}
+		step := workflow.Steps[i]
+		if _, err := db.StartStep(ctx, d.db, types.StepExecution{
+			ExecutionID: job.ExecutionID,
+			StepIndex:   i,
+			Step:        step.Name,
+			Lambda:      step.Lambda,
+			Input:       marshalRaw(state.Steps[step.Name].Input.Data),
+		}); err != nil {
+			logger.Warn("Failed to record step start", "step", step.Name, "error", err)
+		}
+
+		result, err := d.executor.ExecuteStep(step, &state)
+		if err != nil {
+			result = &types.StepResult{Error: types.NewWorkflowError(step.Name, types.ErrorCodeInternal, err.Error())}
+		}
+		if result.Error != nil && result.Error.Code.Retryable() && job.Attempts+1 < d.cfg.MaxAttempts {
+			if state.RetryAllowed() {
+				state.Retries++
+				d.retry(ctx, job, i, &state, result.Error, logger)
+				return
+			}
+			logger.Warn("Not retrying step, retry budget spent", "step", step.Name, "retries", state.Retries)
+		}
+
+		output, err := d.executor.completeStep(workflow, &state, i, result)
+		if err != nil {
+			output = &types.WorkflowOutput{Error: types.NewWorkflowError(step.Name, types.ErrorCodeInternal, err.Error())}
+		}
+		if output != nil {
+			// The last step, or a failed one, ends the execution
+			status := types.ExecutionSucceeded
+			if result.Error != nil {
+				status = types.ExecutionFailed
+			}
+			d.recordStep(ctx, job.ExecutionID, i, status, result, logger)
+			d.finish(ctx, job, output, logger)
+			return
+		}
+
+		// Checkpoint the step's result and the state the next step starts
+		// from in one transaction, so a resumed job never reruns a step
+		// that was recorded as done
+		encoded, err := json.Marshal(state)
+		if err != nil {
+			logger.Error("Failed to encode workflow state", "error", err)
+			return
+		}
+		// A step an on_error handler recovered keeps its error, and the
+		// handler's output it continued with, for the execution's timeline
+		data, code, errData := result.Data, types.WorkflowErrorCode(""), json.RawMessage(nil)
+		if result.Error != nil {
+			data = state.Steps[step.HandlerFor(result.Error.Code)].Output.Data
+			code, errData = result.Error.Code, marshalRaw(result.Error)
+		}
+		err = db.WithTx(ctx, d.db, func(tx *sql.Tx) error {
+			if _, err := db.FinishStep(ctx, tx, job.ExecutionID, i, types.ExecutionSucceeded, marshalRaw(data), code, errData); err != nil && !errors.Is(err, db.ErrNotFound) {
+				return err
+			}
+			return db.AdvanceJob(ctx, tx, job.ExecutionID, d.worker, nextStep(workflow, i), encoded)
+		})
+		if err != nil {
+			// The lease was lost or the database is unreachable; whoever holds
+			// the job next resumes it from the last checkpoint
+			logger.Warn("Failed to checkpoint step", "step", step.Name, "error", err)
+			return
+		}
+		job.Attempts = 0
+	}
+}
+
+// retry puts a job back in the queue to rerun step i from state after a
+// backoff, keeping the retries state has spent
+func (d *DurableEngine) retry(ctx context.Context, job *types.ExecutionJob, i int, state *types.WorkflowState, stepErr *types.WorkflowError, logger *slog.Logger) {
+	d.recordStep(ctx, job.ExecutionID, i, types.ExecutionFailed, &types.StepResult{Error: stepErr}, logger)
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		logger.Error("Failed to encode workflow state", "error", err)
+		return
+	}
+	delay := d.cfg.RetryDelay << min(job.Attempts, 20)
+	if delay > 5*time.Minute || delay <= 0 {
+		delay = 5 * time.Minute
+	}
+	if err := db.RetryJob(ctx, d.db, job.ExecutionID, d.worker, time.Now().Add(delay), encoded, stepErr.Error()); err != nil {
+		logger.Warn("Failed to schedule retry", "error", err)
+		return
+	}
+	logger.Info("Step will be retried", "step", stepErr.Step, "attempt", job.Attempts+1, "delay", delay.String(), "code", stepErr.Code)
+}
+
+// recordStep stores the outcome of one attempt of step i
+func (d *DurableEngine) recordStep(ctx context.Context, executionID string, i int, status types.ExecutionStatus, result *types.StepResult, logger *slog.Logger) {
+	var code types.WorkflowErrorCode
+	var errData json.RawMessage
+	if result.Error != nil {
+		code = result.Error.Code
+		errData = marshalRaw(result.Error)
+	}
+	if _, err := db.FinishStep(ctx, d.db, executionID, i, status, marshalRaw(result.Data), code, errData); err != nil {
+		logger.Warn("Failed to record step result", "step_index", i, "error", err)
+	}
+}
+
+// finish records an execution's output and removes its job in one transaction
+func (d *DurableEngine) finish(ctx context.Context, job *types.ExecutionJob, output *types.WorkflowOutput, logger *slog.Logger) {
+	err := db.WithTx(ctx, d.db, func(tx *sql.Tx) error {
+		return d.finishTx(ctx, tx, job, output)
+	})
+	if err != nil {
+		logger.Warn("Failed to finish execution", "error", err)
+		return
+	}
+	if output.Error != nil {
+		logger.Warn("Execution failed", "step", output.Error.Step, "code", output.Error.Code, "error", output.Error.Message)
+	} else {
+		logger.Info("Execution succeeded")
+	}
+}
+
+// finishTx records an execution's output, with its event when there is an
+// outbox, and removes its job through tx
+func (d *DurableEngine) finishTx(ctx context.Context, tx *sql.Tx, job *types.ExecutionJob, output *types.WorkflowOutput) error {
+	status := types.ExecutionSucceeded
+	var code types.WorkflowErrorCode
+	var errData json.RawMessage
+	if output.Error != nil {
+		status = types.ExecutionFailed
+		code = output.Error.Code
+		errData = marshalRaw(output.Error)
+	}
+	if _, err := db.FinishExecution(ctx, tx, job.ExecutionID, status, marshalRaw(output.Data), code, errData); err != nil {
+		return err
+	}
+	if d.outbox != nil {
+		event := finishEvent(job.Workflow, output)
+		event.ExecutionID = job.ExecutionID
+		if err := d.outbox.Record(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	return db.CompleteJob(ctx, tx, job.ExecutionID, d.worker)
+}
+
+// SkipStep completes the step a durable execution of the context's tenant is
+// waiting to run or retry with input.Output, as if its lambda had returned
+// it, so the execution continues from the next step. The change is audited.
+func (d *DurableEngine) SkipStep(ctx context.Context, executionID string, input types.StepOverrideInput) (*types.Execution, error) {
+	return d.overrideStep(ctx, executionID, input.Step, types.AuditSkipStep, &types.StepResult{Data: input.Output})
+}
+
+// FailStep fails the step a durable execution of the context's tenant is
+// waiting to run or retry, without retrying it, so the step's error handler
+// runs and the execution ends failed. The change is audited.
+func (d *DurableEngine) FailStep(ctx context.Context, executionID string, input types.StepOverrideInput) (*types.Execution, error) {
+	code := input.Code
+	if code == "" {
+		code = types.ErrorCodeInternal
+	}
+	message := input.Message
+	if message == "" {
+		message = "failed by an operator"
+	}
+	return d.overrideStep(ctx, executionID, input.Step, types.AuditFailStep, &types.StepResult{Error: types.NewWorkflowError("", code, message)})
+}
+
+// overrideStep completes the pending step of an execution with result in
+// place of running it. The job is leased for the change, so a worker cannot
+// run the step meanwhile; it returns db.ErrConflict while one is.
+func (d *DurableEngine) overrideStep(ctx context.Context, executionID, stepName string, action types.AuditAction, result *types.StepResult) (*types.Execution, error) {
+	job, err := db.LockJob(ctx, d.db, executionID, d.worker, d.cfg.Lease)
+	if err != nil {
+		return nil, err
+	}
+	done := false
+	defer func() {
+		if !done {
+			if err := db.ReleaseJob(ctx, d.db, executionID, d.worker, job.RunAt); err != nil {
+				d.logger.Warn("Failed to release job", "execution_id", executionID, "error", err)
+			}
+		}
+	}()
+
+	workflow, exists := d.executor.workflows[job.Workflow]
+	var state types.WorkflowState
+	if !exists || job.StepIndex >= len(workflow.Steps) || json.Unmarshal(job.State, &state) != nil {
+		return nil, fmt.Errorf("%w: execution %s cannot be resumed", db.ErrConflict, executionID)
+	}
+	i := job.StepIndex
+	step := workflow.Steps[i]
+	if stepName != "" && stepName != step.Name {
+		return nil, fmt.Errorf("%w: execution %s is at step %s, not %s", db.ErrConflict, executionID, step.Name, stepName)
+	}
+	if result.Error != nil {
+		result.Error.Step = step.Name
+	}
+	before := map[string]interface{}{"step": step.Name, "attempts": job.Attempts, "last_error": job.LastError}
+
+	output, err := d.executor.completeStep(workflow, &state, i, result)
+	if err != nil {
+		output = &types.WorkflowOutput{Error: types.NewWorkflowError(step.Name, types.ErrorCodeInternal, err.Error())}
+	}
+	status := types.ExecutionSucceeded
+	if result.Error != nil {
+		status = types.ExecutionFailed
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode workflow state: %w", err)
+	}
+
+	err = db.WithTx(ctx, d.db, func(tx *sql.Tx) error {
+		finishStep := func() error {
+			_, err := db.FinishStep(ctx, tx, executionID, i, status, marshalRaw(result.Data), codeOf(result.Error), marshalRaw(result.Error))
+			return err
+		}
+		err := finishStep()
+		if errors.Is(err, db.ErrNotFound) {
+			// A step that never started gets its row first
+			if _, err := db.StartStep(ctx, tx, types.StepExecution{
+				ExecutionID: executionID,
+				StepIndex:   i,
+				Step:        step.Name,
+				Lambda:      step.Lambda,
+				Input:       marshalRaw(state.Steps[step.Name].Input.Data),
+			}); err != nil {
+				return err
+			}
+			err = finishStep()
+		}
+		if err != nil {
+			return err
+		}
+		if output != nil {
+			if err := d.finishTx(ctx, tx, job, output); err != nil {
+				return err
+			}
+		} else {
+			if err := db.AdvanceJob(ctx, tx, executionID, d.worker, nextStep(workflow, i), encoded); err != nil {
+				return err
+			}
+			if err := db.ReleaseJob(ctx, tx, executionID, d.worker, time.Now()); err != nil {
+				return err
+			}
+		}
+		after := map[string]interface{}{"step": step.Name, "output": result.Data, "error": result.Error}
+		return db.RecordAudit(ctx, tx, types.AuditEntityExecution, executionID, action, before, after)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to override step: %w", err)
+	}
+	done = true
+	d.logger.Info("Step overridden by operator", "execution_id", executionID, "step", step.Name, "action", action)
+	return db.GetExecution(ctx, d.db, executionID)
+}
+
+// codeOf returns the code of err, or "" when it is nil
+func codeOf(err *types.WorkflowError) types.WorkflowErrorCode {
+	if err == nil {
+		return ""
+	}
+	return err.Code
+}
+
+// keepLease renews the job's lease at a third of its length until ctx is done
+func (d *DurableEngine) keepLease(ctx context.Context, executionID string, logger *slog.Logger) {
+	ticker := time.NewTicker(d.cfg.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := db.ExtendJobLease(ctx, d.db, executionID, d.worker, d.cfg.Lease); err != nil && ctx.Err() == nil {
+				logger.Warn("Failed to extend job lease", "error", err)
+			}
+		}
+	}
+}
+
+// marshalRaw encodes v for a JSONB column, or nil when it is empty
+func marshalRaw(v interface{}) json.RawMessage {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		if v == nil {
+			return nil
+		}
+	case *types.WorkflowError:
+		if v == nil {
+			return nil
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
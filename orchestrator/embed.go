@@ -0,0 +1,92 @@
+// Package orchestrator runs workflows: chains of lambda calls defined in
+// YAML. The server builds on it, and other Go services can embed it:
+//
+//	executor := orchestrator.NewChainExecutor()
+//	executor.SetRegistry(orchestrator.NewRegistry(map[string]string{"user_create": "http://users:8080"}))
+//	workflow, err := types.ParseWorkflow(definition)
+//	...
+//	err = executor.AddWorkflow("user_signup_chain", workflow)
+//	output, err := executor.ExecuteChain("user_signup_chain", types.WorkflowInput{Data: input})
+//
+// The workflow package builds workflows in code instead of YAML. Durable
+// execution (NewDurableEngine) additionally needs the Postgres schema in
+// db/migrations.
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"tala_base/types"
+)
+
+// Executor runs workflows and single steps. *ChainExecutor implements it;
+// code embedding the orchestrator can depend on Executor instead, such as to
+// wrap it with its own instrumentation or to fake it in tests.
+type Executor interface {
+	ExecuteChain(name string, input types.WorkflowInput) (*types.WorkflowOutput, error)
+	ExecuteStep(step types.Step, state *types.WorkflowState) (*types.StepResult, error)
+	Workflow(name string) (types.Workflow, bool)
+	GetWorkflows() []string
+}
+
+var _ Executor = (*ChainExecutor)(nil)
+
+// StateStore keeps the state of executions ExecuteChain runs, saved after
+// each step, so a service embedding the executor can follow or persist their
+// progress. Durable executions keep their state in Postgres instead.
+type StateStore interface {
+	Save(ctx context.Context, execCtx types.ExecutionContext, workflow string, state *types.WorkflowState) error
+}
+
+// MemoryStateStore keeps the latest state of each execution in memory, by
+// execution ID or, for executions without one, request ID. States are stored
+// encoded, so they do not change as the execution goes on.
+type MemoryStateStore struct {
+	mu     sync.RWMutex
+	states map[string][]byte
+}
+
+// NewMemoryStateStore creates an empty in-memory state store
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{states: make(map[string][]byte)}
+}
+
+func (m *MemoryStateStore) Save(ctx context.Context, execCtx types.ExecutionContext, workflow string, state *types.WorkflowState) error {
+	key := execCtx.ExecutionID
+	if key == "" {
+		key = execCtx.RequestID
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode workflow state: %w", err)
+	}
+	m.mu.Lock()
+	m.states[key] = encoded
+	m.mu.Unlock()
+	return nil
+}
+
+// Get returns the latest state saved for an execution or request ID
+func (m *MemoryStateStore) Get(id string) (*types.WorkflowState, bool) {
+	m.mu.RLock()
+	encoded, ok := m.states[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	var state types.WorkflowState
+	if err := json.Unmarshal(encoded, &state); err != nil {
+		return nil, false
+	}
+	return &state, true
+}
+
+// Delete forgets the state of an execution or request ID, such as once it finished
+func (m *MemoryStateStore) Delete(id string) {
+	m.mu.Lock()
+	delete(m.states, id)
+	m.mu.Unlock()
+}
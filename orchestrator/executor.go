@@ -2,199 +2,1237 @@ package orchestrator
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
 
+	"tala_base/logging"
 	"tala_base/types"
-
-	"gopkg.in/yaml.v3"
+	"tala_base/utils"
+	"tala_base/utils/httpclient"
+	"tala_base/utils/validate"
 )
 
+// DefaultLambdaPorts is the localhost port each lambda listens on when run on its own
+var DefaultLambdaPorts = map[string]int{
+	"user_create":      8080,
+	"user_read":        8081,
+	"user_update":      8082,
+	"user_delete":      8083,
+	"user_list":        8084,
+	"user_search":      8085,
+	"user_bulk_create": 8086,
+	"user_audit_read":  8087,
+	"auth_register":    8088,
+	"auth_login":       8089,
+	"auth_refresh":     8090,
+	"notify_email":     8091,
+	"webhook_send":     8092,
+	"transform":        8093,
+	"storage":          8094,
+	"gdpr_erase":       8095,
+}
+
+// ChainExecutor runs workflows step by step, calling each step's lambda
+// through its registry. It implements Executor.
 type ChainExecutor struct {
 	workflows map[string]types.Workflow
-	ports     map[string]int
+	registry  *Registry
+	client    *http.Client
+	logger    *slog.Logger
+	// warm hands the client connections dialed ahead; nil when LAMBDA_WARM_CONNS is unset
+	warm *warmConns
+
+	// authSecret signs lambda calls; serviceToken is sent as a bearer token when no secret is set
+	credMu       sync.RWMutex
+	authSecret   string
+	serviceToken string
+
+	// gcpTokens authenticates calls to lambdas on Cloud Run or Cloud
+	// Functions; nil when LAMBDA_GCP_AUTH is off or credentials are unusable
+	gcpTokens *GCPIDTokens
+	gcpAuth   string
+
+	// locker keeps singleton workflows to one execution at a time
+	locker Locker
+
+	// flags decides the steps conditioned on a feature flag
+	flags Flags
+
+	// retryBudget is the retry budget of workflows that do not set their own
+	retryBudget int
+	// maxResponseSize bounds the lambda responses read into memory
+	maxResponseSize int64
+
+	// onFinish is called with the final event of every workflow ExecuteChain ran
+	onFinish []func(types.ExecutionContext, types.ExecutionEvent)
+	// onCall is called each time a step calls its lambda
+	onCall []func(types.ExecutionContext, types.Step)
+
+	// deprecated counts the executions started of each deprecated workflow
+	deprecated *deprecationMetrics
+	// stepMetrics holds the metrics lambdas report with their results
+	stepMetrics *stepMetrics
+
+	// states checkpoints the executions ExecuteChain runs; nil keeps them in memory only
+	states StateStore
+
+	// blobs stores the responses of binary: blob steps; nil when unconfigured
+	blobs BlobStore
 }
 
 func NewChainExecutor() *ChainExecutor {
-	// Default port mapping based on local_deploy.sh
-	ports := map[string]int{
-		"user_create": 8080,
-		"user_read":   8081,
-		"user_update": 8082,
-		"user_delete": 8083,
-	}
-	return &ChainExecutor{
+	warm := newWarmConns()
+	clientCfg := httpclient.Config{Name: "lambda", Timeout: 5 * time.Minute}
+	if warm != nil {
+		clientCfg.Dial = warm.DialContext
+	}
+	e := &ChainExecutor{
 		workflows: make(map[string]types.Workflow),
-		ports:     ports,
+		// Lambda calls are not idempotent, so they are never retried here,
+		// only hedged by steps that set hedge_after; execution deadlines
+		// still bound them through the request context
+		client: httpclient.New(clientCfg),
+		logger: logging.Component("orchestrator"),
+		warm:   warm,
+		locker: NewLocalLocker(),
+		flags:  EnvFlags{},
+
+		retryBudget:     10,
+		maxResponseSize: 10 << 20,
+		deprecated:      newDeprecationMetrics(),
+		stepMetrics:     newStepMetrics(),
 	}
+	if n, err := strconv.Atoi(os.Getenv("EXECUTION_RETRY_BUDGET")); err == nil && n >= 0 {
+		e.retryBudget = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("LAMBDA_MAX_RESPONSE_SIZE"), 10, 64); err == nil && n > 0 {
+		e.maxResponseSize = n
+	}
+	e.registry = e.newRegistry()
+	e.setupGCPAuth()
+	e.loadCredentials()
+	utils.DefaultSecrets().OnRotate(func(string) { e.loadCredentials() })
+	return e
 }
 
+// newRegistry resolves lambdas through the discovery backend configured by
+// LAMBDA_DISCOVERY, falling back to their static URLs when none is set or it
+// is misconfigured
+func (e *ChainExecutor) newRegistry() *Registry {
+	discovery, ttl, err := DiscoveryFromEnv()
+	if err != nil {
+		e.logger.Warn("Lambda discovery disabled", "error", err)
+	}
+	var registry *Registry
+	if discovery == nil {
+		registry = NewRegistry(lambdaURLs(DefaultLambdaPorts))
+	} else {
+		names := make([]string, 0, len(DefaultLambdaPorts))
+		for name := range DefaultLambdaPorts {
+			names = append(names, name)
+		}
+		registry = NewDiscoveryRegistry(names, discovery, ttl)
+	}
+
+	ejectAfter := 3
+	if n, err := strconv.Atoi(os.Getenv("LAMBDA_EJECT_AFTER")); err == nil && n >= 0 {
+		ejectAfter = n
+	}
+	if err := registry.SetBalancing(os.Getenv("LAMBDA_LB_POLICY"), ejectAfter); err != nil {
+		e.logger.Warn("Using round-robin balancing", "error", err)
+	}
+	return registry
+}
+
+// setupGCPAuth reads LAMBDA_GCP_AUTH: auto (the default) attaches ID tokens
+// to lambdas at *.run.app and *.cloudfunctions.net URLs, always attaches them
+// to every lambda, such as Cloud Run behind a custom domain, and off never does
+func (e *ChainExecutor) setupGCPAuth() {
+	e.gcpAuth = os.Getenv("LAMBDA_GCP_AUTH")
+	switch e.gcpAuth {
+	case "":
+		e.gcpAuth = "auto"
+	case "auto", "always":
+	case "off":
+		return
+	default:
+		e.logger.Warn("Unknown LAMBDA_GCP_AUTH, using auto", "value", e.gcpAuth)
+		e.gcpAuth = "auto"
+	}
+	tokens, err := NewGCPIDTokens()
+	if err != nil {
+		e.logger.Warn("GCP ID tokens disabled", "error", err)
+		return
+	}
+	e.gcpTokens = tokens
+	e.registry.idTokens = e.idToken
+}
+
+// idToken returns the ID token to call the lambda at lambdaURL with, or "" if
+// it needs none
+func (e *ChainExecutor) idToken(ctx context.Context, lambdaURL string) (string, error) {
+	if e.gcpTokens == nil || e.gcpAuth != "always" && !isGCPServerless(lambdaURL) {
+		return "", nil
+	}
+	return e.gcpTokens.Token(ctx, lambdaURL)
+}
+
+// loadCredentials reads LAMBDA_AUTH_SECRET and LAMBDA_SERVICE_TOKEN, either of
+// which may be a secret:// reference; it runs again whenever a secret rotates
+func (e *ChainExecutor) loadCredentials() {
+	secret, err := utils.SecretEnv("LAMBDA_AUTH_SECRET")
+	if err != nil {
+		e.logger.Warn("Lambda auth secret unavailable", "error", err)
+	}
+	token, err := utils.SecretEnv("LAMBDA_SERVICE_TOKEN")
+	if err != nil {
+		e.logger.Warn("Lambda service token unavailable", "error", err)
+	}
+	e.credMu.Lock()
+	defer e.credMu.Unlock()
+	e.authSecret, e.serviceToken = secret, token
+}
+
+// templateFuncs are available to every input template. secret renders a value
+// from utils.DefaultSecrets; the rendered input is sent to the lambda and kept
+// in execution history, so pass secrets only to steps that need them. get and
+// jsonpath read nested values without failing on missing ones; toInt,
+// toString, parseTime and round convert values decoded from JSON.
+var templateFuncs = template.FuncMap{
+	"secret": func(name string) (string, error) {
+		return utils.DefaultSecrets().Secret(context.Background(), name)
+	},
+	"get":       getPath,
+	"jsonpath":  jsonPath,
+	"toInt":     toInt,
+	"toString":  toString,
+	"parseTime": parseTime,
+	"round":     round,
+}
+
+// lambdaURLs returns each lambda's base URL: LAMBDA_URL_TEMPLATE with {name},
+// {dns_name} (the name with dashes for underscores) and {port} substituted
+// when set, such as http://{name}:{port} under docker compose or
+// srv://{dns_name}.tala.svc in Kubernetes, or a comma-separated list of
+// replicas to balance across; a path under LAMBDA_BASE_URL when
+// the lambdas are served from one process by cmd/lambdas; otherwise its own
+// localhost port
+func lambdaURLs(ports map[string]int) map[string]string {
+	tmpl := os.Getenv("LAMBDA_URL_TEMPLATE")
+	base := strings.TrimSuffix(os.Getenv("LAMBDA_BASE_URL"), "/")
+	urls := make(map[string]string, len(ports))
+	for name, port := range ports {
+		switch {
+		case tmpl != "":
+			urls[name] = strings.NewReplacer(
+				"{name}", name,
+				"{dns_name}", strings.ReplaceAll(name, "_", "-"),
+				"{port}", strconv.Itoa(port),
+			).Replace(tmpl)
+		case base != "":
+			urls[name] = base + "/" + name
+		default:
+			urls[name] = fmt.Sprintf("http://localhost:%d", port)
+		}
+	}
+	return urls
+}
+
+// SetLocker sets the locker singleton workflows are serialized with, in
+// place of the default that only covers this process
+func (e *ChainExecutor) SetLocker(l Locker) {
+	e.locker = l
+}
+
+// lockExecution takes the lock an execution of a singleton workflow holds
+// while it runs, or a free one of the max_concurrent_executions slots of a
+// workflow that sets it, returning ErrLocked when none is free
+func (e *ChainExecutor) lockExecution(ctx context.Context, name string, workflow types.Workflow) (func(), error) {
+	if workflow.Singleton {
+		return e.locker.TryLock(ctx, "workflow:"+name)
+	}
+	for slot := 0; slot < workflow.MaxConcurrentExecutions; slot++ {
+		unlock, err := e.locker.TryLock(ctx, fmt.Sprintf("workflow:%s:%d", name, slot))
+		if !errors.Is(err, ErrLocked) {
+			return unlock, err
+		}
+	}
+	return nil, ErrLocked
+}
+
+// SetFlags replaces the provider that steps with a flag are decided by,
+// which defaults to EnvFlags
+func (e *ChainExecutor) SetFlags(f Flags) {
+	e.flags = f
+}
+
+// Registry returns the lambda registry used to resolve and health-check lambdas
+func (e *ChainExecutor) Registry() *Registry {
+	return e.registry
+}
+
+// SetRegistry replaces the lambda registry, such as with one built by
+// NewRegistry for lambdas an embedding service runs itself, in place of the
+// default built from LAMBDA_DISCOVERY and the *_URL variables
+func (e *ChainExecutor) SetRegistry(r *Registry) {
+	e.registry = r
+}
+
+// SetStateStore checkpoints the state of every execution ExecuteChain runs
+// to s after each step
+func (e *ChainExecutor) SetStateStore(s StateStore) {
+	e.states = s
+}
+
+// Workflow returns the workflow added as name
+func (e *ChainExecutor) Workflow(name string) (types.Workflow, bool) {
+	workflow, exists := e.workflows[name]
+	return workflow, exists
+}
+
+// authorize signs req with the shared lambda secret, or attaches the service
+// token. The signature covers the execution context headers, so they must be
+// set first.
+func (e *ChainExecutor) authorize(req *http.Request, body []byte) {
+	e.credMu.RLock()
+	defer e.credMu.RUnlock()
+	switch {
+	case e.authSecret != "":
+		path := req.URL.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		timestamp := time.Now().Unix()
+		req.Header.Set(utils.SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(utils.SignatureHeader, utils.SignLambdaRequest(e.authSecret, timestamp, req.Method, path, req.Header, body))
+	case e.serviceToken != "":
+		req.Header.Set("Authorization", "Bearer "+e.serviceToken)
+	}
+}
+
+// setIDToken attaches a GCP ID token, in X-Serverless-Authorization when the
+// lambda's service token already occupies Authorization
+func setIDToken(req *http.Request, token string) {
+	switch {
+	case token == "":
+	case req.Header.Get("Authorization") != "":
+		req.Header.Set(serverlessAuthHeader, "Bearer "+token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// LoadWorkflow reads workflows/<name>.yaml and adds it as name
 func (e *ChainExecutor) LoadWorkflow(name string) error {
 	file, err := os.ReadFile(fmt.Sprintf("workflows/%s.yaml", name))
 	if err != nil {
 		return fmt.Errorf("failed to read workflow file: %w", err)
 	}
 
-	var workflow types.Workflow
-	if err := yaml.Unmarshal(file, &workflow); err != nil {
+	workflow, err := types.ParseWorkflow(file)
+	if err != nil {
 		return fmt.Errorf("failed to parse workflow: %w", err)
 	}
+	return e.AddWorkflow(name, workflow)
+}
 
-	e.workflows[name] = workflow
+// AddWorkflow validates a workflow and adds it as name, replacing any workflow
+// of that name, such as one an embedding service defines in code or parses
+// with types.ParseWorkflow from its own storage. Add workflows before
+// executions start; they are not guarded against concurrent changes.
+func (e *ChainExecutor) AddWorkflow(name string, workflow *types.Workflow) error {
+	if len(workflow.Steps) == 0 {
+		return fmt.Errorf("failed to parse workflow: no steps")
+	}
+	for field, rule := range workflow.Inputs {
+		if err := validate.CheckRule(rule); err != nil {
+			return fmt.Errorf("failed to parse workflow: input %s: %w", field, err)
+		}
+	}
+	overrideConfig(name, workflow.Config)
+	if workflow.RetryBudget == nil {
+		budget := e.retryBudget
+		workflow.RetryBudget = &budget
+	} else if *workflow.RetryBudget < 0 {
+		return fmt.Errorf("failed to parse workflow: retry_budget must not be negative")
+	}
+	if workflow.MaxConcurrentExecutions < 0 {
+		return fmt.Errorf("failed to parse workflow: max_concurrent_executions must not be negative")
+	}
+	if !workflow.Priority.Valid() {
+		return fmt.Errorf("failed to parse workflow: unknown priority %q (expected low, normal or high)", workflow.Priority)
+	}
+	if workflow.Singleton && workflow.MaxConcurrentExecutions > 0 {
+		return fmt.Errorf("failed to parse workflow: set singleton or max_concurrent_executions, not both")
+	}
+	if err := checkRunnable(workflow.Steps); err != nil {
+		return fmt.Errorf("failed to parse workflow: %w", err)
+	}
+	for i, step := range workflow.Steps {
+		for code, handler := range step.OnError {
+			if workflow.StepIndex(handler) < 0 {
+				return fmt.Errorf("failed to parse workflow: step %s handles %s with unknown step %s", step.Name, code, handler)
+			}
+		}
+		if step.ErrorHandler != "" && i == len(workflow.Steps)-1 {
+			return fmt.Errorf("failed to parse workflow: step %s sets error_handler but no step follows it to handle its errors", step.Name)
+		}
+	}
+	if workflow.IsErrorHandler(0) {
+		return fmt.Errorf("failed to parse workflow: the first step %s cannot be an on_error handler", workflow.Steps[0].Name)
+	}
+	if workflow.Deprecated != nil {
+		if _, err := workflow.Deprecated.SunsetTime(); err != nil {
+			return fmt.Errorf("failed to parse workflow: deprecated: %w", err)
+		}
+	}
+
+	e.workflows[name] = *workflow
 	return nil
 }
 
+// runnableKinds are the step kinds executeStep runs
+var runnableKinds = map[types.StepKind]bool{
+	types.StepKindLambda: true,
+	types.StepKindSet:    true,
+}
+
+// checkRunnable rejects steps, including those nested in parallel branches
+// and switch cases, of kinds the executor cannot run yet, so a workflow fails
+// to load rather than after its earlier steps have had side effects
+func checkRunnable(steps []types.Step) error {
+	for _, step := range steps {
+		if kind := step.EffectiveKind(); !runnableKinds[kind] {
+			return fmt.Errorf("step %s is of kind %s, which is not supported yet (supported: lambda, set)", step.Name, kind)
+		}
+		var nested [][]types.Step
+		if step.Parallel != nil {
+			for _, branch := range step.Parallel.Branches {
+				nested = append(nested, branch.Steps)
+			}
+		}
+		if step.Switch != nil {
+			for _, c := range step.Switch.Cases {
+				nested = append(nested, c.Steps)
+			}
+			nested = append(nested, step.Switch.Default)
+		}
+		for _, steps := range nested {
+			if err := checkRunnable(steps); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// overrideConfig replaces each top-level config value that has a
+// WORKFLOW_CONFIG_<WORKFLOW>_<NAME> variable set, such as
+// WORKFLOW_CONFIG_USER_SIGNUP_CHAIN_MAX_RETRIES. A value that parses as JSON,
+// such as a number or boolean, is used as parsed, and any other as a string.
+func overrideConfig(workflow string, config map[string]interface{}) {
+	for key := range config {
+		raw, ok := os.LookupEnv("WORKFLOW_CONFIG_" + envName(workflow) + "_" + envName(key))
+		if !ok {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		config[key] = value
+	}
+}
+
+// envName turns a name into the form used in environment variable names:
+// upper case, with anything but letters and digits replaced by underscores
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// ExecuteStep runs one step against state. Once the execution's deadline has
+// passed, the step is not run and fails with DEADLINE_EXCEEDED, as does a
+// step failing with a retryable code after it passed, such as a lambda call
+// the deadline cut short, since retrying it could only overrun further.
+// A step whose flag rules it out is skipped, passing its input on unchanged.
 func (e *ChainExecutor) ExecuteStep(step types.Step, state *types.WorkflowState) (*types.StepResult, error) {
+	if err := deadlineExceeded(step, state); err != nil {
+		return &types.StepResult{Error: err}, nil
+	}
+	if step.Flag != "" && !e.flagAllows(step, state) {
+		return &types.StepResult{Data: state.Steps[state.CurrentStep].Input.Data}, nil
+	}
+	result, err := e.executeStep(step, state)
+	if err == nil && result.Error != nil && result.Error.Code.Retryable() {
+		if deadlineErr := deadlineExceeded(step, state); deadlineErr != nil {
+			result.Error = deadlineErr
+		}
+	}
+	return result, err
+}
+
+// flagAllows reports whether a step's flag lets it run in this execution. A
+// flag the provider fails to evaluate counts as off, so an outage of the flag
+// service only skips or runs steps as if their flags were off, instead of
+// failing executions.
+func (e *ChainExecutor) flagAllows(step types.Step, state *types.WorkflowState) bool {
+	name, negated := step.FlagName()
+	execCtx := state.Steps[state.CurrentStep].Input.Context
+	on, err := e.flags.Enabled(context.Background(), name, execCtx)
+	if err != nil {
+		e.logger.Warn("Failed to evaluate flag; treating it as off", "step", step.Name, "flag", name, "error", err)
+		on = false
+	}
+	return on != negated
+}
+
+// deadlineExceeded returns the error of a step started or finished after
+// the execution's deadline, or nil while time remains
+func deadlineExceeded(step types.Step, state *types.WorkflowState) *types.WorkflowError {
+	deadline := state.Steps[state.CurrentStep].Input.Context.Deadline
+	if deadline == nil || time.Now().Before(*deadline) {
+		return nil
+	}
+	return types.WorkflowErrorf(step.Name, types.ErrorCodeDeadlineExceeded,
+		"execution deadline %s passed", deadline.UTC().Format(time.RFC3339Nano))
+}
+
+func (e *ChainExecutor) executeStep(step types.Step, state *types.WorkflowState) (*types.StepResult, error) {
+	switch kind := step.EffectiveKind(); kind {
+	case types.StepKindLambda:
+	case types.StepKindSet:
+		return setVars(step, state), nil
+	default:
+		return &types.StepResult{
+			Error: types.WorkflowErrorf(step.Name, types.ErrorCodeUnsupportedStepKind, "steps of kind %s are not supported yet", kind),
+		}, nil
+	}
+
 	// Parse input template
-	tmpl, err := template.New("input").Parse(step.InputTemplate)
+	tmpl, err := parseTemplate("input", step.InputTemplate)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse input template: %w", err)
+		return &types.StepResult{
+			Error: types.WorkflowErrorf(step.Name, types.ErrorCodeTemplateError, "failed to parse input template: %v", err),
+		}, nil
 	}
 
-	// Execute template with current state
-	var inputBuf bytes.Buffer
-	if err := tmpl.Execute(&inputBuf, state); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
+	// Render the template with current state straight into the request body
+	body := newRequestBody()
+	defer body.release()
+	if err := tmpl.Execute(body.buf, templateData(state)); err != nil {
+		return &types.StepResult{
+			Error: types.WorkflowErrorf(step.Name, types.ErrorCodeTemplateError, "failed to execute input template: %v", err),
+		}, nil
 	}
 
-	// Get port for lambda
-	port, exists := e.ports[step.Lambda]
-	if !exists {
-		return nil, fmt.Errorf("no port mapping found for lambda %s", step.Lambda)
+	// A dedupe step reuses the output of an identical call made earlier
+	var callKey string
+	if step.Dedupe {
+		callKey = lambdaCallKey(step.Lambda, body.Bytes())
+		if data, ok := state.Calls[callKey]; ok {
+			return &types.StepResult{Data: data}, nil
+		}
 	}
 
-	// Call lambda with correct port
-	lambdaURL := fmt.Sprintf("http://localhost:%d", port)
-	resp, err := http.Post(lambdaURL, "application/json", &inputBuf)
+	// Resolve the lambda, failing fast if its last readiness check failed
+	lambdaURL, release, err := e.registry.Acquire(step.Lambda)
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) {
+		return &types.StepResult{
+			Error: types.NewWorkflowError(step.Name, types.ErrorCodeLambdaUnavailable, err.Error()),
+		}, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to call lambda: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+	execCtx := state.Steps[state.CurrentStep].Input.Context
+	if execCtx.ExecutionID != "" {
+		execCtx.IdempotencyKey = execCtx.ExecutionID + "/" + step.Name
+	}
+	ctx := withCallStep(context.Background(), step)
+	if execCtx.Deadline != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, *execCtx.Deadline)
+		defer cancel()
+	}
+
+	// Call lambda
+	for _, fn := range e.onCall {
+		fn(execCtx, step)
+	}
+	resp := e.call(ctx, step, state, lambdaURL, release, body, execCtx)
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	if resp.stepErr != nil {
+		return &types.StepResult{Error: resp.stepErr}, nil
+	}
+	result, err := e.decodeResponse(ctx, step, execCtx, resp)
+	// The upload of a blob step's body may still be reading it
+	if step.Binary != types.BinaryBlob {
+		resp.release()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to read lambda response: %w", err)
+		return nil, err
+	}
+	e.stepMetrics.record(step, result.Metrics, e.logger)
+	result.Headers = captureHeaders(step.CaptureHeaders, resp.header)
+	rememberCall(state, callKey, result)
+	return result, nil
+}
+
+// decodeResponse turns what a lambda answered into the step's result
+func (e *ChainExecutor) decodeResponse(ctx context.Context, step types.Step, execCtx types.ExecutionContext, resp *lambdaResponse) (*types.StepResult, error) {
+	body := resp.body
+	succeeded := step.Succeeded(resp.status)
+
+	// A status the step maps to an error code fails it with that code,
+	// whatever the body says
+	if code, ok := step.StatusCodes[resp.status]; ok && !succeeded {
+		message := fmt.Sprintf("lambda returned status %d", resp.status)
+		var lambdaErr struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(body, &lambdaErr); err == nil && lambdaErr.Error != "" {
+			message = lambdaErr.Error
+		}
+		return &types.StepResult{Error: types.NewWorkflowError(step.Name, code, message)}, nil
+	}
+	// A success such as 204 No Content may have no body at all
+	if succeeded && len(bytes.TrimSpace(body)) == 0 {
+		return &types.StepResult{Data: map[string]interface{}{}}, nil
 	}
 
-	// Validate Content-Type
-	contentType := resp.Header.Get("Content-Type")
+	// Validate Content-Type; binary steps keep a successful non-JSON body as is
+	contentType := resp.contentType
+	if contentType != "application/json" && step.Binary != "" && succeeded {
+		return e.binaryResult(ctx, step, execCtx, contentType, body)
+	}
 	if contentType != "application/json" {
 		return &types.StepResult{
-			Error: &types.WorkflowError{
-				Step:    step.Name,
-				Message: fmt.Sprintf("lambda returned unexpected Content-Type: %s, body: %s", contentType, string(body)),
-				Code:    "INVALID_RESPONSE_TYPE",
-			},
+			Error: types.WorkflowErrorf(step.Name, types.ErrorCodeInvalidResponseType,
+				"lambda returned unexpected Content-Type: %s, body: %s", contentType, string(body)),
 		}, nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if !succeeded {
+		// Lambdas on the SDK answer {"error": ..., "code": ...}; keep their code,
+		// such as USER_NOT_FOUND, so workflows can branch on it
+		var lambdaErr struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if err := json.Unmarshal(body, &lambdaErr); err == nil && lambdaErr.Code != "" {
+			return &types.StepResult{
+				Error: types.NewWorkflowError(step.Name, types.WorkflowErrorCode(lambdaErr.Code), lambdaErr.Error),
+			}, nil
+		}
 		return &types.StepResult{
-			Error: &types.WorkflowError{
-				Step:    step.Name,
-				Message: fmt.Sprintf("lambda returned error: %s", string(body)),
-				Code:    "LAMBDA_ERROR",
-			},
+			Error: types.WorkflowErrorf(step.Name, types.ErrorCodeLambdaError, "lambda returned error: %s", string(body)),
 		}, nil
 	}
 
 	// Parse response
-	var result types.StepResult
-	if err := json.Unmarshal(body, &result); err != nil {
+	result, err := decodeStepResult(body)
+	if err != nil {
 		return &types.StepResult{
-			Error: &types.WorkflowError{
-				Step:    step.Name,
-				Message: fmt.Sprintf("failed to parse lambda response as JSON: %s, error: %v", string(body), err),
-				Code:    "INVALID_JSON",
-			},
+			Error: types.WorkflowErrorf(step.Name, types.ErrorCodeInvalidJSON,
+				"failed to parse lambda response as JSON: %s, error: %v", string(body), err),
 		}, nil
 	}
+	return result, nil
+}
+
+// captureHeaders returns the named headers the response carries, keyed as
+// named, or nil when it carries none of them
+func captureHeaders(names []string, header http.Header) map[string]string {
+	var captured map[string]string
+	for _, name := range names {
+		if value := header.Get(name); value != "" {
+			if captured == nil {
+				captured = make(map[string]string, len(names))
+			}
+			captured[name] = value
+		}
+	}
+	return captured
+}
 
-	return &result, nil
+// rememberCall keeps the output of a dedupe step's successful call for later
+// dedupe steps making the same call
+func rememberCall(state *types.WorkflowState, callKey string, result *types.StepResult) {
+	if callKey == "" || result.Error != nil {
+		return
+	}
+	if state.Calls == nil {
+		state.Calls = make(map[string]map[string]interface{})
+	}
+	state.Calls[callKey] = result.Data
+}
+
+// lambdaResponse is the outcome of one call to a lambda instance: what it
+// answered, or the step error or internal error that kept it from answering
+type lambdaResponse struct {
+	status      int
+	contentType string
+	header      http.Header
+	body        []byte
+	stepErr     *types.WorkflowError
+	err         error
+	// buf holds body, pooled again by release
+	buf *bytes.Buffer
+}
+
+// release returns the buffer holding the body to the pool; the body must not
+// be used after
+func (r *lambdaResponse) release() {
+	if r.buf != nil {
+		putBuffer(r.buf)
+		r.buf, r.body = nil, nil
+	}
+}
+
+// answered reports whether the lambda itself answered, rather than the call
+// failing or a gateway answering in its place
+func (r *lambdaResponse) answered() bool {
+	return r.err == nil && r.stepErr == nil && instanceFailure(&http.Response{StatusCode: r.status}, nil) == nil
+}
+
+// call calls the lambda at lambdaURL. A step with hedge_after also calls
+// another instance if the first has not answered by then, spending one retry
+// from the execution's budget; the first answer is used and the other call
+// canceled, and if neither answers the first failure is returned.
+func (e *ChainExecutor) call(ctx context.Context, step types.Step, state *types.WorkflowState, lambdaURL string, release func(error), body *requestBody, execCtx types.ExecutionContext) *lambdaResponse {
+	hedgeAfter, _ := time.ParseDuration(step.HedgeAfter)
+	if hedgeAfter <= 0 {
+		return e.attempt(ctx, step.Name, lambdaURL, release, body, execCtx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	responses := make(chan *lambdaResponse, 2)
+	go func() { responses <- e.attempt(ctx, step.Name, lambdaURL, release, body, execCtx) }()
+	pending := 1
+
+	hedge := time.NewTimer(hedgeAfter)
+	defer hedge.Stop()
+	var failed *lambdaResponse
+	for {
+		select {
+		case <-hedge.C:
+			if !state.RetryAllowed() {
+				e.logger.Debug("Not hedging, retry budget spent", "step", step.Name)
+				continue
+			}
+			hedgeURL, hedgeRelease, err := e.registry.AcquireOther(step.Lambda, lambdaURL)
+			if err != nil {
+				e.logger.Debug("Not hedging", "step", step.Name, "error", err)
+				continue
+			}
+			state.Retries++
+			pending++
+			go func() { responses <- e.attempt(ctx, step.Name, hedgeURL, hedgeRelease, body, execCtx) }()
+		case resp := <-responses:
+			pending--
+			if resp.answered() {
+				return resp
+			}
+			if failed == nil {
+				failed = resp
+			}
+			if pending == 0 {
+				return failed
+			}
+		}
+	}
+}
+
+// attempt makes one call to the lambda instance at lambdaURL, releasing it
+// with the call's outcome
+func (e *ChainExecutor) attempt(ctx context.Context, stepName, lambdaURL string, release func(error), body *requestBody, execCtx types.ExecutionContext) *lambdaResponse {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lambdaURL, nil)
+	if err == nil {
+		req.Body, err = body.open()
+	}
+	if err != nil {
+		release(nil)
+		return &lambdaResponse{err: fmt.Errorf("failed to build lambda request: %w", err)}
+	}
+	req.ContentLength = int64(len(body.Bytes()))
+	req.GetBody = body.open
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(utils.StepEnvelopeHeader, "true")
+	utils.SetExecutionContextHeaders(req.Header, execCtx)
+	e.authorize(req, body.Bytes())
+	idToken, err := e.idToken(ctx, lambdaURL)
+	if err != nil {
+		release(nil)
+		return &lambdaResponse{
+			stepErr: types.WorkflowErrorf(stepName, types.ErrorCodeLambdaUnavailable, "failed to get ID token: %v", err),
+		}
+	}
+	setIDToken(req, idToken)
+
+	resp, err := e.client.Do(req)
+	release(instanceFailure(resp, err))
+	if err != nil {
+		code := types.ErrorCodeLambdaUnavailable
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			code = types.ErrorCodeTimeout
+		}
+		return &lambdaResponse{
+			stepErr: types.WorkflowErrorf(stepName, code, "failed to call lambda: %v", err),
+		}
+	}
+	defer resp.Body.Close()
+
+	// A lambda streaming an unbounded response must not exhaust our memory
+	if resp.ContentLength > e.maxResponseSize {
+		return tooLarge(stepName, e.maxResponseSize)
+	}
+	buf := getBuffer()
+	if resp.ContentLength > 0 {
+		buf.Grow(int(resp.ContentLength))
+	}
+	_, err = buf.ReadFrom(io.LimitReader(resp.Body, e.maxResponseSize+1))
+	if err != nil && ctx.Err() != nil {
+		putBuffer(buf)
+		return &lambdaResponse{
+			stepErr: types.WorkflowErrorf(stepName, types.ErrorCodeTimeout, "failed to read lambda response: %v", err),
+		}
+	}
+	if err != nil {
+		putBuffer(buf)
+		return &lambdaResponse{err: fmt.Errorf("failed to read lambda response: %w", err)}
+	}
+	if int64(buf.Len()) > e.maxResponseSize {
+		putBuffer(buf)
+		return tooLarge(stepName, e.maxResponseSize)
+	}
+	return &lambdaResponse{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), header: resp.Header, body: buf.Bytes(), buf: buf}
+}
+
+// tooLarge is the response of a call whose answer exceeded limit bytes
+func tooLarge(stepName string, limit int64) *lambdaResponse {
+	return &lambdaResponse{
+		stepErr: types.WorkflowErrorf(stepName, types.ErrorCodeResponseTooLarge,
+			"lambda response exceeds LAMBDA_MAX_RESPONSE_SIZE (%d bytes)", limit),
+	}
+}
+
+// lambdaCallKey identifies a call by lambda and a hash of its input, with
+// JSON whitespace removed so formatting differences between templates do not
+// count
+func lambdaCallKey(lambda string, input []byte) string {
+	compact := getBuffer()
+	defer putBuffer(compact)
+	if err := json.Compact(compact, input); err == nil {
+		input = compact.Bytes()
+	}
+	sum := sha256.Sum256(input)
+	return lambda + ":" + hex.EncodeToString(sum[:])
+}
+
+// templateData is what step templates are executed with: the state's Data,
+// plus its Config, Vars and the input and output of each step so far as Steps
+func templateData(state *types.WorkflowState) map[string]interface{} {
+	data := make(map[string]interface{}, len(state.Data)+3)
+	for key, value := range state.Data {
+		data[key] = value
+	}
+	data["Config"] = state.Config
+	data["Vars"] = state.Vars
+	data["Steps"] = state.Steps
+	return data
+}
+
+// setVars runs a set step: it renders each variable's template against the
+// state, stores the values in state.Vars and hands the step's own input on
+// to the next step unchanged
+func setVars(step types.Step, state *types.WorkflowState) *types.StepResult {
+	values := make(map[string]interface{}, len(step.Set.Vars))
+	for name, text := range step.Set.Vars {
+		tmpl, err := parseTemplate(name, text)
+		if err != nil {
+			return &types.StepResult{
+				Error: types.WorkflowErrorf(step.Name, types.ErrorCodeTemplateError, "failed to parse template of %s: %v", name, err),
+			}
+		}
+		buf := getBuffer()
+		if err := tmpl.Execute(buf, templateData(state)); err != nil {
+			putBuffer(buf)
+			return &types.StepResult{
+				Error: types.WorkflowErrorf(step.Name, types.ErrorCodeTemplateError, "failed to execute template of %s: %v", name, err),
+			}
+		}
+		var value interface{}
+		if err := json.Unmarshal(buf.Bytes(), &value); err != nil {
+			value = buf.String()
+		}
+		putBuffer(buf)
+		values[name] = value
+	}
+
+	if state.Vars == nil {
+		state.Vars = make(map[string]interface{}, len(values))
+	}
+	for name, value := range values {
+		state.Vars[name] = value
+	}
+	return &types.StepResult{Data: state.Steps[step.Name].Input.Data}
+}
+
+// instanceFailure is the error a call counts as against the instance that
+// served it: a transport error, or a gateway status from a proxy in front of
+// an instance that is down. Errors the lambda itself answered with are not.
+func instanceFailure(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("lambda returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// decodeStepResult parses a lambda response. Lambdas on the SDK answer with a
+// StepResult envelope; older lambdas return their output object directly, which
+// is adapted by treating the whole object as the step's Data.
+func decodeStepResult(body []byte) (*types.StepResult, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	value, hasData := raw["data"]
+	data, isObject := value.(map[string]interface{})
+	envelope := hasData && (isObject || value == nil)
+	for key := range raw {
+		if key != "data" && key != "error" && key != "metrics" {
+			envelope = false
+		}
+	}
+	if !envelope {
+		return &types.StepResult{Data: raw}, nil
+	}
+
+	// The error and metrics are small and rarely set, so they are converted
+	// from the decoded values rather than decoding the body a second time
+	result := &types.StepResult{Data: data}
+	if raw["error"] != nil {
+		if err := convertJSON(raw["error"], &result.Error); err != nil {
+			return &types.StepResult{Data: raw}, nil
+		}
+	}
+	if raw["metrics"] != nil {
+		if err := convertJSON(raw["metrics"], &result.Metrics); err != nil {
+			return &types.StepResult{Data: raw}, nil
+		}
+	}
+	return result, nil
+}
+
+// convertJSON converts a decoded JSON value into out, as if out had been
+// decoded from it
+func convertJSON(value, out interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := json.NewEncoder(buf).Encode(value); err != nil {
+		return err
+	}
+	return json.Unmarshal(buf.Bytes(), out)
+}
+
+// OnFinish registers fn to be called with the context and the
+// execution.succeeded or execution.failed event of each workflow ExecuteChain runs
+func (e *ChainExecutor) OnFinish(fn func(execCtx types.ExecutionContext, event types.ExecutionEvent)) {
+	e.onFinish = append(e.onFinish, fn)
+}
+
+// OnCall registers fn to be called with the context and step each time a
+// step calls its lambda, including calls retried by a durable execution, but
+// not steps skipped or answered by dedupe
+func (e *ChainExecutor) OnCall(fn func(execCtx types.ExecutionContext, step types.Step)) {
+	e.onCall = append(e.onCall, fn)
 }
 
 func (e *ChainExecutor) ExecuteChain(name string, input types.WorkflowInput) (*types.WorkflowOutput, error) {
+	output, err := e.executeChain(name, input)
+	if output != nil && len(e.onFinish) > 0 {
+		event := finishEvent(name, output)
+		event.ExecutionID = input.Context.ExecutionID
+		for _, fn := range e.onFinish {
+			fn(input.Context, event)
+		}
+	}
+	return output, err
+}
+
+// finishEvent describes how a workflow ended
+func finishEvent(name string, output *types.WorkflowOutput) types.ExecutionEvent {
+	event := types.ExecutionEvent{
+		Workflow:  name,
+		Type:      types.EventExecutionSucceeded,
+		Status:    types.ExecutionSucceeded,
+		Output:    marshalRaw(output.Data),
+		Error:     output.Error,
+		Timestamp: time.Now().UTC(),
+	}
+	if output.Error != nil {
+		event.Type = types.EventExecutionFailed
+		event.Status = types.ExecutionFailed
+	}
+	return event
+}
+
+func (e *ChainExecutor) executeChain(name string, input types.WorkflowInput) (*types.WorkflowOutput, error) {
 	workflow, exists := e.workflows[name]
 	if !exists {
 		return nil, fmt.Errorf("workflow %s not found", name)
 	}
+	if workflow.Disabled {
+		return &types.WorkflowOutput{Error: disabledError(name)}, nil
+	}
+	if err := validate.Map(input.Data, workflow.Inputs); err != nil {
+		return &types.WorkflowOutput{
+			Error: types.NewWorkflowError("input", types.ErrorCodeValidationFailed, err.Error()),
+		}, nil
+	}
+	e.deprecated.count(name, workflow)
+
+	if workflow.Singleton || workflow.MaxConcurrentExecutions > 0 {
+		unlock, err := e.lockExecution(context.Background(), name, workflow)
+		if errors.Is(err, ErrLocked) && workflow.Singleton {
+			return &types.WorkflowOutput{
+				Error: types.WorkflowErrorf("", types.ErrorCodeConflict, "workflow %s is already running", name),
+			}, nil
+		}
+		if errors.Is(err, ErrLocked) {
+			return &types.WorkflowOutput{
+				Error: types.WorkflowErrorf("", types.ErrorCodeRateLimited,
+					"workflow %s is already running its maximum of %d executions", name, workflow.MaxConcurrentExecutions),
+			}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock workflow %s: %w", name, err)
+		}
+		defer unlock()
+	}
 
+	state := newWorkflowState(workflow, input)
+	for i, step := range workflow.Steps {
+		if workflow.IsErrorHandler(i) {
+			continue
+		}
+		// Execute step
+		result, err := e.ExecuteStep(step, state)
+		if err != nil {
+			return nil, fmt.Errorf("step %s failed: %w", step.Name, err)
+		}
+		output, err := e.completeStep(workflow, state, i, result)
+		e.checkpoint(input.Context, name, state)
+		if output != nil || err != nil {
+			return output, err
+		}
+	}
+	return nil, fmt.Errorf("workflow %s has no steps", name)
+}
+
+// checkpoint saves state to the state store, if there is one. A failed save
+// is logged rather than failing an execution that is otherwise fine.
+func (e *ChainExecutor) checkpoint(execCtx types.ExecutionContext, name string, state *types.WorkflowState) {
+	if e.states == nil {
+		return
+	}
+	if err := e.states.Save(context.Background(), execCtx, name, state); err != nil {
+		e.logger.Warn("Failed to checkpoint workflow state", "workflow", name, "step", state.CurrentStep, "error", err)
+	}
+}
+
+// newWorkflowState starts a workflow at its first step with input
+func newWorkflowState(workflow types.Workflow, input types.WorkflowInput) *types.WorkflowState {
 	state := &types.WorkflowState{
 		Steps:       make(map[string]types.StepState),
 		CurrentStep: workflow.Steps[0].Name,
+		Config:      workflow.Config,
+		Vars:        make(map[string]interface{}, len(input.Context.Vars)),
+		Data:        map[string]interface{}{"input": input.Data},
+		RetryBudget: workflow.RetryBudget,
+	}
+	for name, value := range input.Context.Vars {
+		state.Vars[name] = value
 	}
 
 	// Initialize first step
 	state.Steps[workflow.Steps[0].Name] = types.StepState{
 		Input: input,
 	}
+	return state
+}
 
-	for i, step := range workflow.Steps {
-		// Execute step
-		result, err := e.ExecuteStep(step, state)
-		if err != nil {
-			return nil, fmt.Errorf("step %s failed: %w", step.Name, err)
-		}
+// completeStep records the result of step i in state. A failed step runs its
+// error handler and ends the workflow; a successful one stores its output
+// under its OutputKey and hands it to the next step as input, or ends the
+// workflow if it was the last. The execution context is carried unchanged
+// from step to step and into the output, whether the workflow succeeded or
+// failed. The workflow's output is returned once it has ended, and nil while
+// steps remain.
+func (e *ChainExecutor) completeStep(workflow types.Workflow, state *types.WorkflowState, i int, result *types.StepResult) (*types.WorkflowOutput, error) {
+	step := workflow.Steps[i]
 
-		// Update state
-		stepState := state.Steps[step.Name]
-		stepState.Output = types.WorkflowOutput{
-			Data:  result.Data,
-			Error: result.Error,
-		}
-		state.Steps[step.Name] = stepState
-
-		// Handle error if any
-		if result.Error != nil {
-			if step.ErrorHandler != "" {
-				// Execute error handler
-				errorStep := workflow.Steps[i+1]
-				errorResult, err := e.ExecuteStep(errorStep, state)
-				if err != nil {
-					return nil, fmt.Errorf("error handler %s failed: %w", errorStep.Name, err)
-				}
-				state.Steps[errorStep.Name] = types.StepState{
-					Input: stepState.Input,
-					Output: types.WorkflowOutput{
-						Data:  errorResult.Data,
-						Error: errorResult.Error,
-					},
-				}
+	// Update state
+	stepState := state.Steps[step.Name]
+	stepState.Output = types.WorkflowOutput{
+		Data:  result.Data,
+		Error: result.Error,
+	}
+	stepState.Headers = result.Headers
+	state.Steps[step.Name] = stepState
+	if state.Data == nil {
+		state.Data = make(map[string]interface{})
+	}
+	if result.Error == nil {
+		state.Data[step.OutputKey()] = result.Data
+	}
+
+	// A handler named in on_error for the error's code can recover the step;
+	// it fails the workflow with its own error if it fails too
+	if result.Error != nil {
+		if handler := step.HandlerFor(result.Error.Code); handler != "" {
+			handled, err := e.runErrorHandler(workflow, state, handler, stepState.Input)
+			if err != nil {
+				return nil, err
 			}
-			return &types.WorkflowOutput{
-				Error: result.Error,
-			}, nil
+			if handled.Error != nil {
+				return &types.WorkflowOutput{
+					Context: stepState.Input.Context,
+					Error:   handled.Error,
+				}, nil
+			}
+			result = handled
 		}
+	}
 
-		// Move to next step
-		if i < len(workflow.Steps)-1 {
-			nextStep := workflow.Steps[i+1]
-			state.CurrentStep = nextStep.Name
-			state.Steps[nextStep.Name] = types.StepState{
-				Input: types.WorkflowInput{
-					Data:    result.Data,
-					Context: stepState.Input.Context,
+	// Handle error if any
+	if result.Error != nil {
+		if step.ErrorHandler != "" {
+			// Execute error handler
+			errorStep := workflow.Steps[i+1]
+			errorResult, err := e.ExecuteStep(errorStep, state)
+			if err != nil {
+				return nil, fmt.Errorf("error handler %s failed: %w", errorStep.Name, err)
+			}
+			state.Steps[errorStep.Name] = types.StepState{
+				Input: stepState.Input,
+				Output: types.WorkflowOutput{
+					Data:  errorResult.Data,
+					Error: errorResult.Error,
 				},
+				Headers: errorResult.Headers,
 			}
+			if errorResult.Error == nil {
+				state.Data[errorStep.OutputKey()] = errorResult.Data
+			}
+		}
+		return &types.WorkflowOutput{
+			Context: stepState.Input.Context,
+			Error:   result.Error,
+		}, nil
+	}
+
+	// Move to next step
+	if next := nextStep(workflow, i); next >= 0 {
+		nextStep := workflow.Steps[next]
+		state.CurrentStep = nextStep.Name
+		state.Steps[nextStep.Name] = types.StepState{
+			Input: types.WorkflowInput{
+				Data:    result.Data,
+				Context: stepState.Input.Context,
+			},
 		}
+		return nil, nil
 	}
 
 	// Workflow completed successfully
 	state.Completed = true
-	lastStep := workflow.Steps[len(workflow.Steps)-1]
-	lastState := state.Steps[lastStep.Name]
 
 	return &types.WorkflowOutput{
-		Data:    lastState.Output.Data,
-		Context: lastState.Input.Context,
+		Data:    result.Data,
+		Context: stepState.Input.Context,
 	}, nil
 }
 
+// runErrorHandler runs the named on_error handler with the failed step's
+// input. A handler that succeeds recovers the step: its output is stored
+// under its OutputKey and becomes the next step's input.
+func (e *ChainExecutor) runErrorHandler(workflow types.Workflow, state *types.WorkflowState, name string, input types.WorkflowInput) (*types.StepResult, error) {
+	handler := workflow.Steps[workflow.StepIndex(name)]
+	state.Steps[handler.Name] = types.StepState{Input: input}
+	result, err := e.ExecuteStep(handler, state)
+	if err != nil {
+		return nil, fmt.Errorf("error handler %s failed: %w", handler.Name, err)
+	}
+	state.Steps[handler.Name] = types.StepState{
+		Input: input,
+		Output: types.WorkflowOutput{
+			Data:  result.Data,
+			Error: result.Error,
+		},
+		Headers: result.Headers,
+	}
+	if result.Error == nil {
+		state.Data[handler.OutputKey()] = result.Data
+	}
+	return result, nil
+}
+
+// nextStep returns the index of the step that runs after step i, skipping
+// on_error handlers, or -1 when i is the last
+func nextStep(workflow types.Workflow, i int) int {
+	for next := i + 1; next < len(workflow.Steps); next++ {
+		if !workflow.IsErrorHandler(next) {
+			return next
+		}
+	}
+	return -1
+}
+
+// disabledError is what a new execution of a disabled workflow fails with
+func disabledError(name string) *types.WorkflowError {
+	return types.WorkflowErrorf("", types.ErrorCodeWorkflowDisabled, "workflow %s is disabled", name)
+}
+
+// Deprecation returns how the named workflow is being retired, or nil when
+// it is not deprecated or does not exist
+func (e *ChainExecutor) Deprecation(name string) *types.Deprecation {
+	return e.workflows[name].Deprecated
+}
+
 // GetWorkflows returns a list of all available workflow names
 func (e *ChainExecutor) GetWorkflows() []string {
 	workflows := make([]string, 0, len(e.workflows))
@@ -0,0 +1,100 @@
+package orchestrator_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tala_base/orchestrator"
+	"tala_base/types"
+)
+
+// benchWorkflow is a lambda step whose output the next two read through
+// their templates
+const benchWorkflow = `
+name: bench
+steps:
+  - name: create
+    lambda: bench
+    input_template: |
+      {"email": "{{.input.email}}", "name": "{{.input.name}}"}
+    pass_output_as: user
+  - name: read
+    lambda: bench
+    input_template: |
+      {"email": "{{.user.email}}"}
+    pass_output_as: read
+  - name: update
+    lambda: bench
+    input_template: |
+      {"email": "{{.read.email}}", "name": "{{.user.name}}", "verified": true}
+    pass_output_as: updated
+`
+
+// benchInput is the input of each benchmarked execution
+var benchInput = types.WorkflowInput{Data: map[string]interface{}{"email": "bench@example.com", "name": "Bench"}}
+
+// benchExecutor returns an executor with benchWorkflow added and its lambda
+// served by a local server answering with the request as the step's data
+func benchExecutor(b *testing.B) (*orchestrator.ChainExecutor, types.Workflow) {
+	workflow, err := types.ParseWorkflow([]byte(strings.TrimSpace(benchWorkflow)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var data map[string]interface{}
+		if json.Unmarshal(body, &data) != nil || data == nil {
+			data = map[string]interface{}{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.StepResult{Data: data})
+	}))
+	b.Cleanup(server.Close)
+
+	executor := orchestrator.NewChainExecutor()
+	executor.SetRegistry(orchestrator.NewRegistry(map[string]string{"bench": server.URL + "/bench"}))
+	if err := executor.AddWorkflow("bench", workflow); err != nil {
+		b.Fatal(err)
+	}
+	return executor, *workflow
+}
+
+func BenchmarkExecuteStep(b *testing.B) {
+	executor, workflow := benchExecutor(b)
+	step := workflow.Steps[0]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state := &types.WorkflowState{
+			Steps:       map[string]types.StepState{step.Name: {Input: benchInput}},
+			CurrentStep: step.Name,
+			Data:        map[string]interface{}{"input": benchInput.Data},
+		}
+		result, err := executor.ExecuteStep(step, state)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if result.Error != nil {
+			b.Fatal(result.Error)
+		}
+	}
+}
+
+func BenchmarkExecuteChain(b *testing.B) {
+	executor, _ := benchExecutor(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out, err := executor.ExecuteChain("bench", benchInput)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if out.Error != nil {
+			b.Fatal(out.Error)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package orchestrator_test
+
+import (
+	"strings"
+	"testing"
+
+	"tala_base/orchestrator"
+	"tala_base/types"
+)
+
+func TestAddWorkflowRejectsStepsItCannotRun(t *testing.T) {
+	tests := []struct {
+		name, yaml, err string
+	}{
+		{
+			name: "http step",
+			yaml: `
+name: notify
+steps:
+  - name: create
+    lambda: user_create
+  - name: notify
+    kind: http
+    http:
+      method: POST
+      url: https://example.com/events
+`,
+			err: "step notify is of kind http",
+		},
+		{
+			name: "parallel of lambdas",
+			yaml: `
+name: fanout
+steps:
+  - name: fanout
+    kind: parallel
+    parallel:
+      branches:
+        - name: a
+          steps:
+            - name: a
+              lambda: user_read
+`,
+			err: "step fanout is of kind parallel",
+		},
+		{
+			name: "error_handler on the last step",
+			yaml: `
+name: legacy
+steps:
+  - name: create
+    lambda: user_create
+    error_handler: "true"
+`,
+			err: "step create sets error_handler but no step follows it",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow, err := types.ParseWorkflow([]byte(strings.TrimSpace(tt.yaml)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = orchestrator.NewChainExecutor().AddWorkflow(workflow.Name, workflow)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAddWorkflowAcceptsLambdaAndSetSteps(t *testing.T) {
+	workflow, err := types.ParseWorkflow([]byte(strings.TrimSpace(`
+name: signup
+steps:
+  - name: create
+    lambda: user_create
+    error_handler: "true"
+  - name: remember
+    kind: set
+    set:
+      vars:
+        id: "{{.create.user.id}}"
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.NewChainExecutor().AddWorkflow(workflow.Name, workflow); err != nil {
+		t.Fatal(err)
+	}
+}
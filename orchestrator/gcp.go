@@ -0,0 +1,202 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"tala_base/utils/httpclient"
+)
+
+const (
+	gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+	gcpTokenURL    = "https://oauth2.googleapis.com/token"
+
+	// serverlessAuthHeader carries the ID token when Authorization is taken by
+	// the lambda's own service token; Cloud Run strips it before the request
+	// reaches the lambda
+	serverlessAuthHeader = "X-Serverless-Authorization"
+)
+
+// isGCPServerless reports whether a lambda URL is a Cloud Run service or a
+// Cloud Function, which reject calls without a Google-signed ID token
+func isGCPServerless(lambdaURL string) bool {
+	u, err := url.Parse(lambdaURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return strings.HasSuffix(host, ".run.app") || strings.HasSuffix(host, ".cloudfunctions.net")
+}
+
+// GCPIDTokens mints Google-signed ID tokens for calling Cloud Run and Cloud
+// Functions, caching each until shortly before it expires. Tokens come from
+// the service account key in GOOGLE_APPLICATION_CREDENTIALS when set, and
+// otherwise from the metadata server of the GCE, GKE or Cloud Run instance
+// the orchestrator runs on.
+type GCPIDTokens struct {
+	// key is the parsed service account key, nil when using the metadata server
+	key    *gcpServiceAccount
+	client *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]gcpToken
+}
+
+type gcpServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type gcpToken struct {
+	value   string
+	expires time.Time
+}
+
+// NewGCPIDTokens creates a token source from GOOGLE_APPLICATION_CREDENTIALS,
+// or the metadata server when it is unset
+func NewGCPIDTokens() (*GCPIDTokens, error) {
+	t := &GCPIDTokens{
+		client: httpclient.New(httpclient.Config{Name: "gcp_identity", Timeout: 10 * time.Second, Retries: 2}),
+		tokens: make(map[string]gcpToken),
+	}
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		return t, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GCP credentials: %w", err)
+	}
+	var key gcpServiceAccount
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse GCP credentials: %w", err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("GCP credentials in %s are not a service account key", path)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = gcpTokenURL
+	}
+	t.key = &key
+	return t, nil
+}
+
+// Token returns an ID token whose audience is the given lambda URL
+func (t *GCPIDTokens) Token(ctx context.Context, audience string) (string, error) {
+	t.mu.Lock()
+	cached, ok := t.tokens[audience]
+	t.mu.Unlock()
+	if ok && time.Until(cached.expires) > 5*time.Minute {
+		return cached.value, nil
+	}
+
+	var token string
+	var err error
+	if t.key != nil {
+		token, err = t.exchange(ctx, audience)
+	} else {
+		token, err = t.fromMetadata(ctx, audience)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The token is only read for its expiry; Google verifies it on arrival
+	expires := time.Now().Add(time.Hour)
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err == nil && claims.ExpiresAt != nil {
+		expires = claims.ExpiresAt.Time
+	}
+	t.mu.Lock()
+	t.tokens[audience] = gcpToken{value: token, expires: expires}
+	t.mu.Unlock()
+	return token, nil
+}
+
+// fromMetadata asks the instance's metadata server for a token for the
+// attached service account
+func (t *GCPIDTokens) fromMetadata(ctx context.Context, audience string) (string, error) {
+	endpoint := gcpMetadataURL + "?format=full&audience=" + url.QueryEscape(audience)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build metadata request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get ID token from metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", fmt.Errorf("failed to read ID token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned %d: %s", resp.StatusCode, body)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// exchange signs an assertion with the service account key and trades it
+// for an ID token at Google's token endpoint
+func (t *GCPIDTokens) exchange(ctx context.Context, audience string) (string, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(t.key.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse GCP private key: %w", err)
+	}
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":             t.key.ClientEmail,
+		"sub":             t.key.ClientEmail,
+		"aud":             t.key.TokenURI,
+		"target_audience": audience,
+		"iat":             now.Unix(),
+		"exp":             now.Add(time.Hour).Unix(),
+	})
+	assertion.Header["kid"] = t.key.PrivateKeyID
+	signed, err := assertion.SignedString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GCP assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signed},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange GCP assertion: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, detail)
+	}
+	var out struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if out.IDToken == "" {
+		return "", fmt.Errorf("token endpoint returned no id_token")
+	}
+	return out.IDToken, nil
+}
@@ -0,0 +1,284 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tala_base/db"
+	"tala_base/logging"
+	"tala_base/utils"
+)
+
+// ErrLocked is returned by Locker.TryLock when another holder has the lock
+var ErrLocked = errors.New("lock is held")
+
+// Locker takes cluster-wide locks, such as the one a singleton workflow
+// holds while it runs
+type Locker interface {
+	// TryLock takes the lock on key without waiting, returning ErrLocked if
+	// it is held. unlock releases it.
+	TryLock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// LockerFromEnv builds the locker selected by WORKFLOW_LOCK_BACKEND: redis,
+// using REDIS_URL; postgres, using advisory locks on dbConn; or local, which
+// only excludes runs within this process. By default it is redis when
+// REDIS_URL is set, postgres when dbConn is not nil, and local otherwise.
+func LockerFromEnv(dbConn *sql.DB) (Locker, error) {
+	redisURL, err := utils.SecretEnv("REDIS_URL")
+	if err != nil {
+		return nil, err
+	}
+	backend := os.Getenv("WORKFLOW_LOCK_BACKEND")
+	if backend == "" {
+		switch {
+		case redisURL != "":
+			backend = "redis"
+		case dbConn != nil:
+			backend = "postgres"
+		default:
+			backend = "local"
+		}
+	}
+	switch backend {
+	case "redis":
+		if redisURL == "" {
+			return nil, fmt.Errorf("WORKFLOW_LOCK_BACKEND=redis needs REDIS_URL")
+		}
+		return NewRedisLocker(redisURL)
+	case "postgres":
+		if dbConn == nil {
+			return nil, fmt.Errorf("WORKFLOW_LOCK_BACKEND=postgres needs DATABASE_URL")
+		}
+		return PostgresLocker{DB: dbConn}, nil
+	case "local":
+		return NewLocalLocker(), nil
+	default:
+		return nil, fmt.Errorf("unknown WORKFLOW_LOCK_BACKEND %q (expected redis, postgres or local)", backend)
+	}
+}
+
+// LocalLocker holds locks in memory, excluding holders within one process only
+type LocalLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+// NewLocalLocker creates an in-process locker
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{held: make(map[string]bool)}
+}
+
+func (l *LocalLocker) TryLock(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[key] {
+		return nil, ErrLocked
+	}
+	l.held[key] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, key)
+	}, nil
+}
+
+// PostgresLocker takes Postgres advisory locks, each held on its own
+// connection so that a holder that dies releases it with its session
+type PostgresLocker struct {
+	DB *sql.DB
+}
+
+func (l PostgresLocker) TryLock(ctx context.Context, key string) (func(), error) {
+	release, ok, err := db.TryAdvisoryLock(ctx, l.DB, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+	return release, nil
+}
+
+// RedisLocker takes locks as Redis keys set with NX and an expiry. The holder
+// renews the expiry while it holds the lock, so a lock whose holder died is
+// freed after TTL; unlocking deletes the key only if it still holds its token.
+type RedisLocker struct {
+	addr     string
+	username string
+	password string
+	database int
+	tls      bool
+	// TTL is how long a lock outlives a holder that stopped renewing it
+	TTL time.Duration
+}
+
+// Scripts that touch the key only while it still holds the caller's token
+const (
+	redisRenewScript  = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+// NewRedisLocker creates a locker for the server at rawURL, such as
+// redis://:password@localhost:6379/0 or rediss:// for TLS
+func NewRedisLocker(rawURL string) (*RedisLocker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse REDIS_URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("REDIS_URL must use redis:// or rediss://")
+	}
+	l := &RedisLocker{addr: u.Host, tls: u.Scheme == "rediss", TTL: 30 * time.Second}
+	if u.Port() == "" {
+		l.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		l.username = u.User.Username()
+		l.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if l.database, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+	}
+	return l, nil
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, key string) (func(), error) {
+	key = "tala:lock:" + key
+	token := uuid.NewString()
+	ttl := strconv.FormatInt(l.TTL.Milliseconds(), 10)
+	reply, err := l.do(ctx, "SET", key, token, "NX", "PX", ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take Redis lock: %w", err)
+	}
+	if reply == nil {
+		return nil, ErrLocked
+	}
+
+	renewCtx, stopRenewing := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(l.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				if _, err := l.do(renewCtx, "EVAL", redisRenewScript, "1", key, token, ttl); err != nil && renewCtx.Err() == nil {
+					logging.Component("orchestrator").Warn("Failed to renew Redis lock", "key", key, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		stopRenewing()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := l.do(ctx, "EVAL", redisUnlockScript, "1", key, token); err != nil {
+			logging.Component("orchestrator").Warn("Failed to release Redis lock", "key", key, "error", err)
+		}
+	}, nil
+}
+
+// do runs one command on a fresh connection, authenticating and selecting
+// the database first. It returns nil for a null reply.
+func (l *RedisLocker) do(ctx context.Context, args ...string) (interface{}, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if l.tls {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", l.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", l.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	var commands [][]string
+	if l.password != "" {
+		if l.username != "" {
+			commands = append(commands, []string{"AUTH", l.username, l.password})
+		} else {
+			commands = append(commands, []string{"AUTH", l.password})
+		}
+	}
+	if l.database != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(l.database)})
+	}
+	commands = append(commands, args)
+
+	w := bufio.NewWriter(conn)
+	for _, command := range commands {
+		fmt.Fprintf(w, "*%d\r\n", len(command))
+		for _, arg := range command {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	var reply interface{}
+	for range commands {
+		if reply, err = readRESP(r); err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+// readRESP reads one reply: a string or integer, nil for a null bulk string,
+// or an error for a Redis error reply
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty Redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	default:
+		return nil, fmt.Errorf("unexpected Redis reply %q", line)
+	}
+}
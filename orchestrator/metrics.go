@@ -0,0 +1,270 @@
+package orchestrator
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tala_base/types"
+)
+
+// waitBuckets are the histogram upper bounds, in seconds, for queue waits
+var waitBuckets = []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900, 3600}
+
+// waitHistogram is a cumulative Prometheus-style histogram
+type waitHistogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// waitMetrics records how long durable jobs waited to be claimed once due
+type waitMetrics struct {
+	mu    sync.Mutex
+	waits map[types.ExecutionPriority]*waitHistogram
+}
+
+func newWaitMetrics() *waitMetrics {
+	return &waitMetrics{waits: make(map[types.ExecutionPriority]*waitHistogram)}
+}
+
+func (m *waitMetrics) observe(priority types.ExecutionPriority, wait time.Duration) {
+	seconds := max(wait.Seconds(), 0)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := m.waits[priority]
+	if h == nil {
+		h = &waitHistogram{counts: make([]uint64, len(waitBuckets))}
+		m.waits[priority] = h
+	}
+	for i, bound := range waitBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// WriteMetrics renders the queue wait of the jobs this process claimed, by
+// priority, in the Prometheus text format
+func (d *DurableEngine) WriteMetrics(w io.Writer) {
+	m := d.queueWait
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	priorities := make([]types.ExecutionPriority, 0, len(m.waits))
+	for p := range m.waits {
+		priorities = append(priorities, p)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i].Rank() > priorities[j].Rank() })
+
+	const name = "tala_durable_queue_wait_seconds"
+	fmt.Fprintf(w, "# HELP %s Time durable jobs waited to be claimed after falling due, by priority.\n# TYPE %s histogram\n", name, name)
+	for _, p := range priorities {
+		h := m.waits[p]
+		for i, bound := range waitBuckets {
+			fmt.Fprintf(w, "%s_bucket{priority=%q,le=\"%g\"} %d\n", name, p, bound, h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{priority=%q,le=\"+Inf\"} %d\n", name, p, h.count)
+		fmt.Fprintf(w, "%s_sum{priority=%q} %g\n", name, p, h.sum)
+		fmt.Fprintf(w, "%s_count{priority=%q} %d\n", name, p, h.count)
+	}
+}
+
+// deprecationMetrics counts the executions started of deprecated workflows,
+// so their remaining callers can be tracked down before the sunset
+type deprecationMetrics struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newDeprecationMetrics() *deprecationMetrics {
+	return &deprecationMetrics{counts: make(map[string]uint64)}
+}
+
+// count records an execution of workflow name if it is deprecated
+func (m *deprecationMetrics) count(name string, workflow types.Workflow) {
+	if workflow.Deprecated == nil {
+		return
+	}
+	m.mu.Lock()
+	m.counts[name]++
+	m.mu.Unlock()
+}
+
+// WriteMetrics renders the executions started of each deprecated workflow,
+// the metrics lambdas reported and the use of warm connections, in the
+// Prometheus text format
+func (e *ChainExecutor) WriteMetrics(w io.Writer) {
+	e.deprecated.write(w)
+	e.stepMetrics.write(w)
+	if e.warm != nil {
+		e.warm.writeMetrics(w)
+	}
+}
+
+func (m *deprecationMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.counts))
+	for name := range m.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const name = "tala_deprecated_workflow_executions_total"
+	fmt.Fprintf(w, "# HELP %s Executions started of deprecated workflows.\n# TYPE %s counter\n", name, name)
+	for _, workflow := range names {
+		fmt.Fprintf(w, "%s{workflow=%q} %d\n", name, workflow, m.counts[workflow])
+	}
+}
+
+// maxStepSeries caps the series lambdas can create through reported metrics,
+// so labels carrying IDs cannot grow /metrics without bound
+const maxStepSeries = 1000
+
+// stepSeries is one labeled series of a metric lambdas report
+type stepSeries struct {
+	name   string
+	labels string
+	value  float64
+}
+
+// stepMetrics holds the metrics lambdas report with their step results,
+// exposed as tala_step_<name> and labeled with the lambda, step and the
+// step's metric_labels
+type stepMetrics struct {
+	mu      sync.Mutex
+	types   map[string]types.StepMetricType
+	series  map[string]*stepSeries
+	dropped bool
+}
+
+func newStepMetrics() *stepMetrics {
+	return &stepMetrics{
+		types:  make(map[string]types.StepMetricType),
+		series: make(map[string]*stepSeries),
+	}
+}
+
+// record adds the metrics step's lambda reported. Invalid ones, and new
+// series once maxStepSeries exist, are dropped with a warning.
+func (m *stepMetrics) record(step types.Step, metrics []types.StepMetric, logger *slog.Logger) {
+	if len(metrics) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, metric := range metrics {
+		kind := metric.Type
+		if kind == "" {
+			kind = types.StepMetricCounter
+		}
+		name := "tala_step_" + metric.Name
+		if err := m.check(name, kind, metric); err != nil {
+			logger.Warn("Dropping step metric", "step", step.Name, "metric", metric.Name, "error", err)
+			continue
+		}
+
+		labels := make(map[string]string, len(metric.Labels)+len(step.MetricLabels)+2)
+		for key, value := range metric.Labels {
+			labels[key] = value
+		}
+		for key, value := range step.MetricLabels {
+			labels[key] = value
+		}
+		labels["lambda"] = step.Lambda
+		labels["step"] = step.Name
+		rendered := renderLabels(labels)
+
+		key := name + rendered
+		series := m.series[key]
+		if series == nil {
+			if len(m.series) >= maxStepSeries {
+				if !m.dropped {
+					logger.Warn("Dropping new step metric series", "limit", maxStepSeries)
+					m.dropped = true
+				}
+				continue
+			}
+			series = &stepSeries{name: name, labels: rendered}
+			m.series[key] = series
+			m.types[name] = kind
+		}
+		if kind == types.StepMetricGauge {
+			series.value = metric.Value
+		} else {
+			series.value += metric.Value
+		}
+	}
+}
+
+// check returns why a reported metric cannot be recorded as name, or nil
+func (m *stepMetrics) check(name string, kind types.StepMetricType, metric types.StepMetric) error {
+	if !types.ValidMetricName(metric.Name) {
+		return fmt.Errorf("invalid name")
+	}
+	for key := range metric.Labels {
+		if !types.ValidMetricName(key) {
+			return fmt.Errorf("invalid label %q", key)
+		}
+	}
+	switch kind {
+	case types.StepMetricCounter:
+		if metric.Value < 0 {
+			return fmt.Errorf("counters cannot decrease")
+		}
+	case types.StepMetricGauge:
+	default:
+		return fmt.Errorf("unknown type %q", kind)
+	}
+	if known, ok := m.types[name]; ok && known != kind {
+		return fmt.Errorf("already recorded as a %s", known)
+	}
+	return nil
+}
+
+// renderLabels renders labels in the Prometheus text format, sorted by name
+func renderLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", key, labels[key])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// write renders the metrics lambdas reported in the Prometheus text format
+func (m *stepMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var last string
+	for _, key := range keys {
+		series := m.series[key]
+		if series.name != last {
+			fmt.Fprintf(w, "# HELP %s Reported by workflow lambdas.\n# TYPE %s %s\n", series.name, series.name, m.types[series.name])
+			last = series.name
+		}
+		fmt.Fprintf(w, "%s%s %g\n", series.name, series.labels, series.value)
+	}
+}
@@ -0,0 +1,119 @@
+package orchestrator
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"text/template"
+)
+
+// maxPooledBuffer is the largest buffer returned to bufferPool; larger ones,
+// from the occasional huge input or response, are left to the collector so
+// the pool does not pin their memory
+const maxPooledBuffer = 64 << 10
+
+// bufferPool holds the buffers step inputs are rendered into and lambda
+// responses read into
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// maxCachedTemplates caps the parsed templates kept, so an embedding service
+// replacing workflows over and over cannot grow the cache without bound;
+// templates past it are parsed on every use
+const maxCachedTemplates = 4096
+
+// templateCache holds parsed step templates by name and text. A parsed
+// template is safe to execute concurrently.
+var (
+	templateCache  sync.Map
+	templateCached atomic.Int64
+)
+
+// parseTemplate parses text with the template functions, reusing the parse
+// of an identical template
+func parseTemplate(name, text string) (*template.Template, error) {
+	key := name + "\x00" + text
+	if tmpl, ok := templateCache.Load(key); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if templateCached.Load() < maxCachedTemplates {
+		if _, loaded := templateCache.LoadOrStore(key, tmpl); !loaded {
+			templateCached.Add(1)
+		}
+	}
+	return tmpl, nil
+}
+
+// errBodyReleased is returned when a request body is reopened after the
+// step that rendered it finished
+var errBodyReleased = errors.New("request body already released")
+
+// requestBody is a step's rendered input in a pooled buffer, shared by every
+// request sending it: the first call, hedged calls and retries. The buffer
+// goes back to the pool once the step and every request are done with it,
+// as the transport may still be reading a body after answering.
+type requestBody struct {
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+// newRequestBody returns an empty body held by the caller until release
+func newRequestBody() *requestBody {
+	b := &requestBody{buf: getBuffer()}
+	b.refs.Store(1)
+	return b
+}
+
+// Bytes returns the rendered input
+func (b *requestBody) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// open returns a reader of the body for one request, held until it is closed
+func (b *requestBody) open() (io.ReadCloser, error) {
+	for {
+		refs := b.refs.Load()
+		if refs == 0 {
+			return nil, errBodyReleased
+		}
+		if b.refs.CompareAndSwap(refs, refs+1) {
+			return &bodyReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}, nil
+		}
+	}
+}
+
+// release drops one hold on the body, pooling its buffer after the last
+func (b *requestBody) release() {
+	if b.refs.Add(-1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+// bodyReader reads a requestBody for one request
+type bodyReader struct {
+	*bytes.Reader
+	body   *requestBody
+	closed sync.Once
+}
+
+func (r *bodyReader) Close() error {
+	r.closed.Do(r.body.release)
+	return nil
+}
@@ -0,0 +1,239 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"tala_base/types"
+)
+
+// callStepKey carries the step a lambda call is made for in its request context
+type callStepKey struct{}
+
+func withCallStep(ctx context.Context, step types.Step) context.Context {
+	return context.WithValue(ctx, callStepKey{}, step)
+}
+
+func callStepFrom(ctx context.Context) (types.Step, bool) {
+	step, ok := ctx.Value(callStepKey{}).(types.Step)
+	return step, ok
+}
+
+// wrapTransport wraps the transport lambda calls are made through
+func (e *ChainExecutor) wrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	client := *e.client
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = wrap(next)
+	e.client = &client
+}
+
+// Recorder captures the lambda calls an executor makes, for a Recording
+type Recorder struct {
+	next  http.RoundTripper
+	mu    sync.Mutex
+	calls []types.RecordedCall
+}
+
+// RecordCalls makes the executor capture every lambda call it makes from now
+// on in the returned Recorder
+func (e *ChainExecutor) RecordCalls() *Recorder {
+	r := &Recorder{}
+	e.wrapTransport(func(next http.RoundTripper) http.RoundTripper {
+		r.next = next
+		return r
+	})
+	return r
+}
+
+// RoundTrip makes the call and records it along with its response
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	step, ok := callStepFrom(req.Context())
+	if !ok {
+		return r.next.RoundTrip(req)
+	}
+	var request []byte
+	if req.Body != nil {
+		var err error
+		if request, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read lambda request: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(request))
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lambda response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	call := types.RecordedCall{
+		Step:    step.Name,
+		Lambda:  step.Lambda,
+		Request: recordedRequest(request),
+		Status:  resp.StatusCode,
+		Header:  resp.Header.Clone(),
+	}
+	if json.Valid(body) {
+		call.Response = body
+	} else {
+		call.ResponseBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Calls returns the calls recorded so far, in the order they were answered
+func (r *Recorder) Calls() []types.RecordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]types.RecordedCall(nil), r.calls...)
+}
+
+// recordedRequest is the form a request is recorded and matched in: compact
+// JSON, or a JSON string of anything else
+func recordedRequest(body []byte) json.RawMessage {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		return compact.Bytes()
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// Replayer answers lambda calls from a Recording's calls instead of calling
+// the lambdas
+type Replayer struct {
+	mu         sync.Mutex
+	calls      []types.RecordedCall
+	used       []bool
+	changed    []string
+	unanswered []string
+}
+
+// ReplayCalls makes the executor answer every lambda call from calls rather
+// than the network. A call is answered with the first unused recorded call
+// of the same step and lambda with the same request, or failing that the
+// first of the same step and lambda, which Changed reports.
+func (e *ChainExecutor) ReplayCalls(calls []types.RecordedCall) *Replayer {
+	r := &Replayer{calls: calls, used: make([]bool, len(calls))}
+	urls := make(map[string]string)
+	for _, workflow := range e.workflows {
+		for _, step := range workflow.Steps {
+			if step.Lambda != "" {
+				urls[step.Lambda] = "http://replay.invalid/" + step.Lambda
+			}
+		}
+	}
+	e.SetRegistry(NewRegistry(urls))
+	e.wrapTransport(func(http.RoundTripper) http.RoundTripper { return r })
+	return r
+}
+
+// RoundTrip answers req from the recorded calls
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	step, _ := callStepFrom(req.Context())
+	var request []byte
+	if req.Body != nil {
+		var err error
+		if request, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read lambda request: %w", err)
+		}
+		req.Body.Close()
+	}
+	normalized := recordedRequest(request)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	match := -1
+	for i, call := range r.calls {
+		if r.used[i] || call.Step != step.Name || call.Lambda != step.Lambda {
+			continue
+		}
+		if bytes.Equal(call.Request, normalized) {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		r.unanswered = append(r.unanswered, step.Name)
+		return nil, fmt.Errorf("no recorded call of lambda %s for step %s", step.Lambda, step.Name)
+	}
+	r.used[match] = true
+	call := r.calls[match]
+	if !bytes.Equal(call.Request, normalized) {
+		r.changed = append(r.changed, fmt.Sprintf("step %s sent %s, recorded %s", step.Name, normalized, call.Request))
+	}
+
+	body := []byte(call.Response)
+	if call.ResponseBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(call.ResponseBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode recorded response of step %s: %w", step.Name, err)
+		}
+		body = decoded
+	}
+	header := call.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode:    call.Status,
+		Status:        fmt.Sprintf("%d %s", call.Status, http.StatusText(call.Status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Changed describes the calls answered from a recorded call whose request
+// differed
+func (r *Replayer) Changed() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.changed...)
+}
+
+// Unanswered lists the steps whose calls had no recorded call left to answer
+// them
+func (r *Replayer) Unanswered() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.unanswered...)
+}
+
+// Unused returns the recorded calls nothing asked for
+func (r *Replayer) Unused() []types.RecordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []types.RecordedCall
+	for i, call := range r.calls {
+		if !r.used[i] {
+			unused = append(unused, call)
+		}
+	}
+	return unused
+}
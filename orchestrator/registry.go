@@ -0,0 +1,588 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tala_base/logging"
+	"tala_base/utils/httpclient"
+)
+
+// Policies for choosing among a lambda's instances
+const (
+	PolicyRoundRobin   = "round_robin"
+	PolicyLeastPending = "least_pending"
+)
+
+// LambdaStatus is the last known health of one lambda
+type LambdaStatus struct {
+	Name string `json:"name"`
+	// URL is the static base URL; lambdas with several instances list Instances instead
+	URL       string   `json:"url,omitempty"`
+	Instances []string `json:"instances,omitempty"`
+	// Ejected are the instances taken out of rotation after failing
+	Ejected     []string  `json:"ejected,omitempty"`
+	Healthy     bool      `json:"healthy"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Registry maps lambda names to their base URLs and tracks their health.
+// Lambdas that have never been checked are assumed healthy, so a registry
+// that is not polled behaves like a plain address book.
+//
+// A lambda with several instances, listed comma-separated in its URL or found
+// through discovery, has calls spread across them by policy. An instance that
+// fails ejectAfter calls in a row is ejected until it passes a readiness
+// probe, unless it is the last one in rotation.
+type Registry struct {
+	mu      sync.RWMutex
+	lambdas map[string]*lambdaEntry
+	client  *http.Client
+	logger  *slog.Logger
+
+	// discovery, when set, supplies each lambda's instances in place of a
+	// static URL; an answer is reused for discoveryTTL
+	discovery    Discovery
+	discoveryTTL time.Duration
+
+	policy     string
+	ejectAfter int
+
+	// idTokens, when set, returns the ID token readiness probes of an
+	// instance must carry, as Cloud Run requires
+	idTokens func(ctx context.Context, url string) (string, error)
+}
+
+// lambdaEntry is a lambda's status and the state used to spread calls over its instances
+type lambdaEntry struct {
+	status    LambdaStatus
+	resolved  time.Time
+	next      atomic.Uint64
+	endpoints map[string]*endpoint
+}
+
+// endpoint is the load and passive health of one instance
+type endpoint struct {
+	url     string
+	pending atomic.Int64
+	// failures and ejected are guarded by Registry.mu
+	failures int
+	ejected  bool
+}
+
+// NewRegistry creates a registry for lambdas at the given base URLs. A URL
+// may list several instances separated by commas.
+func NewRegistry(urls map[string]string) *Registry {
+	r := newRegistry()
+	for name, url := range urls {
+		entry := &lambdaEntry{status: LambdaStatus{Name: name, Healthy: true}}
+		var instances []string
+		for _, instance := range strings.Split(url, ",") {
+			if instance = strings.TrimSuffix(strings.TrimSpace(instance), "/"); instance != "" {
+				instances = append(instances, instance)
+			}
+		}
+		if len(instances) > 1 {
+			entry.status.Instances = instances
+		} else {
+			entry.status.URL = strings.TrimSuffix(url, "/")
+		}
+		entry.setEndpoints(entry.urls())
+		r.lambdas[name] = entry
+	}
+	return r
+}
+
+// NewDiscoveryRegistry creates a registry that resolves the named lambdas
+// through d, caching each answer for ttl
+func NewDiscoveryRegistry(names []string, d Discovery, ttl time.Duration) *Registry {
+	r := newRegistry()
+	r.discovery = d
+	r.discoveryTTL = ttl
+	for _, name := range names {
+		r.lambdas[name] = &lambdaEntry{
+			status:    LambdaStatus{Name: name, Healthy: true},
+			endpoints: make(map[string]*endpoint),
+		}
+	}
+	return r
+}
+
+func newRegistry() *Registry {
+	return &Registry{
+		lambdas:    make(map[string]*lambdaEntry),
+		client:     httpclient.New(httpclient.Config{Name: "lambda_health", Timeout: 2 * time.Second}),
+		logger:     logging.Component("orchestrator"),
+		policy:     PolicyRoundRobin,
+		ejectAfter: 3,
+	}
+}
+
+// SetBalancing sets the policy for choosing among instances and how many
+// failures in a row eject one; 0 never ejects
+func (r *Registry) SetBalancing(policy string, ejectAfter int) error {
+	switch policy {
+	case "":
+		policy = PolicyRoundRobin
+	case PolicyRoundRobin, PolicyLeastPending:
+	default:
+		return fmt.Errorf("unknown balancing policy %q (expected %s or %s)", policy, PolicyRoundRobin, PolicyLeastPending)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+	r.ejectAfter = ejectAfter
+	return nil
+}
+
+// urls returns the instances calls may go to
+func (e *lambdaEntry) urls() []string {
+	if len(e.status.Instances) > 0 {
+		return e.status.Instances
+	}
+	if e.status.URL != "" {
+		return []string{e.status.URL}
+	}
+	return nil
+}
+
+// setEndpoints keeps the endpoints of instances still present, so their load
+// and health carry over, and adds the new ones
+func (e *lambdaEntry) setEndpoints(urls []string) {
+	endpoints := make(map[string]*endpoint, len(urls))
+	for _, url := range urls {
+		if ep, ok := e.endpoints[url]; ok {
+			endpoints[url] = ep
+		} else {
+			endpoints[url] = &endpoint{url: url}
+		}
+	}
+	e.endpoints = endpoints
+}
+
+// inRotation returns the endpoints that are not ejected, in instance order
+func (e *lambdaEntry) inRotation() []*endpoint {
+	var eps []*endpoint
+	for _, url := range e.urls() {
+		if ep := e.endpoints[url]; ep != nil && !ep.ejected {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+// URL returns a base URL for a lambda, or an error if it is unknown or was
+// unhealthy at the last check. With discovery, instances are re-resolved once
+// the cached answer is stale. A static srv:// URL is resolved through DNS SRV
+// on every call.
+func (r *Registry) URL(name string) (string, error) {
+	url, _, err := r.pick(name)
+	return url, err
+}
+
+// Acquire is URL for a call whose outcome counts toward the instance's load
+// and passive health. The caller must call release with the call's error, or
+// nil once the lambda answered.
+func (r *Registry) Acquire(name string) (url string, release func(error), err error) {
+	url, ep, err := r.pick(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if ep == nil {
+		return url, func(error) {}, nil
+	}
+	ep.pending.Add(1)
+	return url, func(err error) { r.release(name, ep, err) }, nil
+}
+
+// AcquireOther is Acquire for a second call alongside one to the instance at
+// exclude, such as a hedged call, choosing any other instance in rotation
+func (r *Registry) AcquireOther(name, exclude string) (string, func(error), error) {
+	r.mu.RLock()
+	entry, ok := r.lambdas[name]
+	var eps []*endpoint
+	if ok {
+		for _, ep := range entry.inRotation() {
+			if ep.url != exclude && !isSRV(ep.url) {
+				eps = append(eps, ep)
+			}
+		}
+	}
+	policy := r.policy
+	r.mu.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("no URL registered for lambda %s", name)
+	}
+	if len(eps) == 0 {
+		return "", nil, &UnavailableError{Lambda: name, Reason: "no other instance in rotation"}
+	}
+
+	ep := choose(policy, eps, entry.next.Add(1))
+	ep.pending.Add(1)
+	return ep.url, func(err error) { r.release(name, ep, err) }, nil
+}
+
+// instances returns the base URLs of a lambda's instances in rotation, with
+// an SRV name resolved to the one instance it currently answers with
+func (r *Registry) instances(ctx context.Context, name string) []string {
+	r.mu.RLock()
+	var urls []string
+	if entry, ok := r.lambdas[name]; ok {
+		for _, ep := range entry.inRotation() {
+			urls = append(urls, ep.url)
+		}
+	}
+	r.mu.RUnlock()
+
+	resolved := urls[:0]
+	for _, url := range urls {
+		if isSRV(url) {
+			var err error
+			if url, err = resolveSRV(ctx, url); err != nil {
+				continue
+			}
+		}
+		resolved = append(resolved, url)
+	}
+	return resolved
+}
+
+// pick chooses a lambda's instance, returning its endpoint unless the URL
+// came from an SRV lookup
+func (r *Registry) pick(name string) (string, *endpoint, error) {
+	r.mu.RLock()
+	entry, ok := r.lambdas[name]
+	stale := ok && r.discovery != nil && time.Since(entry.resolved) > r.discoveryTTL
+	r.mu.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("no URL registered for lambda %s", name)
+	}
+	if stale {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		r.resolve(ctx, name)
+		cancel()
+	}
+
+	r.mu.RLock()
+	status := entry.status
+	eps := entry.inRotation()
+	policy := r.policy
+	r.mu.RUnlock()
+	if !status.Healthy {
+		return "", nil, &UnavailableError{Lambda: name, Reason: status.LastError}
+	}
+	if len(eps) == 0 {
+		return "", nil, &UnavailableError{Lambda: name, Reason: "no instances in rotation"}
+	}
+	if len(eps) == 1 && isSRV(eps[0].url) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		url, err := resolveSRV(ctx, eps[0].url)
+		if err != nil {
+			return "", nil, &UnavailableError{Lambda: name, Reason: err.Error()}
+		}
+		return url, nil, nil
+	}
+
+	ep := choose(policy, eps, entry.next.Add(1))
+	return ep.url, ep, nil
+}
+
+// choose picks an endpoint by policy. Least-pending breaks ties round-robin
+// from the rotation offset n, so idle instances still share calls evenly.
+func choose(policy string, eps []*endpoint, n uint64) *endpoint {
+	start := int(n % uint64(len(eps)))
+	if policy != PolicyLeastPending {
+		return eps[start]
+	}
+	best := eps[start]
+	for i := 1; i < len(eps); i++ {
+		ep := eps[(start+i)%len(eps)]
+		if ep.pending.Load() < best.pending.Load() {
+			best = ep
+		}
+	}
+	return best
+}
+
+// release records the outcome of a call to ep, ejecting it after too many
+// failures in a row. A call its caller canceled, such as the losing call of a
+// hedged step, says nothing about the instance and is not counted.
+func (r *Registry) release(name string, ep *endpoint, err error) {
+	ep.pending.Add(-1)
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		ep.failures = 0
+		return
+	}
+	ep.failures++
+	entry := r.lambdas[name]
+	if r.ejectAfter <= 0 || ep.ejected || ep.failures < r.ejectAfter || len(entry.inRotation()) <= 1 {
+		return
+	}
+	ep.ejected = true
+	r.logger.Warn("Ejected lambda instance", "lambda", name, "instance", ep.url, "failures", ep.failures, "error", err)
+}
+
+// reinstate puts an ejected endpoint back into rotation after it passed a probe
+func (r *Registry) reinstate(name string, ep *endpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !ep.ejected {
+		return
+	}
+	ep.ejected = false
+	ep.failures = 0
+	r.logger.Info("Reinstated lambda instance", "lambda", name, "instance", ep.url)
+}
+
+// resolve asks discovery for a lambda's instances. A lambda with none is
+// unhealthy; when discovery itself fails the last known instances are kept.
+func (r *Registry) resolve(ctx context.Context, name string) {
+	instances, err := r.discovery.Instances(ctx, name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := r.lambdas[name]
+	entry.resolved = time.Now()
+	entry.status.LastChecked = entry.resolved
+	switch {
+	case err != nil:
+		entry.status.LastError = err.Error()
+		entry.status.Healthy = len(entry.status.Instances) > 0
+	case len(instances) == 0:
+		entry.status.Instances = nil
+		entry.status.Healthy = false
+		entry.status.LastError = "no healthy instances"
+	default:
+		entry.status.Instances = instances
+		entry.status.Healthy = true
+		entry.status.LastError = ""
+	}
+	entry.setEndpoints(entry.urls())
+}
+
+// isSRV reports whether a base URL names a DNS SRV record, as srv://name or
+// srv+https://name
+func isSRV(base string) bool {
+	return strings.HasPrefix(base, "srv://") || strings.HasPrefix(base, "srv+https://")
+}
+
+// resolveSRV looks up the SRV records for an srv:// base URL, such as a
+// Kubernetes headless service (srv://user-create.tala.svc), and returns the
+// address of one target. Targets in the best priority class are picked in
+// proportion to their weight, which spreads calls across the service's pods.
+func resolveSRV(ctx context.Context, base string) (string, error) {
+	scheme, host, _ := strings.Cut(base, "://")
+	host = strings.TrimSuffix(host, "/")
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve SRV %s: %w", host, err)
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("no SRV records for %s", host)
+	}
+	// LookupSRV sorts by priority and shuffles by weight within a priority
+	target := records[0]
+	urlScheme := "http"
+	if scheme == "srv+https" {
+		urlScheme = "https"
+	}
+	return urlScheme + "://" + net.JoinHostPort(strings.TrimSuffix(target.Target, "."), strconv.Itoa(int(target.Port))), nil
+}
+
+// UnavailableError is returned by URL for a lambda that failed its last readiness check
+type UnavailableError struct {
+	Lambda string
+	Reason string
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("lambda %s is unavailable: %s", e.Lambda, e.Reason)
+}
+
+// Statuses returns the health of every registered lambda, sorted by name
+func (r *Registry) Statuses() []LambdaStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]LambdaStatus, 0, len(r.lambdas))
+	for _, entry := range r.lambdas {
+		status := entry.status
+		for _, url := range entry.urls() {
+			if ep := entry.endpoints[url]; ep != nil && ep.ejected {
+				status.Ejected = append(status.Ejected, url)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// CheckAll probes every lambda once, in parallel. Each instance's /readyz is
+// polled: a lambda is healthy while any instance passes, and instances that
+// fail are ejected as passive failures would be. With discovery the catalog's
+// checks decide health instead, and only ejected instances are probed, to
+// bring them back.
+func (r *Registry) CheckAll(ctx context.Context) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.lambdas))
+	for name := range r.lambdas {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if r.discovery != nil {
+				r.resolve(ctx, name)
+				r.probeEjected(ctx, name)
+				return
+			}
+			r.checkLambda(ctx, name)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// checkLambda probes every instance of a statically configured lambda
+func (r *Registry) checkLambda(ctx context.Context, name string) {
+	r.mu.RLock()
+	entry := r.lambdas[name]
+	var eps []*endpoint
+	for _, url := range entry.urls() {
+		eps = append(eps, entry.endpoints[url])
+	}
+	r.mu.RUnlock()
+
+	errs := make([]error, len(eps))
+	var wg sync.WaitGroup
+	for i, ep := range eps {
+		wg.Add(1)
+		go func(i int, ep *endpoint) {
+			defer wg.Done()
+			errs[i] = r.check(ctx, ep.url)
+		}(i, ep)
+	}
+	wg.Wait()
+
+	var lastErr error
+	for i, ep := range eps {
+		if errs[i] == nil {
+			r.reinstate(name, ep)
+			continue
+		}
+		lastErr = errs[i]
+		if len(eps) > 1 {
+			r.mu.Lock()
+			if !ep.ejected && len(entry.inRotation()) > 1 {
+				ep.ejected = true
+				r.logger.Warn("Ejected lambda instance", "lambda", name, "instance", ep.url, "error", errs[i])
+			}
+			r.mu.Unlock()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.status.LastChecked = time.Now()
+	entry.status.Healthy = hasPassing(errs)
+	entry.status.LastError = ""
+	if lastErr != nil {
+		entry.status.LastError = lastErr.Error()
+	}
+}
+
+// hasPassing reports whether any probe succeeded
+func hasPassing(errs []error) bool {
+	for _, err := range errs {
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// probeEjected checks each ejected instance of a lambda, reinstating those that pass
+func (r *Registry) probeEjected(ctx context.Context, name string) {
+	r.mu.RLock()
+	var ejected []*endpoint
+	for _, ep := range r.lambdas[name].endpoints {
+		if ep.ejected {
+			ejected = append(ejected, ep)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, ep := range ejected {
+		if err := r.check(ctx, ep.url); err == nil {
+			r.reinstate(name, ep)
+		}
+	}
+}
+
+func (r *Registry) check(ctx context.Context, url string) error {
+	if isSRV(url) {
+		resolved, err := resolveSRV(ctx, url)
+		if err != nil {
+			return err
+		}
+		url = resolved
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+	if r.idTokens != nil {
+		token, err := r.idTokens(ctx, url)
+		if err != nil {
+			return fmt.Errorf("readiness check failed: %w", err)
+		}
+		setIDToken(req, token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("readiness check failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("readiness check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Poll checks every lambda immediately and then every interval until ctx is done
+func (r *Registry) Poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package orchestrator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tala_base/db"
+	"tala_base/logging"
+	"tala_base/types"
+	"tala_base/utils/cron"
+	"tala_base/utils/validate"
+)
+
+// Scheduler manages recurring schedules stored in the workflow_schedules
+// table and fires them: each time a schedule falls due it queues a durable
+// execution of its workflow and moves the schedule to its next firing.
+// Firings missed while no scheduler was running are not made up; the first
+// one due fires once.
+type Scheduler struct {
+	engine   *DurableEngine
+	db       *sql.DB
+	interval time.Duration
+	logger   *slog.Logger
+
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler queuing executions on engine, looking for
+// due schedules every interval (15s when it is not positive)
+func NewScheduler(engine *DurableEngine, dbConn *sql.DB, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	return &Scheduler{
+		engine:   engine,
+		db:       dbConn,
+		interval: interval,
+		logger:   logging.Component("scheduler"),
+	}
+}
+
+// Create validates and stores a schedule in the context's tenant
+func (s *Scheduler) Create(ctx context.Context, input types.CreateScheduleInput) (*types.Schedule, error) {
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+	sched := types.Schedule{Workflow: input.Workflow, Cron: input.Cron, Timezone: input.Timezone}
+	if err := s.prepare(&sched, input.Input); err != nil {
+		return nil, err
+	}
+	return db.CreateSchedule(ctx, s.db, sched)
+}
+
+// Update changes a schedule's cron expression, timezone or input. The next
+// run is recomputed unless the schedule is paused.
+func (s *Scheduler) Update(ctx context.Context, id string, input types.UpdateScheduleInput) (*types.Schedule, error) {
+	sched, err := db.GetSchedule(ctx, s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if input.Cron != nil {
+		sched.Cron = *input.Cron
+	}
+	if input.Timezone != nil {
+		sched.Timezone = *input.Timezone
+	}
+	data := input.Input
+	if data == nil {
+		if err := json.Unmarshal(sched.Input, &data); err != nil {
+			return nil, fmt.Errorf("failed to decode schedule input: %w", err)
+		}
+	}
+	if err := s.prepare(sched, data); err != nil {
+		return nil, err
+	}
+	return db.UpdateSchedule(ctx, s.db, *sched)
+}
+
+// SetPaused pauses or resumes a schedule. A resumed schedule next fires at
+// its first firing from now.
+func (s *Scheduler) SetPaused(ctx context.Context, id string, paused bool) (*types.Schedule, error) {
+	sched, err := db.GetSchedule(ctx, s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if sched.Paused == paused {
+		return sched, nil
+	}
+	sched.Paused = paused
+	sched.NextRunAt = nil
+	if !paused {
+		if sched.NextRunAt, err = nextRun(sched.Cron, sched.Timezone, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return db.UpdateSchedule(ctx, s.db, *sched)
+}
+
+// prepare validates a schedule against its workflow, stores its input and
+// sets its next run
+func (s *Scheduler) prepare(sched *types.Schedule, input map[string]interface{}) error {
+	workflow, exists := s.engine.executor.workflows[sched.Workflow]
+	if !exists {
+		return fmt.Errorf("%w: workflow %s not found", db.ErrInvalidArgument, sched.Workflow)
+	}
+	if workflow.Disabled {
+		return fmt.Errorf("%w: workflow %s is disabled", db.ErrInvalidArgument, sched.Workflow)
+	}
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	if err := validate.Map(input, workflow.Inputs); err != nil {
+		return fmt.Errorf("%w: %v", db.ErrInvalidArgument, err)
+	}
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule input: %w", err)
+	}
+	sched.Input = encoded
+
+	sched.NextRunAt = nil
+	next, err := nextRun(sched.Cron, sched.Timezone, time.Now())
+	if err != nil {
+		return err
+	}
+	if !sched.Paused {
+		sched.NextRunAt = next
+	}
+	return nil
+}
+
+// nextRun returns the first firing of a cron expression in timezone after t
+func nextRun(expr, timezone string, t time.Time) (*time.Time, error) {
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", db.ErrInvalidArgument, err)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", db.ErrInvalidArgument, timezone)
+	}
+	next := schedule.Next(t.In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("%w: cron expression %q never fires", db.ErrInvalidArgument, expr)
+	}
+	next = next.UTC()
+	return &next, nil
+}
+
+// Start fires due schedules in the background until Stop is called
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		for {
+			if err := s.fireDue(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Warn("Failed to fire schedules", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.interval):
+			}
+		}
+	}()
+	s.logger.Info("Started scheduler", "interval", s.interval.String())
+}
+
+// Stop stops the scheduler, waiting up to timeout for a firing in progress
+func (s *Scheduler) Stop(timeout time.Duration) {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.logger.Warn("Stopped while firing schedules")
+	}
+}
+
+// fireDue queues an execution for each due schedule, in the transaction
+// that moves the schedule to its next run, so a schedule fires once per
+// due time however many schedulers are running
+func (s *Scheduler) fireDue(ctx context.Context) error {
+	return db.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		due, err := db.ClaimDueSchedules(ctx, tx, 100)
+		if err != nil {
+			return err
+		}
+		for _, sched := range due {
+			if err := s.fire(ctx, tx, sched); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fire queues one execution of a due schedule and records the run. Problems
+// with the schedule itself, such as a workflow that was removed, are recorded
+// on the schedule instead of being returned.
+func (s *Scheduler) fire(ctx context.Context, tx *sql.Tx, sched *types.Schedule) error {
+	ctx = db.WithTenant(ctx, sched.TenantID)
+	logger := s.logger.With("schedule_id", sched.ID, "workflow", sched.Workflow)
+
+	var executionID, lastError string
+	var data map[string]interface{}
+	if _, exists := s.engine.executor.workflows[sched.Workflow]; !exists {
+		lastError = "workflow no longer exists"
+	} else if err := json.Unmarshal(sched.Input, &data); err != nil {
+		lastError = "failed to decode input: " + err.Error()
+	} else {
+		exec, invalid, err := s.engine.enqueue(ctx, tx, types.Execution{Workflow: sched.Workflow}, types.WorkflowInput{
+			Data:    data,
+			Context: types.ExecutionContext{RequestID: uuid.NewString()},
+		}, "")
+		if err != nil {
+			return err
+		}
+		if invalid != nil {
+			lastError = invalid.Message
+		} else {
+			executionID = exec.ID
+		}
+	}
+
+	next, err := nextRun(sched.Cron, sched.Timezone, time.Now())
+	if err != nil {
+		lastError = err.Error()
+	}
+	if err := db.RecordScheduleRun(ctx, tx, sched.ID, executionID, lastError, next); err != nil {
+		return err
+	}
+	if lastError != "" {
+		logger.Warn("Schedule failed to start execution", "error", lastError)
+	} else {
+		logger.Info("Schedule started execution", "execution_id", executionID)
+	}
+	return nil
+}
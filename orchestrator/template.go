@@ -0,0 +1,351 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getPath is the get template function: it returns the value at a
+// dot-separated path under data, such as "Steps.create_user.output.data.user.id",
+// with numeric segments indexing arrays. A missing key, an index out of
+// range or a nil along the way yields the optional fallback, or nil, instead
+// of failing the template.
+func getPath(data interface{}, path string, fallback ...interface{}) interface{} {
+	value := plain(data)
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		var ok bool
+		if value, ok = child(value, key); !ok {
+			break
+		}
+	}
+	if value == nil && len(fallback) > 0 {
+		return fallback[0]
+	}
+	return value
+}
+
+// jsonPath is the jsonpath template function. It supports $, .name, ['name'],
+// [n] (negative from the end), * and .. for recursive descent, such as
+// "$.Steps..email". A path with * or .. returns a list of every match, empty
+// when none do; any other returns its value, or nil when it is missing.
+func jsonPath(data interface{}, expr string) (interface{}, error) {
+	selectors, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []interface{}{plain(data)}
+	definite := true
+	for _, sel := range selectors {
+		if sel.recursive {
+			definite = false
+			var all []interface{}
+			for _, node := range nodes {
+				all = descendants(node, all)
+			}
+			nodes = all
+		}
+		if sel.key == "*" {
+			definite = false
+		}
+		var next []interface{}
+		for _, node := range nodes {
+			next = sel.apply(node, next)
+		}
+		nodes = next
+	}
+
+	if !definite {
+		if nodes == nil {
+			nodes = []interface{}{}
+		}
+		return nodes, nil
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	return nodes[0], nil
+}
+
+// pathSelector is one step of a JSONPath expression: a key, an index or *
+// for every child, applied to the node itself or, when recursive, to the
+// node and all its descendants
+type pathSelector struct {
+	key       string
+	index     *int
+	recursive bool
+}
+
+func (s pathSelector) apply(node interface{}, out []interface{}) []interface{} {
+	switch {
+	case s.key == "*":
+		return appendChildren(node, out)
+	case s.index != nil:
+		list, ok := node.([]interface{})
+		if !ok {
+			return out
+		}
+		i := *s.index
+		if i < 0 {
+			i += len(list)
+		}
+		if i < 0 || i >= len(list) {
+			return out
+		}
+		return append(out, plain(list[i]))
+	default:
+		if value, ok := child(node, s.key); ok {
+			return append(out, value)
+		}
+		return out
+	}
+}
+
+func parseJSONPath(expr string) ([]pathSelector, error) {
+	rest := strings.TrimSpace(expr)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", expr)
+	}
+	rest = rest[1:]
+
+	var selectors []pathSelector
+	for rest != "" {
+		var sel pathSelector
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			sel.recursive = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "["):
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", expr, rest)
+		}
+
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: unclosed [", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				sel.key = "*"
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				sel.key = inner[1 : len(inner)-1]
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath %q: invalid index %q", expr, inner)
+				}
+				sel.index = &i
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			sel.key, rest = rest[:end], rest[end:]
+			if sel.key == "" {
+				return nil, fmt.Errorf("jsonpath %q: empty name", expr)
+			}
+		}
+		selectors = append(selectors, sel)
+	}
+	return selectors, nil
+}
+
+// child returns the value under key of a map, or at a numeric key of a list
+func child(node interface{}, key string) (interface{}, bool) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		value, ok := node[key]
+		return plain(value), ok
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(node) {
+			return nil, false
+		}
+		return plain(node[i]), true
+	}
+	return nil, false
+}
+
+// appendChildren appends the values of a map, in key order, or a list
+func appendChildren(node interface{}, out []interface{}) []interface{} {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(node))
+		for key := range node {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			out = append(out, plain(node[key]))
+		}
+	case []interface{}:
+		for _, value := range node {
+			out = append(out, plain(value))
+		}
+	}
+	return out
+}
+
+// descendants appends node and everything under it, depth first
+func descendants(node interface{}, out []interface{}) []interface{} {
+	out = append(out, node)
+	for _, value := range appendChildren(node, nil) {
+		out = descendants(value, out)
+	}
+	return out
+}
+
+// plain returns a value as JSON would decode it, so structs such as step
+// states and typed maps can be traversed like lambda output
+func plain(value interface{}) interface{} {
+	switch value.(type) {
+	case nil, map[string]interface{}, []interface{}, string, bool, float64, int, int64, json.Number:
+		return value
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// toInt is the toInt template function. It converts a number, a numeric
+// string or a bool to an integer, truncating any fraction, so an ID that
+// came back from JSON as the float64 1e+06 renders as 1000000. nil is 0, and
+// a number past the int64 range is an error rather than a wrapped value.
+func toInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return floatToInt(v)
+	case json.Number:
+		return toInt(string(v))
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return floatToInt(f)
+	}
+	return 0, fmt.Errorf("cannot convert %T to an integer", value)
+}
+
+// floatToInt truncates f to an integer, failing when it is not finite or
+// lies outside the int64 range of -2^63 to 2^63
+func floatToInt(f float64) (int64, error) {
+	if math.IsNaN(f) || f < math.MinInt64 || f >= -math.MinInt64 {
+		return 0, fmt.Errorf("%s is out of the integer range", strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return int64(f), nil
+}
+
+// toString is the toString template function. Numbers render without an
+// exponent, maps and lists as JSON and nil as an empty string.
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(raw)
+	}
+	return fmt.Sprint(value)
+}
+
+// timeLayouts are the layouts parseTime tries when none is given
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseTime is the parseTime template function. It parses RFC 3339 times,
+// dates and Unix seconds, or the given Go layout, such as
+// {{ (parseTime .input.date "02/01/2006").Format "2006-01-02" }}.
+func parseTime(value interface{}, layout ...string) (time.Time, error) {
+	if len(layout) > 0 {
+		return time.Parse(layout[0], toString(value))
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case float64, int, int64, json.Number:
+		seconds, err := toInt(v)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	s := strings.TrimSpace(toString(value))
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time", s)
+}
+
+// round is the round template function. It rounds a number half away from
+// zero to the given decimal places, or to an integer when none are given,
+// and renders without an exponent.
+func round(value interface{}, places ...int) (json.Number, error) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	default:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(toString(v)), 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a number", toString(v))
+		}
+		f = parsed
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("%s is not a finite number", strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	scale := 1.0
+	if len(places) > 0 && places[0] > 0 {
+		scale = math.Pow(10, float64(places[0]))
+	}
+	rounded := math.Round(f*scale) / scale
+	if rounded == 0 {
+		// math.Round keeps the sign of zero, which would render -0
+		rounded = 0
+	}
+	return json.Number(strconv.FormatFloat(rounded, 'f', -1, 64)), nil
+}
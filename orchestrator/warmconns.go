@@ -0,0 +1,278 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warmConnCheckInterval is how often warm connections are checked, reaped
+// and topped up
+const warmConnCheckInterval = 5 * time.Second
+
+// warmConns keeps a few TCP connections to each lambda instance dialed ahead
+// of need. The lambda client's transport takes one whenever it has no idle
+// keep-alive connection to the instance, so a step in a burst or after a
+// quiet spell does not wait for a TCP handshake. Connections unused for
+// maxIdle, or closed by the instance, are replaced.
+type warmConns struct {
+	size    int
+	maxIdle time.Duration
+	dialer  *net.Dialer
+
+	mu    sync.Mutex
+	hosts map[string][]warmConn
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// warmConn is a connection waiting to be used
+type warmConn struct {
+	conn   net.Conn
+	dialed time.Time
+}
+
+// newWarmConns reads LAMBDA_WARM_CONNS, the connections kept per instance,
+// and LAMBDA_WARM_CONN_IDLE, how long one is kept unused (30s by default).
+// It returns nil when LAMBDA_WARM_CONNS is unset or 0.
+func newWarmConns() *warmConns {
+	size, err := strconv.Atoi(os.Getenv("LAMBDA_WARM_CONNS"))
+	if err != nil || size <= 0 {
+		return nil
+	}
+	maxIdle := 30 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("LAMBDA_WARM_CONN_IDLE")); err == nil && v > 0 {
+		maxIdle = v
+	}
+	return &warmConns{
+		size:    size,
+		maxIdle: maxIdle,
+		dialer:  &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second},
+		hosts:   make(map[string][]warmConn),
+	}
+}
+
+// DialContext hands out a warm connection to addr when there is one, and
+// dials otherwise
+func (w *warmConns) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network == "tcp" {
+		if conn, warmed := w.take(addr); conn != nil {
+			w.hits.Add(1)
+			go w.refill(addr)
+			return conn, nil
+		} else if warmed {
+			w.misses.Add(1)
+		}
+	}
+	return w.dialer.DialContext(ctx, network, addr)
+}
+
+// take removes the newest usable connection to addr, closing expired ones
+// and those the instance or a proxy closed since they were checked, and
+// reports whether addr is warmed at all. The transport does not retry a
+// request on a connection it did not reuse, so a dead one would fail the step.
+func (w *warmConns) take(addr string) (net.Conn, bool) {
+	for {
+		w.mu.Lock()
+		conns, warmed := w.hosts[addr]
+		var c warmConn
+		found := false
+		for len(conns) > 0 && !found {
+			c = conns[len(conns)-1]
+			conns = conns[:len(conns)-1]
+			if time.Since(c.dialed) < w.maxIdle {
+				found = true
+			} else {
+				c.conn.Close()
+			}
+		}
+		if warmed {
+			w.hosts[addr] = conns
+		}
+		w.mu.Unlock()
+
+		if !found {
+			return nil, warmed
+		}
+		// A closed connection fails the read at once, so the check waits
+		// barely longer than the read itself
+		if alive(c.conn, time.Microsecond) {
+			return c.conn, true
+		}
+		c.conn.Close()
+	}
+}
+
+// refill dials a connection to replace one the transport took from addr
+func (w *warmConns) refill(addr string) {
+	conn, err := w.dialer.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if conns, warmed := w.hosts[addr]; warmed && len(conns) < w.size {
+		w.hosts[addr] = append(conns, warmConn{conn: conn, dialed: time.Now()})
+		return
+	}
+	conn.Close()
+}
+
+// maintain warms exactly addrs: it closes the connections of other
+// addresses and those expired or closed by the instance, then dials each
+// address up to size connections
+func (w *warmConns) maintain(ctx context.Context, addrs []string) {
+	wanted := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		wanted[addr] = true
+	}
+
+	// Take the connections out to check them without holding the lock
+	w.mu.Lock()
+	pooled := w.hosts
+	w.hosts = make(map[string][]warmConn, len(addrs))
+	for addr := range wanted {
+		w.hosts[addr] = nil
+	}
+	w.mu.Unlock()
+
+	checked := make(map[string][]warmConn, len(addrs))
+	for addr, conns := range pooled {
+		for _, c := range conns {
+			if wanted[addr] && time.Since(c.dialed) < w.maxIdle && alive(c.conn, time.Millisecond) {
+				checked[addr] = append(checked[addr], c)
+			} else {
+				c.conn.Close()
+			}
+		}
+	}
+	w.mu.Lock()
+	for addr, conns := range checked {
+		w.hosts[addr] = conns
+	}
+	w.mu.Unlock()
+
+	// Top up, adding each connection as soon as it is dialed
+	var wg sync.WaitGroup
+	for addr := range wanted {
+		for i := len(checked[addr]); i < w.size; i++ {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				conn, err := w.dialer.DialContext(ctx, "tcp", addr)
+				if err != nil {
+					return
+				}
+				w.mu.Lock()
+				defer w.mu.Unlock()
+				if len(w.hosts[addr]) < w.size {
+					w.hosts[addr] = append(w.hosts[addr], warmConn{conn: conn, dialed: time.Now()})
+					return
+				}
+				conn.Close()
+			}(addr)
+		}
+	}
+	wg.Wait()
+}
+
+// alive reports whether an unused connection is still open. An instance has
+// nothing to send before a request, so a read that waits is a live
+// connection, and one that returns data or an error within wait is not.
+func alive(conn net.Conn, wait time.Duration) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+		return false
+	}
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return false
+	}
+	return conn.SetReadDeadline(time.Time{}) == nil
+}
+
+// close closes every warm connection
+func (w *warmConns) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for addr, conns := range w.hosts {
+		for _, c := range conns {
+			c.conn.Close()
+		}
+		delete(w.hosts, addr)
+	}
+}
+
+// writeMetrics renders the connections kept and how often the transport
+// found one, in the Prometheus text format
+func (w *warmConns) writeMetrics(out io.Writer) {
+	w.mu.Lock()
+	var kept int
+	for _, conns := range w.hosts {
+		kept += len(conns)
+	}
+	w.mu.Unlock()
+
+	const gauge, counter = "tala_lambda_warm_connections", "tala_lambda_warm_connection_dials_total"
+	fmt.Fprintf(out, "# HELP %s Connections to lambda instances dialed ahead and waiting to be used.\n# TYPE %s gauge\n%s %d\n", gauge, gauge, gauge, kept)
+	fmt.Fprintf(out, "# HELP %s Connections the lambda client opened to warmed instances, by whether a warm one was ready.\n# TYPE %s counter\n", counter, counter)
+	fmt.Fprintf(out, "%s{result=\"warm\"} %d\n%s{result=\"dialed\"} %d\n", counter, w.hits.Load(), counter, w.misses.Load())
+}
+
+// dialAddr returns the host:port a client dials for a lambda URL
+func dialAddr(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	if u.Port() != "" {
+		return u.Host, true
+	}
+	switch u.Scheme {
+	case "http":
+		return net.JoinHostPort(u.Hostname(), "80"), true
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443"), true
+	}
+	return "", false
+}
+
+// KeepConnsWarm keeps LAMBDA_WARM_CONNS connections open to every instance
+// the registry has in rotation for the lambdas the loaded workflows call,
+// until ctx is done. It returns at once when LAMBDA_WARM_CONNS is unset.
+// Only the TCP handshake is saved; TLS is still negotiated per connection.
+func (e *ChainExecutor) KeepConnsWarm(ctx context.Context) {
+	if e.warm == nil {
+		return
+	}
+	defer e.warm.close()
+	ticker := time.NewTicker(warmConnCheckInterval)
+	defer ticker.Stop()
+	for {
+		var addrs []string
+		for _, name := range e.workflowLambdas() {
+			for _, instance := range e.registry.instances(ctx, name) {
+				if addr, ok := dialAddr(instance); ok {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		e.warm.maintain(ctx, addrs)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"tala_base/types"
+)
+
+// Warm pings every instance of each lambda the loaded workflows call, through
+// the client lambda calls use, so that instances scaled to zero are started
+// and keep-alive connections to them are open before the first execution
+// needs them. Lambdas that fail to answer are logged; failures do not affect
+// their health, which the registry's readiness checks decide.
+func (e *ChainExecutor) Warm(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, name := range e.workflowLambdas() {
+		for _, url := range e.registry.instances(ctx, name) {
+			wg.Add(1)
+			go func(name, url string) {
+				defer wg.Done()
+				if err := e.ping(ctx, url); err != nil {
+					e.logger.Warn("Failed to warm lambda", "lambda", name, "instance", url, "error", err)
+				}
+			}(name, url)
+		}
+	}
+	wg.Wait()
+}
+
+// WarmEvery warms the lambdas immediately and then every interval until ctx
+// is done. An interval shorter than the client's 90s idle timeout keeps the
+// connections open while no executions run.
+func (e *ChainExecutor) WarmEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.Warm(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ping requests an instance's /readyz, reading the body so the connection
+// goes back to the pool
+func (e *ChainExecutor) ping(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+	idToken, err := e.idToken(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to get ID token: %w", err)
+	}
+	setIDToken(req, idToken)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("readiness check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// workflowLambdas returns the lambdas named by the loaded workflows' steps,
+// including those nested in parallel and switch steps
+func (e *ChainExecutor) workflowLambdas() []string {
+	seen := make(map[string]bool)
+	var walk func(steps []types.Step)
+	walk = func(steps []types.Step) {
+		for _, step := range steps {
+			if step.Lambda != "" {
+				seen[step.Lambda] = true
+			}
+			if step.Parallel != nil {
+				for _, branch := range step.Parallel.Branches {
+					walk(branch.Steps)
+				}
+			}
+			if step.Switch != nil {
+				for _, c := range step.Switch.Cases {
+					walk(c.Steps)
+				}
+				walk(step.Switch.Default)
+			}
+		}
+	}
+	for _, workflow := range e.workflows {
+		walk(workflow.Steps)
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,223 @@
+// Package outbox delivers events announced by workflow executions. Events are
+// stored in the outbox table, in the same transaction as the execution state
+// they describe where there is one, and a relay delivers them to each sink,
+// retrying until the sink accepts them, so an event is never lost to a broker
+// that is briefly down. Delivery is at least once; sinks carry the event ID
+// so consumers can drop duplicates.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"tala_base/db"
+	"tala_base/logging"
+	"tala_base/types"
+)
+
+// Sink delivers events to one destination
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, event *types.OutboxEvent) error
+}
+
+// Config controls the relay
+type Config struct {
+	Sinks []Sink
+	// BatchSize is how many events one poll claims; defaults to 100
+	BatchSize int
+	// PollInterval is how long the relay waits after finding nothing to
+	// deliver; defaults to 1s
+	PollInterval time.Duration
+	// RetryDelay is the wait after a first failed delivery, doubled after
+	// each further failure up to 10m; defaults to 1s
+	RetryDelay time.Duration
+	// Retention is how long delivered events are kept; defaults to 24h
+	Retention time.Duration
+}
+
+// ConfigFromEnv reads OUTBOX_BATCH_SIZE, OUTBOX_POLL_INTERVAL,
+// OUTBOX_RETRY_DELAY and OUTBOX_RETENTION, and builds the sinks configured by
+// SinksFromEnv
+func ConfigFromEnv() (Config, error) {
+	sinks, err := SinksFromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{Sinks: sinks}
+	if n, err := strconv.Atoi(os.Getenv("OUTBOX_BATCH_SIZE")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if v, err := time.ParseDuration(os.Getenv("OUTBOX_POLL_INTERVAL")); err == nil && v > 0 {
+		cfg.PollInterval = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("OUTBOX_RETRY_DELAY")); err == nil && v > 0 {
+		cfg.RetryDelay = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION")); err == nil && v > 0 {
+		cfg.Retention = v
+	}
+	return cfg, nil
+}
+
+// Relay stores events and delivers them to the configured sinks
+type Relay struct {
+	db     *sql.DB
+	cfg    Config
+	sinks  map[string]Sink
+	names  []string
+	logger *slog.Logger
+
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// NewRelay creates a relay for the outbox table in dbConn
+func NewRelay(dbConn *sql.DB, cfg Config) *Relay {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	r := &Relay{
+		db:     dbConn,
+		cfg:    cfg,
+		sinks:  make(map[string]Sink, len(cfg.Sinks)),
+		logger: logging.Component("outbox"),
+	}
+	for _, sink := range cfg.Sinks {
+		r.sinks[sink.Name()] = sink
+		r.names = append(r.names, sink.Name())
+	}
+	return r
+}
+
+// Record stores an execution event for every sink through tx, which should
+// be the transaction recording the execution's new state. Without sinks it
+// does nothing.
+func (r *Relay) Record(ctx context.Context, tx db.DBTX, event types.ExecutionEvent) error {
+	if len(r.names) == 0 {
+		return nil
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	return db.InsertOutboxEvent(ctx, tx, r.names, string(event.Type), payload)
+}
+
+// Start delivers events in the background until Stop is called
+func (r *Relay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		r.relay(ctx)
+	}()
+	r.logger.Info("Started outbox relay", "sinks", r.names)
+}
+
+// Stop stops the relay, waiting up to timeout for deliveries in progress.
+// Events it claimed but did not deliver are retried once their claim lapses.
+func (r *Relay) Stop(timeout time.Duration) {
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		r.logger.Warn("Stopped with deliveries still running")
+	}
+}
+
+// relay polls for due events until ctx is done, pruning delivered ones hourly
+func (r *Relay) relay(ctx context.Context) {
+	pruned := time.Time{}
+	for ctx.Err() == nil {
+		if time.Since(pruned) > time.Hour {
+			pruned = time.Now()
+			if n, err := db.DeleteOutboxDeliveredBefore(ctx, r.db, time.Now().Add(-r.cfg.Retention)); err != nil {
+				r.logger.Warn("Failed to prune outbox", "error", err)
+			} else if n > 0 {
+				r.logger.Info("Pruned outbox", "deleted", n)
+			}
+		}
+
+		delivered, err := r.deliverBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Warn("Failed to claim outbox events", "error", err)
+		}
+		if delivered < r.cfg.BatchSize {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.cfg.PollInterval):
+			}
+		}
+	}
+}
+
+// deliverBatch claims one batch of due events and delivers each, returning
+// how many were claimed
+func (r *Relay) deliverBatch(ctx context.Context) (int, error) {
+	// A claim outlasts the deliveries of the whole batch, so no other relay
+	// picks the events up while this one is still working through them
+	events, err := db.ClaimOutboxEvents(ctx, r.db, r.cfg.BatchSize, 5*time.Minute)
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		r.deliver(event)
+	}
+	return len(events), nil
+}
+
+// deliver sends one event to its sink and records the outcome
+func (r *Relay) deliver(event *types.OutboxEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	logger := r.logger.With("event_id", event.ID, "sink", event.Sink, "topic", event.Topic)
+
+	err := fmt.Errorf("sink %s is not configured", event.Sink)
+	if sink, ok := r.sinks[event.Sink]; ok {
+		err = sink.Deliver(ctx, event)
+	}
+	if err == nil {
+		if err := db.MarkOutboxDelivered(ctx, r.db, event.ID); err != nil {
+			logger.Warn("Failed to mark event delivered", "error", err)
+		}
+		return
+	}
+
+	delay := r.cfg.RetryDelay << min(event.Attempts, 20)
+	if delay > 10*time.Minute || delay <= 0 {
+		delay = 10 * time.Minute
+	}
+	logger.Warn("Event delivery failed", "attempt", event.Attempts+1, "retry_in", delay.String(), "error", err)
+	if err := db.MarkOutboxFailed(ctx, r.db, event.ID, time.Now().Add(delay), err.Error()); err != nil {
+		logger.Warn("Failed to record failed delivery", "error", err)
+	}
+}
@@ -0,0 +1,186 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"tala_base/notify"
+	"tala_base/types"
+	"tala_base/utils"
+	"tala_base/utils/httpclient"
+)
+
+// EventIDHeader carries the outbox event ID, which stays the same across
+// redeliveries of one event
+const EventIDHeader = "X-Event-ID"
+
+// SinksFromEnv builds a sink for each destination that is configured:
+// OUTBOX_NATS_SUBJECT on the server at NATS_URL, OUTBOX_WEBHOOK_URL, signed
+// with WEBHOOK_SECRET, and OUTBOX_KAFKA_TOPIC through the Kafka REST Proxy at
+// OUTBOX_KAFKA_REST_URL
+func SinksFromEnv() ([]Sink, error) {
+	var sinks []Sink
+	if subject := os.Getenv("OUTBOX_NATS_SUBJECT"); subject != "" {
+		natsURL, err := utils.SecretEnv("NATS_URL")
+		if err != nil {
+			return nil, err
+		}
+		conn, err := nats.Connect(natsURL, nats.Name("tala-outbox"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+		sinks = append(sinks, NewNATSSink(conn, subject))
+	}
+	if webhookURL := os.Getenv("OUTBOX_WEBHOOK_URL"); webhookURL != "" {
+		cfg := notify.WebhookConfigFromEnv()
+		// The relay retries failed deliveries itself, with its own backoff
+		cfg.MaxAttempts = 1
+		sinks = append(sinks, NewWebhookSink(notify.NewWebhookSender(cfg), webhookURL))
+	}
+	if topic := os.Getenv("OUTBOX_KAFKA_TOPIC"); topic != "" {
+		restURL := os.Getenv("OUTBOX_KAFKA_REST_URL")
+		if restURL == "" {
+			return nil, fmt.Errorf("OUTBOX_KAFKA_TOPIC needs OUTBOX_KAFKA_REST_URL")
+		}
+		sinks = append(sinks, NewKafkaSink(restURL, topic))
+	}
+	return sinks, nil
+}
+
+// NATSSink publishes each event to <prefix>.<workflow>.<topic>, such as
+// tala.events.user_signup_chain.execution.succeeded
+type NATSSink struct {
+	conn      *nats.Conn
+	publisher *notify.NATSPublisher
+	prefix    string
+}
+
+// NewNATSSink creates a sink publishing on conn under the subject prefix
+func NewNATSSink(conn *nats.Conn, prefix string) *NATSSink {
+	return &NATSSink{conn: conn, publisher: notify.NewNATSPublisher(conn), prefix: strings.TrimSuffix(prefix, ".")}
+}
+
+func (s *NATSSink) Name() string { return "nats" }
+
+func (s *NATSSink) Deliver(ctx context.Context, event *types.OutboxEvent) error {
+	subject := s.prefix
+	if workflow := eventWorkflow(event); workflow != "" {
+		subject += "." + workflow
+	}
+	if err := s.publisher.Publish(ctx, subject+"."+event.Topic, event.Payload); err != nil {
+		return err
+	}
+	// Publishes are buffered while disconnected; only a flush confirms the
+	// server has the event
+	if err := s.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush NATS: %w", err)
+	}
+	return nil
+}
+
+// WebhookSink posts each event to a URL, with the event ID in X-Event-ID
+type WebhookSink struct {
+	sender *notify.WebhookSender
+	url    string
+}
+
+// NewWebhookSink creates a sink posting to url
+func NewWebhookSink(sender *notify.WebhookSender, url string) *WebhookSink {
+	return &WebhookSink{sender: sender, url: url}
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Deliver(ctx context.Context, event *types.OutboxEvent) error {
+	_, err := s.sender.Send(ctx, notify.WebhookRequest{
+		URL: s.url,
+		Headers: map[string]string{
+			EventIDHeader:  strconv.FormatInt(event.ID, 10),
+			"X-Event-Type": event.Topic,
+		},
+		Body: event.Payload,
+	})
+	return err
+}
+
+// KafkaSink produces each event to a topic through a Confluent Kafka REST
+// Proxy (v2 API), keyed by workflow so one workflow's events stay in order
+// within a partition
+type KafkaSink struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewKafkaSink creates a sink producing to topic through the proxy at restURL
+func NewKafkaSink(restURL, topic string) *KafkaSink {
+	return &KafkaSink{
+		endpoint: strings.TrimSuffix(restURL, "/") + "/topics/" + url.PathEscape(topic),
+		client:   httpclient.New(httpclient.Config{Name: "kafka_rest", Timeout: 10 * time.Second}),
+	}
+}
+
+func (s *KafkaSink) Name() string { return "kafka" }
+
+func (s *KafkaSink) Deliver(ctx context.Context, event *types.OutboxEvent) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{
+			"key":   eventWorkflow(event),
+			"value": event.Payload,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode Kafka record: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build Kafka request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	req.Header.Set(EventIDHeader, strconv.FormatInt(event.ID, 10))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce to Kafka: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kafka REST proxy returned %d: %s", resp.StatusCode, detail)
+	}
+
+	// The proxy answers 200 even when single records fail
+	var out struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.Unmarshal(detail, &out); err == nil {
+		for _, offset := range out.Offsets {
+			if offset.ErrorCode != nil {
+				return fmt.Errorf("Kafka rejected record: %s", offset.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// eventWorkflow reads the workflow an execution event belongs to
+func eventWorkflow(event *types.OutboxEvent) string {
+	var payload struct {
+		Workflow string `json:"workflow"`
+	}
+	json.Unmarshal(event.Payload, &payload)
+	return payload.Workflow
+}
@@ -0,0 +1,246 @@
+// Package quota counts the executions and step invocations of each tenant and
+// API key per calendar month (UTC) and enforces their monthly quotas.
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"tala_base/db"
+	"tala_base/logging"
+	"tala_base/types"
+)
+
+// Config holds the default tenant quotas and how often step counts are written
+type Config struct {
+	// MonthlyExecutions and MonthlySteps limit tenants without a quota of
+	// their own; 0 is unlimited
+	MonthlyExecutions int64
+	MonthlySteps      int64
+	// FlushInterval is how often buffered step counts are written; defaults to 10s
+	FlushInterval time.Duration
+}
+
+// ConfigFromEnv reads QUOTA_MONTHLY_EXECUTIONS, QUOTA_MONTHLY_STEPS and QUOTA_FLUSH_INTERVAL
+func ConfigFromEnv() Config {
+	cfg := Config{FlushInterval: 10 * time.Second}
+	if n, err := strconv.ParseInt(os.Getenv("QUOTA_MONTHLY_EXECUTIONS"), 10, 64); err == nil && n >= 0 {
+		cfg.MonthlyExecutions = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("QUOTA_MONTHLY_STEPS"), 10, 64); err == nil && n >= 0 {
+		cfg.MonthlySteps = n
+	}
+	if v, err := time.ParseDuration(os.Getenv("QUOTA_FLUSH_INTERVAL")); err == nil && v > 0 {
+		cfg.FlushInterval = v
+	}
+	return cfg
+}
+
+// counter identifies whose steps a buffered count belongs to
+type counter struct {
+	tenant   string
+	apiKeyID int64
+	month    time.Time
+}
+
+// Meter admits executions against their tenant's and API key's quotas and
+// counts the steps they invoke. Executions are counted as they are admitted;
+// step counts are buffered and written every FlushInterval, so a step quota
+// can be overrun by the steps of executions already running, but no further
+// execution is admitted once it is.
+type Meter struct {
+	db     *sql.DB
+	cfg    Config
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	pending map[counter]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMeter creates a meter that keeps usage and quotas in dbConn
+func NewMeter(dbConn *sql.DB, cfg Config) *Meter {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 10 * time.Second
+	}
+	return &Meter{
+		db:      dbConn,
+		cfg:     cfg,
+		logger:  logging.Component("quota"),
+		pending: make(map[counter]int64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Admit counts executions against the tenant of ctx and against apiKeyID,
+// when set, unless either has used up its monthly execution or step quota,
+// in which case nothing is counted and the QUOTA_EXCEEDED error says which.
+// executions may be 0 to check the step quotas only, such as before a direct
+// lambda call.
+func (m *Meter) Admit(ctx context.Context, apiKeyID int64, executions int64) (*types.WorkflowError, error) {
+	month := db.MonthOf(time.Now())
+	var exceeded *types.WorkflowError
+	err := db.WithTx(ctx, m.db, func(tx *sql.Tx) error {
+		tenantQuota, err := db.GetQuota(ctx, tx, 0)
+		if err != nil {
+			return err
+		}
+		keyQuota := &types.Quota{}
+		if apiKeyID != 0 {
+			if keyQuota, err = db.GetQuota(ctx, tx, apiKeyID); err != nil {
+				return err
+			}
+		}
+		// Adding takes the rows' locks, so concurrent admissions are counted one at a time
+		tenantUsage, keyUsage, err := db.AddUsage(ctx, tx, apiKeyID, month, executions, 0)
+		if err != nil {
+			return err
+		}
+		m.limit(&tenantUsage, tenantQuota)
+		exceeded = overQuota(fmt.Sprintf("tenant %s", db.TenantFrom(ctx)), tenantUsage, executions)
+		if exceeded == nil && apiKeyID != 0 {
+			m.limit(&keyUsage, keyQuota)
+			exceeded = overQuota(fmt.Sprintf("API key %d", apiKeyID), keyUsage, executions)
+		}
+		if exceeded != nil {
+			return errRejected
+		}
+		return nil
+	})
+	if errors.Is(err, errRejected) {
+		return exceeded, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check quota: %w", err)
+	}
+	return nil, nil
+}
+
+// errRejected rolls back the usage an over-quota admission added
+var errRejected = errors.New("quota exceeded")
+
+// limit sets the limits of quota on usage, falling back to the configured
+// defaults for a tenant's unset limits
+func (m *Meter) limit(usage *types.Usage, quota *types.Quota) {
+	usage.ExecutionLimit, usage.StepLimit = 0, 0
+	if usage.APIKeyID == 0 {
+		usage.ExecutionLimit, usage.StepLimit = m.cfg.MonthlyExecutions, m.cfg.MonthlySteps
+	}
+	if quota.MonthlyExecutions != nil {
+		usage.ExecutionLimit = *quota.MonthlyExecutions
+	}
+	if quota.MonthlySteps != nil {
+		usage.StepLimit = *quota.MonthlySteps
+	}
+}
+
+// overQuota returns the error for who once usage, including the executions
+// just added, is beyond its execution limit or has reached its step limit
+func overQuota(who string, usage types.Usage, executions int64) *types.WorkflowError {
+	month, _ := time.Parse("2006-01", usage.Month)
+	resets := month.AddDate(0, 1, 0).Format("2006-01-02")
+	switch {
+	case usage.ExecutionLimit > 0 && executions > 0 && usage.Executions > usage.ExecutionLimit:
+		return types.WorkflowErrorf("", types.ErrorCodeQuotaExceeded,
+			"%s has used its quota of %d executions for %s; it resets on %s", who, usage.ExecutionLimit, usage.Month, resets)
+	case usage.StepLimit > 0 && usage.Steps >= usage.StepLimit:
+		return types.WorkflowErrorf("", types.ErrorCodeQuotaExceeded,
+			"%s has used its quota of %d step invocations for %s; it resets on %s", who, usage.StepLimit, usage.Month, resets)
+	}
+	return nil
+}
+
+// CountStep counts one step invocation of the execution against its tenant and API key
+func (m *Meter) CountStep(execCtx types.ExecutionContext) {
+	tenant := execCtx.TenantID
+	if tenant == "" {
+		tenant = db.DefaultTenant
+	}
+	m.mu.Lock()
+	m.pending[counter{tenant: tenant, apiKeyID: execCtx.APIKeyID, month: db.MonthOf(time.Now())}]++
+	m.mu.Unlock()
+}
+
+// Usage returns one month's usage of the tenant of ctx, or of every tenant
+// when all is set, with the limits that apply to each. Steps not yet written
+// are not included.
+func (m *Meter) Usage(ctx context.Context, month time.Time, all bool) (types.UsageOutput, error) {
+	listUsage, listQuotas := db.ListUsage, db.ListQuotas
+	if all {
+		listUsage, listQuotas = db.ListAllUsage, db.ListAllQuotas
+	}
+	usage, err := listUsage(ctx, m.db, month)
+	if err != nil {
+		return types.UsageOutput{}, err
+	}
+	quotas, err := listQuotas(ctx, m.db)
+	if err != nil {
+		return types.UsageOutput{}, err
+	}
+	byOwner := make(map[counter]*types.Quota, len(quotas))
+	for i := range quotas {
+		byOwner[counter{tenant: quotas[i].TenantID, apiKeyID: quotas[i].APIKeyID}] = &quotas[i]
+	}
+	for i := range usage {
+		quota, ok := byOwner[counter{tenant: usage[i].TenantID, apiKeyID: usage[i].APIKeyID}]
+		if !ok {
+			quota = &types.Quota{}
+		}
+		m.limit(&usage[i], quota)
+	}
+	return types.UsageOutput{Month: month.Format("2006-01"), Usage: usage}, nil
+}
+
+// Start writes buffered step counts every FlushInterval until Stop is called
+func (m *Meter) Start() {
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.flush(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop stops the flush loop and writes the remaining counts, waiting up to timeout
+func (m *Meter) Stop(timeout time.Duration) {
+	close(m.stop)
+	<-m.done
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	m.flush(ctx)
+}
+
+// flush writes the buffered step counts, keeping any that fail for the next flush
+func (m *Meter) flush(ctx context.Context) {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[counter]int64)
+	m.mu.Unlock()
+
+	for c, steps := range pending {
+		tenantCtx := db.WithTenant(ctx, c.tenant)
+		if _, _, err := db.AddUsage(tenantCtx, m.db, c.apiKeyID, c.month, 0, steps); err != nil {
+			m.logger.Warn("Failed to record step usage", "tenant", c.tenant, "api_key_id", c.apiKeyID, "error", err)
+			m.mu.Lock()
+			m.pending[c] += steps
+			m.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tala_base/orchestrator"
+	"tala_base/types"
+)
+
+// runRecording implements the `tala recording record|check` commands
+func runRecording(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing recording command (expected record or check)")
+	}
+	switch args[0] {
+	case "record":
+		return runRecord(args[1:])
+	case "check":
+		return runCheckRecordings(args[1:])
+	default:
+		return fmt.Errorf("unknown recording command %q (expected record or check)", args[0])
+	}
+}
+
+// runRecord implements `tala recording record [-input file] [-o file] <workflow>`.
+// It runs a workflow once against the real lambdas with the input's data,
+// and writes the execution with every lambda call it made as a recording.
+func runRecord(args []string) error {
+	flags := flag.NewFlagSet("recording record", flag.ContinueOnError)
+	inputFile := flags.String("input", "-", "JSON file of the workflow input data, or - for standard input")
+	output := flags.String("o", "-", "file to write the recording to, or - for standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one workflow name")
+	}
+	name := flags.Arg(0)
+
+	var raw []byte
+	var err error
+	if *inputFile == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*inputFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	input := types.WorkflowInput{Context: types.ExecutionContext{RequestID: uuid.NewString()}}
+	if err := json.Unmarshal(raw, &input.Data); err != nil {
+		return fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	executor := orchestrator.NewChainExecutor()
+	if err := executor.LoadWorkflow(name); err != nil {
+		return err
+	}
+	recorder := executor.RecordCalls()
+	out, err := executor.ExecuteChain(name, input)
+	if err != nil {
+		return fmt.Errorf("failed to run workflow: %w", err)
+	}
+
+	recording := types.Recording{
+		Workflow:   name,
+		Input:      input,
+		Calls:      recorder.Calls(),
+		Output:     out,
+		RecordedAt: time.Now().UTC(),
+	}
+	encoded, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recording: %w", err)
+	}
+	encoded = append(encoded, '\n')
+	if *output == "-" {
+		_, err = os.Stdout.Write(encoded)
+		return err
+	}
+	if err := os.WriteFile(*output, encoded, 0o644); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	slog.Info("Recorded workflow", "workflow", name, "calls", len(recording.Calls), "file", *output)
+	return nil
+}
+
+// runCheckRecordings implements `tala recording check [-workflow file]
+// recordings...`. It reruns each recording's workflow, as defined now or in
+// the given file, answering its lambda calls from the recording, and fails
+// if any output differs from the recorded one.
+func runCheckRecordings(args []string) error {
+	flags := flag.NewFlagSet("recording check", flag.ContinueOnError)
+	workflowFile := flags.String("workflow", "", "workflow file to check instead of workflows/<name>.yaml")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("expected at least one recording file")
+	}
+
+	changed := 0
+	for _, file := range flags.Args() {
+		ok, err := checkRecording(file, *workflowFile)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", file, err)
+		}
+		if !ok {
+			changed++
+		}
+	}
+	if changed > 0 {
+		return fmt.Errorf("%d of %d recordings changed", changed, flags.NArg())
+	}
+	return nil
+}
+
+// checkRecording replays one recording and reports whether its output is
+// unchanged, logging what differs
+func checkRecording(file, workflowFile string) (bool, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	var recording types.Recording
+	if err := json.Unmarshal(raw, &recording); err != nil {
+		return false, fmt.Errorf("failed to parse recording: %w", err)
+	}
+
+	executor := orchestrator.NewChainExecutor()
+	if workflowFile == "" {
+		err = executor.LoadWorkflow(recording.Workflow)
+	} else {
+		err = addWorkflowFile(executor, recording.Workflow, workflowFile)
+	}
+	if err != nil {
+		return false, err
+	}
+	replayer := executor.ReplayCalls(recording.Calls)
+	out, err := executor.ExecuteChain(recording.Workflow, recording.Input)
+	if err != nil {
+		return false, fmt.Errorf("failed to run workflow: %w", err)
+	}
+
+	logger := slog.With("recording", file, "workflow", recording.Workflow)
+	for _, change := range replayer.Changed() {
+		logger.Warn("Lambda request changed", "change", change)
+	}
+	for _, step := range replayer.Unanswered() {
+		logger.Warn("Lambda call not in recording", "step", step)
+	}
+	for _, call := range replayer.Unused() {
+		logger.Warn("Recorded lambda call not made", "step", call.Step, "lambda", call.Lambda)
+	}
+
+	want, err := comparableOutput(recording.Output)
+	if err != nil {
+		return false, err
+	}
+	got, err := comparableOutput(out)
+	if err != nil {
+		return false, err
+	}
+	if !reflect.DeepEqual(want, got) {
+		wantJSON, _ := json.Marshal(want)
+		gotJSON, _ := json.Marshal(got)
+		logger.Error("Output changed", "recorded", string(wantJSON), "replayed", string(gotJSON))
+		return false, nil
+	}
+	logger.Info("Output unchanged", "calls", len(recording.Calls))
+	return true, nil
+}
+
+// addWorkflowFile parses a workflow file and adds it as name
+func addWorkflowFile(executor *orchestrator.ChainExecutor, name, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read workflow file: %w", err)
+	}
+	workflow, err := types.ParseWorkflow(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse workflow: %w", err)
+	}
+	return executor.AddWorkflow(name, workflow)
+}
+
+// comparableOutput is an output's data and error as decoded JSON, leaving
+// out the execution context, which differs between runs
+func comparableOutput(out *types.WorkflowOutput) (interface{}, error) {
+	if out == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(struct {
+		Data  map[string]interface{} `json:"data"`
+		Error *types.WorkflowError   `json:"error,omitempty"`
+	}{out.Data, out.Error})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode output: %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"tala_base/db"
+	"tala_base/types"
+	"tala_base/utils"
+)
+
+// handleReplay queues a new durable execution of a stored execution's
+// workflow with the same input, such as to reprocess it after a lambda fix.
+// Fields under data in the body replace those of the input; the priority
+// query parameter is honored as for workflow requests. The new execution
+// records the original in replay_of.
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var input types.ReplayInput
+	if err := utils.DecodeJSONBody(w, r, &input); err != nil && !errors.Is(err, io.EOF) {
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	priority := types.ExecutionPriority(r.URL.Query().Get("priority"))
+	if !priority.Valid() {
+		utils.RespondError(w, r, http.StatusBadRequest, "priority must be low, normal or high")
+		return
+	}
+
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+	original, err := db.GetExecution(ctx, s.db, id)
+	if errors.Is(err, db.ErrNotFound) {
+		utils.RespondError(w, r, http.StatusNotFound, "Execution not found")
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to get execution")
+		return
+	}
+
+	s.warnDeprecated(w, original.Workflow)
+	execCtx := requestContext(r)
+	if _, ok := s.admitLoad(w, r, false); !ok {
+		return
+	}
+	if !s.admit(w, r, execCtx, 1) {
+		return
+	}
+	exec, invalid, err := s.jobs.Replay(ctx, original, input.Data, execCtx, priority)
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if invalid != nil {
+		utils.RespondResult(w, r, nil, invalid)
+		return
+	}
+	w.Header().Set(utils.ExecutionIDHeader, exec.ID)
+	w.Header().Set("Location", "/executions/"+exec.ID)
+	utils.RespondSuccess(w, r, http.StatusAccepted, exec)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tala_base/db"
+	"tala_base/types"
+	"tala_base/utils"
+)
+
+// handleSchedules lists (GET) or creates (POST) recurring schedules in the
+// request's tenant. GET accepts the workflow, cursor and limit query parameters.
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		utils.RespondError(w, r, http.StatusNotFound, "Schedules are not enabled")
+		return
+	}
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		page := types.PageRequest{Cursor: query.Get("cursor"), Limit: limit}
+		schedules, err := db.ListSchedules(ctx, s.db, page, query.Get("workflow"))
+		if err != nil {
+			respondScheduleError(w, r, err, "Failed to list schedules")
+			return
+		}
+		utils.RespondSuccess(w, r, http.StatusOK, schedules)
+
+	case http.MethodPost:
+		var input types.CreateScheduleInput
+		if err := utils.DecodeJSONBody(w, r, &input); err != nil {
+			utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		schedule, err := s.schedules.Create(ctx, input)
+		if err != nil {
+			respondScheduleError(w, r, err, "Failed to create schedule")
+			return
+		}
+		s.warnDeprecated(w, schedule.Workflow)
+		w.Header().Set("Location", "/schedules/"+schedule.ID)
+		utils.RespondSuccess(w, r, http.StatusCreated, schedule)
+
+	default:
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleSchedule acts on one schedule: GET, PATCH and DELETE
+// /schedules/<id>, and POST /schedules/<id>/pause or /schedules/<id>/resume
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		utils.RespondError(w, r, http.StatusNotFound, "Schedules are not enabled")
+		return
+	}
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/schedules/"), "/")
+	if id == "" || strings.Contains(action, "/") {
+		utils.RespondError(w, r, http.StatusBadRequest, "Invalid schedule path")
+		return
+	}
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+
+	if action != "" {
+		if action != "pause" && action != "resume" {
+			utils.RespondError(w, r, http.StatusNotFound, "Unknown schedule action")
+			return
+		}
+		if r.Method != http.MethodPost {
+			utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		schedule, err := s.schedules.SetPaused(ctx, id, action == "pause")
+		if err != nil {
+			respondScheduleError(w, r, err, "Failed to "+action+" schedule")
+			return
+		}
+		utils.RespondSuccess(w, r, http.StatusOK, schedule)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := db.GetSchedule(ctx, s.db, id)
+		if err != nil {
+			respondScheduleError(w, r, err, "Failed to get schedule")
+			return
+		}
+		utils.RespondSuccess(w, r, http.StatusOK, schedule)
+
+	case http.MethodPatch:
+		var input types.UpdateScheduleInput
+		if err := utils.DecodeJSONBody(w, r, &input); err != nil {
+			utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		schedule, err := s.schedules.Update(ctx, id, input)
+		if err != nil {
+			respondScheduleError(w, r, err, "Failed to update schedule")
+			return
+		}
+		utils.RespondSuccess(w, r, http.StatusOK, schedule)
+
+	case http.MethodDelete:
+		if err := db.DeleteSchedule(ctx, s.db, id); err != nil {
+			respondScheduleError(w, r, err, "Failed to delete schedule")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// respondScheduleError maps repository and validation errors to a status,
+// hiding unexpected errors behind message
+func respondScheduleError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		utils.RespondError(w, r, http.StatusNotFound, "Schedule not found")
+	case errors.Is(err, db.ErrInvalidArgument):
+		utils.RespondError(w, r, http.StatusBadRequest, err.Error())
+	default:
+		utils.RespondError(w, r, http.StatusInternalServerError, message)
+	}
+}
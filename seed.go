@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+
+	"tala_base/db"
+	"tala_base/db/seed"
+)
+
+// defaultFixtures is loaded by `tala seed` when no files are given
+const defaultFixtures = "db/seed/fixtures/*.yaml"
+
+// runSeed implements the `tala seed [fixture files...]` command
+func runSeed(args []string) error {
+	files := args
+	if len(files) == 0 {
+		matches, err := filepath.Glob(defaultFixtures)
+		if err != nil {
+			return err
+		}
+		files = matches
+	}
+
+	dbConn, err := db.Connect(db.ConfigFromEnv())
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	for _, file := range files {
+		fixtures, err := seed.LoadFile(file)
+		if err != nil {
+			return err
+		}
+		result, err := seed.Apply(context.Background(), dbConn, fixtures, seed.Options{WorkflowDir: "workflows"})
+		if err != nil {
+			return err
+		}
+		slog.Info("Seeded fixtures",
+			"file", file,
+			"users_created", result.UsersCreated,
+			"users_existing", result.UsersSkipped,
+			"workflows_written", result.WorkflowsWritten,
+			"workflows_existing", result.WorkflowsSkipped,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Package sigv4 signs requests to AWS-compatible APIs with Signature Version 4,
+// so the SES and S3 clients do not need the AWS SDK
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm = "AWS4-HMAC-SHA256"
+	// UnsignedPayload is used as the payload hash for presigned URLs and streamed bodies
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// Credentials are the keys used to sign requests; SessionToken is set for temporary credentials
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Valid reports whether both keys are set
+func (c Credentials) Valid() bool {
+	return c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+// Signer signs requests for one service in one region
+type Signer struct {
+	Credentials Credentials
+	Region      string
+	Service     string
+}
+
+// Sign adds the X-Amz-* and Authorization headers to req. payloadHash is the
+// hex SHA-256 of the body (see HashPayload) or UnsignedPayload.
+func (s Signer) Sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "content-md5" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	scope := s.scope(now)
+	signature := s.signature(now, scope, strings.Join([]string{
+		req.Method,
+		EscapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.Credentials.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// Presign returns u with query parameters that authorize method on it until expires elapses
+func (s Signer) Presign(method string, u *url.URL, expires time.Duration, now time.Time) *url.URL {
+	now = now.UTC()
+	scope := s.scope(now)
+
+	signed := *u
+	query := signed.Query()
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", s.Credentials.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if s.Credentials.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+
+	signature := s.signature(now, scope, strings.Join([]string{
+		method,
+		EscapePath(signed.Path),
+		canonicalQuery(query),
+		"host:" + signed.Host + "\n",
+		"host",
+		UnsignedPayload,
+	}, "\n"))
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return &signed
+}
+
+// HashPayload returns the hex SHA-256 of body
+func HashPayload(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s Signer) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+func (s Signer) signature(now time.Time, scope, canonicalRequest string) string {
+	stringToSign := algorithm + "\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + HashPayload([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.Credentials.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery sorts and RFC 3986-encodes query parameters
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escape(key, false)+"="+escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// EscapePath RFC 3986-encodes a URL path as S3 expects it on the wire and in signatures
+func EscapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return escape(path, true)
+}
+
+// escape percent-encodes everything except RFC 3986 unreserved characters, and '/' when keepSlash is set
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', keepSlash && c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,210 @@
+// Package storage reads and writes objects in S3-compatible storage
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tala_base/sigv4"
+	"tala_base/utils/httpclient"
+)
+
+// MaxPresignExpiry is the longest lifetime SigV4 allows for a presigned URL
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+var (
+	// ErrNotFound is returned when an object does not exist
+	ErrNotFound = errors.New("object not found")
+	// ErrTooLarge is returned when an object exceeds Config.MaxObjectSize
+	ErrTooLarge = errors.New("object is too large")
+)
+
+// Config holds the bucket and endpoint settings. Endpoint is empty for AWS
+// and set for other S3-compatible services such as MinIO.
+type Config struct {
+	Endpoint    string
+	Region      string
+	Bucket      string
+	PathStyle   bool
+	Credentials sigv4.Credentials
+	// MaxObjectSize bounds objects read or written through the client, since
+	// they travel through workflow step JSON
+	MaxObjectSize int64
+}
+
+// ConfigFromEnv builds a Config from the S3_* and AWS_* variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Endpoint:      os.Getenv("S3_ENDPOINT"),
+		Region:        os.Getenv("S3_REGION"),
+		Bucket:        os.Getenv("S3_BUCKET"),
+		Credentials:   sigv4.CredentialsFromEnv(),
+		MaxObjectSize: 5 << 20,
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.PathStyle, _ = strconv.ParseBool(os.Getenv("S3_FORCE_PATH_STYLE"))
+	if v, err := strconv.ParseInt(os.Getenv("STORAGE_MAX_OBJECT_SIZE"), 10, 64); err == nil && v > 0 {
+		cfg.MaxObjectSize = v
+	}
+	return cfg
+}
+
+// Object is an object's metadata and, when read, its content
+type Object struct {
+	Key         string
+	ContentType string
+	ETag        string
+	Size        int64
+	Body        []byte
+}
+
+// Client is a minimal S3 client for putting, getting and presigning objects
+type Client struct {
+	cfg    Config
+	base   *url.URL
+	signer sigv4.Signer
+	client *http.Client
+}
+
+// New creates a client for cfg.Bucket
+func New(cfg Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is not set")
+	}
+	if !cfg.Credentials.Valid() {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for storage")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", cfg.Endpoint)
+	}
+	if cfg.PathStyle || cfg.Endpoint != "" {
+		base.Path = "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+	}
+
+	return &Client{
+		cfg:    cfg,
+		base:   base,
+		signer: sigv4.Signer{Credentials: cfg.Credentials, Region: cfg.Region, Service: "s3"},
+		client: httpclient.New(httpclient.Config{Name: "s3", Timeout: 30 * time.Second, Retries: 2}),
+	}, nil
+}
+
+// Bucket returns the configured bucket name
+func (c *Client) Bucket() string {
+	return c.cfg.Bucket
+}
+
+// Put writes body to key, replacing any existing object
+func (c *Client) Put(ctx context.Context, key, contentType string, body []byte) (*Object, error) {
+	if int64(len(body)) > c.cfg.MaxObjectSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, len(body), c.cfg.MaxObjectSize)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build put request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	c.signer.Sign(req, sigv4.HashPayload(body), time.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("put", key, resp)
+	}
+	return &Object{
+		Key:         key,
+		ContentType: contentType,
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		Size:        int64(len(body)),
+	}, nil
+}
+
+// Get reads the object at key, returning ErrNotFound if it does not exist
+func (c *Client) Get(ctx context.Context, key string) (*Object, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build get request: %w", err)
+	}
+	c.signer.Sign(req, sigv4.HashPayload(nil), time.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("get", key, resp)
+	}
+	if resp.ContentLength > c.cfg.MaxObjectSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, resp.ContentLength, c.cfg.MaxObjectSize)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.cfg.MaxObjectSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	if int64(len(body)) > c.cfg.MaxObjectSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, c.cfg.MaxObjectSize)
+	}
+	return &Object{
+		Key:         key,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		Size:        int64(len(body)),
+		Body:        body,
+	}, nil
+}
+
+// Presign returns a URL that allows method (GET or PUT) on key without credentials until expires elapses
+func (c *Client) Presign(method, key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > MaxPresignExpiry {
+		return "", fmt.Errorf("presign expiry must be between 1s and %s", MaxPresignExpiry)
+	}
+	return c.signer.Presign(method, c.objectURL(key), expires, time.Now()).String(), nil
+}
+
+// objectURL returns the URL of key, with RawPath set so the path sent on the
+// wire matches the one that was signed
+func (c *Client) objectURL(key string) *url.URL {
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = sigv4.EscapePath(u.Path)
+	return &u
+}
+
+func responseError(op, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("failed to %s object %s: S3 returned %d: %s", op, key, resp.StatusCode, detail)
+}
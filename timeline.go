@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tala_base/db"
+	"tala_base/types"
+	"tala_base/utils"
+)
+
+// redactedKeys are the substrings of field names whose values the timeline
+// hides, matched case-insensitively
+var redactedKeys = []string{"password", "secret", "token", "authorization", "api_key", "apikey", "credential", "ssn", "card_number"}
+
+// handleTimeline returns a stored execution as an ordered list of events:
+// when it was created, waited and started, each step with its duration,
+// attempts, input, output and error, the branches it took, operator
+// overrides and how it finished. Sensitive fields are redacted.
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+	exec, err := db.GetExecution(ctx, s.db, id)
+	if errors.Is(err, db.ErrNotFound) {
+		utils.RespondError(w, r, http.StatusNotFound, "Execution not found")
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to get execution")
+		return
+	}
+	audit, err := db.ListAudit(ctx, s.db, types.ListAuditInput{
+		PageRequest: types.PageRequest{Limit: 100},
+		Entity:      types.AuditEntityExecution,
+		EntityID:    id,
+	})
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to get execution audit log")
+		return
+	}
+
+	workflow, _ := s.executor.Workflow(exec.Workflow)
+	utils.RespondSuccess(w, r, http.StatusOK, buildTimeline(exec, workflow, audit.Items))
+}
+
+// buildTimeline orders an execution's events. Steps follow the workflow's
+// order; those without a record are listed as skipped, with the reason where
+// workflow still defines them.
+func buildTimeline(exec *types.Execution, workflow types.Workflow, audit []*types.AuditEntry) types.ExecutionTimeline {
+	created := exec.CreatedAt
+	events := []types.TimelineEvent{{Kind: types.TimelineCreated, At: &created}}
+	if exec.ScheduledFor != nil {
+		events = append(events, types.TimelineEvent{Kind: types.TimelineScheduled, At: exec.ScheduledFor})
+	}
+	if exec.StartedAt != nil {
+		due := exec.CreatedAt
+		if exec.ScheduledFor != nil && exec.ScheduledFor.After(due) {
+			due = *exec.ScheduledFor
+		}
+		events = append(events, types.TimelineEvent{Kind: types.TimelineStarted, At: exec.StartedAt, DurationMs: millis(due, *exec.StartedAt)})
+	}
+
+	recorded := make(map[int]types.StepExecution, len(exec.Steps))
+	for _, step := range exec.Steps {
+		recorded[step.StepIndex] = step
+	}
+	last := -1
+	for _, step := range exec.Steps {
+		last = max(last, step.StepIndex)
+	}
+	for i, def := range workflow.Steps {
+		step, ok := recorded[i]
+		if !ok || step.Step != def.Name {
+			if reason := skipReason(workflow, i, last, exec.Status); reason != "" {
+				events = append(events, types.TimelineEvent{Kind: types.TimelineSkipped, Step: def.Name, Lambda: def.Lambda, Decision: reason})
+			}
+			continue
+		}
+		events = append(events, stepEvent(step, def))
+		delete(recorded, i)
+	}
+	// Steps the workflow no longer defines, or has reordered
+	for _, step := range exec.Steps {
+		if _, ok := recorded[step.StepIndex]; ok {
+			events = append(events, stepEvent(step, types.Step{}))
+		}
+	}
+
+	for _, entry := range audit {
+		at := entry.CreatedAt
+		events = append(events, types.TimelineEvent{
+			Kind:     types.TimelineOperator,
+			At:       &at,
+			Decision: string(entry.Action),
+			Actor:    entry.Actor,
+			Output:   redact(entry.After),
+		})
+	}
+
+	if exec.FinishedAt != nil {
+		finished := types.TimelineEvent{Kind: types.TimelineFinished, At: exec.FinishedAt, Status: exec.Status, ErrorCode: exec.ErrorCode, Error: exec.Error, Output: redact(exec.Output)}
+		if exec.StartedAt != nil {
+			finished.DurationMs = millis(*exec.StartedAt, *exec.FinishedAt)
+		}
+		events = append(events, finished)
+	}
+
+	sortEvents(events)
+	return types.ExecutionTimeline{ExecutionID: exec.ID, Workflow: exec.Workflow, Status: exec.Status, Events: events}
+}
+
+// stepEvent is the event of a recorded step, with def the workflow's
+// definition of it when known
+func stepEvent(step types.StepExecution, def types.Step) types.TimelineEvent {
+	event := types.TimelineEvent{
+		Kind:      types.TimelineStep,
+		At:        step.StartedAt,
+		Step:      step.Step,
+		Lambda:    step.Lambda,
+		Status:    step.Status,
+		Attempts:  step.Attempts,
+		Retries:   max(step.Attempts-1, 0),
+		Input:     redact(step.Input),
+		Output:    redact(step.Output),
+		ErrorCode: step.ErrorCode,
+		Error:     step.Error,
+	}
+	if step.StartedAt != nil && step.FinishedAt != nil {
+		event.DurationMs = millis(*step.StartedAt, *step.FinishedAt)
+	}
+	switch {
+	case step.Status == types.ExecutionSucceeded && step.ErrorCode != "":
+		event.Decision = fmt.Sprintf("failed with %s and recovered by on_error handler %s", step.ErrorCode, def.HandlerFor(step.ErrorCode))
+	case step.Status == types.ExecutionFailed && def.HandlerFor(step.ErrorCode) != "":
+		event.Decision = fmt.Sprintf("on_error handler %s failed too", def.HandlerFor(step.ErrorCode))
+	case def.Flag != "":
+		name, negated := def.FlagName()
+		state := "on"
+		if negated {
+			state = "off"
+		}
+		event.Decision = fmt.Sprintf("conditioned on flag %s being %s", name, state)
+	}
+	return event
+}
+
+// skipReason explains why step i of workflow has no record, given the last
+// step recorded and the execution's status, or returns "" while it may
+// still run or, for on_error handlers, whose runs are reported on the step
+// they handled
+func skipReason(workflow types.Workflow, i, last int, status types.ExecutionStatus) string {
+	switch {
+	case workflow.IsErrorHandler(i):
+		return ""
+	case i < last:
+		return "not recorded"
+	case status.Finished():
+		return "not reached; the execution ended first"
+	}
+	return ""
+}
+
+// sortEvents orders events by time, keeping events without one, such as
+// skipped steps, after the event before them
+func sortEvents(events []types.TimelineEvent) {
+	type keyed struct {
+		at    time.Time
+		event types.TimelineEvent
+	}
+	sorted := make([]keyed, len(events))
+	var previous time.Time
+	for i, event := range events {
+		if event.At != nil {
+			previous = *event.At
+		}
+		sorted[i] = keyed{at: previous, event: event}
+	}
+	sort.SliceStable(sorted, func(a, b int) bool { return sorted[a].at.Before(sorted[b].at) })
+	for i, k := range sorted {
+		events[i] = k.event
+	}
+}
+
+// millis returns the milliseconds from start to end
+func millis(start, end time.Time) float64 {
+	return float64(end.Sub(start).Microseconds()) / 1000
+}
+
+// redact returns raw with the values of sensitive fields replaced, at any
+// depth, or raw unchanged if it is not JSON
+func redact(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return raw
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return raw
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitive(key) {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range redactedKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
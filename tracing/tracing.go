@@ -0,0 +1,89 @@
+// Package tracing sets up OpenTelemetry tracing for the server and lambdas,
+// propagating W3C trace context so a workflow is one trace across processes
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceparentKey is the W3C header and carrier key holding the traceparent
+const TraceparentKey = "traceparent"
+
+// Enabled reports whether an OTLP endpoint is configured
+func Enabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Init installs the W3C trace context propagator and, when an OTLP endpoint is
+// configured through the standard OTEL_EXPORTER_OTLP_* variables, a tracer
+// provider exporting spans over OTLP/HTTP as service. OTEL_SERVICE_NAME
+// overrides service. The returned function flushes and stops the exporter.
+func Init(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		service = name
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for the tala instrumentation scope
+func Tracer() trace.Tracer {
+	return otel.Tracer("tala_base")
+}
+
+// Extract returns ctx with the remote span context carried by headers, if any
+func Extract(ctx context.Context, headers propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, headers)
+}
+
+// Traceparent returns the W3C traceparent for ctx's span, or "" if it has none
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier.Get(TraceparentKey)
+}
+
+// Middleware runs next inside a server span named name, continuing the caller's trace if it sent one
+func Middleware(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+		next(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,195 @@
+package triggers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/codes"
+
+	"tala_base/logging"
+	"tala_base/notify"
+	"tala_base/utils"
+)
+
+// NATSConfig controls which subjects start workflows and where results go
+type NATSConfig struct {
+	// URL is the server to connect to; the trigger is disabled when empty
+	URL string
+	// Subjects maps each subscribed subject, which may use NATS wildcards, to
+	// the workflow its messages start
+	Subjects map[string]string
+	// Queue is the queue group every subscription joins, so replicas share
+	// messages instead of each running them; defaults to tala
+	Queue string
+	// ResultSubject, when set, is the prefix each result is published under
+	// as ResultSubject.<workflow>
+	ResultSubject string
+	// MaxInFlight caps how many workflows run at once; defaults to 8
+	MaxInFlight int
+}
+
+// NATSConfigFromEnv reads NATS_URL, which may be a secret:// reference,
+// NATS_TRIGGERS as comma-separated subject=workflow pairs, NATS_QUEUE_GROUP,
+// NATS_RESULT_SUBJECT and NATS_MAX_IN_FLIGHT
+func NATSConfigFromEnv() (NATSConfig, error) {
+	url, err := utils.SecretEnv("NATS_URL")
+	if err != nil {
+		return NATSConfig{}, err
+	}
+	cfg := NATSConfig{
+		URL:           url,
+		Subjects:      make(map[string]string),
+		Queue:         os.Getenv("NATS_QUEUE_GROUP"),
+		ResultSubject: os.Getenv("NATS_RESULT_SUBJECT"),
+	}
+	for _, pair := range strings.Split(os.Getenv("NATS_TRIGGERS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		subject, workflow, ok := strings.Cut(pair, "=")
+		subject, workflow = strings.TrimSpace(subject), strings.TrimSpace(workflow)
+		if !ok || subject == "" || workflow == "" {
+			return NATSConfig{}, fmt.Errorf("invalid NATS_TRIGGERS entry %q (expected subject=workflow)", pair)
+		}
+		cfg.Subjects[subject] = workflow
+	}
+	if n, err := strconv.Atoi(os.Getenv("NATS_MAX_IN_FLIGHT")); err == nil && n > 0 {
+		cfg.MaxInFlight = n
+	}
+	return cfg, nil
+}
+
+// NATSTrigger runs a workflow for each message on its subjects. A message
+// sent as a request gets the result as its reply.
+type NATSTrigger struct {
+	cfg       NATSConfig
+	runner    Runner
+	conn      *nats.Conn
+	publisher *notify.NATSPublisher
+	logger    *slog.Logger
+	subs      []*nats.Subscription
+
+	slots    chan struct{}
+	inFlight sync.WaitGroup
+}
+
+// StartNATS connects to cfg.URL and subscribes to cfg.Subjects
+func StartNATS(cfg NATSConfig, runner Runner) (*NATSTrigger, error) {
+	if cfg.Queue == "" {
+		cfg.Queue = "tala"
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 8
+	}
+	logger := logging.Component("nats")
+	conn, err := nats.Connect(cfg.URL,
+		nats.Name("tala-server"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("Disconnected from NATS", "error", err)
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			logger.Info("Reconnected to NATS", "url", c.ConnectedUrlRedacted())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	t := &NATSTrigger{
+		cfg:       cfg,
+		runner:    runner,
+		conn:      conn,
+		publisher: notify.NewNATSPublisher(conn),
+		logger:    logger,
+		slots:     make(chan struct{}, cfg.MaxInFlight),
+	}
+	for subject, workflow := range cfg.Subjects {
+		workflow := workflow
+		sub, err := conn.QueueSubscribe(subject, cfg.Queue, func(msg *nats.Msg) {
+			t.dispatch(workflow, msg)
+		})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+		}
+		t.subs = append(t.subs, sub)
+		logger.Info("Subscribed", "subject", subject, "workflow", workflow, "queue", cfg.Queue)
+	}
+	return t, nil
+}
+
+// Stop stops taking messages and waits up to timeout for running workflows
+// before closing the connection
+func (t *NATSTrigger) Stop(timeout time.Duration) {
+	for _, sub := range t.subs {
+		sub.Unsubscribe()
+	}
+	done := make(chan struct{})
+	go func() {
+		t.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.logger.Warn("Stopped with workflows still running")
+	}
+	t.conn.Close()
+}
+
+// dispatch waits for a free slot, blocking the subscription so NATS buffers
+// further messages, then runs the workflow in the background
+func (t *NATSTrigger) dispatch(workflow string, msg *nats.Msg) {
+	t.slots <- struct{}{}
+	t.inFlight.Add(1)
+	go func() {
+		defer func() {
+			<-t.slots
+			t.inFlight.Done()
+		}()
+		t.handle(workflow, msg)
+	}()
+}
+
+// handle runs workflow for msg in a consumer span continuing the publisher's
+// trace, then replies and publishes the result
+func (t *NATSTrigger) handle(workflow string, msg *nats.Msg) {
+	header := http.Header{}
+	for key, values := range msg.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	ctx, span := startConsumerSpan(header, "nats", msg.Subject, workflow)
+	defer span.End()
+
+	result := run(ctx, t.runner, workflow, msg.Data, header)
+	logger := t.logger.With("subject", msg.Subject, "workflow", workflow, "request_id", result.Meta.RequestID)
+	if result.Error != nil {
+		span.SetStatus(codes.Error, result.Error.Message)
+		logger.Warn("Workflow failed", "code", result.Error.Code, "error", result.Error.Message)
+	} else {
+		logger.Info("Workflow completed", "duration_ms", result.Meta.DurationMs)
+	}
+
+	if msg.Reply != "" {
+		if err := t.publisher.Publish(ctx, msg.Reply, result); err != nil {
+			logger.Warn("Failed to reply", "error", err)
+		}
+	}
+	if t.cfg.ResultSubject != "" {
+		if err := t.publisher.Publish(ctx, t.cfg.ResultSubject+"."+workflow, result); err != nil {
+			logger.Warn("Failed to publish result", "error", err)
+		}
+	}
+}
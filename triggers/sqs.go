@@ -0,0 +1,382 @@
+package triggers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+
+	"tala_base/logging"
+	"tala_base/sigv4"
+	"tala_base/types"
+	"tala_base/utils/httpclient"
+)
+
+// WorkflowAttribute is the SQS message attribute that picks the workflow a
+// message starts, overriding SQSConfig.Workflow
+const WorkflowAttribute = "workflow"
+
+// Message attributes added to messages moved to the dead-letter queue
+const (
+	DeadLetterReasonAttribute = "tala-dead-letter-reason"
+	DeadLetterSourceAttribute = "tala-source-queue"
+)
+
+// SQSConfig controls which queue starts workflows and how messages are held
+// while they run
+type SQSConfig struct {
+	// QueueURL is the queue to consume; the trigger is disabled when empty
+	QueueURL string
+	// Workflow is started by messages without a workflow attribute
+	Workflow    string
+	Region      string
+	Credentials sigv4.Credentials
+	// VisibilityTimeout hides a received message from other consumers; it is
+	// extended by the same amount at half-intervals while the workflow runs.
+	// Defaults to 30s.
+	VisibilityTimeout time.Duration
+	// WaitTime is the long-polling wait per receive; defaults to 20s
+	WaitTime time.Duration
+	// MaxInFlight caps how many workflows run at once; defaults to 10
+	MaxInFlight int
+	// MaxReceives is how many times a message may be received before it is
+	// treated as poison; defaults to 5
+	MaxReceives int
+	// DeadLetterURL is the queue poison messages are moved to. Without one
+	// they are left for the queue's own redrive policy.
+	DeadLetterURL string
+}
+
+// SQSConfigFromEnv reads SQS_QUEUE_URL, SQS_WORKFLOW, SQS_VISIBILITY_TIMEOUT,
+// SQS_MAX_IN_FLIGHT, SQS_MAX_RECEIVES and SQS_DLQ_URL, with AWS_REGION and
+// the AWS_* credentials
+func SQSConfigFromEnv() SQSConfig {
+	cfg := SQSConfig{
+		QueueURL:      os.Getenv("SQS_QUEUE_URL"),
+		Workflow:      os.Getenv("SQS_WORKFLOW"),
+		Region:        os.Getenv("AWS_REGION"),
+		Credentials:   sigv4.CredentialsFromEnv(),
+		DeadLetterURL: os.Getenv("SQS_DLQ_URL"),
+	}
+	if v, err := time.ParseDuration(os.Getenv("SQS_VISIBILITY_TIMEOUT")); err == nil && v > 0 {
+		cfg.VisibilityTimeout = v
+	}
+	if n, err := strconv.Atoi(os.Getenv("SQS_MAX_IN_FLIGHT")); err == nil && n > 0 {
+		cfg.MaxInFlight = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SQS_MAX_RECEIVES")); err == nil && n > 0 {
+		cfg.MaxReceives = n
+	}
+	return cfg
+}
+
+// sqsMessage is a received message in the SQS JSON protocol
+type sqsMessage struct {
+	MessageID         string                         `json:"MessageId"`
+	ReceiptHandle     string                         `json:"ReceiptHandle"`
+	Body              string                         `json:"Body"`
+	Attributes        map[string]string              `json:"Attributes"`
+	MessageAttributes map[string]sqsMessageAttribute `json:"MessageAttributes"`
+}
+
+type sqsMessageAttribute struct {
+	DataType    string `json:"DataType"`
+	StringValue string `json:"StringValue,omitempty"`
+}
+
+// SQSTrigger runs a workflow for each message on a queue. A message is
+// deleted only once its workflow succeeds; a failed one reappears when its
+// visibility timeout lapses and is retried until it becomes poison.
+type SQSTrigger struct {
+	cfg      SQSConfig
+	runner   Runner
+	signer   sigv4.Signer
+	endpoint string
+	client   *http.Client
+	logger   *slog.Logger
+
+	cancel   context.CancelFunc
+	polling  sync.WaitGroup
+	slots    chan struct{}
+	inFlight sync.WaitGroup
+}
+
+// StartSQS starts polling cfg.QueueURL
+func StartSQS(cfg SQSConfig, runner Runner) (*SQSTrigger, error) {
+	if cfg.Region == "" || !cfg.Credentials.Valid() {
+		return nil, fmt.Errorf("AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for SQS")
+	}
+	queue, err := url.Parse(cfg.QueueURL)
+	if err != nil || queue.Host == "" {
+		return nil, fmt.Errorf("invalid SQS_QUEUE_URL %q", cfg.QueueURL)
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 30 * time.Second
+	}
+	if cfg.WaitTime <= 0 {
+		cfg.WaitTime = 20 * time.Second
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 10
+	}
+	if cfg.MaxReceives <= 0 {
+		cfg.MaxReceives = 5
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &SQSTrigger{
+		cfg:    cfg,
+		runner: runner,
+		signer: sigv4.Signer{Credentials: cfg.Credentials, Region: cfg.Region, Service: "sqs"},
+		// The JSON protocol is served from the root of the queue's host,
+		// which also covers local stand-ins such as ElasticMQ
+		endpoint: queue.Scheme + "://" + queue.Host + "/",
+		client:   httpclient.New(httpclient.Config{Name: "sqs", Timeout: cfg.WaitTime + 10*time.Second}),
+		logger:   logging.Component("sqs").With("queue", cfg.QueueURL),
+		cancel:   cancel,
+		slots:    make(chan struct{}, cfg.MaxInFlight),
+	}
+	t.polling.Add(1)
+	go t.poll(ctx)
+	t.logger.Info("Polling", "workflow", cfg.Workflow, "max_in_flight", cfg.MaxInFlight)
+	return t, nil
+}
+
+// Stop stops receiving and waits up to timeout for running workflows. Messages
+// still running are not deleted, so another consumer picks them up.
+func (t *SQSTrigger) Stop(timeout time.Duration) {
+	t.cancel()
+	t.polling.Wait()
+	done := make(chan struct{})
+	go func() {
+		t.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.logger.Warn("Stopped with workflows still running")
+	}
+}
+
+// poll receives batches until ctx is done, never holding more messages than
+// there are free slots so none sit invisible waiting to run
+func (t *SQSTrigger) poll(ctx context.Context) {
+	defer t.polling.Done()
+	for ctx.Err() == nil {
+		// Wait for one free slot, then ask for as many as are free
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		free := cap(t.slots) - len(t.slots) + 1
+		if free > 10 {
+			free = 10
+		}
+
+		messages, err := t.receive(ctx, free)
+		if err != nil {
+			<-t.slots
+			if ctx.Err() == nil {
+				t.logger.Warn("Failed to receive messages", "error", err)
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+				}
+			}
+			continue
+		}
+		if len(messages) == 0 {
+			<-t.slots
+			continue
+		}
+
+		for i, m := range messages {
+			if i > 0 {
+				t.slots <- struct{}{}
+			}
+			t.inFlight.Add(1)
+			go func(m sqsMessage) {
+				defer func() {
+					<-t.slots
+					t.inFlight.Done()
+				}()
+				t.handle(m)
+			}(m)
+		}
+	}
+}
+
+// handle runs the workflow for m, keeping m invisible while it runs, and
+// deletes it on success. Poison messages go to the dead-letter queue.
+func (t *SQSTrigger) handle(m sqsMessage) {
+	logger := t.logger.With("message_id", m.MessageID)
+	if receives, _ := strconv.Atoi(m.Attributes["ApproximateReceiveCount"]); receives > t.cfg.MaxReceives {
+		t.deadLetter(logger, m, fmt.Sprintf("received %d times", receives))
+		return
+	}
+	workflow := t.cfg.Workflow
+	if attr, ok := m.MessageAttributes[WorkflowAttribute]; ok && attr.StringValue != "" {
+		workflow = attr.StringValue
+	}
+	if workflow == "" {
+		t.deadLetter(logger, m, "no workflow: set SQS_WORKFLOW or the workflow message attribute")
+		return
+	}
+	logger = logger.With("workflow", workflow)
+
+	header := http.Header{}
+	for name, attr := range m.MessageAttributes {
+		if attr.DataType == "String" {
+			header.Set(name, attr.StringValue)
+		}
+	}
+	ctx, span := startConsumerSpan(header, "aws_sqs", t.cfg.QueueURL, workflow)
+	defer span.End()
+
+	stopExtending := t.keepInvisible(ctx, logger, m)
+	result := run(ctx, t.runner, workflow, []byte(m.Body), header)
+	stopExtending()
+	logger = logger.With("request_id", result.Meta.RequestID)
+
+	if result.Error == nil {
+		logger.Info("Workflow completed", "duration_ms", result.Meta.DurationMs)
+		if err := t.call(ctx, "DeleteMessage", map[string]interface{}{
+			"QueueUrl":      t.cfg.QueueURL,
+			"ReceiptHandle": m.ReceiptHandle,
+		}, nil); err != nil {
+			logger.Warn("Failed to delete message; it will run again", "error", err)
+		}
+		return
+	}
+
+	span.SetStatus(codes.Error, result.Error.Message)
+	switch result.Error.Code {
+	case types.ErrorCodeBadRequest, types.ErrorCodeValidationFailed:
+		// Retrying cannot fix the message itself
+		t.deadLetter(logger, m, fmt.Sprintf("%s: %s", result.Error.Code, result.Error.Message))
+	default:
+		logger.Warn("Workflow failed; message will be retried", "code", result.Error.Code, "error", result.Error.Message)
+	}
+}
+
+// keepInvisible extends m's visibility timeout every half timeout until the
+// returned function is called, so a long chain is not handed to another consumer
+func (t *SQSTrigger) keepInvisible(ctx context.Context, logger *slog.Logger, m sqsMessage) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(t.cfg.VisibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := t.call(ctx, "ChangeMessageVisibility", map[string]interface{}{
+					"QueueUrl":          t.cfg.QueueURL,
+					"ReceiptHandle":     m.ReceiptHandle,
+					"VisibilityTimeout": int(t.cfg.VisibilityTimeout.Seconds()),
+				}, nil); err != nil {
+					logger.Warn("Failed to extend visibility timeout", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// deadLetter moves m to the dead-letter queue with the reason attached, or
+// leaves it to the queue's redrive policy when there is none
+func (t *SQSTrigger) deadLetter(logger *slog.Logger, m sqsMessage, reason string) {
+	ctx := context.Background()
+	if t.cfg.DeadLetterURL == "" {
+		logger.Error("Poison message left for the queue's redrive policy", "reason", reason)
+		return
+	}
+	attributes := make(map[string]sqsMessageAttribute, len(m.MessageAttributes)+2)
+	for name, attr := range m.MessageAttributes {
+		attributes[name] = attr
+	}
+	attributes[DeadLetterReasonAttribute] = sqsMessageAttribute{DataType: "String", StringValue: reason}
+	attributes[DeadLetterSourceAttribute] = sqsMessageAttribute{DataType: "String", StringValue: t.cfg.QueueURL}
+
+	if err := t.call(ctx, "SendMessage", map[string]interface{}{
+		"QueueUrl":          t.cfg.DeadLetterURL,
+		"MessageBody":       m.Body,
+		"MessageAttributes": attributes,
+	}, nil); err != nil {
+		logger.Error("Failed to dead-letter message", "reason", reason, "error", err)
+		return
+	}
+	if err := t.call(ctx, "DeleteMessage", map[string]interface{}{
+		"QueueUrl":      t.cfg.QueueURL,
+		"ReceiptHandle": m.ReceiptHandle,
+	}, nil); err != nil {
+		logger.Warn("Failed to delete dead-lettered message", "error", err)
+	}
+	logger.Warn("Moved message to dead-letter queue", "reason", reason)
+}
+
+// receive long-polls for up to max messages
+func (t *SQSTrigger) receive(ctx context.Context, max int) ([]sqsMessage, error) {
+	var out struct {
+		Messages []sqsMessage `json:"Messages"`
+	}
+	err := t.call(ctx, "ReceiveMessage", map[string]interface{}{
+		"QueueUrl":                    t.cfg.QueueURL,
+		"MaxNumberOfMessages":         max,
+		"WaitTimeSeconds":             int(t.cfg.WaitTime.Seconds()),
+		"VisibilityTimeout":           int(t.cfg.VisibilityTimeout.Seconds()),
+		"MessageSystemAttributeNames": []string{"ApproximateReceiveCount"},
+		"MessageAttributeNames":       []string{"All"},
+	}, &out)
+	return out.Messages, err
+}
+
+// call invokes an SQS action over the JSON protocol, decoding the response into out when set
+func (t *SQSTrigger) call(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode SQS %s request: %w", action, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build SQS %s request: %w", action, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	t.signer.Sign(req, sigv4.HashPayload(body), time.Now())
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call SQS %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SQS %s returned %d: %s", action, resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode SQS %s response: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package triggers starts workflows from message brokers. Each message body is
+// a workflow's input, as the body of POST /workflow/<name> is, and its result
+// is reported in the same envelope the server responds with.
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"tala_base/tracing"
+	"tala_base/types"
+	"tala_base/utils"
+)
+
+// Runner executes workflows; *orchestrator.ChainExecutor implements it
+type Runner interface {
+	ExecuteChain(name string, input types.WorkflowInput) (*types.WorkflowOutput, error)
+}
+
+// run executes workflow with a message's body as input and header as its
+// execution context. The returned envelope carries Error when the body is not
+// a JSON object, the workflow could not run, or a step failed.
+func run(ctx context.Context, runner Runner, workflow string, body []byte, header http.Header) (result utils.Envelope) {
+	start := time.Now()
+	execCtx := utils.ExecutionContextFromHeaders(header)
+	execCtx.ExecutionID = ""
+	execCtx.IdempotencyKey = ""
+	if execCtx.RequestID == "" {
+		execCtx.RequestID = uuid.NewString()
+	}
+	execCtx.TraceParent = tracing.Traceparent(ctx)
+
+	result = utils.Envelope{Meta: utils.ResponseMeta{RequestID: execCtx.RequestID}}
+	defer func() {
+		result.Meta.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	input := map[string]interface{}{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &input); err != nil {
+			result.Error = &utils.ResponseError{Code: types.ErrorCodeBadRequest, Message: "message body must be a JSON object"}
+			return result
+		}
+	}
+
+	output, err := runner.ExecuteChain(workflow, types.WorkflowInput{Data: input, Context: execCtx})
+	if err != nil {
+		result.Error = &utils.ResponseError{Code: types.ErrorCodeInternal, Message: err.Error()}
+		return result
+	}
+	result.Meta.ExecutionID = output.Context.ExecutionID
+	if output.Error != nil {
+		result.Error = &utils.ResponseError{Code: output.Error.Code, Message: output.Error.Message, Step: output.Error.Step}
+		return result
+	}
+	result.Data = output.Data
+	return result
+}
+
+// startConsumerSpan starts the span a message is handled in, continuing the
+// trace whose context the producer put in header
+func startConsumerSpan(header http.Header, system, destination, workflow string) (context.Context, trace.Span) {
+	ctx := tracing.Extract(context.Background(), propagation.HeaderCarrier(header))
+	return tracing.Tracer().Start(ctx, system+" "+destination,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", system),
+			attribute.String("messaging.destination.name", destination),
+			attribute.String("workflow", workflow),
+		),
+	)
+}
@@ -0,0 +1,37 @@
+package types
+
+import "time"
+
+// APIKey represents a stored API key. The secret itself is never stored or returned
+// after creation; only its hash is kept.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	TenantID   string     `json:"tenant_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKeyInput represents the input for issuing an API key.
+// TenantID selects the tenant the key authenticates as, defaulting to the default tenant.
+type CreateAPIKeyInput struct {
+	Name     string   `json:"name"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// CreateAPIKeyOutput represents a newly issued API key.
+// Key is the full secret and is only ever returned here.
+type CreateAPIKeyOutput struct {
+	APIKey APIKey `json:"api_key"`
+	Key    string `json:"key"`
+}
+
+// ListAPIKeysOutput represents the output of listing API keys
+type ListAPIKeysOutput struct {
+	APIKeys []*APIKey `json:"api_keys"`
+	Total   int       `json:"total"`
+}
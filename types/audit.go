@@ -0,0 +1,98 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserAuditAction names the kind of mutation recorded in the user audit log
+type UserAuditAction string
+
+const (
+	UserAuditCreate     UserAuditAction = "create"
+	UserAuditUpdate     UserAuditAction = "update"
+	UserAuditDelete     UserAuditAction = "delete"
+	UserAuditHardDelete UserAuditAction = "hard_delete"
+	UserAuditRestore    UserAuditAction = "restore"
+	UserAuditErase      UserAuditAction = "erase"
+)
+
+// UserAuditEntry represents one recorded change to a user
+type UserAuditEntry struct {
+	ID          int64           `json:"id"`
+	UserID      int             `json:"user_id"`
+	Action      UserAuditAction `json:"action"`
+	Actor       string          `json:"actor,omitempty"`
+	ExecutionID string          `json:"execution_id,omitempty"`
+	Before      json.RawMessage `json:"before,omitempty"`
+	After       json.RawMessage `json:"after,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ReadUserAuditInput represents the input for reading the user audit log.
+// At least one of UserID and ExecutionID must be set.
+type ReadUserAuditInput struct {
+	UserID      int    `json:"user_id,omitempty"`
+	ExecutionID string `json:"execution_id,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+	Offset      int    `json:"offset,omitempty"`
+}
+
+// ReadUserAuditOutput represents the output of reading the user audit log
+type ReadUserAuditOutput struct {
+	Entries []UserAuditEntry `json:"entries"`
+}
+
+// AuditEntity names the kind of resource a management audit entry records a change to
+type AuditEntity string
+
+const (
+	AuditEntitySchedule  AuditEntity = "schedule"
+	AuditEntityAPIKey    AuditEntity = "api_key"
+	AuditEntityExecution AuditEntity = "execution"
+	AuditEntityQuota     AuditEntity = "quota"
+)
+
+// AuditAction names the management action an audit entry records
+type AuditAction string
+
+const (
+	AuditCreate   AuditAction = "create"
+	AuditUpdate   AuditAction = "update"
+	AuditPause    AuditAction = "pause"
+	AuditResume   AuditAction = "resume"
+	AuditDelete   AuditAction = "delete"
+	AuditRevoke   AuditAction = "revoke"
+	AuditCancel   AuditAction = "cancel"
+	AuditSkipStep AuditAction = "skip_step"
+	AuditFailStep AuditAction = "fail_step"
+)
+
+// AuditEntry represents one management action recorded in the audit log.
+// Before is unset for creates and After for deletes; Changed lists the
+// top-level fields that differ between them.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Entity    AuditEntity     `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Action    AuditAction     `json:"action"`
+	Actor     string          `json:"actor,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Changed   []string        `json:"changed,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ListAuditInput represents the filters for listing the audit log; unset fields match every entry
+type ListAuditInput struct {
+	PageRequest
+	Entity        AuditEntity `json:"entity,omitempty"`
+	EntityID      string      `json:"entity_id,omitempty"`
+	Action        AuditAction `json:"action,omitempty"`
+	Actor         string      `json:"actor,omitempty"`
+	CreatedAfter  *time.Time  `json:"created_after,omitempty"`
+	CreatedBefore *time.Time  `json:"created_before,omitempty"`
+}
+
+// ListAuditOutput represents one page of audit entries along with the total number of matches
+type ListAuditOutput = ListResponse[*AuditEntry]
@@ -0,0 +1,42 @@
+package types
+
+// Error codes returned by the auth lambdas
+const (
+	ErrorCodeInvalidCredentials  = "INVALID_CREDENTIALS"
+	ErrorCodeInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	ErrorCodeAccountInactive     = "ACCOUNT_INACTIVE"
+)
+
+// RegisterInput represents the input for registering a user with a password.
+// bcrypt ignores bytes past 72, so longer passwords are rejected.
+type RegisterInput struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Name     string `json:"name" validate:"required,notblank,max=255"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// LoginInput represents the input for logging in with email and password
+type LoginInput struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RefreshInput represents the input for exchanging a refresh token for new tokens
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// AuthTokens is an access token with the refresh token that renews it.
+// The refresh token is single-use; refreshing returns a new one.
+type AuthTokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthOutput represents the output of the register, login and refresh lambdas
+type AuthOutput struct {
+	User   User       `json:"user"`
+	Tokens AuthTokens `json:"tokens"`
+}
@@ -0,0 +1,38 @@
+package types
+
+import (
+	"strings"
+	"time"
+)
+
+// ExecutionContext travels with a workflow from the request that started it
+// to every lambda it calls. It is stored in the JSON body of workflow inputs
+// and outputs, and forwarded to lambdas as request headers.
+type ExecutionContext struct {
+	ExecutionID string `json:"execution_id,omitempty"`
+	RequestID   string `json:"request_id,omitempty"`
+	// TraceParent is the W3C traceparent of the span the workflow runs under
+	TraceParent string `json:"traceparent,omitempty"`
+	TenantID    string `json:"tenant_id,omitempty"`
+	// UserID is the end user the workflow acts for, recorded as the audit actor
+	UserID string `json:"user_id,omitempty"`
+	// Deadline bounds the whole workflow; lambda calls are cancelled once it passes
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// Vars are caller-defined values passed through to every step
+	Vars map[string]string `json:"vars,omitempty"`
+	// APIKeyID is the API key the workflow was started with, which its usage
+	// is counted against; it is never sent to lambdas
+	APIKeyID int64 `json:"api_key_id,omitempty"`
+	// IdempotencyKey identifies one step of a durable execution, and is the
+	// same each time the step is retried
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// TraceID returns the trace ID part of TraceParent, or "" if it has none
+func (c ExecutionContext) TraceID() string {
+	parts := strings.Split(c.TraceParent, "-")
+	if len(parts) != 4 {
+		return ""
+	}
+	return parts[1]
+}
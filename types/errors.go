@@ -0,0 +1,128 @@
+package types
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// WorkflowErrorCode classifies a failed step. The generic codes below are
+// produced by the orchestrator and the lambda SDK; lambdas may also return
+// their own, more specific codes such as ErrorCodeUserNotFound.
+type WorkflowErrorCode string
+
+// Generic error codes shared by the orchestrator and every lambda
+const (
+	ErrorCodeBadRequest       WorkflowErrorCode = "BAD_REQUEST"
+	ErrorCodeValidationFailed WorkflowErrorCode = "VALIDATION_FAILED"
+	ErrorCodeInvalidArgument  WorkflowErrorCode = "INVALID_ARGUMENT"
+	ErrorCodeUnauthenticated  WorkflowErrorCode = "UNAUTHENTICATED"
+	ErrorCodeNotFound         WorkflowErrorCode = "NOT_FOUND"
+	ErrorCodeMethodNotAllowed WorkflowErrorCode = "METHOD_NOT_ALLOWED"
+	ErrorCodeConflict         WorkflowErrorCode = "CONFLICT"
+	ErrorCodeTimeout          WorkflowErrorCode = "TIMEOUT"
+	ErrorCodeRateLimited      WorkflowErrorCode = "RATE_LIMITED"
+	ErrorCodeOverloaded       WorkflowErrorCode = "OVERLOADED"
+	ErrorCodeQuotaExceeded    WorkflowErrorCode = "QUOTA_EXCEEDED"
+	ErrorCodeInternal         WorkflowErrorCode = "INTERNAL"
+)
+
+// Error codes produced by the orchestrator when calling a lambda
+const (
+	// ErrorCodeTemplateError means a step's input template failed to parse or execute
+	ErrorCodeTemplateError WorkflowErrorCode = "TEMPLATE_ERROR"
+	// ErrorCodeLambdaUnavailable means the lambda is failing readiness checks or could not be reached
+	ErrorCodeLambdaUnavailable WorkflowErrorCode = "LAMBDA_UNAVAILABLE"
+	// ErrorCodeLambdaError means the lambda failed without returning an error code
+	ErrorCodeLambdaError WorkflowErrorCode = "LAMBDA_ERROR"
+	// ErrorCodeInvalidResponseType means the lambda answered with something other than JSON
+	ErrorCodeInvalidResponseType WorkflowErrorCode = "INVALID_RESPONSE_TYPE"
+	// ErrorCodeInvalidJSON means the lambda's JSON response could not be parsed
+	ErrorCodeInvalidJSON WorkflowErrorCode = "INVALID_JSON"
+	// ErrorCodeUnsupportedStepKind means the orchestrator cannot yet run a step of this kind
+	ErrorCodeUnsupportedStepKind WorkflowErrorCode = "UNSUPPORTED_STEP_KIND"
+	// ErrorCodeResponseTooLarge means the lambda's response exceeded LAMBDA_MAX_RESPONSE_SIZE
+	ErrorCodeResponseTooLarge WorkflowErrorCode = "RESPONSE_TOO_LARGE"
+	// ErrorCodeDeadlineExceeded means the execution's deadline passed before the workflow finished
+	ErrorCodeDeadlineExceeded WorkflowErrorCode = "DEADLINE_EXCEEDED"
+	// ErrorCodeWorkflowDisabled means the workflow is marked disabled: true and takes no new executions
+	ErrorCodeWorkflowDisabled WorkflowErrorCode = "WORKFLOW_DISABLED"
+)
+
+// errorCodeStatus maps known codes onto the HTTP status they are reported with
+var errorCodeStatus = map[WorkflowErrorCode]int{
+	ErrorCodeBadRequest:          http.StatusBadRequest,
+	ErrorCodeValidationFailed:    http.StatusBadRequest,
+	ErrorCodeInvalidArgument:     http.StatusBadRequest,
+	ErrorCodeUnauthenticated:     http.StatusUnauthorized,
+	ErrorCodeNotFound:            http.StatusNotFound,
+	ErrorCodeMethodNotAllowed:    http.StatusMethodNotAllowed,
+	ErrorCodeConflict:            http.StatusConflict,
+	ErrorCodeTimeout:             http.StatusGatewayTimeout,
+	ErrorCodeRateLimited:         http.StatusTooManyRequests,
+	ErrorCodeOverloaded:          http.StatusServiceUnavailable,
+	ErrorCodeQuotaExceeded:       http.StatusTooManyRequests,
+	ErrorCodeInternal:            http.StatusInternalServerError,
+	ErrorCodeTemplateError:       http.StatusInternalServerError,
+	ErrorCodeLambdaUnavailable:   http.StatusServiceUnavailable,
+	ErrorCodeLambdaError:         http.StatusBadGateway,
+	ErrorCodeInvalidResponseType: http.StatusBadGateway,
+	ErrorCodeInvalidJSON:         http.StatusBadGateway,
+	ErrorCodeUnsupportedStepKind: http.StatusNotImplemented,
+	ErrorCodeResponseTooLarge:    http.StatusBadGateway,
+	ErrorCodeDeadlineExceeded:    http.StatusGatewayTimeout,
+	ErrorCodeWorkflowDisabled:    http.StatusForbidden,
+
+	ErrorCodeUserNotFound:        http.StatusNotFound,
+	ErrorCodeDuplicateEmail:      http.StatusConflict,
+	ErrorCodeInvalidCredentials:  http.StatusUnauthorized,
+	ErrorCodeInvalidRefreshToken: http.StatusUnauthorized,
+	ErrorCodeAccountInactive:     http.StatusForbidden,
+	ErrorCodeTemplateNotFound:    http.StatusNotFound,
+	ErrorCodeTemplateInvalid:     http.StatusUnprocessableEntity,
+	ErrorCodeEmailSendFailed:     http.StatusBadGateway,
+	ErrorCodeWebhookFailed:       http.StatusBadGateway,
+	ErrorCodeHostNotAllowed:      http.StatusForbidden,
+	ErrorCodeInvalidExpression:   http.StatusUnprocessableEntity,
+	ErrorCodeTransformFailed:     http.StatusUnprocessableEntity,
+	ErrorCodeObjectNotFound:      http.StatusNotFound,
+	ErrorCodeObjectTooLarge:      http.StatusRequestEntityTooLarge,
+	ErrorCodeStorageFailed:       http.StatusBadGateway,
+}
+
+// HTTPStatus returns the status a failure with this code is reported with.
+// Codes not known to the orchestrator are reported as 502, since they come from a lambda.
+func (c WorkflowErrorCode) HTTPStatus() int {
+	if status, ok := errorCodeStatus[c]; ok {
+		return status
+	}
+	return http.StatusBadGateway
+}
+
+// Retryable reports whether a step failing with this code may succeed if
+// run again unchanged, because the lambda was unreachable, slow or shedding load
+func (c WorkflowErrorCode) Retryable() bool {
+	switch c {
+	case ErrorCodeTimeout, ErrorCodeRateLimited, ErrorCodeOverloaded, ErrorCodeLambdaUnavailable:
+		return true
+	}
+	return false
+}
+
+// NewWorkflowError creates an error for the given step
+func NewWorkflowError(step string, code WorkflowErrorCode, message string) *WorkflowError {
+	return &WorkflowError{Step: step, Code: code, Message: message}
+}
+
+// WorkflowErrorf creates an error for the given step with a formatted message
+func WorkflowErrorf(step string, code WorkflowErrorCode, format string, args ...interface{}) *WorkflowError {
+	return NewWorkflowError(step, code, fmt.Sprintf(format, args...))
+}
+
+func (e *WorkflowError) Error() string {
+	return fmt.Sprintf("step %s failed with %s: %s", e.Step, e.Code, e.Message)
+}
+
+// HTTPStatus returns the status the error is reported with
+func (e *WorkflowError) HTTPStatus() int {
+	return e.Code.HTTPStatus()
+}
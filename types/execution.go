@@ -0,0 +1,249 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ExecutionStatus is the lifecycle state of a workflow or step execution
+type ExecutionStatus string
+
+const (
+	ExecutionScheduled ExecutionStatus = "scheduled"
+	ExecutionPending   ExecutionStatus = "pending"
+	ExecutionRunning   ExecutionStatus = "running"
+	ExecutionSucceeded ExecutionStatus = "succeeded"
+	ExecutionFailed    ExecutionStatus = "failed"
+	ExecutionCanceled  ExecutionStatus = "canceled"
+)
+
+// Valid reports whether s is a known execution status
+func (s ExecutionStatus) Valid() bool {
+	switch s {
+	case ExecutionScheduled, ExecutionPending, ExecutionRunning, ExecutionSucceeded, ExecutionFailed, ExecutionCanceled:
+		return true
+	}
+	return false
+}
+
+// Finished reports whether s is a terminal status
+func (s ExecutionStatus) Finished() bool {
+	return s == ExecutionSucceeded || s == ExecutionFailed || s == ExecutionCanceled
+}
+
+// Execution represents one stored run of a workflow. ScheduledFor is set on
+// executions requested to start at a later time, and ReplayOf on replays of
+// another execution's input.
+type Execution struct {
+	ID           string            `json:"id"`
+	TenantID     string            `json:"tenant_id"`
+	Workflow     string            `json:"workflow"`
+	Status       ExecutionStatus   `json:"status"`
+	Input        json.RawMessage   `json:"input,omitempty"`
+	Output       json.RawMessage   `json:"output,omitempty"`
+	ErrorCode    WorkflowErrorCode `json:"error_code,omitempty"`
+	Error        json.RawMessage   `json:"error,omitempty"`
+	Attempt      int               `json:"attempt"`
+	Labels       map[string]string `json:"labels"`
+	CreatedAt    time.Time         `json:"created_at"`
+	ScheduledFor *time.Time        `json:"scheduled_for,omitempty"`
+	StartedAt    *time.Time        `json:"started_at,omitempty"`
+	FinishedAt   *time.Time        `json:"finished_at,omitempty"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	ReplayOf     string            `json:"replay_of,omitempty"`
+	Steps        []StepExecution   `json:"steps,omitempty"`
+}
+
+// StepExecution represents one step of a stored execution.
+// Attempts counts how many times the step was invoked, including retries.
+type StepExecution struct {
+	ID          int64             `json:"id"`
+	TenantID    string            `json:"tenant_id"`
+	ExecutionID string            `json:"execution_id"`
+	StepIndex   int               `json:"step_index"`
+	Step        string            `json:"step"`
+	Lambda      string            `json:"lambda"`
+	Status      ExecutionStatus   `json:"status"`
+	Input       json.RawMessage   `json:"input,omitempty"`
+	Output      json.RawMessage   `json:"output,omitempty"`
+	ErrorCode   WorkflowErrorCode `json:"error_code,omitempty"`
+	Error       json.RawMessage   `json:"error,omitempty"`
+	Attempts    int               `json:"attempts"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+}
+
+// TimelineEventKind names what a timeline event records
+type TimelineEventKind string
+
+const (
+	TimelineCreated   TimelineEventKind = "created"
+	TimelineScheduled TimelineEventKind = "scheduled"
+	TimelineStarted   TimelineEventKind = "started"
+	TimelineStep      TimelineEventKind = "step"
+	TimelineSkipped   TimelineEventKind = "skipped"
+	TimelineOperator  TimelineEventKind = "operator"
+	TimelineFinished  TimelineEventKind = "finished"
+)
+
+// TimelineEvent is one entry of an execution's timeline. DurationMs is how
+// long a step's last attempt ran, how long the execution waited to start, or
+// how long it ran in all. Decision explains a branch the execution took at
+// the step, such as the on_error handler that recovered it.
+type TimelineEvent struct {
+	Kind       TimelineEventKind `json:"kind"`
+	At         *time.Time        `json:"at,omitempty"`
+	DurationMs float64           `json:"duration_ms,omitempty"`
+	Step       string            `json:"step,omitempty"`
+	Lambda     string            `json:"lambda,omitempty"`
+	Status     ExecutionStatus   `json:"status,omitempty"`
+	Attempts   int               `json:"attempts,omitempty"`
+	Retries    int               `json:"retries,omitempty"`
+	Input      json.RawMessage   `json:"input,omitempty"`
+	Output     json.RawMessage   `json:"output,omitempty"`
+	ErrorCode  WorkflowErrorCode `json:"error_code,omitempty"`
+	Error      json.RawMessage   `json:"error,omitempty"`
+	Decision   string            `json:"decision,omitempty"`
+	Actor      string            `json:"actor,omitempty"`
+}
+
+// ExecutionTimeline represents the ordered events of a stored execution,
+// with sensitive fields of inputs and outputs redacted
+type ExecutionTimeline struct {
+	ExecutionID string          `json:"execution_id"`
+	Workflow    string          `json:"workflow"`
+	Status      ExecutionStatus `json:"status"`
+	Events      []TimelineEvent `json:"events"`
+}
+
+// ReplayInput represents the body of an execution replay: fields replacing
+// those of the replayed execution's input
+type ReplayInput struct {
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// StepOverrideInput represents an operator's resolution of the step a
+// durable execution is waiting to run or retry. Step, when set, must name
+// that step, guarding against an execution that moved on. A skipped step
+// completes with Output; a failed one fails with Code (default INTERNAL) and
+// Message.
+type StepOverrideInput struct {
+	Step    string                 `json:"step,omitempty"`
+	Output  map[string]interface{} `json:"output,omitempty"`
+	Code    WorkflowErrorCode      `json:"code,omitempty"`
+	Message string                 `json:"message,omitempty"`
+}
+
+// ExecutionPriority orders the due jobs of durable executions: workers claim
+// higher priorities first, so while every worker is busy, queued executions
+// of a lower priority wait behind them. Running executions are never
+// interrupted. Empty means normal.
+type ExecutionPriority string
+
+const (
+	PriorityLow    ExecutionPriority = "low"
+	PriorityNormal ExecutionPriority = "normal"
+	PriorityHigh   ExecutionPriority = "high"
+)
+
+// Valid reports whether p is empty or a known priority
+func (p ExecutionPriority) Valid() bool {
+	switch p {
+	case "", PriorityLow, PriorityNormal, PriorityHigh:
+		return true
+	}
+	return false
+}
+
+// Rank is the number a priority is stored and ordered by
+func (p ExecutionPriority) Rank() int {
+	switch p {
+	case PriorityLow:
+		return -1
+	case PriorityHigh:
+		return 1
+	}
+	return 0
+}
+
+// PriorityFromRank returns the priority stored as rank
+func PriorityFromRank(rank int) ExecutionPriority {
+	switch {
+	case rank < 0:
+		return PriorityLow
+	case rank > 0:
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// ExecutionJob is the queued remainder of a durable execution: the workflow
+// state as of its last completed step and the index of the step to run next.
+// Attempts counts failed tries of that step.
+type ExecutionJob struct {
+	ExecutionID string            `json:"execution_id"`
+	TenantID    string            `json:"tenant_id"`
+	Workflow    string            `json:"workflow"`
+	StepIndex   int               `json:"step_index"`
+	State       json.RawMessage   `json:"state"`
+	Attempts    int               `json:"attempts"`
+	Priority    ExecutionPriority `json:"priority"`
+	RunAt       time.Time         `json:"run_at"`
+	LockedBy    string            `json:"locked_by,omitempty"`
+	LockedUntil *time.Time        `json:"locked_until,omitempty"`
+	LastError   string            `json:"last_error,omitempty"`
+}
+
+// ExecutionEventType names a state change in an execution
+type ExecutionEventType string
+
+const (
+	EventExecutionStarted   ExecutionEventType = "execution.started"
+	EventExecutionSucceeded ExecutionEventType = "execution.succeeded"
+	EventExecutionFailed    ExecutionEventType = "execution.failed"
+	EventExecutionCanceled  ExecutionEventType = "execution.canceled"
+	EventStepStarted        ExecutionEventType = "step.started"
+	EventStepSucceeded      ExecutionEventType = "step.succeeded"
+	EventStepFailed         ExecutionEventType = "step.failed"
+)
+
+// Terminal reports whether no further events follow an event of this type
+func (t ExecutionEventType) Terminal() bool {
+	return t == EventExecutionSucceeded || t == EventExecutionFailed || t == EventExecutionCanceled
+}
+
+// ExecutionEvent is one state change of an execution, as streamed to clients.
+// Seq orders the events of one execution from 1, so a reconnecting client can
+// resume after the last one it saw. Step fields are
+// set on step events only; Output and Error on the events that finish something.
+type ExecutionEvent struct {
+	Seq         int64              `json:"seq"`
+	ExecutionID string             `json:"execution_id"`
+	Workflow    string             `json:"workflow,omitempty"`
+	Type        ExecutionEventType `json:"type"`
+	Status      ExecutionStatus    `json:"status"`
+	Step        string             `json:"step,omitempty"`
+	StepIndex   *int               `json:"step_index,omitempty"`
+	Lambda      string             `json:"lambda,omitempty"`
+	Attempt     int                `json:"attempt,omitempty"`
+	Output      json.RawMessage    `json:"output,omitempty"`
+	Error       *WorkflowError     `json:"error,omitempty"`
+	Timestamp   time.Time          `json:"timestamp"`
+}
+
+// ListExecutionsInput represents the filters and pagination for listing executions
+type ListExecutionsInput struct {
+	PageRequest
+	OrderBy       string            `json:"order_by,omitempty"`
+	Descending    bool              `json:"descending,omitempty"`
+	Workflow      string            `json:"workflow,omitempty"`
+	Status        ExecutionStatus   `json:"status,omitempty"`
+	ErrorCode     WorkflowErrorCode `json:"error_code,omitempty"`
+	CreatedAfter  *time.Time        `json:"created_after,omitempty"`
+	CreatedBefore *time.Time        `json:"created_before,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	ReplayOf      string            `json:"replay_of,omitempty"`
+}
+
+// ListExecutionsOutput represents one page of executions along with the total number of matches
+type ListExecutionsOutput = ListResponse[*Execution]
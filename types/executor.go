@@ -1,19 +1,91 @@
 package types
 
-// Step represents a single step in a workflow
-type Step struct {
+import (
+	"fmt"
+	"time"
+)
+
+// Workflow represents a complete workflow definition. Load it with
+// ParseWorkflow so older schema versions are upgraded first.
+type Workflow struct {
+	SchemaVersion int    `yaml:"schema_version"`
 	Name          string `yaml:"name"`
-	Lambda        string `yaml:"lambda"`
-	InputTemplate string `yaml:"input_template"`
-	PassOutputAs  string `yaml:"pass_output_as"`
-	ErrorHandler  string `yaml:"error_handler,omitempty"`
+	Description   string `yaml:"description"`
+	// Inputs maps input fields to the utils/validate rules they must pass,
+	// such as email: required,email
+	Inputs map[string]string `yaml:"inputs,omitempty"`
+	// Singleton allows only one execution of the workflow at a time across
+	// every server, such as for a nightly reconciliation
+	Singleton bool `yaml:"singleton,omitempty"`
+	// MaxConcurrentExecutions, when set, caps how many executions of the
+	// workflow run at a time across every server, such as to stay within a
+	// downstream API's rate limit
+	MaxConcurrentExecutions int `yaml:"max_concurrent_executions,omitempty"`
+	// Priority is the priority of the workflow's durable executions when the
+	// request starting one sets none: low, normal (the default) or high
+	Priority ExecutionPriority `yaml:"priority,omitempty"`
+	// Config holds settings templates read as {{ .Config.name }}, such as
+	// endpoints and thresholds. WORKFLOW_CONFIG_<WORKFLOW>_<NAME> overrides
+	// a top-level value when the workflow loads.
+	Config map[string]interface{} `yaml:"config,omitempty"`
+	// RetryBudget caps how many step retries and hedged calls one execution
+	// makes in all, so retries cannot multiply load on lambdas that are
+	// already failing. Unset, it is EXECUTION_RETRY_BUDGET (10 by default).
+	RetryBudget *int `yaml:"retry_budget,omitempty"`
+	// Disabled rejects new executions of the workflow with WORKFLOW_DISABLED,
+	// such as while a downstream system is out of service. Executions already
+	// queued still run.
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Deprecated marks a workflow being retired. It still runs, but callers
+	// are warned in response headers and its executions are counted.
+	Deprecated *Deprecation `yaml:"deprecated,omitempty"`
+	Steps      []Step       `yaml:"steps"`
 }
 
-// Workflow represents a complete workflow definition
-type Workflow struct {
-	Name        string `yaml:"name"`
-	Description string `yaml:"description"`
-	Steps       []Step `yaml:"steps"`
+// StepIndex returns the index of the named step, or -1 when there is none
+func (w Workflow) StepIndex(name string) int {
+	for i, step := range w.Steps {
+		if step.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsErrorHandler reports whether a step's on_error names the step at i. Such
+// steps only run as handlers and are skipped in the workflow's normal order.
+func (w Workflow) IsErrorHandler(i int) bool {
+	for _, step := range w.Steps {
+		for _, handler := range step.OnError {
+			if handler == w.Steps[i].Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Deprecation describes how a deprecated workflow is being retired
+type Deprecation struct {
+	Message string `yaml:"message"`
+	// Sunset is the date (YYYY-MM-DD) or RFC 3339 time after which the
+	// workflow may be removed
+	Sunset string `yaml:"sunset,omitempty"`
+}
+
+// SunsetTime parses Sunset, returning the zero time when it is unset
+func (d Deprecation) SunsetTime() (time.Time, error) {
+	if d.Sunset == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, d.Sunset); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, d.Sunset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("sunset must be a date (YYYY-MM-DD) or RFC 3339 time")
+	}
+	return t, nil
 }
 
 // WorkflowState represents the state of a workflow execution
@@ -21,36 +93,103 @@ type WorkflowState struct {
 	Steps       map[string]StepState `json:"steps"`
 	CurrentStep string               `json:"current_step"`
 	Completed   bool                 `json:"completed"`
+	// Data is what templates read: the workflow input under "input" and the
+	// output of each step that succeeded under its OutputKey. A step writing
+	// a key an earlier step wrote replaces that value; nothing else is
+	// overwritten, so every step's output stays readable to the end.
+	Data map[string]interface{} `json:"data,omitempty"`
+	// Calls holds the output of each successful lambda call a dedupe step
+	// made, by lambda and input hash, for later dedupe steps to reuse
+	Calls map[string]map[string]interface{} `json:"calls,omitempty"`
+	// Config is the workflow's config as of the execution's start
+	Config map[string]interface{} `json:"config,omitempty"`
+	// Vars starts with the caller's context vars and holds the values set
+	// steps store, read by templates as .Vars
+	Vars map[string]interface{} `json:"vars,omitempty"`
+	// RetryBudget is the workflow's retry budget as of the execution's start,
+	// nil for executions started before budgets existed, which have none.
+	// Retries counts the retries and hedged calls spent from it.
+	RetryBudget *int `json:"retry_budget,omitempty"`
+	Retries     int  `json:"retries,omitempty"`
 }
 
-// StepState represents the state of a single step execution
+// RetryAllowed reports whether the retry budget has room for another retry
+// or hedged call
+func (s *WorkflowState) RetryAllowed() bool {
+	return s.RetryBudget == nil || s.Retries < *s.RetryBudget
+}
+
+// StepState represents the state of a single step execution. Headers holds
+// the response headers the step's capture_headers lists that its lambda sent.
 type StepState struct {
-	Input  WorkflowInput  `json:"input"`
-	Output WorkflowOutput `json:"output"`
+	Input   WorkflowInput     `json:"input"`
+	Output  WorkflowOutput    `json:"output"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 // WorkflowInput represents the input to a workflow
 type WorkflowInput struct {
 	Data    map[string]interface{} `json:"data"`
-	Context map[string]interface{} `json:"context"`
+	Context ExecutionContext       `json:"context"`
 }
 
 // WorkflowOutput represents the output of a workflow
 type WorkflowOutput struct {
 	Data    map[string]interface{} `json:"data"`
-	Context map[string]interface{} `json:"context"`
+	Context ExecutionContext       `json:"context"`
 	Error   *WorkflowError         `json:"error,omitempty"`
 }
 
 // WorkflowError represents an error in workflow execution
 type WorkflowError struct {
-	Step    string `json:"step"`
-	Message string `json:"message"`
-	Code    string `json:"code"`
+	Step    string            `json:"step"`
+	Message string            `json:"message"`
+	Code    WorkflowErrorCode `json:"code"`
 }
 
-// StepResult represents the result of a single step execution
+// StepResult represents the result of a single step execution. Headers are
+// the captured response headers, which are not part of what lambdas send.
+// Metrics are measurements the lambda reports alongside its output.
 type StepResult struct {
-	Data  map[string]interface{} `json:"data"`
-	Error *WorkflowError         `json:"error,omitempty"`
+	Data    map[string]interface{} `json:"data"`
+	Error   *WorkflowError         `json:"error,omitempty"`
+	Metrics []StepMetric           `json:"metrics,omitempty"`
+	Headers map[string]string      `json:"-"`
+}
+
+// StepMetricType is how the orchestrator records a StepMetric
+type StepMetricType string
+
+const (
+	// StepMetricCounter adds the value to a running total
+	StepMetricCounter StepMetricType = "counter"
+	// StepMetricGauge replaces the last value
+	StepMetricGauge StepMetricType = "gauge"
+)
+
+// StepMetric is a measurement a lambda reports with its result, such as the
+// users it created, which the orchestrator exposes on /metrics. Type
+// defaults to counter.
+type StepMetric struct {
+	Name   string            `json:"name"`
+	Type   StepMetricType    `json:"type,omitempty"`
+	Value  float64           `json:"value"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ValidMetricName reports whether name can be used as a Prometheus metric or
+// label name
+func ValidMetricName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
 }
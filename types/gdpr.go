@@ -0,0 +1,25 @@
+package types
+
+// GDPR erase operations, run in this order by the gdpr_erase workflow
+const (
+	GDPREraseOpAnonymize = "anonymize"
+	GDPREraseOpPurge     = "purge"
+)
+
+// GDPREraseInput represents the input for one step of erasing a user.
+// Anonymize scrubs the user's PII and signs them out; purge clears the
+// payloads of their audit entries and of the executions those entries name.
+type GDPREraseInput struct {
+	Operation string `json:"operation" validate:"required,enum=anonymize purge"`
+	UserID    int    `json:"user_id" validate:"required"`
+}
+
+// GDPREraseOutput represents the output of the gdpr_erase lambda
+type GDPREraseOutput struct {
+	UserID        int   `json:"user_id"`
+	User          *User `json:"user,omitempty"`
+	RevokedTokens int   `json:"revoked_tokens,omitempty"`
+	AuditEntries  int   `json:"audit_entries,omitempty"`
+	Executions    int   `json:"executions,omitempty"`
+	Steps         int   `json:"steps,omitempty"`
+}
@@ -0,0 +1,49 @@
+package types
+
+import "encoding/json"
+
+// Error codes returned by the notify lambdas
+const (
+	ErrorCodeTemplateNotFound = "TEMPLATE_NOT_FOUND"
+	ErrorCodeTemplateInvalid  = "TEMPLATE_INVALID"
+	ErrorCodeEmailSendFailed  = "EMAIL_SEND_FAILED"
+	ErrorCodeWebhookFailed    = "WEBHOOK_FAILED"
+	ErrorCodeHostNotAllowed   = "HOST_NOT_ALLOWED"
+)
+
+// SendEmailInput represents the input for sending an email. Either Template
+// names a template rendered with Data, or Subject and Text or HTML are given inline.
+type SendEmailInput struct {
+	To       string                 `json:"to" validate:"required,email,max=255"`
+	Template string                 `json:"template,omitempty" validate:"max=100"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Subject  string                 `json:"subject,omitempty" validate:"max=998"`
+	Text     string                 `json:"text,omitempty"`
+	HTML     string                 `json:"html,omitempty"`
+}
+
+// SendEmailOutput represents the output of the notify_email lambda
+type SendEmailOutput struct {
+	MessageID string `json:"message_id"`
+	Provider  string `json:"provider"`
+	To        string `json:"to"`
+}
+
+// WebhookInput represents the input for sending a webhook. The body is either
+// Payload as-is, or Template rendered with Data, which must produce valid JSON.
+type WebhookInput struct {
+	URL      string                 `json:"url" validate:"required,notblank,max=2048"`
+	Method   string                 `json:"method,omitempty"`
+	Headers  map[string]string      `json:"headers,omitempty"`
+	Payload  json.RawMessage        `json:"payload,omitempty"`
+	Template string                 `json:"template,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookOutput represents the output of the webhook_send lambda
+type WebhookOutput struct {
+	DeliveryID string `json:"delivery_id"`
+	Status     int    `json:"status"`
+	Attempts   int    `json:"attempts"`
+	Response   string `json:"response,omitempty"`
+}
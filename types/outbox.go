@@ -0,0 +1,20 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is an event stored for delivery to one sink. Topic names the
+// event, such as execution.succeeded, and Payload is its JSON body.
+type OutboxEvent struct {
+	ID          int64           `json:"id"`
+	TenantID    string          `json:"tenant_id"`
+	Sink        string          `json:"sink"`
+	Topic       string          `json:"topic"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// PageRequest selects one page of a list. Cursor is opaque: leave it empty for
+// the first page and pass the previous page's NextCursor for the next one.
+// Limit is clamped to the server's bounds, and the default applies when it is unset.
+type PageRequest struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Page describes the page held by a ListResponse. NextCursor is empty on the last page.
+type Page struct {
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListResponse is one page of a list endpoint's results
+type ListResponse[T any] struct {
+	Items []T  `json:"items"`
+	Page  Page `json:"page"`
+}
+
+// cursorPrefix versions the cursor encoding so it can change without
+// misreading cursors issued by an older server
+const cursorPrefix = "o1:"
+
+// ErrInvalidCursor is returned for a cursor this server did not issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// OffsetCursor returns the cursor that resumes a list at offset
+func OffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// Offset decodes the cursor into the offset the page starts at, 0 for an empty cursor
+func (r PageRequest) Offset() (int, error) {
+	if r.Cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(r.Cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	value, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// NewListResponse wraps the page of items that starts at offset. It sets
+// NextCursor when items remain past this page.
+func NewListResponse[T any](items []T, total, limit, offset int) ListResponse[T] {
+	if items == nil {
+		items = []T{}
+	}
+	page := Page{Limit: limit, Total: total}
+	if next := offset + len(items); len(items) > 0 && next < total {
+		page.NextCursor = OffsetCursor(next)
+	}
+	return ListResponse[T]{Items: items, Page: page}
+}
@@ -0,0 +1,34 @@
+package types
+
+import "time"
+
+// Quota holds the monthly limits of a tenant (APIKeyID 0) or one of its API
+// keys. A nil limit falls back to the server default for a tenant and is
+// unlimited for a key; a limit of 0 is unlimited.
+type Quota struct {
+	TenantID          string    `json:"tenant_id"`
+	APIKeyID          int64     `json:"api_key_id,omitempty"`
+	MonthlyExecutions *int64    `json:"monthly_executions,omitempty"`
+	MonthlySteps      *int64    `json:"monthly_steps,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Usage counts the executions and step invocations of a tenant (APIKeyID 0)
+// or one of its API keys in one month, with the limits that apply to it
+// (0 when unlimited)
+type Usage struct {
+	TenantID       string `json:"tenant_id"`
+	APIKeyID       int64  `json:"api_key_id,omitempty"`
+	Month          string `json:"month"`
+	Executions     int64  `json:"executions"`
+	Steps          int64  `json:"steps"`
+	ExecutionLimit int64  `json:"execution_limit,omitempty"`
+	StepLimit      int64  `json:"step_limit,omitempty"`
+}
+
+// UsageOutput represents one month's usage of one tenant or of every tenant,
+// with each tenant's total before the usage of its API keys
+type UsageOutput struct {
+	Month string  `json:"month"`
+	Usage []Usage `json:"usage"`
+}
@@ -0,0 +1,31 @@
+package types
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Recording is an execution captured with every lambda call it made, so a
+// changed workflow definition can be run against the same responses offline
+// and its output compared with Output
+type Recording struct {
+	Workflow   string          `json:"workflow"`
+	Input      WorkflowInput   `json:"input"`
+	Calls      []RecordedCall  `json:"calls"`
+	Output     *WorkflowOutput `json:"output"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+// RecordedCall is one lambda call of a Recording. Request is the rendered
+// input, kept as a JSON string when it is not JSON itself; Response holds a
+// JSON response and ResponseBase64 any other.
+type RecordedCall struct {
+	Step           string          `json:"step"`
+	Lambda         string          `json:"lambda"`
+	Request        json.RawMessage `json:"request"`
+	Status         int             `json:"status"`
+	Header         http.Header     `json:"header,omitempty"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	ResponseBase64 string          `json:"response_base64,omitempty"`
+}
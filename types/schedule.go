@@ -0,0 +1,44 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Schedule starts a workflow with a fixed input each time its cron
+// expression fires, evaluated in Timezone. NextRunAt is nil while the
+// schedule is paused.
+type Schedule struct {
+	ID              string          `json:"id"`
+	TenantID        string          `json:"tenant_id"`
+	Workflow        string          `json:"workflow"`
+	Cron            string          `json:"cron"`
+	Timezone        string          `json:"timezone"`
+	Input           json.RawMessage `json:"input"`
+	Paused          bool            `json:"paused"`
+	NextRunAt       *time.Time      `json:"next_run_at,omitempty"`
+	LastRunAt       *time.Time      `json:"last_run_at,omitempty"`
+	LastExecutionID string          `json:"last_execution_id,omitempty"`
+	LastError       string          `json:"last_error,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// CreateScheduleInput represents the input for creating a schedule.
+// Timezone is an IANA name such as Europe/Lisbon and defaults to UTC.
+type CreateScheduleInput struct {
+	Workflow string                 `json:"workflow"`
+	Cron     string                 `json:"cron"`
+	Timezone string                 `json:"timezone,omitempty"`
+	Input    map[string]interface{} `json:"input,omitempty"`
+}
+
+// UpdateScheduleInput represents a partial update of a schedule; nil fields are left unchanged
+type UpdateScheduleInput struct {
+	Cron     *string                `json:"cron,omitempty"`
+	Timezone *string                `json:"timezone,omitempty"`
+	Input    map[string]interface{} `json:"input,omitempty"`
+}
+
+// ListSchedulesOutput represents one page of schedules along with the total number of matches
+type ListSchedulesOutput = ListResponse[*Schedule]
@@ -0,0 +1,406 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StepKind selects what a workflow step does and which config block it reads
+type StepKind string
+
+const (
+	StepKindLambda      StepKind = "lambda"
+	StepKindHTTP        StepKind = "http"
+	StepKindScript      StepKind = "script"
+	StepKindSQL         StepKind = "sql"
+	StepKindWait        StepKind = "wait"
+	StepKindApproval    StepKind = "approval"
+	StepKindParallel    StepKind = "parallel"
+	StepKindSwitch      StepKind = "switch"
+	StepKindSubworkflow StepKind = "subworkflow"
+	StepKindSet         StepKind = "set"
+)
+
+// Step represents a single step in a workflow. Kind defaults to lambda, so
+// steps written before kinds existed keep working; every other kind reads its
+// settings from the config block of the same name, and InputTemplate is the
+// request body, script input or subworkflow input where the kind takes one.
+// Dedupe makes a lambda step reuse the output of an earlier dedupe step's
+// successful call to the same lambda with the same rendered input in the same
+// execution, instead of calling the lambda again. HedgeAfter makes a lambda
+// step call a second instance of its lambda when the first has not answered
+// within that duration, using whichever answers first. Flag makes the step
+// run only while that feature flag is on for the execution, or off when the
+// name starts with "!"; otherwise it is skipped. OnError maps the error codes
+// the step may fail with, and "default" for any other, to the workflow step
+// that handles them. Binary makes a lambda step accept a successful response
+// that is not JSON, keeping its body base64-encoded in the step output, or
+// with blob in object storage, instead of failing with INVALID_RESPONSE_TYPE.
+// CaptureHeaders names lambda response headers to keep in the step's state.
+// SuccessCodes lists the lambda response statuses the step succeeds with,
+// only 200 by default, and StatusCodes maps others to the error code the step
+// fails with, such as 404 to USER_NOT_FOUND, for on_error to branch on.
+// MetricLabels are added to the metrics the step's lambda reports.
+type Step struct {
+	Name          string     `yaml:"name"`
+	Kind          StepKind   `yaml:"kind,omitempty"`
+	Lambda        string     `yaml:"lambda,omitempty"`
+	InputTemplate string     `yaml:"input_template,omitempty"`
+	PassOutputAs  string     `yaml:"pass_output_as,omitempty"`
+	ErrorHandler  string     `yaml:"error_handler,omitempty"`
+	Dedupe        bool       `yaml:"dedupe,omitempty"`
+	HedgeAfter    string     `yaml:"hedge_after,omitempty"`
+	Flag          string     `yaml:"flag,omitempty"`
+	Binary        BinaryMode `yaml:"binary,omitempty"`
+
+	CaptureHeaders []string                  `yaml:"capture_headers,omitempty"`
+	SuccessCodes   []int                     `yaml:"success_codes,omitempty"`
+	StatusCodes    map[int]WorkflowErrorCode `yaml:"status_codes,omitempty"`
+	MetricLabels   map[string]string         `yaml:"metric_labels,omitempty"`
+
+	OnError map[WorkflowErrorCode]string `yaml:"on_error,omitempty"`
+
+	HTTP        *HTTPStep        `yaml:"http,omitempty"`
+	Script      *ScriptStep      `yaml:"script,omitempty"`
+	SQL         *SQLStep         `yaml:"sql,omitempty"`
+	Wait        *WaitStep        `yaml:"wait,omitempty"`
+	Approval    *ApprovalStep    `yaml:"approval,omitempty"`
+	Parallel    *ParallelStep    `yaml:"parallel,omitempty"`
+	Switch      *SwitchStep      `yaml:"switch,omitempty"`
+	Subworkflow *SubworkflowStep `yaml:"subworkflow,omitempty"`
+	Set         *SetStep         `yaml:"set,omitempty"`
+}
+
+// BinaryMode selects where a lambda step keeps a response that is not JSON
+type BinaryMode string
+
+const (
+	// BinaryInline keeps the body in the step output as content_base64
+	BinaryInline BinaryMode = "inline"
+	// BinaryBlob stores the body in object storage and keeps its bucket and key
+	BinaryBlob BinaryMode = "blob"
+)
+
+// HTTPStep calls an external URL. URL and Headers are templates.
+type HTTPStep struct {
+	Method  string            `yaml:"method,omitempty"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Timeout string            `yaml:"timeout,omitempty"`
+}
+
+// ScriptStep evaluates an expression over the step input. Only jq is supported.
+type ScriptStep struct {
+	Language string `yaml:"language,omitempty"`
+	Source   string `yaml:"source"`
+}
+
+// SQLStep runs a parameterized query. Params are templates bound in order to $1, $2, ...
+type SQLStep struct {
+	Query    string   `yaml:"query"`
+	Params   []string `yaml:"params,omitempty"`
+	ReadOnly bool     `yaml:"read_only,omitempty"`
+}
+
+// WaitStep pauses the workflow for Duration, or until the time Until renders to
+type WaitStep struct {
+	Duration string `yaml:"duration,omitempty"`
+	Until    string `yaml:"until,omitempty"`
+}
+
+// ApprovalStep pauses the workflow until one of Approvers approves or rejects it
+type ApprovalStep struct {
+	Approvers []string `yaml:"approvers"`
+	Message   string   `yaml:"message,omitempty"`
+	Timeout   string   `yaml:"timeout,omitempty"`
+}
+
+// ParallelStep runs its branches concurrently and waits for all of them
+type ParallelStep struct {
+	Branches []Branch `yaml:"branches"`
+}
+
+// Branch is a named sequence of steps inside a parallel or switch step
+type Branch struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// SwitchStep runs the steps of the first case whose When template renders
+// "true", or Default when none does
+type SwitchStep struct {
+	Cases   []SwitchCase `yaml:"cases"`
+	Default []Step       `yaml:"default,omitempty"`
+}
+
+// SwitchCase is one branch of a switch step
+type SwitchCase struct {
+	When  string `yaml:"when"`
+	Steps []Step `yaml:"steps"`
+}
+
+// SubworkflowStep runs another workflow with InputTemplate as its input
+type SubworkflowStep struct {
+	Workflow string `yaml:"workflow"`
+}
+
+// SetStep stores variables that every later step's templates read as
+// {{ .Vars.name }}. Each value is a template; a rendered value that parses as
+// JSON, such as a number or object, is stored as parsed, and any other as a
+// string. All values are rendered before any is stored.
+type SetStep struct {
+	Vars map[string]string `yaml:"vars"`
+}
+
+// ReservedOutputKeys are template names a step's output cannot be stored under
+var ReservedOutputKeys = []string{"input", "Config", "Vars", "Steps"}
+
+// OutputKey is the name later templates read the step's output under:
+// PassOutputAs, or the step name when it is unset
+func (s Step) OutputKey() string {
+	if s.PassOutputAs != "" {
+		return s.PassOutputAs
+	}
+	return s.Name
+}
+
+// FlagName returns the feature flag the step is conditioned on, and whether
+// the step runs while it is off rather than on
+func (s Step) FlagName() (string, bool) {
+	name, negated := strings.CutPrefix(s.Flag, "!")
+	return name, negated
+}
+
+// Succeeded reports whether the step succeeds when its lambda answers with
+// status
+func (s Step) Succeeded(status int) bool {
+	if len(s.SuccessCodes) == 0 {
+		return status == http.StatusOK
+	}
+	return slices.Contains(s.SuccessCodes, status)
+}
+
+// OnErrorDefault is the OnError key of the handler for codes not listed
+const OnErrorDefault WorkflowErrorCode = "default"
+
+// HandlerFor returns the name of the step OnError hands an error with code
+// to, or "" when it names none
+func (s Step) HandlerFor(code WorkflowErrorCode) string {
+	if handler, ok := s.OnError[code]; ok {
+		return handler
+	}
+	return s.OnError[OnErrorDefault]
+}
+
+// EffectiveKind returns Kind, or lambda when it is unset
+func (s Step) EffectiveKind() StepKind {
+	if s.Kind == "" {
+		return StepKindLambda
+	}
+	return s.Kind
+}
+
+// UnmarshalYAML decodes a step and validates it for its kind
+func (s *Step) UnmarshalYAML(value *yaml.Node) error {
+	type plain Step
+	var decoded plain
+	if err := value.Decode(&decoded); err != nil {
+		return err
+	}
+	step := Step(decoded)
+	if err := step.Validate(); err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	*s = step
+	return nil
+}
+
+// Validate checks that the step names a known kind, has that kind's required
+// fields, and sets no config block belonging to another kind
+func (s Step) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("step name is required")
+	}
+	kind := s.EffectiveKind()
+
+	blocks := map[StepKind]bool{
+		StepKindHTTP:        s.HTTP != nil,
+		StepKindScript:      s.Script != nil,
+		StepKindSQL:         s.SQL != nil,
+		StepKindWait:        s.Wait != nil,
+		StepKindApproval:    s.Approval != nil,
+		StepKindParallel:    s.Parallel != nil,
+		StepKindSwitch:      s.Switch != nil,
+		StepKindSubworkflow: s.Subworkflow != nil,
+		StepKindSet:         s.Set != nil,
+	}
+	for other, set := range blocks {
+		if set && other != kind {
+			return fmt.Errorf("step %s of kind %s must not have a %s block", s.Name, kind, other)
+		}
+	}
+	if slices.Contains(ReservedOutputKeys, s.OutputKey()) {
+		return fmt.Errorf("step %s cannot store its output as %s, which is reserved; set pass_output_as", s.Name, s.OutputKey())
+	}
+	if kind != StepKindLambda && s.Lambda != "" {
+		return fmt.Errorf("step %s of kind %s must not name a lambda", s.Name, kind)
+	}
+	if kind != StepKindLambda && s.Dedupe {
+		return fmt.Errorf("step %s of kind %s cannot dedupe; only lambda steps can", s.Name, kind)
+	}
+	if name, _ := s.FlagName(); s.Flag != "" && strings.TrimSpace(name) == "" {
+		return fmt.Errorf("step %s has an empty flag name", s.Name)
+	}
+	for code, handler := range s.OnError {
+		if strings.TrimSpace(string(code)) == "" || strings.TrimSpace(handler) == "" {
+			return fmt.Errorf("step %s has an on_error entry without a code or step", s.Name)
+		}
+		if handler == s.Name {
+			return fmt.Errorf("step %s cannot handle its own errors", s.Name)
+		}
+	}
+	switch s.Binary {
+	case "", BinaryInline, BinaryBlob:
+	default:
+		return fmt.Errorf("step %s has unsupported binary %q (expected inline or blob)", s.Name, s.Binary)
+	}
+	if kind != StepKindLambda && s.Binary != "" {
+		return fmt.Errorf("step %s of kind %s cannot take binary responses; only lambda steps can", s.Name, kind)
+	}
+	if kind != StepKindLambda && len(s.CaptureHeaders) > 0 {
+		return fmt.Errorf("step %s of kind %s cannot capture headers; only lambda steps can", s.Name, kind)
+	}
+	for _, header := range s.CaptureHeaders {
+		if strings.TrimSpace(header) == "" {
+			return fmt.Errorf("step %s captures a header with an empty name", s.Name)
+		}
+	}
+	if kind != StepKindLambda && (len(s.SuccessCodes) > 0 || len(s.StatusCodes) > 0) {
+		return fmt.Errorf("step %s of kind %s cannot set success_codes or status_codes; only lambda steps can", s.Name, kind)
+	}
+	for _, status := range s.SuccessCodes {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("step %s has invalid success code %d", s.Name, status)
+		}
+	}
+	for status, code := range s.StatusCodes {
+		if status < 100 || status > 599 || s.Succeeded(status) {
+			return fmt.Errorf("step %s maps status %d, which is invalid or a success code", s.Name, status)
+		}
+		if strings.TrimSpace(string(code)) == "" {
+			return fmt.Errorf("step %s maps status %d to an empty error code", s.Name, status)
+		}
+	}
+	if kind != StepKindLambda && len(s.MetricLabels) > 0 {
+		return fmt.Errorf("step %s of kind %s cannot set metric_labels; only lambda steps report metrics", s.Name, kind)
+	}
+	for label := range s.MetricLabels {
+		if !ValidMetricName(label) || label == "lambda" || label == "step" {
+			return fmt.Errorf("step %s has invalid or reserved metric label %q", s.Name, label)
+		}
+	}
+	if kind != StepKindLambda && s.HedgeAfter != "" {
+		return fmt.Errorf("step %s of kind %s cannot hedge; only lambda steps can", s.Name, kind)
+	}
+
+	missing := func(field string) error {
+		return fmt.Errorf("step %s of kind %s requires %s", s.Name, kind, field)
+	}
+	switch kind {
+	case StepKindLambda:
+		if s.Lambda == "" {
+			return missing("lambda")
+		}
+		if err := validDuration(s.Name, "hedge_after", s.HedgeAfter); err != nil {
+			return err
+		}
+	case StepKindHTTP:
+		if s.HTTP == nil || s.HTTP.URL == "" {
+			return missing("http.url")
+		}
+		switch strings.ToUpper(s.HTTP.Method) {
+		case "", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead:
+		default:
+			return fmt.Errorf("step %s has unsupported http.method %q", s.Name, s.HTTP.Method)
+		}
+		if err := validDuration(s.Name, "http.timeout", s.HTTP.Timeout); err != nil {
+			return err
+		}
+	case StepKindScript:
+		if s.Script == nil || strings.TrimSpace(s.Script.Source) == "" {
+			return missing("script.source")
+		}
+		if s.Script.Language != "" && s.Script.Language != "jq" {
+			return fmt.Errorf("step %s has unsupported script.language %q (expected jq)", s.Name, s.Script.Language)
+		}
+	case StepKindSQL:
+		if s.SQL == nil || strings.TrimSpace(s.SQL.Query) == "" {
+			return missing("sql.query")
+		}
+	case StepKindWait:
+		if s.Wait == nil || (s.Wait.Duration == "") == (s.Wait.Until == "") {
+			return missing("exactly one of wait.duration and wait.until")
+		}
+		if err := validDuration(s.Name, "wait.duration", s.Wait.Duration); err != nil {
+			return err
+		}
+	case StepKindApproval:
+		if s.Approval == nil || len(s.Approval.Approvers) == 0 {
+			return missing("approval.approvers")
+		}
+		if err := validDuration(s.Name, "approval.timeout", s.Approval.Timeout); err != nil {
+			return err
+		}
+	case StepKindParallel:
+		if s.Parallel == nil || len(s.Parallel.Branches) == 0 {
+			return missing("parallel.branches")
+		}
+		for i, branch := range s.Parallel.Branches {
+			if branch.Name == "" || len(branch.Steps) == 0 {
+				return fmt.Errorf("step %s branch %d requires a name and steps", s.Name, i)
+			}
+		}
+	case StepKindSwitch:
+		if s.Switch == nil || len(s.Switch.Cases) == 0 {
+			return missing("switch.cases")
+		}
+		for i, c := range s.Switch.Cases {
+			if strings.TrimSpace(c.When) == "" || len(c.Steps) == 0 {
+				return fmt.Errorf("step %s case %d requires when and steps", s.Name, i)
+			}
+		}
+	case StepKindSubworkflow:
+		if s.Subworkflow == nil || s.Subworkflow.Workflow == "" {
+			return missing("subworkflow.workflow")
+		}
+	case StepKindSet:
+		if s.Set == nil || len(s.Set.Vars) == 0 {
+			return missing("set.vars")
+		}
+		for name := range s.Set.Vars {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("step %s sets a variable with an empty name", s.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("step %s has unknown kind %q", s.Name, s.Kind)
+	}
+	return nil
+}
+
+// validDuration checks an optional duration field
+func validDuration(step, field, value string) error {
+	if value == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		return fmt.Errorf("step %s has invalid %s %q", step, field, value)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package types
+
+// Storage operations
+const (
+	StorageOpPut     = "put"
+	StorageOpGet     = "get"
+	StorageOpPresign = "presign"
+)
+
+// Error codes returned by the storage lambda
+const (
+	ErrorCodeObjectNotFound = "OBJECT_NOT_FOUND"
+	ErrorCodeObjectTooLarge = "OBJECT_TOO_LARGE"
+	ErrorCodeStorageFailed  = "STORAGE_FAILED"
+)
+
+// StorageInput represents the input for a storage operation. Put takes the
+// object as Content, or ContentBase64 for binary data. Presign signs Method
+// (GET or PUT) for ExpiresIn seconds.
+type StorageInput struct {
+	Operation     string `json:"operation" validate:"required,enum=put get presign"`
+	Key           string `json:"key" validate:"required,notblank,max=900"`
+	Content       string `json:"content,omitempty"`
+	ContentBase64 string `json:"content_base64,omitempty"`
+	ContentType   string `json:"content_type,omitempty" validate:"max=255"`
+	Method        string `json:"method,omitempty"`
+	ExpiresIn     int    `json:"expires_in,omitempty"`
+}
+
+// StorageOutput represents the output of the storage lambda. Get returns text
+// objects in Content and anything else in ContentBase64.
+type StorageOutput struct {
+	Bucket        string `json:"bucket"`
+	Key           string `json:"key"`
+	ContentType   string `json:"content_type,omitempty"`
+	ETag          string `json:"etag,omitempty"`
+	Size          int64  `json:"size,omitempty"`
+	Content       string `json:"content,omitempty"`
+	ContentBase64 string `json:"content_base64,omitempty"`
+	URL           string `json:"url,omitempty"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,22 @@
+package types
+
+// Error codes returned by the transform lambda
+const (
+	ErrorCodeInvalidExpression = "INVALID_EXPRESSION"
+	ErrorCodeTransformFailed   = "TRANSFORM_FAILED"
+)
+
+// TransformInput represents the input for applying a jq expression to data.
+// Vars are bound as $name inside the expression.
+type TransformInput struct {
+	Expression string                 `json:"expression" validate:"required,notblank,max=10000"`
+	Data       interface{}            `json:"data"`
+	Vars       map[string]interface{} `json:"vars,omitempty"`
+}
+
+// TransformOutput represents the output of the transform lambda. Result is
+// the first value the expression produced; Results holds all of them.
+type TransformOutput struct {
+	Result  interface{}   `json:"result"`
+	Results []interface{} `json:"results"`
+}
@@ -2,29 +2,81 @@ package types
 
 import "time"
 
+// ErrorCodeUserNotFound is the error code user lambdas return, and workflows
+// report, when the requested user does not exist
+const ErrorCodeUserNotFound = "USER_NOT_FOUND"
+
+// ErrorCodeDuplicateEmail is returned when another active user already has the email
+const ErrorCodeDuplicateEmail = "DUPLICATE_EMAIL"
+
+// UserStatus is the lifecycle state of a user account
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	UserStatusPending   UserStatus = "pending"
+)
+
+// Valid reports whether s is one of the known statuses
+func (s UserStatus) Valid() bool {
+	switch s {
+	case UserStatusActive, UserStatusSuspended, UserStatusPending:
+		return true
+	}
+	return false
+}
+
 // User represents a user in the system
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int                    `json:"id"`
+	TenantID  string                 `json:"tenant_id"`
+	Email     string                 `json:"email"`
+	Name      string                 `json:"name"`
+	Status    UserStatus             `json:"status"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	DeletedAt *time.Time             `json:"deleted_at,omitempty"`
 }
 
-// CreateUserInput represents the input for creating a user
+// CreateUserInput represents the input for creating a user.
+// Status defaults to active and Metadata to an empty object.
 type CreateUserInput struct {
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	Email    string                 `json:"email" yaml:"email" validate:"required,email,max=255"`
+	Name     string                 `json:"name" yaml:"name" validate:"required,notblank,max=255"`
+	Status   UserStatus             `json:"status,omitempty" yaml:"status,omitempty" validate:"omitempty,enum"`
+	Metadata map[string]interface{} `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
-// UpdateUserInput represents the input for updating a user
+// BulkCreateUsersInput represents the input for creating many users at once
+type BulkCreateUsersInput struct {
+	Users []CreateUserInput `json:"users"`
+}
+
+// UpdateUserInput represents the input for updating a user.
+// Nil fields are left unchanged; a non-nil Metadata replaces the stored object.
+// ID names the user in a POST, as workflow steps send, rather than the path.
 type UpdateUserInput struct {
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	ID       int                    `json:"id,omitempty"`
+	Email    *string                `json:"email,omitempty" validate:"omitnil,notblank,email,max=255"`
+	Name     *string                `json:"name,omitempty" validate:"omitnil,notblank,max=255"`
+	Status   *UserStatus            `json:"status,omitempty" validate:"omitnil,enum"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
-// DeleteUserInput represents the input for deleting a user
+// DeleteUserInput represents the input for deleting a user.
+// Users are soft-deleted unless Hard is set. Cascade also revokes the user's
+// refresh tokens in the same transaction, so a soft-deleted user is signed out
+// everywhere; audit history is always kept.
 type DeleteUserInput struct {
+	ID      int  `json:"id"`
+	Hard    bool `json:"hard,omitempty"`
+	Cascade bool `json:"cascade,omitempty"`
+}
+
+// RestoreUserInput represents the input for restoring a soft-deleted user
+type RestoreUserInput struct {
 	ID int `json:"id"`
 }
 
@@ -33,6 +85,29 @@ type ReadUserInput struct {
 	ID int `json:"id"`
 }
 
+// ListUsersInput represents the input for listing users.
+// OrderBy must be one of id, email, name, status, created_at or updated_at;
+// email is unavailable when emails are encrypted at rest.
+// EmailPrefix is unavailable when emails are encrypted at rest; Email matches exactly.
+// Metadata matches users whose metadata contains the given object.
+type ListUsersInput struct {
+	PageRequest
+	OrderBy      string                 `json:"order_by,omitempty"`
+	Descending   bool                   `json:"descending,omitempty"`
+	Email        string                 `json:"email,omitempty"`
+	EmailPrefix  string                 `json:"email_prefix,omitempty"`
+	CreatedAfter *time.Time             `json:"created_after,omitempty"`
+	Status       UserStatus             `json:"status,omitempty" validate:"omitempty,enum"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SearchUsersInput represents the input for searching users by name or email
+type SearchUsersInput struct {
+	Query         string  `json:"query"`
+	Limit         int     `json:"limit,omitempty"`
+	MinSimilarity float64 `json:"min_similarity,omitempty"`
+}
+
 // CreateUserOutput represents the output of creating a user
 type CreateUserOutput struct {
 	User User `json:"user"`
@@ -50,5 +125,41 @@ type UpdateUserOutput struct {
 
 // DeleteUserOutput represents the output of deleting a user
 type DeleteUserOutput struct {
-	Success bool `json:"success"`
+	Success       bool `json:"success"`
+	Hard          bool `json:"hard"`
+	RevokedTokens int  `json:"revoked_tokens"`
+}
+
+// RestoreUserOutput represents the output of restoring a user
+type RestoreUserOutput struct {
+	User User `json:"user"`
+}
+
+// ListUsersOutput represents one page of users along with the total number of matches
+type ListUsersOutput = ListResponse[*User]
+
+// UserSearchResult is a single search match with its similarity rank
+type UserSearchResult struct {
+	User User    `json:"user"`
+	Rank float64 `json:"rank"`
+}
+
+// SearchUsersOutput represents the ranked results of a user search
+type SearchUsersOutput struct {
+	Results []UserSearchResult `json:"results"`
+}
+
+// BulkCreateUserResult reports the outcome of one row of a bulk create.
+// Exactly one of User and Error is set.
+type BulkCreateUserResult struct {
+	Index int    `json:"index"`
+	User  *User  `json:"user,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// BulkCreateUsersOutput represents the per-row results of a bulk create
+type BulkCreateUsersOutput struct {
+	Results []BulkCreateUserResult `json:"results"`
+	Created int                    `json:"created"`
+	Failed  int                    `json:"failed"`
 }
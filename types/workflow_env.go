@@ -0,0 +1,61 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// workflowEnvPattern matches ${NAME}, ${NAME:-default} and the escape $${
+var workflowEnvPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolateWorkflowEnv replaces ${NAME} in every scalar of a workflow
+// document with the NAME environment variable, or with default in
+// ${NAME:-default} when it is unset or empty, and $${ with a literal ${. It
+// fails listing every variable that is unset without a default, so a workflow
+// never loads with an endpoint or constant missing. A replaced plain scalar
+// is typed by its new value, so ${MAX_RETRIES} can fill an integer field.
+// Aliases share their anchor's node, so they are left to the walk reaching it.
+func interpolateWorkflowEnv(node *yaml.Node) error {
+	var unresolved []string
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		switch n.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode, yaml.MappingNode:
+			for _, child := range n.Content {
+				walk(child)
+			}
+		case yaml.ScalarNode:
+			if !strings.Contains(n.Value, "${") {
+				return
+			}
+			n.Value = workflowEnvPattern.ReplaceAllStringFunc(n.Value, func(ref string) string {
+				if ref == "$${" {
+					return "${"
+				}
+				match := workflowEnvPattern.FindStringSubmatch(ref)
+				value, set := os.LookupEnv(match[1])
+				switch {
+				case value != "":
+					return value
+				case strings.Contains(ref, ":-"):
+					return match[2]
+				case !set:
+					unresolved = append(unresolved, fmt.Sprintf("%s (line %d)", match[1], n.Line))
+				}
+				return value
+			})
+			if n.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				n.Tag = ""
+			}
+		}
+	}
+	walk(node)
+	if len(unresolved) > 0 {
+		return fmt.Errorf("unresolved environment variables: %s", strings.Join(unresolved, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowSchemaVersion is the workflow document schema this build reads.
+// Documents without schema_version are version 1, written before steps had kinds.
+const WorkflowSchemaVersion = 2
+
+// workflowUpgrades[v] rewrites a version v document into version v+1 in place
+var workflowUpgrades = map[int]func(doc *yaml.Node) error{
+	1: upgradeWorkflowV1,
+}
+
+// ParseWorkflow decodes a workflow document, upgrading it to the current
+// schema first so steps are validated against the format this build expects.
+// YAML anchors, aliases and << merge keys are resolved, and ${NAME}
+// references replaced from the environment; see interpolateWorkflowEnv.
+func ParseWorkflow(data []byte) (*Workflow, error) {
+	doc, err := upgradeWorkflowDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := interpolateWorkflowEnv(doc); err != nil {
+		return nil, err
+	}
+	var workflow Workflow
+	if err := doc.Decode(&workflow); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// UpgradeWorkflow rewrites a workflow document at the current schema version,
+// keeping its comments and layout. It reports whether anything changed.
+func UpgradeWorkflow(data []byte) ([]byte, bool, error) {
+	version, err := workflowSchemaVersion(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if version == WorkflowSchemaVersion {
+		return data, false, nil
+	}
+	doc, err := upgradeWorkflowDocument(data)
+	if err != nil {
+		return nil, false, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, false, fmt.Errorf("failed to encode workflow: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed to encode workflow: %w", err)
+	}
+	return buf.Bytes(), true, nil
+}
+
+// workflowSchemaVersion reads and checks a document's schema_version
+func workflowSchemaVersion(data []byte) (int, error) {
+	var header struct {
+		SchemaVersion *int `yaml:"schema_version"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if header.SchemaVersion == nil {
+		return 1, nil
+	}
+	version := *header.SchemaVersion
+	if version < 1 || version > WorkflowSchemaVersion {
+		return 0, fmt.Errorf("unsupported schema_version %d (this build reads 1 to %d)", version, WorkflowSchemaVersion)
+	}
+	return version, nil
+}
+
+// upgradeWorkflowDocument parses a document and applies each upgrade from its
+// version to the current one, stamping the result with the current version
+func upgradeWorkflowDocument(data []byte) (*yaml.Node, error) {
+	version, err := workflowSchemaVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	var file yaml.Node
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Content) == 0 || file.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("workflow document must be a mapping")
+	}
+	doc := file.Content[0]
+	for v := version; v < WorkflowSchemaVersion; v++ {
+		if err := workflowUpgrades[v](doc); err != nil {
+			return nil, fmt.Errorf("failed to upgrade workflow from schema_version %d: %w", v, err)
+		}
+	}
+	setMappingValue(doc, "schema_version", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: fmt.Sprint(WorkflowSchemaVersion)}, true)
+	return &file, nil
+}
+
+// upgradeWorkflowV1 makes every step's kind explicit. Version 1 steps could
+// only call a lambda, so a step without a kind is a lambda step.
+func upgradeWorkflowV1(doc *yaml.Node) error {
+	steps := mappingValue(doc, "steps")
+	if steps == nil {
+		return nil
+	}
+	if steps.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: steps must be a list", steps.Line)
+	}
+	for _, step := range steps.Content {
+		if step.Kind == yaml.AliasNode {
+			step = step.Alias
+		}
+		if step.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: step must be a mapping", step.Line)
+		}
+		if mappingValue(step, "kind") == nil {
+			setMappingValue(step, "kind", &yaml.Node{Kind: yaml.ScalarNode, Value: string(StepKindLambda)}, false)
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets key in a mapping node, adding it after the first
+// entry (normally name) when it is missing, or first when first is set
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node, first bool) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	at := 0
+	if !first && len(mapping.Content) >= 2 {
+		at = 2
+	}
+	entry := []*yaml.Node{{Kind: yaml.ScalarNode, Value: key}, value}
+	mapping.Content = append(mapping.Content[:at], append(entry, mapping.Content[at:]...)...)
+}
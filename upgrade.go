@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"tala_base/types"
+)
+
+// defaultWorkflows is upgraded by `tala upgrade-workflows` when no files are given
+const defaultWorkflows = "workflows/*.yaml"
+
+// runUpgradeWorkflows implements the `tala upgrade-workflows [-check] [files...]`
+// command. It rewrites workflow files written against an older schema_version
+// at the current one; with -check it only lists them and fails if any are out of date.
+func runUpgradeWorkflows(args []string) error {
+	flags := flag.NewFlagSet("upgrade-workflows", flag.ContinueOnError)
+	check := flags.Bool("check", false, "list outdated workflows without rewriting them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		matches, err := filepath.Glob(defaultWorkflows)
+		if err != nil {
+			return err
+		}
+		files = matches
+	}
+
+	outdated := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read workflow file: %w", err)
+		}
+		upgraded, changed, err := types.UpgradeWorkflow(data)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade %s: %w", file, err)
+		}
+		if !changed {
+			continue
+		}
+		outdated++
+		if *check {
+			slog.Warn("Workflow is outdated", "file", file, "schema_version", types.WorkflowSchemaVersion)
+			continue
+		}
+		if err := os.WriteFile(file, upgraded, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		slog.Info("Upgraded workflow", "file", file, "schema_version", types.WorkflowSchemaVersion)
+	}
+
+	if *check && outdated > 0 {
+		return errors.New("workflows need upgrading; run `tala upgrade-workflows`")
+	}
+	slog.Info("Upgraded workflows", "upgraded", outdated, "total", len(files))
+	return nil
+}
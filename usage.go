@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tala_base/db"
+	"tala_base/types"
+	"tala_base/utils"
+)
+
+// usageMonth reads the month query parameter (YYYY-MM, default the current
+// month), writing a 400 if it is malformed
+func usageMonth(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	v := r.URL.Query().Get("month")
+	if v == "" {
+		return db.MonthOf(time.Now()), true
+	}
+	month, err := time.Parse("2006-01", v)
+	if err != nil {
+		utils.RespondError(w, r, http.StatusBadRequest, "month must be formatted as YYYY-MM")
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// handleUsage reports the request tenant's executions and step invocations
+// in the month query parameter, in total and per API key, with their quotas
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.quotas == nil {
+		utils.RespondError(w, r, http.StatusNotFound, "Usage tracking is not enabled")
+		return
+	}
+	month, ok := usageMonth(w, r)
+	if !ok {
+		return
+	}
+	ctx := db.WithTenant(r.Context(), r.Header.Get(utils.TenantHeader))
+	usage, err := s.quotas.Usage(ctx, month, false)
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to get usage")
+		return
+	}
+	utils.RespondSuccess(w, r, http.StatusOK, usage)
+}
+
+// handleAdminUsage reports usage like handleUsage for the tenant named by
+// the tenant_id query parameter, or for every tenant when it is unset, such
+// as for billing
+func (s *Server) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	tenant := r.URL.Query().Get("tenant_id")
+	if !adminTenant(w, r, tenant) {
+		return
+	}
+	month, ok := usageMonth(w, r)
+	if !ok {
+		return
+	}
+	usage, err := s.quotas.Usage(db.WithTenant(r.Context(), tenant), month, tenant == "")
+	if err != nil {
+		utils.RespondError(w, r, http.StatusInternalServerError, "Failed to get usage")
+		return
+	}
+	utils.RespondSuccess(w, r, http.StatusOK, usage)
+}
+
+// handleQuotas lists (GET) the stored quotas of the tenant named by the
+// tenant_id query parameter, or the default tenant, or sets (PUT) the
+// quota of that tenant or, with api_key_id, of one of its API keys
+func (s *Server) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant_id")
+	if !adminTenant(w, r, tenant) {
+		return
+	}
+	ctx := db.WithTenant(r.Context(), tenant)
+
+	switch r.Method {
+	case http.MethodGet:
+		quotas, err := db.ListQuotas(ctx, s.db)
+		if err != nil {
+			utils.RespondError(w, r, http.StatusInternalServerError, "Failed to list quotas")
+			return
+		}
+		utils.RespondSuccess(w, r, http.StatusOK, map[string]interface{}{"quotas": quotas})
+
+	case http.MethodPut:
+		var input types.Quota
+		if err := utils.DecodeJSONBody(w, r, &input); err != nil {
+			utils.RespondError(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if v := r.URL.Query().Get("api_key_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				utils.RespondError(w, r, http.StatusBadRequest, "Invalid API key ID")
+				return
+			}
+			input.APIKeyID = id
+		}
+		quota, err := db.SetQuota(ctx, s.db, input)
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			utils.RespondError(w, r, http.StatusNotFound, "API key not found")
+		case errors.Is(err, db.ErrInvalidArgument):
+			utils.RespondError(w, r, http.StatusBadRequest, err.Error())
+		case err != nil:
+			utils.RespondError(w, r, http.StatusInternalServerError, "Failed to set quota")
+		default:
+			utils.RespondSuccess(w, r, http.StatusOK, quota)
+		}
+
+	default:
+		utils.RespondError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
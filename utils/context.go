@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"tala_base/types"
+)
+
+// Headers that carry the rest of a types.ExecutionContext to lambdas
+const (
+	UserIDHeader      = "X-User-ID"
+	DeadlineHeader    = "X-Deadline"
+	ContextVarsHeader = "X-Context-Vars"
+	TraceparentHeader = "traceparent"
+	IdempotencyHeader = "Idempotency-Key"
+	// RemainingHeader carries the milliseconds left until the deadline when
+	// the request was sent, which unlike DeadlineHeader does not depend on
+	// the sender's and receiver's clocks agreeing
+	RemainingHeader = "X-Deadline-Remaining"
+)
+
+// SetExecutionContextHeaders writes the non-empty fields of c to h.
+// The deadline is sent as RFC 3339 and as the time remaining until it, and
+// the vars form-encoded.
+func SetExecutionContextHeaders(h http.Header, c types.ExecutionContext) {
+	set := func(key, value string) {
+		if value != "" {
+			h.Set(key, value)
+		}
+	}
+	set(ExecutionIDHeader, c.ExecutionID)
+	set(RequestIDHeader, c.RequestID)
+	set(TraceparentHeader, c.TraceParent)
+	set(TenantHeader, c.TenantID)
+	set(UserIDHeader, c.UserID)
+	set(IdempotencyHeader, c.IdempotencyKey)
+	if c.Deadline != nil {
+		h.Set(DeadlineHeader, c.Deadline.UTC().Format(time.RFC3339Nano))
+		h.Set(RemainingHeader, strconv.FormatInt(max(time.Until(*c.Deadline).Milliseconds(), 0), 10))
+	}
+	if len(c.Vars) > 0 {
+		vars := url.Values{}
+		for key, value := range c.Vars {
+			vars.Set(key, value)
+		}
+		h.Set(ContextVarsHeader, vars.Encode())
+	}
+}
+
+// ExecutionContextFromHeaders reads a context written by SetExecutionContextHeaders.
+// The deadline is taken from the remaining time when it is sent, and from
+// the deadline header otherwise. A malformed deadline or vars header is ignored.
+func ExecutionContextFromHeaders(h http.Header) types.ExecutionContext {
+	c := types.ExecutionContext{
+		ExecutionID: h.Get(ExecutionIDHeader),
+		RequestID:   h.Get(RequestIDHeader),
+		TraceParent: h.Get(TraceparentHeader),
+		TenantID:    h.Get(TenantHeader),
+		UserID:      h.Get(UserIDHeader),
+
+		IdempotencyKey: h.Get(IdempotencyHeader),
+	}
+	if ms, err := strconv.ParseInt(h.Get(RemainingHeader), 10, 64); err == nil && ms >= 0 {
+		deadline := time.Now().Add(time.Duration(ms) * time.Millisecond)
+		c.Deadline = &deadline
+	} else if deadline, err := time.Parse(time.RFC3339Nano, h.Get(DeadlineHeader)); err == nil {
+		c.Deadline = &deadline
+	}
+	if vars, err := url.ParseQuery(h.Get(ContextVarsHeader)); err == nil && len(vars) > 0 {
+		c.Vars = make(map[string]string, len(vars))
+		for key := range vars {
+			c.Vars[key] = vars.Get(key)
+		}
+	}
+	return c
+}
@@ -1,31 +1,147 @@
 package utils
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"time"
+
+	"tala_base/types"
+)
+
+// Headers the orchestrator uses to attribute lambda calls to a caller and workflow execution
+const (
+	ActorHeader       = "X-Actor"
+	ExecutionIDHeader = "X-Execution-ID"
+	// RequestIDHeader correlates the log lines of one request across the server and lambdas
+	RequestIDHeader = "X-Request-ID"
 )
 
+// TenantHeader carries the tenant a request is scoped to
+const TenantHeader = "X-Tenant-ID"
+
+// StepEnvelopeHeader asks a lambda to wrap its output in a StepResult {"data": ...}
+const StepEnvelopeHeader = "X-Step-Envelope"
+
 // SetCORSHeaders sets standard CORS headers for all responses
 func SetCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, X-Actor, X-Execution-ID, X-Request-ID, X-Tenant-ID, X-User-ID, X-Deadline, X-Deadline-Remaining, X-Context-Vars")
 }
 
-// RespondJSON sends a JSON response with the given status code and data
+// RespondJSON sends a JSON response with the given status code and data as is.
+// Server endpoints answer through RespondSuccess, RespondResult and RespondError instead.
 func RespondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
 }
 
-// RespondError sends an error response with the given status code and message
-func RespondError(w http.ResponseWriter, status int, message string) {
-	RespondJSON(w, status, map[string]string{"error": message})
+// Envelope is the body of every server response: Data on success, Error on
+// failure, and Meta on both
+type Envelope struct {
+	Data  interface{}    `json:"data"`
+	Meta  ResponseMeta   `json:"meta"`
+	Error *ResponseError `json:"error,omitempty"`
+}
+
+// ResponseMeta identifies the request, the execution it started if any, and
+// how long the server spent on it
+type ResponseMeta struct {
+	RequestID   string  `json:"request_id,omitempty"`
+	ExecutionID string  `json:"execution_id,omitempty"`
+	DurationMs  float64 `json:"duration_ms"`
+}
+
+// ResponseError describes a failed request. Code is a types.WorkflowErrorCode;
+// Step names the workflow step that failed, when one did.
+type ResponseError struct {
+	Code    types.WorkflowErrorCode `json:"code"`
+	Message string                  `json:"message"`
+	Step    string                  `json:"step,omitempty"`
+}
+
+// RespondSuccess sends data in the response envelope
+func RespondSuccess(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	RespondJSON(w, status, Envelope{Data: data, Meta: responseMeta(w, r)})
+}
+
+// RespondResult sends the outcome of a workflow or step: data on success, or
+// err with the HTTP status its code maps to
+func RespondResult(w http.ResponseWriter, r *http.Request, data interface{}, err *types.WorkflowError) {
+	if err == nil {
+		RespondSuccess(w, r, http.StatusOK, data)
+		return
+	}
+	RespondJSON(w, err.HTTPStatus(), Envelope{
+		Meta:  responseMeta(w, r),
+		Error: &ResponseError{Code: err.Code, Message: err.Message, Step: err.Step},
+	})
+}
+
+// RespondError sends an error in the response envelope, with the generic code for status
+func RespondError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	RespondJSON(w, status, Envelope{
+		Meta:  responseMeta(w, r),
+		Error: &ResponseError{Code: statusCode(status), Message: message},
+	})
+}
+
+// statusCode returns the generic error code reported with status
+func statusCode(status int) types.WorkflowErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return types.ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return types.ErrorCodeUnauthenticated
+	case http.StatusNotFound:
+		return types.ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return types.ErrorCodeMethodNotAllowed
+	case http.StatusConflict:
+		return types.ErrorCodeConflict
+	case http.StatusUnprocessableEntity:
+		return types.ErrorCodeValidationFailed
+	case http.StatusTooManyRequests:
+		return types.ErrorCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return types.ErrorCodeOverloaded
+	case http.StatusGatewayTimeout:
+		return types.ErrorCodeTimeout
+	default:
+		return types.ErrorCodeInternal
+	}
+}
+
+type requestStartKey struct{}
+
+// WithRequestStart records when the server began handling a request, for the duration in ResponseMeta
+func WithRequestStart(r *http.Request, start time.Time) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestStartKey{}, start))
+}
+
+// responseMeta builds the meta block from the request's ID and start time and
+// the execution ID the handler set on the response, if any
+func responseMeta(w http.ResponseWriter, r *http.Request) ResponseMeta {
+	meta := ResponseMeta{
+		RequestID:   r.Header.Get(RequestIDHeader),
+		ExecutionID: w.Header().Get(ExecutionIDHeader),
+	}
+	if start, ok := r.Context().Value(requestStartKey{}).(time.Time); ok {
+		meta.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	}
+	return meta
 }
 
 // DecodeJSONBody decodes the request body into the given value
 func DecodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
 	return json.NewDecoder(r.Body).Decode(v)
 }
+
+// ConstantTimeEqual compares two secrets without leaking their common prefix length through timing
+func ConstantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,234 @@
+// Package httpclient builds the outbound HTTP clients used by the orchestrator,
+// notifiers and lambdas, with timeouts, pooling, optional retries and tracing
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"tala_base/tracing"
+)
+
+// Config controls a client. Zero fields take the defaults noted on each.
+type Config struct {
+	// Name labels the client's spans and observations, such as "webhook"
+	Name string
+	// Timeout bounds each attempt, including reading the body; defaults to 30s
+	Timeout time.Duration
+	// DialTimeout bounds establishing a connection; defaults to 5s
+	DialTimeout time.Duration
+	// MaxIdleConnsPerHost is the keep-alive pool size per host; defaults to 16
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes pooled connections idle this long; defaults to 90s
+	IdleConnTimeout time.Duration
+	// Dial opens connections in place of a dialer bounded by DialTimeout,
+	// such as to hand out connections dialed ahead of time
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Proxy routes every request through this URL. When nil the standard
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply.
+	Proxy *url.URL
+
+	// Retries is how many more times a failed request is attempted. Only
+	// idempotent methods and requests carrying an Idempotency-Key are retried,
+	// on connection errors, 429 and 502-504.
+	Retries int
+	// RetryBaseDelay is the first backoff, doubled per attempt with jitter; defaults to 200ms
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the backoff; defaults to 5s
+	RetryMaxDelay time.Duration
+}
+
+// Observer is told the client name, method, final status (0 when no response
+// arrived), duration and error of each request made by a client from New
+type Observer func(ctx context.Context, client, method string, status int, d time.Duration, err error)
+
+// observer is the process-wide observer; nil disables it
+var observer Observer
+
+// SetObserver installs the observer for requests made by clients from New.
+// It must be called before the clients are used.
+func SetObserver(o Observer) {
+	observer = o
+}
+
+// New returns a client for cfg. Each request runs in a client span, carries
+// the caller's trace context, and is reported to the installed Observer.
+func New(cfg Config) *http.Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = 16
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = 90 * time.Second
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = 200 * time.Millisecond
+	}
+	if cfg.RetryMaxDelay <= 0 {
+		cfg.RetryMaxDelay = 5 * time.Second
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != nil {
+		proxy = http.ProxyURL(cfg.Proxy)
+	}
+	dial := cfg.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.DialTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Timeout:   cfg.Timeout * time.Duration(cfg.Retries+1),
+		Transport: &roundTripper{cfg: cfg, next: transport},
+	}
+}
+
+// roundTripper traces, observes and retries requests on the pooled transport
+type roundTripper struct {
+	cfg  Config
+	next http.RoundTripper
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.client", t.cfg.Name),
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, attempts, err := t.do(req)
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	span.SetAttributes(attribute.Int("http.attempts", attempts))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	if observer != nil {
+		observer(ctx, t.cfg.Name, req.Method, status, time.Since(start), err)
+	}
+	return resp, err
+}
+
+// do sends req, retrying it while the policy allows, and returns the final
+// response or error and the number of attempts made
+func (t *roundTripper) do(req *http.Request) (*http.Response, int, error) {
+	retries := t.cfg.Retries
+	if !retryable(req) {
+		retries = 0
+	}
+
+	delay := t.cfg.RetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt > retries || !shouldRetry(req.Context(), resp, err) {
+			return resp, attempt, err
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		if after := retryAfter(resp); after > wait {
+			wait = after
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, attempt, req.Context().Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+		if delay > t.cfg.RetryMaxDelay {
+			delay = t.cfg.RetryMaxDelay
+		}
+
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, attempt, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether req may be sent more than once
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// shouldRetry reports whether a response or error is transient
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay a Retry-After header in seconds asks for
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,210 @@
+// Package middleware composes the server's HTTP handlers from a standard stack
+// of recovery, request IDs, logging, CORS and metrics, plus per-route auth
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tala_base/logging"
+	"tala_base/tracing"
+	"tala_base/utils"
+)
+
+// Middleware wraps a handler with behaviour that runs around it
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Chain combines middlewares into one. The first runs outermost, so
+// Chain(a, b)(h) handles a request as a(b(h)).
+func Chain(ms ...Middleware) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		for i := len(ms) - 1; i >= 0; i-- {
+			next = ms[i](next)
+		}
+		return next
+	}
+}
+
+// With wraps h in ms, the first outermost
+func With(h http.HandlerFunc, ms ...Middleware) http.HandlerFunc {
+	return Chain(ms...)(h)
+}
+
+// Standard is the stack every API route runs behind: request ID, logging,
+// recovery, metrics under route, and CORS, which answers preflight requests
+// before any auth runs
+func Standard(route string, metrics *Metrics) Middleware {
+	return Chain(RequestID, Logging, Recover, metrics.Middleware(route), CORS)
+}
+
+// Trace runs the handler inside a server span named name
+func Trace(name string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return tracing.Middleware(name, next)
+	}
+}
+
+// RequestID makes sure the request carries an X-Request-ID, generating one
+// if the caller sent none, and echoes it on the response. It also records the
+// start time reported in the response envelope.
+func RequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(utils.RequestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+			r.Header.Set(utils.RequestIDHeader, id)
+		}
+		w.Header().Set(utils.RequestIDHeader, id)
+		next(w, utils.WithRequestStart(r, time.Now()))
+	}
+}
+
+// Logging attaches a logger carrying the request ID to the request context,
+// for handlers to fetch with logging.LoggerFromContext, and logs each
+// request's method, path, status and duration once it completes
+func Logging(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		logger := logging.Component("server").With("request_id", r.Header.Get(utils.RequestIDHeader))
+		r = r.WithContext(logging.WithLogger(r.Context(), logger))
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		logger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+// Recover turns a panicking handler into a 500, logging the panic and its stack
+func Recover(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				logging.LoggerFromContext(r.Context()).Error("panic serving request",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", fmt.Sprint(p),
+					"stack", string(debug.Stack()),
+				)
+				utils.RespondError(w, r, http.StatusInternalServerError, "Internal server error")
+			}
+		}()
+		next(w, r)
+	}
+}
+
+// CORS sets the CORS headers on every response and answers OPTIONS preflight requests
+func CORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.SetCORSHeaders(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// statusRecorder remembers the status a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// status returns the written status, 200 if the handler wrote nothing
+func (r *statusRecorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+type metricsKey struct{ route, method, status string }
+
+// Metrics counts requests and totals their duration per route
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[metricsKey]uint64
+	seconds  map[string]float64
+}
+
+// NewMetrics creates an empty set of route metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[metricsKey]uint64),
+		seconds:  make(map[string]float64),
+	}
+}
+
+// Middleware records requests under route
+func (m *Metrics) Middleware(route string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			defer func() {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				m.requests[metricsKey{route, r.Method, strconv.Itoa(rec.status())}]++
+				m.seconds[route] += time.Since(start).Seconds()
+			}()
+			next(rec, r)
+		}
+	}
+}
+
+// Write renders the metrics in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricsKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].route+keys[i].method+keys[i].status < keys[j].route+keys[j].method+keys[j].status
+	})
+	fmt.Fprintf(w, "# HELP tala_http_requests_total Requests handled, by route, method and status.\n# TYPE tala_http_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(w, "tala_http_requests_total{route=%q,method=%q,status=%q} %d\n", k.route, k.method, k.status, m.requests[k])
+	}
+
+	routes := make([]string, 0, len(m.seconds))
+	for route := range m.seconds {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	fmt.Fprintf(w, "# HELP tala_http_request_seconds_total Time spent handling requests, by route.\n# TYPE tala_http_request_seconds_total counter\n")
+	for _, route := range routes {
+		fmt.Fprintf(w, "tala_http_request_seconds_total{route=%q} %g\n", route, m.seconds[route])
+	}
+}
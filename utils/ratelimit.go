@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader is the request header callers send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// maxRateLimitKeys caps the per-caller buckets kept. Callers seen while the
+// map is full, even after pruning, share one overflow bucket of their kind,
+// so a flood of new callers can neither grow memory nor get a fresh burst each.
+const maxRateLimitKeys = 10000
+
+// overflowRateLimitKey names the bucket shared by callers past maxRateLimitKeys
+const overflowRateLimitKey = "overflow"
+
+// RateLimitConfig configures the global, per-address and per-key token
+// buckets. A rate of zero disables the corresponding limit.
+type RateLimitConfig struct {
+	GlobalRate  float64
+	GlobalBurst int
+	// AddrRate limits each client address before it is authenticated, so a
+	// flood of missing or invalid keys never reaches the key lookup
+	AddrRate  float64
+	AddrBurst int
+	// KeyRate limits each authenticated API key, or each client address
+	// without key auth
+	KeyRate  float64
+	KeyBurst int
+}
+
+// RateLimitConfigFromEnv reads the rate limit configuration from the environment
+func RateLimitConfigFromEnv() RateLimitConfig {
+	return RateLimitConfig{
+		GlobalRate:  envFloat("RATE_LIMIT_GLOBAL_RPS", 0),
+		GlobalBurst: envInt("RATE_LIMIT_GLOBAL_BURST", 0),
+		AddrRate:    envFloat("RATE_LIMIT_ADDR_RPS", 0),
+		AddrBurst:   envInt("RATE_LIMIT_ADDR_BURST", 0),
+		KeyRate:     envFloat("RATE_LIMIT_KEY_RPS", 0),
+		KeyBurst:    envInt("RATE_LIMIT_KEY_BURST", 0),
+	}
+}
+
+// tokenBucket is a classic token bucket refilled continuously at rate tokens per second
+type tokenBucket struct {
+	rate     float64
+	burst    float64
+	tokens   float64
+	lastSeen time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, lastSeen: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.lastSeen = now
+}
+
+// wait returns how long until a token is available, or zero if one is available now
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// RateLimiter enforces a global token bucket and one bucket per client
+// address before authentication, and one bucket per API key after it
+type RateLimiter struct {
+	cfg       RateLimitConfig
+	mu        sync.Mutex
+	global    *tokenBucket
+	keys      map[string]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter with the given configuration
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{
+		cfg:  cfg,
+		keys: make(map[string]*tokenBucket),
+		now:  time.Now,
+	}
+	rl.lastPrune = rl.now()
+	if cfg.GlobalRate > 0 {
+		rl.global = newTokenBucket(cfg.GlobalRate, cfg.GlobalBurst, rl.now())
+	}
+	return rl
+}
+
+// AllowAddress reports whether a request from the client address may proceed
+// under the global and per-address limits. When it may not, the returned
+// duration is how long the caller should wait.
+func (rl *RateLimiter) AllowAddress(addr string) (bool, time.Duration) {
+	return rl.allow("addr:", addr, rl.cfg.AddrRate, rl.cfg.AddrBurst, true)
+}
+
+// AllowKey reports whether a request for the given caller may proceed under
+// the per-key limit. When it may not, the returned duration is how long the
+// caller should wait.
+func (rl *RateLimiter) AllowKey(key string) (bool, time.Duration) {
+	return rl.allow("key:", key, rl.cfg.KeyRate, rl.cfg.KeyBurst, false)
+}
+
+// allow takes a token from the caller's bucket, kept under kind+key and
+// refilled at rate, and from the global bucket when global is set
+func (rl *RateLimiter) allow(kind, key string, rate float64, burst int, global bool) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.prune(now, time.Minute)
+
+	var keyBucket *tokenBucket
+	if rate > 0 {
+		key = kind + key
+		keyBucket = rl.keys[key]
+		if keyBucket == nil && len(rl.keys) >= maxRateLimitKeys {
+			rl.prune(now, time.Second)
+			if len(rl.keys) >= maxRateLimitKeys {
+				key = kind + overflowRateLimitKey
+				keyBucket = rl.keys[key]
+			}
+		}
+		if keyBucket == nil {
+			keyBucket = newTokenBucket(rate, burst, now)
+			rl.keys[key] = keyBucket
+		}
+		keyBucket.refill(now)
+	}
+	var globalBucket *tokenBucket
+	if global && rl.global != nil {
+		globalBucket = rl.global
+		globalBucket.refill(now)
+	}
+
+	// Only consume tokens once both buckets agree, so a rejected request
+	// does not drain the other bucket
+	var retryAfter time.Duration
+	if keyBucket != nil {
+		retryAfter = keyBucket.wait()
+	}
+	if globalBucket != nil {
+		if wait := globalBucket.wait(); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return false, retryAfter
+	}
+
+	if keyBucket != nil {
+		keyBucket.tokens--
+	}
+	if globalBucket != nil {
+		globalBucket.tokens--
+	}
+	return true, 0
+}
+
+// prune drops per-key buckets that have been idle long enough to be full
+// again, at most once per interval
+func (rl *RateLimiter) prune(now time.Time, interval time.Duration) {
+	if now.Sub(rl.lastPrune) < interval {
+		return
+	}
+	rl.lastPrune = now
+	for key, b := range rl.keys {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(rl.keys, key)
+		}
+	}
+}
+
+// Middleware rejects requests over the global or per-address limit with 429
+// and Retry-After. It runs before authentication, so unauthenticated floods
+// are turned away before their keys are looked up.
+func (rl *RateLimiter) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if allowed, retryAfter := rl.AllowAddress(clientAddr(r)); !allowed {
+			rejectRateLimited(w, r, retryAfter)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// KeyMiddleware rejects requests over the per-key limit with 429 and
+// Retry-After. It must run after authentication, so callers are told apart by
+// the key that authenticated them rather than by headers they choose.
+func (rl *RateLimiter) KeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if allowed, retryAfter := rl.AllowKey(rateLimitKey(r)); !allowed {
+			rejectRateLimited(w, r, retryAfter)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rejectRateLimited answers a request over a limit with 429 and Retry-After
+func rejectRateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	RespondError(w, r, http.StatusTooManyRequests, "Rate limit exceeded")
+}
+
+type rateLimitKeyKey struct{}
+
+// WithRateLimitKey identifies an authenticated caller for per-caller rate
+// limiting, such as by the ID of the API key that authenticated it
+func WithRateLimitKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, rateLimitKeyKey{}, key)
+}
+
+// rateLimitKey identifies the caller by what authenticated it, falling back
+// to the client address for unauthenticated requests
+func rateLimitKey(r *http.Request) string {
+	if key, ok := r.Context().Value(rateLimitKeyKey{}).(string); ok && key != "" {
+		return key
+	}
+	return "addr:" + clientAddr(r)
+}
+
+// clientAddr returns the host of the request's remote address
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
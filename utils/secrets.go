@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tala_base/utils/httpclient"
+)
+
+// SecretRefPrefix marks a configuration value as a reference to a secret,
+// such as DATABASE_URL=secret://database_url
+const SecretRefPrefix = "secret://"
+
+// ErrSecretNotFound is returned by a Secrets provider that does not hold the secret
+var ErrSecretNotFound = errors.New("secret not found")
+
+// Secrets resolves named secrets
+type Secrets interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSecrets reads secret name from the environment variable Prefix+NAME,
+// the name upper-cased with dots, slashes and dashes turned into underscores
+type EnvSecrets struct {
+	Prefix string
+}
+
+func (s EnvSecrets) Secret(ctx context.Context, name string) (string, error) {
+	key := s.Prefix + strings.ToUpper(strings.NewReplacer(".", "_", "/", "_", "-", "_").Replace(name))
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return value, nil
+}
+
+// FileSecrets reads secret name from the file Dir/name, as mounted by Docker
+// and Kubernetes secrets. A trailing newline is dropped.
+type FileSecrets struct {
+	Dir string
+}
+
+func (s FileSecrets) Secret(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.Contains(name, "..") || filepath.IsAbs(name) {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// VaultSecrets reads secrets from a Vault KV version 2 engine. Name is
+// "path#key", reading key from the secret at path; without #key it reads "value".
+type VaultSecrets struct {
+	Addr  string
+	Token string
+	// Mount is the KV engine's mount point; defaults to secret
+	Mount  string
+	client *http.Client
+}
+
+// NewVaultSecrets creates a Vault provider for the server at addr
+func NewVaultSecrets(addr, token, mount string) *VaultSecrets {
+	if mount == "" {
+		mount = "secret"
+	}
+	return &VaultSecrets{
+		Addr:   strings.TrimSuffix(addr, "/"),
+		Token:  token,
+		Mount:  strings.Trim(mount, "/"),
+		client: httpclient.New(httpclient.Config{Name: "vault", Timeout: 5 * time.Second, Retries: 2}),
+	}
+}
+
+func (s *VaultSecrets) Secret(ctx context.Context, name string) (string, error) {
+	path, key, ok := strings.Cut(name, "#")
+	if !ok {
+		key = "value"
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", s.Addr, s.Mount, (&url.URL{Path: strings.Trim(path, "/")}).EscapedPath())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s from vault: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read secret %s from vault: status %d", name, resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	value, ok := body.Data.Data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return value, nil
+}
+
+// ChainSecrets tries each provider in order, returning the first that holds the secret
+type ChainSecrets []Secrets
+
+func (c ChainSecrets) Secret(ctx context.Context, name string) (string, error) {
+	for _, s := range c {
+		value, err := s.Secret(ctx, name)
+		if !errors.Is(err, ErrSecretNotFound) {
+			return value, err
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// cachedSecret is a resolved value and when it was fetched
+type cachedSecret struct {
+	value   string
+	fetched time.Time
+}
+
+// CachedSecrets remembers values from another provider for TTL. Refresh
+// re-reads every cached secret and calls the rotation hooks for each one
+// whose value changed, so holders of derived state can rebuild it.
+type CachedSecrets struct {
+	next Secrets
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	values map[string]cachedSecret
+	hooks  []func(name string)
+}
+
+// NewCachedSecrets caches next's values for ttl
+func NewCachedSecrets(next Secrets, ttl time.Duration) *CachedSecrets {
+	return &CachedSecrets{next: next, ttl: ttl, values: make(map[string]cachedSecret)}
+}
+
+func (c *CachedSecrets) Secret(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.values[name]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetched) < c.ttl {
+		return cached.value, nil
+	}
+
+	value, err := c.next.Secret(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	c.store(name, value)
+	return value, nil
+}
+
+// OnRotate registers fn to be called with the name of each secret whose value changes
+func (c *CachedSecrets) OnRotate(fn func(name string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, fn)
+}
+
+// Refresh re-reads every cached secret, keeping the old value of any that fails
+func (c *CachedSecrets) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.values))
+	for name := range c.values {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		value, err := c.next.Secret(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.store(name, value)
+	}
+	return errors.Join(errs...)
+}
+
+// Watch calls Refresh every interval until ctx is done
+func (c *CachedSecrets) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// store caches value and runs the rotation hooks if it replaced a different one
+func (c *CachedSecrets) store(name, value string) {
+	c.mu.Lock()
+	previous, existed := c.values[name]
+	c.values[name] = cachedSecret{value: value, fetched: time.Now()}
+	var hooks []func(string)
+	if existed && previous.value != value {
+		hooks = append(hooks, c.hooks...)
+	}
+	c.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(name)
+	}
+}
+
+var (
+	defaultSecrets     *CachedSecrets
+	defaultSecretsOnce sync.Once
+)
+
+// DefaultSecrets returns the process-wide provider: Vault when VAULT_ADDR is
+// set, then files under SECRETS_DIR when set, then the environment, cached
+// for SECRETS_CACHE_TTL (default 5m)
+func DefaultSecrets() *CachedSecrets {
+	defaultSecretsOnce.Do(func() {
+		var chain ChainSecrets
+		if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+			chain = append(chain, NewVaultSecrets(addr, os.Getenv("VAULT_TOKEN"), os.Getenv("VAULT_KV_MOUNT")))
+		}
+		if dir := os.Getenv("SECRETS_DIR"); dir != "" {
+			chain = append(chain, FileSecrets{Dir: dir})
+		}
+		chain = append(chain, EnvSecrets{})
+
+		ttl := 5 * time.Minute
+		if v, err := time.ParseDuration(os.Getenv("SECRETS_CACHE_TTL")); err == nil && v > 0 {
+			ttl = v
+		}
+		defaultSecrets = NewCachedSecrets(chain, ttl)
+	})
+	return defaultSecrets
+}
+
+// ResolveSecret returns value, or the secret it names when it starts with secret://
+func ResolveSecret(ctx context.Context, s Secrets, value string) (string, error) {
+	name, ok := strings.CutPrefix(value, SecretRefPrefix)
+	if !ok {
+		return value, nil
+	}
+	return s.Secret(ctx, name)
+}
+
+// SecretEnv returns the environment variable key, resolving a secret://
+// reference through DefaultSecrets. A reference that cannot be resolved is
+// reported through the returned error and yields "".
+func SecretEnv(key string) (string, error) {
+	value, err := ResolveSecret(context.Background(), DefaultSecrets(), os.Getenv(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", key, err)
+	}
+	return value, nil
+}
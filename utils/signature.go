@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers carrying the orchestrator's signature on lambda calls
+const (
+	SignatureHeader          = "X-Tala-Signature"
+	SignatureTimestampHeader = "X-Tala-Timestamp"
+)
+
+// SignatureMaxSkew bounds how far a signed request's timestamp may be from the
+// lambda's clock, limiting how long a captured request can be replayed
+const SignatureMaxSkew = 5 * time.Minute
+
+// SignedContextHeaders are the execution context headers a lambda call's
+// signature covers, in the order they are signed. Lambdas scope queries and
+// audit attribution by them, so a captured request cannot be replayed for
+// another tenant or actor.
+var SignedContextHeaders = []string{TenantHeader, ActorHeader, UserIDHeader, ExecutionIDHeader, ContextVarsHeader}
+
+// SignLambdaRequest returns the signature of a lambda call:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "\n" + method + "\n" + path + "\n" +
+// one "name:value\n" line per SignedContextHeaders entry, empty when unset, + body))
+func SignLambdaRequest(secret string, timestamp int64, method, path string, header http.Header, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + method + "\n" + path + "\n"))
+	for _, name := range SignedContextHeaders {
+		mac.Write([]byte(name + ":" + header.Get(name) + "\n"))
+	}
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyLambdaRequest checks a signature made by SignLambdaRequest, so also
+// that the execution context headers are the ones signed, and that its
+// timestamp is within SignatureMaxSkew of now
+func VerifyLambdaRequest(secret, signature, timestamp, method, path string, header http.Header, body []byte, now time.Time) error {
+	if signature == "" || timestamp == "" {
+		return errors.New("missing signature")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > SignatureMaxSkew || skew < -SignatureMaxSkew {
+		return errors.New("signature timestamp is outside the allowed window")
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignLambdaRequest(secret, ts, method, path, header, body))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
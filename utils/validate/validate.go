@@ -0,0 +1,190 @@
+// Package validate checks lambda inputs and workflow inputs against
+// `validate` rules, reporting a message per invalid field. Rules are those of
+// go-playground/validator, with these changed or added:
+//
+//	email     the string must be a bare email address, as accepted by net/mail
+//	notblank  strings must not be empty or only whitespace
+//	enum      with a parameter, the value must be one of its space-separated
+//	          options (enum=anonymize purge); without one, the value's
+//	          Valid() bool method must report true
+//
+// Use omitnil before the other rules of optional pointer fields.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate is shared by every caller; it caches struct metadata
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	v.RegisterValidation("email", isEmail)
+	v.RegisterValidation("notblank", isNotBlank)
+	v.RegisterValidation("enum", isEnum)
+	return v
+}
+
+func isEmail(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value
+}
+
+func isNotBlank(fl validator.FieldLevel) bool {
+	if fl.Field().Kind() != reflect.String {
+		return true
+	}
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+// valider is implemented by enum types such as types.UserStatus
+type valider interface {
+	Valid() bool
+}
+
+func isEnum(fl validator.FieldLevel) bool {
+	if fl.Param() == "" {
+		if v, ok := fl.Field().Interface().(valider); ok {
+			return v.Valid()
+		}
+		return true
+	}
+	value := fmt.Sprint(fl.Field().Interface())
+	for _, option := range strings.Fields(fl.Param()) {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldErrors maps the JSON path of each invalid field, such as "email" or
+// "items[0].name", to why it is invalid
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " " + e[name]
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Struct checks the `validate` tags of v, a struct or pointer to one. It
+// returns FieldErrors when any field is invalid and nil for other kinds.
+func Struct(v interface{}) error {
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+		return nil
+	}
+	return fieldErrors(validate.Struct(v))
+}
+
+// Map checks each value of data against the rules for its key, for inputs that
+// arrive as loose JSON such as a workflow's. A missing or null value only
+// fails rules starting with required.
+func Map(data map[string]interface{}, rules map[string]string) error {
+	fields := FieldErrors{}
+	for name, rule := range rules {
+		value, ok := data[name]
+		if !ok || value == nil {
+			if strings.HasPrefix(rule, "required") {
+				fields[name] = "is required"
+			}
+			continue
+		}
+		var errs validator.ValidationErrors
+		if err := validate.Var(value, rule); errors.As(err, &errs) {
+			fields[name] = message(errs[0])
+		} else if err != nil {
+			return fmt.Errorf("invalid rule for %s: %w", name, err)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// CheckRule reports whether rule is well formed, so a bad rule fails when a
+// workflow loads rather than when it runs
+func CheckRule(rule string) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("invalid rule %q: %v", rule, p)
+		}
+	}()
+	validate.Var("", rule)
+	return nil
+}
+
+// fieldErrors converts the validator's errors into FieldErrors keyed by JSON
+// path, without the name of the top-level struct
+func fieldErrors(err error) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	fields := FieldErrors{}
+	for _, fe := range errs {
+		path := fe.Namespace()
+		if _, rest, ok := strings.Cut(path, "."); ok {
+			path = rest
+		}
+		if _, exists := fields[path]; !exists {
+			fields[path] = message(fe)
+		}
+	}
+	return fields
+}
+
+// message describes a failed rule in the same words for every input
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "notblank":
+		return "must not be blank"
+	case "email":
+		return "must be a valid email address"
+	case "enum", "oneof":
+		if fe.Param() == "" {
+			return "is not a valid value"
+		}
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min", "max", "len":
+		unit := ""
+		if fe.Kind() == reflect.String {
+			unit = " characters"
+		} else if fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map {
+			unit = " items"
+		}
+		bound := map[string]string{"min": "at least", "max": "at most", "len": "exactly"}[fe.Tag()]
+		return fmt.Sprintf("must be %s %s%s", bound, fe.Param(), unit)
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
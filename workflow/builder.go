@@ -0,0 +1,162 @@
+// Package workflow defines workflows in Go instead of YAML, for services
+// embedding the orchestrator. Each step kind has its own constructor taking
+// the fields it requires, so a chain is checked by the compiler as far as Go
+// types allow and by Build for the rest:
+//
+//	err := workflow.New("user_signup_chain").
+//		Input("email", "required,email").
+//		Step(workflow.Lambda("create_user", "user_create").
+//			Input(`{"email": "{{.input.email}}"}`).
+//			As("user")).
+//		Step(workflow.Set("ids", map[string]string{"user_id": "{{.user.user.id}}"})).
+//		Step(workflow.Lambda("send_welcome", "notify_email")).
+//		OnError(types.ErrorCodeTimeout, "alert").
+//		Step(workflow.Lambda("alert", "notify_slack")).
+//		Register(executor)
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"tala_base/orchestrator"
+	"tala_base/types"
+)
+
+// Builder assembles a workflow step by step
+type Builder struct {
+	workflow types.Workflow
+	steps    []*StepBuilder
+	errs     []error
+}
+
+// New starts a workflow; name is the name it is registered under
+func New(name string) *Builder {
+	return &Builder{workflow: types.Workflow{SchemaVersion: types.WorkflowSchemaVersion, Name: name}}
+}
+
+// Description sets the workflow's description
+func (b *Builder) Description(text string) *Builder {
+	b.workflow.Description = text
+	return b
+}
+
+// Input requires an input field to pass a utils/validate rule, such as
+// required,email
+func (b *Builder) Input(field, rule string) *Builder {
+	if b.workflow.Inputs == nil {
+		b.workflow.Inputs = make(map[string]string)
+	}
+	b.workflow.Inputs[field] = rule
+	return b
+}
+
+// Config sets a value templates read as {{ .Config.key }}
+func (b *Builder) Config(key string, value interface{}) *Builder {
+	if b.workflow.Config == nil {
+		b.workflow.Config = make(map[string]interface{})
+	}
+	b.workflow.Config[key] = value
+	return b
+}
+
+// Priority sets the priority of the workflow's durable executions
+func (b *Builder) Priority(priority types.ExecutionPriority) *Builder {
+	b.workflow.Priority = priority
+	return b
+}
+
+// RetryBudget caps the step retries and hedged calls of one execution
+func (b *Builder) RetryBudget(retries int) *Builder {
+	b.workflow.RetryBudget = &retries
+	return b
+}
+
+// MaxConcurrentExecutions caps how many executions run at a time across
+// every server
+func (b *Builder) MaxConcurrentExecutions(n int) *Builder {
+	b.workflow.MaxConcurrentExecutions = n
+	return b
+}
+
+// Singleton allows only one execution at a time across every server
+func (b *Builder) Singleton() *Builder {
+	b.workflow.Singleton = true
+	return b
+}
+
+// Step appends steps to the workflow
+func (b *Builder) Step(steps ...*StepBuilder) *Builder {
+	b.steps = append(b.steps, steps...)
+	return b
+}
+
+// Parallel appends a step running branches concurrently; see Parallel
+func (b *Builder) Parallel(name string, branches ...BranchBuilder) *Builder {
+	return b.Step(Parallel(name, branches...))
+}
+
+// OnError hands errors with code, or types.OnErrorDefault for any other,
+// that the step appended last fails with to the handler step
+func (b *Builder) OnError(code types.WorkflowErrorCode, handler string) *Builder {
+	if len(b.steps) == 0 {
+		b.errs = append(b.errs, fmt.Errorf("on_error %s set before any step", code))
+		return b
+	}
+	b.steps[len(b.steps)-1].OnError(code, handler)
+	return b
+}
+
+// Build returns the workflow, checking each step as a workflow file's steps
+// are checked when it is parsed, and that on_error handlers exist
+func (b *Builder) Build() (*types.Workflow, error) {
+	errs := append([]error(nil), b.errs...)
+	workflow := b.workflow
+	workflow.Inputs, workflow.Config = maps.Clone(workflow.Inputs), maps.Clone(workflow.Config)
+	steps, err := buildSteps(b.steps)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	workflow.Steps = steps
+	if len(workflow.Steps) == 0 {
+		errs = append(errs, errors.New("no steps"))
+	}
+	for _, step := range workflow.Steps {
+		for code, handler := range step.OnError {
+			if workflow.StepIndex(handler) < 0 {
+				errs = append(errs, fmt.Errorf("step %s handles %s with unknown step %s", step.Name, code, handler))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid workflow %s: %w", workflow.Name, err)
+	}
+	return &workflow, nil
+}
+
+// Register builds the workflow and adds it to executor under its name,
+// where it is checked like a loaded workflow file, including that the
+// executor runs each step's kind
+func (b *Builder) Register(executor *orchestrator.ChainExecutor) error {
+	workflow, err := b.Build()
+	if err != nil {
+		return err
+	}
+	return executor.AddWorkflow(workflow.Name, workflow)
+}
+
+// buildSteps converts and validates a sequence of steps, with those nested
+// in parallel branches and switch cases
+func buildSteps(builders []*StepBuilder) ([]types.Step, error) {
+	var errs []error
+	steps := make([]types.Step, 0, len(builders))
+	for _, builder := range builders {
+		step, err := builder.build()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, errors.Join(errs...)
+}
@@ -0,0 +1,221 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"tala_base/types"
+)
+
+// StepBuilder assembles one step. Create it with the constructor of its kind.
+type StepBuilder struct {
+	step     types.Step
+	branches []BranchBuilder
+	cases    []CaseBuilder
+	defaults []*StepBuilder
+}
+
+// BranchBuilder is a named sequence of steps of a parallel step
+type BranchBuilder struct {
+	name  string
+	steps []*StepBuilder
+}
+
+// CaseBuilder is one case of a switch step
+type CaseBuilder struct {
+	when  string
+	steps []*StepBuilder
+}
+
+// Lambda calls a lambda with the step input as the request body
+func Lambda(name, lambda string) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindLambda, Lambda: lambda}}
+}
+
+// HTTP calls an external URL
+func HTTP(name string, config types.HTTPStep) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindHTTP, HTTP: &config}}
+}
+
+// Script evaluates a jq expression over the step input
+func Script(name, source string) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindScript, Script: &types.ScriptStep{Language: "jq", Source: source}}}
+}
+
+// SQL runs a parameterized query
+func SQL(name string, config types.SQLStep) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindSQL, SQL: &config}}
+}
+
+// Wait pauses the workflow for d
+func Wait(name string, d time.Duration) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindWait, Wait: &types.WaitStep{Duration: d.String()}}}
+}
+
+// WaitUntil pauses the workflow until the time the until template renders to
+func WaitUntil(name, until string) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindWait, Wait: &types.WaitStep{Until: until}}}
+}
+
+// Approval pauses the workflow until one of the approvers approves or rejects it
+func Approval(name string, config types.ApprovalStep) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindApproval, Approval: &config}}
+}
+
+// Subworkflow runs another workflow with the step input as its input
+func Subworkflow(name, workflow string) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindSubworkflow, Subworkflow: &types.SubworkflowStep{Workflow: workflow}}}
+}
+
+// Set stores variables, each a template, that later steps read as {{ .Vars.name }}
+func Set(name string, vars map[string]string) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindSet, Set: &types.SetStep{Vars: vars}}}
+}
+
+// Parallel runs branches concurrently and waits for all of them
+func Parallel(name string, branches ...BranchBuilder) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindParallel}, branches: branches}
+}
+
+// Branch is a named sequence of steps for Parallel
+func Branch(name string, steps ...*StepBuilder) BranchBuilder {
+	return BranchBuilder{name: name, steps: steps}
+}
+
+// Switch runs the steps of the first case whose when template renders
+// "true", or those set with Default when none does
+func Switch(name string, cases ...CaseBuilder) *StepBuilder {
+	return &StepBuilder{step: types.Step{Name: name, Kind: types.StepKindSwitch}, cases: cases}
+}
+
+// Case is one case of Switch
+func Case(when string, steps ...*StepBuilder) CaseBuilder {
+	return CaseBuilder{when: when, steps: steps}
+}
+
+// Default sets the steps a switch step runs when no case matches
+func (s *StepBuilder) Default(steps ...*StepBuilder) *StepBuilder {
+	s.defaults = append(s.defaults, steps...)
+	return s
+}
+
+// Input sets the template rendered into the step input
+func (s *StepBuilder) Input(template string) *StepBuilder {
+	s.step.InputTemplate = template
+	return s
+}
+
+// As stores the step output under key for later templates instead of the
+// step name
+func (s *StepBuilder) As(key string) *StepBuilder {
+	s.step.PassOutputAs = key
+	return s
+}
+
+// OnError hands errors with code, or types.OnErrorDefault for any other, to
+// the handler step
+func (s *StepBuilder) OnError(code types.WorkflowErrorCode, handler string) *StepBuilder {
+	if s.step.OnError == nil {
+		s.step.OnError = make(map[types.WorkflowErrorCode]string)
+	}
+	s.step.OnError[code] = handler
+	return s
+}
+
+// Flag runs the step only while a feature flag is on, or off when the name
+// starts with "!"
+func (s *StepBuilder) Flag(name string) *StepBuilder {
+	s.step.Flag = name
+	return s
+}
+
+// Dedupe reuses the output of an earlier dedupe call to the same lambda with
+// the same input in the execution
+func (s *StepBuilder) Dedupe() *StepBuilder {
+	s.step.Dedupe = true
+	return s
+}
+
+// HedgeAfter calls a second instance of the lambda when the first has not
+// answered within d
+func (s *StepBuilder) HedgeAfter(d time.Duration) *StepBuilder {
+	s.step.HedgeAfter = d.String()
+	return s
+}
+
+// Binary accepts lambda responses that are not JSON, kept as mode says
+func (s *StepBuilder) Binary(mode types.BinaryMode) *StepBuilder {
+	s.step.Binary = mode
+	return s
+}
+
+// CaptureHeaders keeps lambda response headers in the step's state
+func (s *StepBuilder) CaptureHeaders(headers ...string) *StepBuilder {
+	s.step.CaptureHeaders = append(s.step.CaptureHeaders, headers...)
+	return s
+}
+
+// SuccessCodes sets the lambda response statuses the step succeeds with
+func (s *StepBuilder) SuccessCodes(statuses ...int) *StepBuilder {
+	s.step.SuccessCodes = append(s.step.SuccessCodes, statuses...)
+	return s
+}
+
+// StatusCode fails the step with code when the lambda answers with status
+func (s *StepBuilder) StatusCode(status int, code types.WorkflowErrorCode) *StepBuilder {
+	if s.step.StatusCodes == nil {
+		s.step.StatusCodes = make(map[int]types.WorkflowErrorCode)
+	}
+	s.step.StatusCodes[status] = code
+	return s
+}
+
+// MetricLabel adds a label to the metrics the step's lambda reports
+func (s *StepBuilder) MetricLabel(name, value string) *StepBuilder {
+	if s.step.MetricLabels == nil {
+		s.step.MetricLabels = make(map[string]string)
+	}
+	s.step.MetricLabels[name] = value
+	return s
+}
+
+// build converts the step, with its branches or cases, and validates it
+func (s *StepBuilder) build() (types.Step, error) {
+	step := s.step
+	var errs []error
+	switch step.Kind {
+	case types.StepKindParallel:
+		step.Parallel = &types.ParallelStep{}
+		for _, branch := range s.branches {
+			steps, err := buildSteps(branch.steps)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("step %s branch %s: %w", step.Name, branch.name, err))
+			}
+			step.Parallel.Branches = append(step.Parallel.Branches, types.Branch{Name: branch.name, Steps: steps})
+		}
+	case types.StepKindSwitch:
+		step.Switch = &types.SwitchStep{}
+		for i, c := range s.cases {
+			steps, err := buildSteps(c.steps)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("step %s case %d: %w", step.Name, i, err))
+			}
+			step.Switch.Cases = append(step.Switch.Cases, types.SwitchCase{When: c.when, Steps: steps})
+		}
+		steps, err := buildSteps(s.defaults)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("step %s default: %w", step.Name, err))
+		}
+		if len(steps) > 0 {
+			step.Switch.Default = steps
+		}
+	}
+	if len(s.defaults) > 0 && step.Kind != types.StepKindSwitch {
+		errs = append(errs, fmt.Errorf("step %s of kind %s cannot have default steps; only switch steps can", step.Name, step.Kind))
+	}
+	if err := step.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return step, errors.Join(errs...)
+}
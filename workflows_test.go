@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tala_base/lambdas/notify_email"
+	"tala_base/lambdas/user_delete"
+	"tala_base/lambdas/user_read"
+	"tala_base/lambdas/user_update"
+	"tala_base/lambdasdk"
+	"tala_base/orchestrator"
+	"tala_base/types"
+)
+
+func TestUserOffboardingWorkflow(t *testing.T) {
+	store := &userStore{users: map[int64]*storedUser{7: {id: 7, tenant: "default", email: "ada@example.com", name: "Ada"}}}
+	executor := workflowExecutor(t, store, user_read.Lambda, user_delete.Lambda, notify_email.Lambda)
+	raw, err := os.ReadFile("workflows/user_offboarding.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addWorkflow(t, executor, raw)
+
+	out, err := executor.ExecuteChain("user_offboarding", types.WorkflowInput{Data: map[string]interface{}{"id": 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Error != nil {
+		t.Fatalf("workflow failed: %+v", out.Error)
+	}
+	if store.users[7].deletedAt == nil {
+		t.Error("user was not deleted")
+	}
+	if got := strings.Join(store.audits, ","); got != string(types.UserAuditDelete) {
+		t.Errorf("audited %q, want %q", got, types.UserAuditDelete)
+	}
+	if out.Data["to"] != "ada@example.com" {
+		t.Errorf("notice sent to %v, want ada@example.com", out.Data["to"])
+	}
+}
+
+func TestUserStepsReportUserNotFound(t *testing.T) {
+	store := &userStore{users: map[int64]*storedUser{}}
+	executor := workflowExecutor(t, store, user_read.Lambda, user_update.Lambda, user_delete.Lambda)
+	for _, lambda := range []string{"user_read", "user_update", "user_delete"} {
+		t.Run(lambda, func(t *testing.T) {
+			addWorkflow(t, executor, []byte(fmt.Sprintf(`
+name: %s_missing
+steps:
+  - name: call
+    lambda: %s
+    input_template: '{"id": 404, "name": "Ada"}'
+`, lambda, lambda)))
+
+			out, err := executor.ExecuteChain(lambda+"_missing", types.WorkflowInput{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Error == nil || out.Error.Code != types.ErrorCodeUserNotFound || out.Error.Step != "call" {
+				t.Fatalf("got error %+v, want %s from step call", out.Error, types.ErrorCodeUserNotFound)
+			}
+		})
+	}
+}
+
+func TestUserUpdateStep(t *testing.T) {
+	store := &userStore{users: map[int64]*storedUser{7: {id: 7, tenant: "default", email: "ada@example.com", name: "Ada"}}}
+	executor := workflowExecutor(t, store, user_update.Lambda)
+	addWorkflow(t, executor, []byte(`
+name: rename
+steps:
+  - name: rename
+    lambda: user_update
+    input_template: '{"id": {{.input.id}}, "name": "{{.input.name}}"}'
+`))
+
+	out, err := executor.ExecuteChain("rename", types.WorkflowInput{Data: map[string]interface{}{"id": 7, "name": "Grace"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Error != nil {
+		t.Fatalf("workflow failed: %+v", out.Error)
+	}
+	if store.users[7].name != "Grace" {
+		t.Errorf("name is %q, want Grace", store.users[7].name)
+	}
+	if got := strings.Join(store.audits, ","); got != string(types.UserAuditUpdate) {
+		t.Errorf("audited %q, want %q", got, types.UserAuditUpdate)
+	}
+}
+
+// workflowExecutor serves lambdas backed by store and returns an executor
+// whose registry points at them
+func workflowExecutor(t *testing.T, store *userStore, lambdas ...lambdasdk.Lambda) *orchestrator.ChainExecutor {
+	t.Helper()
+	t.Setenv("LAMBDA_AUTH_SECRET", "")
+	t.Setenv("LAMBDA_SERVICE_TOKEN", "")
+	t.Setenv("EMAIL_PROVIDER", "log")
+	t.Setenv("EMAIL_FROM", "noreply@example.com")
+
+	dbConn := sql.OpenDB(store)
+	t.Cleanup(func() { dbConn.Close() })
+	app := lambdasdk.New("test")
+	app.UseDB(dbConn)
+	urls := make(map[string]string)
+	server := httptest.NewServer(app.Handler())
+	t.Cleanup(server.Close)
+	for _, l := range lambdas {
+		if err := app.Mount(l); err != nil {
+			t.Fatalf("failed to mount %s: %v", l.Name, err)
+		}
+		urls[l.Name] = server.URL + "/" + l.Name
+	}
+
+	executor := orchestrator.NewChainExecutor()
+	executor.SetRegistry(orchestrator.NewRegistry(urls))
+	return executor
+}
+
+// addWorkflow parses a workflow file and adds it to executor
+func addWorkflow(t *testing.T, executor *orchestrator.ChainExecutor, raw []byte) {
+	t.Helper()
+	workflow, err := types.ParseWorkflow(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := executor.AddWorkflow(workflow.Name, workflow); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// userStore is an in-memory users table behind a database/sql driver. It
+// answers the statements the user lambdas run, so workflows run against the
+// real handlers without Postgres.
+type userStore struct {
+	mu     sync.Mutex
+	users  map[int64]*storedUser
+	audits []string
+}
+
+type storedUser struct {
+	id                  int64
+	tenant, email, name string
+	deletedAt           *time.Time
+}
+
+func (s *userStore) Connect(context.Context) (driver.Conn, error) { return userConn{s}, nil }
+func (s *userStore) Driver() driver.Driver                        { return s }
+func (s *userStore) Open(string) (driver.Conn, error)             { return userConn{s}, nil }
+
+type userConn struct{ store *userStore }
+
+func (c userConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("unexpected prepare: %s", query)
+}
+func (c userConn) Close() error              { return nil }
+func (c userConn) Begin() (driver.Tx, error) { return c, nil }
+func (c userConn) Commit() error             { return nil }
+func (c userConn) Rollback() error           { return nil }
+
+func (c userConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(q, "SELECT") && strings.Contains(q, "FROM users WHERE id = $1 AND tenant_id = $2"):
+		u := s.users[args[0].Value.(int64)]
+		if u == nil || u.tenant != args[1].Value ||
+			(strings.Contains(q, "deleted_at IS NULL") && u.deletedAt != nil) ||
+			(strings.Contains(q, "deleted_at IS NOT NULL") && u.deletedAt == nil) {
+			return &userRows{}, nil
+		}
+		return &userRows{users: []storedUser{*u}}, nil
+	case strings.HasPrefix(q, "UPDATE users SET deleted_at = NOW() WHERE id = $1 RETURNING"):
+		u := s.users[args[0].Value.(int64)]
+		if u == nil {
+			return &userRows{}, nil
+		}
+		now := time.Now()
+		u.deletedAt = &now
+		return &userRows{users: []storedUser{*u}}, nil
+	case strings.HasPrefix(q, "UPDATE users SET name = $1, updated_at = NOW() WHERE id = $2 RETURNING"):
+		u := s.users[args[1].Value.(int64)]
+		if u == nil {
+			return &userRows{}, nil
+		}
+		u.name = args[0].Value.(string)
+		return &userRows{users: []storedUser{*u}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", q)
+}
+
+func (c userConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(q, "UPDATE refresh_tokens SET revoked_at"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(q, "INSERT INTO user_audit"):
+		s.audits = append(s.audits, args[1].Value.(string))
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected statement: %s", q)
+}
+
+// userRows returns users as rows of db's userColumns
+type userRows struct {
+	users []storedUser
+	next  int
+}
+
+func (r *userRows) Columns() []string {
+	return []string{"id", "tenant_id", "email", "name", "status", "metadata", "created_at", "updated_at", "deleted_at"}
+}
+func (r *userRows) Close() error { return nil }
+
+func (r *userRows) Next(dest []driver.Value) error {
+	if r.next == len(r.users) {
+		return io.EOF
+	}
+	u := r.users[r.next]
+	r.next++
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var deletedAt driver.Value
+	if u.deletedAt != nil {
+		deletedAt = *u.deletedAt
+	}
+	copy(dest, []driver.Value{u.id, u.tenant, u.email, u.name, string(types.UserStatusActive), []byte("{}"), created, created, deletedAt})
+	return nil
+}